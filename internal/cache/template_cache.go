@@ -3,30 +3,45 @@ package cache
 import (
 	"crypto/md5"
 	"fmt"
-	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"pdf-gen-simple/internal/models"
 )
 
-// TemplateCache provides caching for parsed CSV templates
+// TemplateCache provides caching for parsed templates. Entries are keyed by
+// template store and file name, and are only used while the file and the
+// files it includes still have the content version they were parsed from.
 type TemplateCache struct {
 	mu      sync.RWMutex
-	entries map[string]*CacheEntry
+	entries map[cacheKey]*CacheEntry
 	maxSize int
 	ttl     time.Duration
 }
 
+// cacheKey identifies a template file in a template store
+type cacheKey struct {
+	store string
+	name  string
+}
+
 // CacheEntry represents a cached template entry
 type CacheEntry struct {
-	Elements    []models.PDFElement
-	Hash        string
-	CreatedAt   time.Time
-	AccessedAt  time.Time
-	FileModTime time.Time
+	Elements   []models.PDFElement
+	Hash       string
+	CreatedAt  time.Time
+	AccessedAt time.Time
+	// Version is the content version of the template the entry was parsed from
+	Version string
+	// Dependencies maps the files a template includes or extends to their
+	// content versions
+	Dependencies map[string]string
 }
 
+// VersionFunc returns the current content version of a file in a store
+type VersionFunc func(name string) (string, error)
+
 // FontCache provides caching for font resources
 type FontCache struct {
 	mu     sync.RWMutex
@@ -38,6 +53,9 @@ var (
 	defaultTemplateCache *TemplateCache
 	defaultFontCache     *FontCache
 	once                 sync.Once
+
+	fontCachesMu sync.Mutex
+	fontCaches   = make(map[string]*FontCache)
 )
 
 // GetTemplateCache returns the global template cache instance
@@ -58,10 +76,26 @@ func GetFontCache() *FontCache {
 	return defaultFontCache
 }
 
+// GetFontCacheFor returns the font cache for the font files in dir. Each
+// font directory has its own cache, as different directories may hold
+// different fonts.
+func GetFontCacheFor(dir string) *FontCache {
+	fontCachesMu.Lock()
+	defer fontCachesMu.Unlock()
+
+	dir = filepath.Clean(dir)
+	fc, ok := fontCaches[dir]
+	if !ok {
+		fc = NewFontCache()
+		fontCaches[dir] = fc
+	}
+	return fc
+}
+
 // NewTemplateCache creates a new template cache
 func NewTemplateCache(maxSize int, ttl time.Duration) *TemplateCache {
 	cache := &TemplateCache{
-		entries: make(map[string]*CacheEntry),
+		entries: make(map[cacheKey]*CacheEntry),
 		maxSize: maxSize,
 		ttl:     ttl,
 	}
@@ -72,33 +106,36 @@ func NewTemplateCache(maxSize int, ttl time.Duration) *TemplateCache {
 	return cache
 }
 
-// Get retrieves a template from cache if valid
-func (tc *TemplateCache) Get(filePath string) ([]models.PDFElement, bool) {
-	tc.mu.RLock()
-	defer tc.mu.RUnlock()
+// Get retrieves a template parsed from the given version of a file. An entry
+// is invalid once the file or any file it depends on has another version;
+// current reports the versions of the dependencies.
+func (tc *TemplateCache) Get(store, name, version string, current VersionFunc) ([]models.PDFElement, bool) {
+	// Get removes stale entries and updates access times, so it needs the write lock
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
 
-	entry, exists := tc.entries[filePath]
+	key := cacheKey{store: store, name: name}
+	entry, exists := tc.entries[key]
 	if !exists {
 		return nil, false
 	}
 
-	// Check if file has been modified
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		// File doesn't exist anymore, remove from cache
-		delete(tc.entries, filePath)
+	if entry.Version != version {
+		// The template has changed, invalidate cache
+		delete(tc.entries, key)
 		return nil, false
 	}
 
-	if fileInfo.ModTime().After(entry.FileModTime) {
-		// File has been modified, invalidate cache
-		delete(tc.entries, filePath)
-		return nil, false
+	for dependency, dependencyVersion := range entry.Dependencies {
+		if v, err := current(dependency); err != nil || v != dependencyVersion {
+			delete(tc.entries, key)
+			return nil, false
+		}
 	}
 
 	// Check TTL
 	if time.Since(entry.CreatedAt) > tc.ttl {
-		delete(tc.entries, filePath)
+		delete(tc.entries, key)
 		return nil, false
 	}
 
@@ -108,28 +145,25 @@ func (tc *TemplateCache) Get(filePath string) ([]models.PDFElement, bool) {
 	return entry.Elements, true
 }
 
-// Set stores a template in cache
-func (tc *TemplateCache) Set(filePath string, elements []models.PDFElement) {
+// Set stores a template parsed from the given version of a file, together
+// with the versions of the files it includes or extends
+func (tc *TemplateCache) Set(store, name, version string, elements []models.PDFElement, dependencies map[string]string) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		return // Can't cache if we can't stat the file
-	}
-
 	// Calculate hash for integrity checking
 	hash := tc.calculateHash(elements)
 
 	entry := &CacheEntry{
-		Elements:    elements,
-		Hash:        hash,
-		CreatedAt:   time.Now(),
-		AccessedAt:  time.Now(),
-		FileModTime: fileInfo.ModTime(),
+		Elements:     elements,
+		Hash:         hash,
+		CreatedAt:    time.Now(),
+		AccessedAt:   time.Now(),
+		Version:      version,
+		Dependencies: dependencies,
 	}
 
-	tc.entries[filePath] = entry
+	tc.entries[cacheKey{store: store, name: name}] = entry
 
 	// Evict oldest entries if cache is full
 	if len(tc.entries) > tc.maxSize {
@@ -148,17 +182,19 @@ func (tc *TemplateCache) calculateHash(elements []models.PDFElement) string {
 
 // evictOldest removes the least recently accessed entry
 func (tc *TemplateCache) evictOldest() {
-	var oldestKey string
+	var oldestKey cacheKey
 	var oldestTime time.Time
+	found := false
 
 	for key, entry := range tc.entries {
-		if oldestKey == "" || entry.AccessedAt.Before(oldestTime) {
+		if !found || entry.AccessedAt.Before(oldestTime) {
 			oldestKey = key
 			oldestTime = entry.AccessedAt
+			found = true
 		}
 	}
 
-	if oldestKey != "" {
+	if found {
 		delete(tc.entries, oldestKey)
 	}
 }
@@ -182,11 +218,39 @@ func (tc *TemplateCache) cleanup() {
 	}
 }
 
+// Invalidate removes a template from the cache together with every template
+// of the same store that includes or extends it
+func (tc *TemplateCache) Invalidate(store, name string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	for key, entry := range tc.entries {
+		if key.store != store {
+			continue
+		}
+		if _, depends := entry.Dependencies[name]; depends || key.name == name {
+			delete(tc.entries, key)
+		}
+	}
+}
+
 // Clear removes all entries from cache
 func (tc *TemplateCache) Clear() {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
-	tc.entries = make(map[string]*CacheEntry)
+	tc.entries = make(map[cacheKey]*CacheEntry)
+}
+
+// ClearStore removes the entries of one template store
+func (tc *TemplateCache) ClearStore(store string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	for key := range tc.entries {
+		if key.store == store {
+			delete(tc.entries, key)
+		}
+	}
 }
 
 // Stats returns cache statistics
@@ -201,6 +265,25 @@ func (tc *TemplateCache) Stats() map[string]interface{} {
 	}
 }
 
+// StoreStats returns cache statistics for the entries of one template store.
+// The maximum size is shared by every store.
+func (tc *TemplateCache) StoreStats(store string) map[string]interface{} {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	entries := 0
+	for key := range tc.entries {
+		if key.store == store {
+			entries++
+		}
+	}
+	return map[string]interface{}{
+		"entries": entries,
+		"maxSize": tc.maxSize,
+		"ttl":     tc.ttl.String(),
+	}
+}
+
 // NewFontCache creates a new font cache
 func NewFontCache() *FontCache {
 	return &FontCache{
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// noDependencies is a VersionFunc for entries without dependencies
+func noDependencies(name string) (string, error) {
+	return "", nil
+}
+
+func TestTemplateCacheStores(t *testing.T) {
+	tc := NewTemplateCache(10, time.Hour)
+	elements := []models.PDFElement{{Type: models.ElementTypeText, Text: "Invoice"}}
+	tc.Set("dir:/tenants/acme", "invoice.csv", "v1", elements, nil)
+	tc.Set("dir:/tenants/acme", "receipt.csv", "v1", elements, nil)
+	tc.Set("dir:/tenants/globex", "invoice.csv", "v1", elements, nil)
+
+	if got := tc.StoreStats("dir:/tenants/acme")["entries"]; got != 2 {
+		t.Errorf("acme entries = %v, want 2", got)
+	}
+	if got := tc.Stats()["entries"]; got != 3 {
+		t.Errorf("entries = %v, want 3", got)
+	}
+
+	tc.ClearStore("dir:/tenants/acme")
+	if _, ok := tc.Get("dir:/tenants/acme", "invoice.csv", "v1", noDependencies); ok {
+		t.Error("ClearStore kept an entry of the store")
+	}
+	if _, ok := tc.Get("dir:/tenants/globex", "invoice.csv", "v1", noDependencies); !ok {
+		t.Error("ClearStore removed an entry of another store")
+	}
+	if got := tc.StoreStats("dir:/tenants/acme")["entries"]; got != 0 {
+		t.Errorf("acme entries after ClearStore = %v, want 0", got)
+	}
+}
+
+func TestTemplateCacheInvalidate(t *testing.T) {
+	tc := NewTemplateCache(10, time.Hour)
+	tc.Set("store", "invoice.csv", "v1", nil, map[string]string{"partials/header.yaml": "h1"})
+	tc.Set("store", "receipt.csv", "v1", nil, nil)
+	tc.Set("other", "invoice.csv", "v1", nil, map[string]string{"partials/header.yaml": "h1"})
+
+	// Invalidating a partial drops the templates of its store that include it
+	tc.Invalidate("store", "partials/header.yaml")
+	current := func(name string) (string, error) { return "h1", nil }
+	if _, ok := tc.Get("store", "invoice.csv", "v1", current); ok {
+		t.Error("a template including the invalidated partial is still cached")
+	}
+	if _, ok := tc.Get("store", "receipt.csv", "v1", current); !ok {
+		t.Error("an unrelated template was invalidated")
+	}
+	if _, ok := tc.Get("other", "invoice.csv", "v1", current); !ok {
+		t.Error("a template of another store was invalidated")
+	}
+
+	// Entries are only used for the version they were parsed from
+	if _, ok := tc.Get("store", "receipt.csv", "v2", current); ok {
+		t.Error("an entry was used for another version")
+	}
+}
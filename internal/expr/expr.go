@@ -0,0 +1,483 @@
+// Package expr evaluates the expressions of computed template fields, such as
+// sum(charges.amount) or subtotal * 0.18. Expressions only read the data they
+// are given: they have no assignments, loops or access to the host, and their
+// size and evaluation cost are limited.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pdf-gen-simple/internal/utils"
+)
+
+// Limits that keep evaluation cheap for any template
+const (
+	// MaxLength is the longest expression accepted
+	MaxLength = 2000
+	// MaxSteps is the most nodes and array items an evaluation may visit
+	MaxSteps = 100000
+)
+
+// Program is a parsed expression
+type Program struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression
+func Compile(source string) (*Program, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	if len(source) > MaxLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", MaxLength)
+	}
+
+	root, err := parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+
+	program := &Program{source: source, root: root}
+	for _, name := range program.functions() {
+		if _, ok := lookupFunction(name); !ok {
+			return nil, fmt.Errorf("invalid expression %q: unknown function %s", source, name)
+		}
+	}
+	return program, nil
+}
+
+// String returns the expression's source
+func (p *Program) String() string {
+	return p.source
+}
+
+// Evaluate runs the program against data. Numbers are returned as float64.
+func (p *Program) Evaluate(data map[string]interface{}) (interface{}, error) {
+	e := &evaluator{data: data}
+	value, err := p.root.eval(e)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.source, err)
+	}
+	return normalize(value), nil
+}
+
+// Evaluate compiles and runs an expression
+func Evaluate(source string, data map[string]interface{}) (interface{}, error) {
+	program, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return program.Evaluate(data)
+}
+
+// EvaluateBool runs the program and converts the result to a boolean: false,
+// null, 0, empty text and empty lists and objects are false
+func (p *Program) EvaluateBool(data map[string]interface{}) (bool, error) {
+	value, err := p.Evaluate(data)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+// Variables returns the variable paths an expression reads, in order of first use
+func (p *Program) Variables() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	walk(p.root, func(n node) {
+		if path, ok := n.(*pathNode); ok && !seen[path.source] {
+			seen[path.source] = true
+			paths = append(paths, path.source)
+		}
+	})
+	return paths
+}
+
+// functions returns the names of the functions an expression calls
+func (p *Program) functions() []string {
+	var names []string
+	walk(p.root, func(n node) {
+		if call, ok := n.(*callNode); ok {
+			names = append(names, call.name)
+		}
+	})
+	return names
+}
+
+// walk calls visit for n and every node below it
+func walk(n node, visit func(node)) {
+	visit(n)
+	switch n := n.(type) {
+	case *unaryNode:
+		walk(n.operand, visit)
+	case *binaryNode:
+		walk(n.left, visit)
+		walk(n.right, visit)
+	case *conditionalNode:
+		walk(n.cond, visit)
+		walk(n.then, visit)
+		walk(n.otherwise, visit)
+	case *callNode:
+		for _, arg := range n.args {
+			walk(arg, visit)
+		}
+	}
+}
+
+// evaluator holds the state of one evaluation
+type evaluator struct {
+	data  map[string]interface{}
+	steps int
+}
+
+// step counts work done and fails once the budget is used up
+func (e *evaluator) step(n int) error {
+	e.steps += n
+	if e.steps > MaxSteps {
+		return fmt.Errorf("expression is too expensive to evaluate")
+	}
+	return nil
+}
+
+func (n *literalNode) eval(e *evaluator) (interface{}, error) {
+	return n.value, e.step(1)
+}
+
+// eval resolves the path. Keys applied to an array select the key from every
+// item, so charges.amount is the list of all charge amounts. Missing
+// variables are null.
+func (n *pathNode) eval(e *evaluator) (interface{}, error) {
+	if err := e.step(1); err != nil {
+		return nil, err
+	}
+	if value, ok := utils.ResolvePath(e.data, n.source); ok {
+		return value, nil
+	}
+
+	var current interface{} = e.data
+	projected := false
+	for _, segment := range n.segments {
+		next, isList, err := e.selectSegment(current, segment, projected)
+		if err != nil {
+			return nil, err
+		}
+		current, projected = next, projected || isList
+	}
+	return current, nil
+}
+
+// selectSegment applies one path segment. On a projected list the segment is
+// applied to every item and the results are flattened.
+func (e *evaluator) selectSegment(current interface{}, segment pathSegment, projected bool) (interface{}, bool, error) {
+	items, isArray := utils.ToSlice(current)
+
+	if segment.isIndex {
+		if !isArray || segment.index >= len(items) {
+			return nil, false, nil
+		}
+		return items[segment.index], false, nil
+	}
+
+	if fields, isMap := current.(map[string]interface{}); isMap {
+		value, _ := utils.ResolvePath(fields, segment.key)
+		return value, false, nil
+	}
+	if !isArray {
+		return nil, false, nil
+	}
+
+	if err := e.step(len(items)); err != nil {
+		return nil, false, err
+	}
+	var values []interface{}
+	for _, item := range items {
+		value, _, err := e.selectSegment(item, segment, false)
+		if err != nil {
+			return nil, false, err
+		}
+		if nested, isList := utils.ToSlice(value); isList && projected {
+			values = append(values, nested...)
+		} else if value != nil {
+			values = append(values, value)
+		}
+	}
+	if values == nil {
+		values = []interface{}{}
+	}
+	return values, true, nil
+}
+
+func (n *unaryNode) eval(e *evaluator) (interface{}, error) {
+	value, err := n.operand.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(value), nil
+	}
+
+	number, err := toNumber(value, "-")
+	if err != nil {
+		return nil, operandError(n.operand, value, err)
+	}
+	return -number, nil
+}
+
+// operandError names the variable when a missing value is used as an operand
+func operandError(operand node, value interface{}, err error) error {
+	if path, ok := operand.(*pathNode); ok && value == nil {
+		return fmt.Errorf("variable %s is missing", path.source)
+	}
+	return err
+}
+
+func (n *binaryNode) eval(e *evaluator) (interface{}, error) {
+	left, err := n.left.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logical operators short-circuit and return booleans
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(e)
+		return truthy(right), err
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(e)
+		return truthy(right), err
+	}
+
+	right, err := n.right.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	case "+":
+		// Text is joined, even if it holds a number: '12' + '3' is '123'
+		if isString(left) || isString(right) {
+			return utils.FormatValue(left) + utils.FormatValue(right), nil
+		}
+	}
+
+	a, err := toNumber(left, n.op)
+	if err != nil {
+		return nil, operandError(n.left, left, err)
+	}
+	b, err := toNumber(right, n.op)
+	if err != nil {
+		return nil, operandError(n.right, right, err)
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func (n *conditionalNode) eval(e *evaluator) (interface{}, error) {
+	cond, err := n.cond.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(cond) {
+		return n.then.eval(e)
+	}
+	return n.otherwise.eval(e)
+}
+
+func (n *callNode) eval(e *evaluator) (interface{}, error) {
+	if err := e.step(1); err != nil {
+		return nil, err
+	}
+	fn, ok := lookupFunction(n.name)
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", n.name)
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	value, err := fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return value, nil
+}
+
+// truthy converts a value to a boolean: false, null, 0, "" and empty lists are false
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	if items, isArray := utils.ToSlice(value); isArray {
+		return len(items) > 0
+	}
+	if number, err := utils.ToFloat(value); err == nil {
+		return number != 0
+	}
+	return true
+}
+
+// isString returns true for string values
+func isString(value interface{}) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+// isNumeric returns true for numbers and strings holding a number
+func isNumeric(value interface{}) bool {
+	switch value.(type) {
+	case nil, bool, map[string]interface{}, []interface{}:
+		return false
+	}
+	_, err := utils.ToFloat(value)
+	return err == nil
+}
+
+// numbers converts both values to numbers if both are numeric
+func numbers(a, b interface{}) (float64, float64, bool) {
+	if !isNumeric(a) || !isNumeric(b) {
+		return 0, 0, false
+	}
+	x, _ := utils.ToFloat(a)
+	y, _ := utils.ToFloat(b)
+	return x, y, true
+}
+
+// toNumber converts an operand to a number for an operator
+func toNumber(value interface{}, op string) (float64, error) {
+	if !isNumeric(value) {
+		return 0, fmt.Errorf("operator %s needs a number, got %s", op, describe(value))
+	}
+	number, _ := utils.ToFloat(value)
+	return number, nil
+}
+
+// equal compares values, numerically if both are numeric
+func equal(a, b interface{}) bool {
+	if x, y, ok := numbers(a, b); ok {
+		return x == y
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if x, ok := a.(bool); ok {
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	return utils.FormatValue(a) == utils.FormatValue(b)
+}
+
+// compare orders numbers numerically and other values as strings
+func compare(op string, a, b interface{}) (bool, error) {
+	var order int
+	if x, y, ok := numbers(a, b); ok {
+		switch {
+		case x < y:
+			order = -1
+		case x > y:
+			order = 1
+		}
+	} else if isString(a) && isString(b) {
+		order = strings.Compare(a.(string), b.(string))
+	} else {
+		return false, fmt.Errorf("cannot compare %s and %s", describe(a), describe(b))
+	}
+
+	switch op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+// describe names the type of a value for error messages
+func describe(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null (missing value)"
+	case bool:
+		return "boolean"
+	case string:
+		return fmt.Sprintf("string %q", value)
+	case map[string]interface{}:
+		return "object"
+	}
+	if _, isArray := utils.ToSlice(value); isArray {
+		return "list"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// normalize converts numbers to float64 and removes binary rounding noise,
+// so 0.1 + 0.2 is 0.3
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return v
+		}
+		clean, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 15, 64), 64)
+		return clean
+	case int, int64, float32:
+		number, _ := utils.ToFloat(v)
+		return number
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalize(item)
+		}
+		return items
+	}
+	return value
+}
@@ -0,0 +1,258 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testData is the data the expression tests evaluate against
+func testData() map[string]interface{} {
+	return map[string]interface{}{
+		"subtotal": 1000,
+		"rate":     "18",
+		"zero":     0,
+		"name":     "Acme",
+		"customer": map[string]interface{}{
+			"address": map[string]interface{}{"city": "Pune"},
+		},
+		"charges": []interface{}{
+			map[string]interface{}{"name": "Freight", "amount": 100},
+			map[string]interface{}{"name": "Insurance", "amount": 25.5},
+			map[string]interface{}{"name": "Waived"},
+		},
+		"orders": []interface{}{
+			map[string]interface{}{"lines": []interface{}{
+				map[string]interface{}{"qty": 1},
+				map[string]interface{}{"qty": 2},
+			}},
+			map[string]interface{}{"lines": []interface{}{
+				map[string]interface{}{"qty": 3},
+			}},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		// Precedence and associativity
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"2 * 6 / 3 % 3", 1.0},
+		{"-2 * 3", -6.0},
+		{"--2", 2.0},
+		{"1 + 2 < 4 == true", true},
+		{"1 < 2 && 3 < 2 || 4 > 3", true},
+		{"true || false && false", true},
+		{"!true || true", true},
+		{"not false and 1 == 1", true},
+		{"subtotal > 500 ? 'large' : subtotal > 100 ? 'medium' : 'small'", "large"},
+		{"0.1 + 0.2", 0.3},
+		{"1_000 * 2", 2000.0},
+
+		// Operands
+		{"subtotal * rate / 100", 180.0},
+		{"'Invoice ' + name", "Invoice Acme"},
+		{"'12' + '3'", "123"},
+		{"rate + 2", "182"},
+		{"number(rate) + 2", 20.0},
+		{"rate == 18", true},
+		{"'abc' < 'abd'", true},
+		{"missing == null", true},
+		{"missing", nil},
+		{"customer.address.city", "Pune"},
+		{"customer.phone", nil},
+
+		// Path projections
+		{"charges.amount", []interface{}{100.0, 25.5}},
+		{"charges[1].name", "Insurance"},
+		{"charges[5].name", nil},
+		{"sum(charges.amount)", 125.5},
+		{"count(charges.amount)", 2.0},
+		{"orders.lines.qty", []interface{}{1.0, 2.0, 3.0}},
+		{"sum(orders.lines.qty)", 6.0},
+		{"orders[1].lines[0].qty", 3.0},
+		{"name.first", nil},
+
+		// Functions
+		{"round(2.675, 2)", 2.68},
+		{"max(charges.amount, 200)", 200.0},
+		{"min(missing)", nil},
+		{"avg()", 0.0},
+		{"coalesce(missing, '', 'fallback')", "fallback"},
+		{"if(zero, 'yes', 'no')", "no"},
+		{"len(charges)", 3.0},
+		{"contains(charges.name, 'Freight')", true},
+		{"upper(name)", "ACME"},
+		{"string(0.1 + 0.2)", "0.3"},
+	}
+	data := testData()
+	for _, tt := range tests {
+		got, err := Evaluate(tt.source, data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	// The right-hand sides fail if evaluated
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		{"false && 1 / 0", false},
+		{"zero and missing.total / zero", false},
+		{"true || 1 / 0", true},
+		{"subtotal or unknown * 2", true},
+		{"true ? 1 : 1 / 0", 1.0},
+		{"false ? 1 / 0 : 2", 2.0},
+	}
+	data := testData()
+	for _, tt := range tests {
+		got, err := Evaluate(tt.source, data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"subtotal / zero", "division by zero"},
+		{"subtotal % 0", "division by zero"},
+		{"1 / (2 - 2)", "division by zero"},
+		{"missing * 2", "variable missing is missing"},
+		{"-name", `operator - needs a number, got string "Acme"`},
+		{"name < 5", "cannot compare"},
+		{"sum(charges.name)", "sum: needs numbers"},
+		{"round()", "round: takes 1 to 2 arguments, got 0"},
+	}
+	data := testData()
+	for _, tt := range tests {
+		_, err := Evaluate(tt.source, data)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.source, err, tt.want)
+		}
+	}
+}
+
+func TestCompileErrorPositions(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"1 + * 2", `unexpected "*" at position 5`},
+		{"1 + 2 3", `unexpected "3" at position 7`},
+		{"1 # 2", `unexpected character '#' at position 3`},
+		{"(1 + 2", `expected ")" at end of expression`},
+		{"round(1 2)", `expected "," at position 9, found "2"`},
+		{"charges[1.5]", "array index must be a whole number at position 9"},
+		{"name + 'abc", "unterminated string at position 8"},
+		{"1.2.3", `invalid number "1.2.3" at position 1`},
+		{"customer.", "unexpected end of expression"},
+		{"nosuch(1)", "unknown function nosuch"},
+		{"  ", "expression is empty"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.source)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error = %v, want %q", tt.source, err, tt.want)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	if _, err := Compile(strings.Repeat("1+", MaxLength/2) + "1"); err == nil ||
+		!strings.Contains(err.Error(), "longer than") {
+		t.Errorf("long expression: error = %v", err)
+	}
+
+	nested := strings.Repeat("(", maxDepth+1) + "1" + strings.Repeat(")", maxDepth+1)
+	if _, err := Compile(nested); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("nested parentheses: error = %v", err)
+	}
+	if _, err := Compile(strings.Repeat("-", maxDepth+1) + "1"); err == nil ||
+		!strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("nested negation: error = %v", err)
+	}
+	shallow := strings.Repeat("(", maxDepth-1) + "1" + strings.Repeat(")", maxDepth-1)
+	if _, err := Compile(shallow); err != nil {
+		t.Errorf("%d levels of nesting: %v", maxDepth-1, err)
+	}
+
+	items := make([]interface{}, MaxSteps+1)
+	for i := range items {
+		items[i] = map[string]interface{}{"amount": 1}
+	}
+	data := map[string]interface{}{"items": items}
+	if _, err := Evaluate("sum(items.amount)", data); err == nil ||
+		!strings.Contains(err.Error(), "too expensive") {
+		t.Errorf("projection over %d items: error = %v", len(items), err)
+	}
+	if got, err := Evaluate("count(items)", data); err != nil || got != float64(len(items)) {
+		t.Errorf("count(items) = %v, %v", got, err)
+	}
+
+	// Each evaluation has its own budget
+	program, err := Compile("sum(items.amount)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := map[string]interface{}{"items": items[:MaxSteps/2]}
+	for i := 0; i < 3; i++ {
+		if _, err := program.Evaluate(small); err != nil {
+			t.Fatalf("evaluation %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	program, err := Compile("sum(charges.amount) + subtotal * rate / 100 + subtotal + charges[0].amount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"charges.amount", "subtotal", "rate", "charges[0].amount"}
+	if got := program.Variables(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Variables() = %v, want %v", got, want)
+	}
+}
+
+func TestEvaluateBool(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"charges", true},
+		{"missing", false},
+		{"zero", false},
+		{"''", false},
+		{"customer", true},
+		{"charges.nothing", false},
+	}
+	data := testData()
+	for _, tt := range tests {
+		program, err := Compile(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := program.EvaluateBool(data); err != nil || got != tt.want {
+			t.Errorf("%s = %v, %v, want %v", tt.source, got, err, tt.want)
+		}
+	}
+}
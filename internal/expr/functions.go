@@ -0,0 +1,303 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"pdf-gen-simple/internal/utils"
+)
+
+// Function is a function callable from expressions. Arguments are evaluated
+// before the call; lists are []interface{} and numbers may be any numeric type.
+type Function func(args []interface{}) (interface{}, error)
+
+var (
+	functionsMu sync.RWMutex
+	functions   = map[string]Function{
+		"sum":      sumFunction,
+		"count":    countFunction,
+		"avg":      avgFunction,
+		"min":      extremeFunction(-1),
+		"max":      extremeFunction(1),
+		"round":    roundFunction,
+		"floor":    mathFunction(math.Floor),
+		"ceil":     mathFunction(math.Ceil),
+		"abs":      mathFunction(math.Abs),
+		"if":       ifFunction,
+		"coalesce": coalesceFunction,
+		"concat":   concatFunction,
+		"upper":    stringFunction(strings.ToUpper),
+		"lower":    stringFunction(strings.ToLower),
+		"trim":     stringFunction(strings.TrimSpace),
+		"len":      lenFunction,
+		"empty":    emptyFunction,
+		"contains": containsFunction,
+		"number":   numberFunction,
+		"string":   stringValueFunction,
+	}
+)
+
+// RegisterFunction adds or replaces a function available to expressions.
+// Functions must not have side effects.
+func RegisterFunction(name string, fn Function) {
+	functionsMu.Lock()
+	defer functionsMu.Unlock()
+	functions[strings.ToLower(name)] = fn
+}
+
+// lookupFunction returns the function with the given name
+func lookupFunction(name string) (Function, bool) {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+	fn, ok := functions[name]
+	return fn, ok
+}
+
+// arity checks the number of arguments
+func arity(args []interface{}, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		switch {
+		case min == max:
+			return fmt.Errorf("takes %d argument(s), got %d", min, len(args))
+		case max < 0:
+			return fmt.Errorf("takes at least %d argument(s), got %d", min, len(args))
+		default:
+			return fmt.Errorf("takes %d to %d arguments, got %d", min, max, len(args))
+		}
+	}
+	return nil
+}
+
+// flatten returns the arguments with lists expanded, skipping nulls
+func flatten(args []interface{}) []interface{} {
+	var values []interface{}
+	for _, arg := range args {
+		if items, isArray := utils.ToSlice(arg); isArray {
+			values = append(values, flatten(items)...)
+		} else if arg != nil {
+			values = append(values, arg)
+		}
+	}
+	return values
+}
+
+// numericValues converts the flattened arguments to numbers
+func numericValues(args []interface{}) ([]float64, error) {
+	values := flatten(args)
+	numbers := make([]float64, len(values))
+	for i, value := range values {
+		number, err := toNumber(value, "")
+		if err != nil {
+			return nil, fmt.Errorf("needs numbers, got %s", describe(value))
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// sumFunction adds numbers and lists of numbers: sum(charges.amount)
+func sumFunction(args []interface{}) (interface{}, error) {
+	numbers, err := numericValues(args)
+	if err != nil {
+		return nil, err
+	}
+	total := 0.0
+	for _, n := range numbers {
+		total += n
+	}
+	return total, nil
+}
+
+// countFunction counts the non-null values: count(items)
+func countFunction(args []interface{}) (interface{}, error) {
+	return float64(len(flatten(args))), nil
+}
+
+// avgFunction averages numbers; the average of nothing is 0
+func avgFunction(args []interface{}) (interface{}, error) {
+	numbers, err := numericValues(args)
+	if err != nil || len(numbers) == 0 {
+		return 0.0, err
+	}
+	total := 0.0
+	for _, n := range numbers {
+		total += n
+	}
+	return total / float64(len(numbers)), nil
+}
+
+// extremeFunction returns min (sign -1) or max (sign 1); null for no values
+func extremeFunction(sign float64) Function {
+	return func(args []interface{}) (interface{}, error) {
+		numbers, err := numericValues(args)
+		if err != nil || len(numbers) == 0 {
+			return nil, err
+		}
+		best := numbers[0]
+		for _, n := range numbers[1:] {
+			if (n-best)*sign > 0 {
+				best = n
+			}
+		}
+		return best, nil
+	}
+}
+
+// roundFunction rounds half away from zero: round(x) or round(x, 2)
+func roundFunction(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 2); err != nil {
+		return nil, err
+	}
+	x, err := toNumber(args[0], "round")
+	if err != nil {
+		return nil, err
+	}
+	decimals := 0.0
+	if len(args) == 2 {
+		if decimals, err = toNumber(args[1], "round"); err != nil {
+			return nil, err
+		}
+	}
+	scale := math.Pow(10, math.Trunc(decimals))
+	// Round the scaled value to 9 decimals first, so 2.675 rounds to 2.68
+	scaled := math.Round(x*scale*1e9) / 1e9
+	return math.Round(scaled) / scale, nil
+}
+
+// mathFunction wraps a one-argument math function
+func mathFunction(fn func(float64) float64) Function {
+	return func(args []interface{}) (interface{}, error) {
+		if err := arity(args, 1, 1); err != nil {
+			return nil, err
+		}
+		x, err := toNumber(args[0], "")
+		if err != nil {
+			return nil, fmt.Errorf("needs a number, got %s", describe(args[0]))
+		}
+		return fn(x), nil
+	}
+}
+
+// ifFunction returns its second argument if the first is true, else the third
+func ifFunction(args []interface{}) (interface{}, error) {
+	if err := arity(args, 2, 3); err != nil {
+		return nil, err
+	}
+	if truthy(args[0]) {
+		return args[1], nil
+	}
+	if len(args) == 3 {
+		return args[2], nil
+	}
+	return nil, nil
+}
+
+// coalesceFunction returns the first argument that isn't null or empty
+func coalesceFunction(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if arg != nil && arg != "" {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+// concatFunction joins values as text, skipping nulls
+func concatFunction(args []interface{}) (interface{}, error) {
+	var text strings.Builder
+	for _, arg := range args {
+		text.WriteString(utils.FormatValue(arg))
+	}
+	return text.String(), nil
+}
+
+// stringFunction wraps a string transformation; null stays null
+func stringFunction(fn func(string) string) Function {
+	return func(args []interface{}) (interface{}, error) {
+		if err := arity(args, 1, 1); err != nil {
+			return nil, err
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		return fn(utils.FormatValue(args[0])), nil
+	}
+}
+
+// lenFunction returns the length of a string or list; null has length 0
+func lenFunction(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return 0.0, nil
+	case string:
+		return float64(len([]rune(v))), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	if items, isArray := utils.ToSlice(args[0]); isArray {
+		return float64(len(items)), nil
+	}
+	return nil, fmt.Errorf("needs a string or list, got %s", describe(args[0]))
+}
+
+// emptyFunction tests whether a value is null, blank text or an empty list or object
+func emptyFunction(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return true, nil
+	case string:
+		return strings.TrimSpace(v) == "", nil
+	case map[string]interface{}:
+		return len(v) == 0, nil
+	}
+	if items, isArray := utils.ToSlice(args[0]); isArray {
+		return len(items) == 0, nil
+	}
+	return false, nil
+}
+
+// containsFunction tests whether a list contains a value or a string contains a substring
+func containsFunction(args []interface{}) (interface{}, error) {
+	if err := arity(args, 2, 2); err != nil {
+		return nil, err
+	}
+	if items, isArray := utils.ToSlice(args[0]); isArray {
+		for _, item := range items {
+			if equal(item, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if args[0] == nil {
+		return false, nil
+	}
+	return strings.Contains(utils.FormatValue(args[0]), utils.FormatValue(args[1])), nil
+}
+
+// numberFunction converts a value to a number
+func numberFunction(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	return toNumber(args[0], "number")
+}
+
+// stringValueFunction formats a value as text
+func stringValueFunction(args []interface{}) (interface{}, error) {
+	if err := arity(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return utils.FormatValue(normalize(args[0])), nil
+}
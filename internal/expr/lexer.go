@@ -0,0 +1,128 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind is the kind of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+// token is a lexical token of an expression
+type token struct {
+	kind   tokenKind
+	text   string
+	number float64
+	pos    int // byte offset in the source, for error messages
+}
+
+// operators are matched longest first
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "!", "(", ")", "[", "]", ".", ",", "?", ":",
+}
+
+// lex splits an expression into tokens
+func lex(source string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.' || source[i] == '_') {
+				i++
+			}
+			text := strings.ReplaceAll(source[start:i], "_", "")
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", source[start:i], start+1)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, number: number, pos: start})
+
+		case c == '"' || c == '\'':
+			text, end, err := lexString(source, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = end
+
+		case isLetter(source[i]):
+			start := i
+			for i < len(source) && (isLetter(source[i]) || isDigit(source[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i+1)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// lexString reads a quoted string starting at source[start] and returns its
+// value and the offset after the closing quote
+func lexString(source string, start int) (string, int, error) {
+	quote := source[start]
+	var value strings.Builder
+
+	for i := start + 1; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			if i+1 < len(source) {
+				i++
+				switch source[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case 't':
+					value.WriteByte('\t')
+				default:
+					value.WriteByte(source[i])
+				}
+			}
+		case quote:
+			return value.String(), i + 1, nil
+		default:
+			value.WriteByte(source[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", start+1)
+}
+
+// isDigit returns true for ASCII digits
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isLetter returns true for the ASCII letters and underscore used in names
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
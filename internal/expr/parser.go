@@ -0,0 +1,319 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// node is a parsed expression
+type node interface {
+	eval(e *evaluator) (interface{}, error)
+}
+
+// literalNode is a number, string, boolean or null
+type literalNode struct {
+	value interface{}
+}
+
+// pathSegment is a key or array index of a variable path
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// pathNode is a variable path such as customer.address.city or items[0].qty
+type pathNode struct {
+	source   string
+	segments []pathSegment
+}
+
+// unaryNode is a negation or logical not
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+// binaryNode is an arithmetic, comparison or logical operation
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+// conditionalNode is cond ? then : otherwise
+type conditionalNode struct {
+	cond, then, otherwise node
+}
+
+// callNode is a function call
+type callNode struct {
+	name string
+	args []node
+}
+
+// parser is a recursive descent parser over the tokens of an expression
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// maxDepth limits nesting so that hostile expressions can't exhaust the stack
+const maxDepth = 64
+
+// parse parses an expression
+func parse(source string) (node, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, p.unexpected(next)
+	}
+	return root, nil
+}
+
+// expression parses a conditional expression, the lowest precedence level
+func (p *parser) expression() (node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, fmt.Errorf("expression is nested too deeply")
+	}
+
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+
+	then, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &conditionalNode{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+// precedence lists the binary operators from lowest to highest precedence
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// keywordOperators are word forms of the logical operators
+var keywordOperators = map[string]string{"or": "||", "and": "&&", "not": "!"}
+
+// binary parses the binary operators at a precedence level and above
+func (p *parser) binary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOperator(precedence[level])
+		if !ok {
+			return left, nil
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+// unary parses negation and logical not
+func (p *parser) unary() (node, error) {
+	op, ok := p.acceptOperator([]string{"-", "!"})
+	if !ok {
+		return p.primary()
+	}
+
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, fmt.Errorf("expression is nested too deeply")
+	}
+
+	operand, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &unaryNode{op: op, operand: operand}, nil
+}
+
+// primary parses literals, paths, function calls and parentheses
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &literalNode{value: t.number}, nil
+	case tokenString:
+		return &literalNode{value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+		if p.accept("(") {
+			return p.call(t.text)
+		}
+		return p.path(t)
+	case tokenOperator:
+		if t.text == "(" {
+			inner, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+// call parses the arguments of a function call after the opening parenthesis
+func (p *parser) call(name string) (node, error) {
+	call := &callNode{name: strings.ToLower(name)}
+	if p.accept(")") {
+		return call, nil
+	}
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if p.accept(")") {
+			return call, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// path parses the keys and indices following a variable name
+func (p *parser) path(first token) (node, error) {
+	path := &pathNode{segments: []pathSegment{{key: first.text}}}
+	source := []string{first.text}
+
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, p.unexpected(t)
+			}
+			path.segments = append(path.segments, pathSegment{key: t.text})
+			source = append(source, "."+t.text)
+		case p.accept("["):
+			t := p.next()
+			if t.kind != tokenNumber || t.number != math.Trunc(t.number) || t.number < 0 {
+				return nil, fmt.Errorf("array index must be a whole number at position %d", t.pos+1)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			path.segments = append(path.segments, pathSegment{index: int(t.number), isIndex: true})
+			source = append(source, "["+t.text+"]")
+		default:
+			path.source = strings.Join(source, "")
+			return path, nil
+		}
+	}
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the next token
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given operator
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOperator && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// acceptOperator consumes the next token if it is one of ops, including the
+// word forms and, or and not
+func (p *parser) acceptOperator(ops []string) (string, bool) {
+	t := p.peek()
+	text := t.text
+	if t.kind == tokenIdent {
+		keyword, ok := keywordOperators[strings.ToLower(t.text)]
+		if !ok {
+			return "", false
+		}
+		text = keyword
+	} else if t.kind != tokenOperator {
+		return "", false
+	}
+
+	for _, op := range ops {
+		if text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// expect consumes the given operator or fails
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		if t.kind == tokenEOF {
+			return fmt.Errorf("expected %q at end of expression", op)
+		}
+		return fmt.Errorf("expected %q at position %d, found %q", op, t.pos+1, t.text)
+	}
+	return nil
+}
+
+// unexpected describes an unexpected token
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at position %d", t.text, t.pos+1)
+}
@@ -0,0 +1,178 @@
+package generators
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// BatchOptions controls how a batch of documents is rendered
+type BatchOptions struct {
+	GenerateOptions
+	// Workers bounds how many documents render at once; it defaults to the
+	// number of CPUs
+	Workers int
+	// Progress is called with the number of records finished so far
+	Progress func(done int)
+	// Manifest, if set, is called with the outcome of every record once a
+	// merged batch is rendered. What it returns is embedded in the merged
+	// PDF as the file attachment ManifestFile.
+	Manifest func(documents []BatchDocument) ([]byte, error)
+}
+
+// ManifestFile is the name of the manifest attached to merged batches
+const ManifestFile = "manifest.json"
+
+// BatchDocument is the outcome of rendering one record of a batch. Err is set
+// if the record failed; the other records are rendered regardless.
+type BatchDocument struct {
+	PDF      []byte
+	Warnings []ElementError
+	Err      error
+}
+
+// GenerateBatch renders one PDF per record with a bounded pool of workers and
+// passes each document to emit as soon as it is rendered, so a batch never
+// holds more PDFs than it has workers. Documents arrive in the order they
+// finish, with their index in records, and emit is called from one goroutine
+// at a time. Records not yet started when ctx is done fail with the
+// context's error. If emit fails, no more records are started and its error
+// is returned.
+func (g *PDFGenerator) GenerateBatch(ctx context.Context, elements []models.PDFElement, records []map[string]interface{}, options BatchOptions, emit func(i int, document BatchDocument) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		index    int
+		document BatchDocument
+		rendered bool
+	}
+	jobs := make(chan int)
+	results := make(chan result)
+
+	var wg sync.WaitGroup
+	for w := 0; w < batchWorkers(options.Workers, len(records)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					results <- result{index: i, document: BatchDocument{Err: err}}
+					continue
+				}
+				pdf, warnings, err := g.GeneratePDFToBytesWithOptions(elements, records[i], options.GenerateOptions)
+				results <- result{index: i, document: BatchDocument{PDF: pdf, Warnings: warnings, Err: err}, rendered: true}
+			}
+		}()
+	}
+	go func() {
+		for i := range records {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Keep receiving after emit fails, so that the workers can finish
+	var emitErr error
+	done := 0
+	for r := range results {
+		if emitErr != nil {
+			continue
+		}
+		if emitErr = emit(r.index, r.document); emitErr != nil {
+			cancel()
+			continue
+		}
+		if r.rendered && options.Progress != nil {
+			done++
+			options.Progress(done)
+		}
+	}
+	return emitErr
+}
+
+// GenerateMergedBatch draws every record into one PDF, each starting on a new
+// page with its own page numbers. Records that fail are left out. Records are
+// drawn once; in strict mode a record that fails leaves pages behind, so the
+// document is drawn again without it, which only costs time when records
+// fail. Generation stops with the context's error once ctx is done.
+func (g *PDFGenerator) GenerateMergedBatch(ctx context.Context, elements []models.PDFElement, records []map[string]interface{}, options BatchOptions) ([]byte, []BatchDocument, error) {
+	results := make([]BatchDocument, len(records))
+	data := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		data[i], results[i].Err = Calculate(record, options.Calculators)
+	}
+
+	settings := models.Settings(elements)
+	if settings.Monochrome {
+		elements = monochromeCodes(elements)
+	}
+	elements = compileConditions(elements)
+	strict := g.ErrorPolicy(options.GenerateOptions) == ErrorPolicyStrict
+
+	utils.LogInfo("Generating merged PDF for %d records", len(records))
+
+	var pdf *fpdf.Fpdf
+	for pass := 1; ; pass++ {
+		var layout documentLayout
+		var err error
+		if pdf, layout, err = g.newDocument(settings); err != nil {
+			return nil, nil, err
+		}
+
+		failed := 0
+		for i := range records {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			if results[i].Err == nil {
+				results[i].Warnings = g.renderElements(pdf, elements, data[i], layout)
+				if strict && len(results[i].Warnings) > 0 {
+					results[i].Err = &RenderError{Elements: results[i].Warnings}
+					failed++
+				}
+			}
+			if pass == 1 && options.Progress != nil {
+				options.Progress(i + 1)
+			}
+		}
+		if failed == 0 {
+			break
+		}
+		utils.LogInfo("Drawing merged PDF again without %d records that failed in strict mode", failed)
+	}
+
+	if options.Manifest != nil {
+		manifest, err := options.Manifest(results)
+		if err != nil {
+			return nil, nil, err
+		}
+		pdf.SetAttachments([]fpdf.Attachment{{Content: manifest, Filename: ManifestFile}})
+	}
+
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	return buf.Bytes(), results, err
+}
+
+// batchWorkers returns the size of the worker pool for a batch
+func batchWorkers(workers, records int) int {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > records {
+		workers = records
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
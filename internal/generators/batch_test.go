@@ -0,0 +1,98 @@
+package generators
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+func batchElements() []models.PDFElement {
+	return []models.PDFElement{{
+		Type:      models.ElementTypeQR,
+		QRContent: "{{code}}",
+		Position:  models.Position{X: 10, Y: 10},
+		Size:      models.Size{Width: 30, Height: 30},
+	}}
+}
+
+func TestGenerateBatchEmitsEveryRecord(t *testing.T) {
+	records := make([]map[string]interface{}, 20)
+	for i := range records {
+		records[i] = map[string]interface{}{"code": "INV"}
+	}
+
+	g := newTestGenerator()
+	seen := make([]int, len(records))
+	progress := 0
+	options := BatchOptions{Workers: 4, Progress: func(done int) { progress = done }}
+	err := g.GenerateBatch(context.Background(), batchElements(), records, options, func(i int, document BatchDocument) error {
+		seen[i]++
+		if document.Err != nil || len(document.PDF) == 0 {
+			t.Errorf("record %d: %v", i+1, document.Err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range seen {
+		if n != 1 {
+			t.Errorf("record %d emitted %d times", i+1, n)
+		}
+	}
+	if progress != len(records) {
+		t.Errorf("progress = %d, want %d", progress, len(records))
+	}
+}
+
+func TestGenerateBatchStopsWhenEmitFails(t *testing.T) {
+	records := make([]map[string]interface{}, 50)
+	for i := range records {
+		records[i] = map[string]interface{}{"code": "INV"}
+	}
+
+	g := newTestGenerator()
+	failure := errors.New("client went away")
+	rendered := 0
+	err := g.GenerateBatch(context.Background(), batchElements(), records, BatchOptions{Workers: 1}, func(i int, document BatchDocument) error {
+		rendered++
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("error = %v, want the emit error", err)
+	}
+	if rendered != 1 {
+		t.Errorf("emit called %d times after it failed", rendered-1)
+	}
+}
+
+func TestGenerateMergedBatchStrict(t *testing.T) {
+	records := []map[string]interface{}{{"code": "A"}, {"code": ""}, {"code": "C"}}
+
+	g := newTestGenerator()
+	var manifest []BatchDocument
+	options := BatchOptions{
+		GenerateOptions: GenerateOptions{ErrorPolicy: ErrorPolicyStrict},
+		Manifest: func(documents []BatchDocument) ([]byte, error) {
+			manifest = documents
+			return []byte("[]"), nil
+		},
+	}
+	pdf, documents, err := g.GenerateMergedBatch(context.Background(), batchElements(), records, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var renderErr *RenderError
+	if documents[0].Err != nil || !errors.As(documents[1].Err, &renderErr) || documents[2].Err != nil {
+		t.Errorf("errors = %v, %v, %v; want only record 2 to fail", documents[0].Err, documents[1].Err, documents[2].Err)
+	}
+	if len(manifest) != len(records) {
+		t.Errorf("manifest called with %d documents", len(manifest))
+	}
+	if !bytes.Contains(pdf, []byte("/Count 2")) {
+		t.Error("the merged PDF doesn't have one page for each of the 2 records that passed")
+	}
+}
@@ -0,0 +1,37 @@
+package generators
+
+import "fmt"
+
+// Calculator computes values from the request data before a document is
+// drawn, such as tax totals. It returns the data the template is rendered
+// with and must not modify its input.
+type Calculator interface {
+	Calculate(data map[string]interface{}) (map[string]interface{}, error)
+}
+
+// CalculationError is returned when a calculator rejects the request data
+type CalculationError struct {
+	Err error
+}
+
+// Error implements error
+func (e *CalculationError) Error() string {
+	return fmt.Sprintf("calculation failed: %v", e.Err)
+}
+
+// Unwrap returns the calculator's error
+func (e *CalculationError) Unwrap() error {
+	return e.Err
+}
+
+// Calculate runs calculators in order, each on the data returned by the last
+func Calculate(data map[string]interface{}, calculators []Calculator) (map[string]interface{}, error) {
+	for _, calculator := range calculators {
+		result, err := calculator.Calculate(data)
+		if err != nil {
+			return nil, &CalculationError{Err: err}
+		}
+		data = result
+	}
+	return data, nil
+}
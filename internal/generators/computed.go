@@ -0,0 +1,35 @@
+package generators
+
+import (
+	"pdf-gen-simple/internal/expr"
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// computeFields evaluates the computed elements in template order and adds
+// their values to data, so later fields and every drawn element can use them.
+// Computed elements are marked done so the planner skips them. A field that
+// fails is left unset and reported as an element error.
+func computeFields(elements []models.PDFElement, data map[string]interface{}, done map[int]bool) []ElementError {
+	var elementErrors []ElementError
+
+	for i, element := range elements {
+		if element.Type != models.ElementTypeComputed {
+			continue
+		}
+		done[i] = true
+
+		name, expression := element.Computation()
+		value, err := expr.Evaluate(expression, data)
+		if err != nil {
+			utils.LogError("Error computing %s (element %d): %v", name, i+1, err)
+			elementErrors = append(elementErrors, newElementError(elements, i, err))
+			continue
+		}
+
+		utils.LogDebug("Computed %s = %v", name, value)
+		data[name] = value
+	}
+
+	return elementErrors
+}
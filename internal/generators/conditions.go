@@ -0,0 +1,58 @@
+package generators
+
+import (
+	"fmt"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// isVisible evaluates an element's showIf and hideIf conditions against the
+// data it is drawn with. Elements without conditions are always visible.
+func isVisible(element models.PDFElement, data map[string]interface{}) (bool, error) {
+	conditions, err := element.Conditions()
+	if err != nil {
+		return false, err
+	}
+
+	if conditions.ShowIf != nil {
+		show, err := conditions.ShowIf.EvaluateBool(data)
+		if err != nil {
+			return false, fmt.Errorf("showIf: %w", err)
+		}
+		if !show {
+			return false, nil
+		}
+	}
+
+	if conditions.HideIf != nil {
+		hide, err := conditions.HideIf.EvaluateBool(data)
+		if err != nil {
+			return false, fmt.Errorf("hideIf: %w", err)
+		}
+		if hide {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// compileConditions returns the elements with their conditions compiled.
+// Templates from a loader are already compiled; other elements are copied
+// and compiled once for the document instead of once per element drawn.
+func compileConditions(elements []models.PDFElement) []models.PDFElement {
+	var result []models.PDFElement
+	for i := range elements {
+		if elements[i].HasCompiledConditions() {
+			continue
+		}
+		if result == nil {
+			result = append([]models.PDFElement(nil), elements...)
+		}
+		result[i].CompileConditions()
+	}
+	if result == nil {
+		return elements
+	}
+	return result
+}
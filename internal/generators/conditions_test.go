@@ -0,0 +1,144 @@
+package generators
+
+import (
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+func TestIsVisible(t *testing.T) {
+	data := map[string]interface{}{"supplierState": "27", "placeOfSupply": "29", "discount": 0}
+	tests := []struct {
+		showIf, hideIf string
+		want           bool
+	}{
+		{"", "", true},
+		{"supplierState != placeOfSupply", "", true},
+		{"supplierState == placeOfSupply", "", false},
+		{"", "discount == 0", false},
+		{"", "discount > 0", true},
+		{"supplierState != placeOfSupply", "discount == 0", false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		element := models.PDFElement{ShowIf: tt.showIf, HideIf: tt.hideIf}
+		got, err := isVisible(element, data)
+		if err != nil {
+			t.Errorf("showIf %q hideIf %q: %v", tt.showIf, tt.hideIf, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("showIf %q hideIf %q = %v, want %v", tt.showIf, tt.hideIf, got, tt.want)
+		}
+	}
+}
+
+func TestIsVisibleErrors(t *testing.T) {
+	tests := []struct {
+		showIf, hideIf string
+		want           string
+	}{
+		{"1 +", "", "showIf: invalid expression"},
+		{"", "nosuch(1)", "hideIf: invalid expression"},
+		{"1 / discount", "", "showIf: 1 / discount: division by zero"},
+		{"", "discount < 'a'", "hideIf:"},
+	}
+	data := map[string]interface{}{"discount": 0}
+	for _, tt := range tests {
+		element := models.PDFElement{ShowIf: tt.showIf, HideIf: tt.hideIf}
+		element.CompileConditions()
+		if _, err := isVisible(element, data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("showIf %q hideIf %q: error = %v, want %q", tt.showIf, tt.hideIf, err, tt.want)
+		}
+	}
+}
+
+func TestCompiledConditionsAreShared(t *testing.T) {
+	element := models.PDFElement{ShowIf: "total > 0"}
+	element.CompileConditions()
+	compiled, err := element.Conditions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Copies, such as loop rows, reuse the compiled programs
+	row := element
+	if got, _ := row.Conditions(); got != compiled {
+		t.Error("a copy of the element compiled its conditions again")
+	}
+
+	// Changing a condition makes the compiled programs stale
+	row.ShowIf = "total < 0"
+	if row.HasCompiledConditions() {
+		t.Error("HasCompiledConditions after the condition changed")
+	}
+	changed, err := row.Conditions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == compiled || changed.ShowIf.String() != "total < 0" {
+		t.Errorf("changed condition compiled to %q", changed.ShowIf)
+	}
+}
+
+func TestCompileConditions(t *testing.T) {
+	elements := []models.PDFElement{
+		{ID: "a", ShowIf: "total > 0"},
+		{ID: "b"},
+		{ID: "c", HideIf: "1 +"},
+	}
+
+	compiled := compileConditions(elements)
+	for i := range compiled {
+		if !compiled[i].HasCompiledConditions() {
+			t.Errorf("element %s wasn't compiled", compiled[i].ID)
+		}
+		if elements[i].HasCompiledConditions() {
+			t.Errorf("element %s was compiled in the caller's slice", elements[i].ID)
+		}
+	}
+	if _, err := compiled[2].Conditions(); err == nil {
+		t.Error("an invalid hideIf compiled without an error")
+	}
+
+	// Elements that are already compiled, like cached templates, aren't copied
+	again := compileConditions(compiled)
+	if &again[0] != &compiled[0] {
+		t.Error("compiled elements were copied")
+	}
+}
+
+// newTestGenerator creates a generator with the repository's fonts
+func newTestGenerator() *PDFGenerator {
+	return NewPDFGenerator(GeneratorConfig{FontDir: "../../fonts"})
+}
+
+func TestGenerateWithConditions(t *testing.T) {
+	elements := []models.PDFElement{
+		{
+			Type:     models.ElementTypeBox,
+			ShowIf:   "paid",
+			Position: models.Position{X: 10, Y: 10},
+			Size:     models.Size{Width: 20, Height: 10},
+		},
+		{
+			Type:     models.ElementTypeBox,
+			HideIf:   "1 / 0",
+			Position: models.Position{X: 10, Y: 30},
+			Size:     models.Size{Width: 20, Height: 10},
+		},
+	}
+
+	g := newTestGenerator()
+	_, elementErrors, err := g.GeneratePDFToBytesWithOptions(elements, map[string]interface{}{"paid": true}, GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elementErrors) != 1 || elementErrors[0].Element != 2 || !strings.Contains(elementErrors[0].Message, "division by zero") {
+		t.Errorf("element errors = %+v, want the hideIf of element 2", elementErrors)
+	}
+	if elements[0].HasCompiledConditions() {
+		t.Error("generating compiled the caller's elements")
+	}
+}
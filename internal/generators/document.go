@@ -0,0 +1,108 @@
+package generators
+
+import (
+	"fmt"
+
+	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/models"
+)
+
+const (
+	// pointsPerMillimetre converts millimetres to points
+	pointsPerMillimetre = 72 / 25.4
+	// barcodePixelsPerMillimetre is the resolution barcodes are rendered at
+	barcodePixelsPerMillimetre = 10
+)
+
+// documentLayout controls how the pages of a document are laid out
+type documentLayout struct {
+	margins models.Margins
+	// continuous pages are as tall as their content and never break
+	continuous bool
+	// hooks draws the page regions of the documents drawn into the PDF
+	hooks *regionHooks
+}
+
+// newDocument returns a document set up with the template's page size,
+// orientation, unit and margins, together with its layout. Templates without
+// settings use the generator's defaults.
+func (g *PDFGenerator) newDocument(settings models.TemplateSettings) (*fpdf.Fpdf, documentLayout, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, documentLayout{}, fmt.Errorf("invalid template settings: %w", err)
+	}
+
+	unit := models.NormalizeUnit(settings.Unit)
+	if unit == "" {
+		unit = g.config.Unit
+	}
+
+	var pdf *fpdf.Fpdf
+	if !settings.Page().IsSet() && unit == g.config.Unit {
+		pdf = fpdf.New(g.config.Orientation, g.config.Unit, g.config.PageSize, g.config.FontDir)
+	} else {
+		width, height := g.pageSize(settings.Page(), unit)
+		orientation, size := "P", fpdf.SizeType{Wd: width, Ht: height}
+		if width > height {
+			orientation, size = "L", fpdf.SizeType{Wd: height, Ht: width}
+		}
+		pdf = fpdf.NewCustom(&fpdf.InitType{
+			OrientationStr: orientation,
+			UnitStr:        unit,
+			Size:           size,
+			FontDirStr:     g.config.FontDir,
+		})
+	}
+	g.setupFonts(pdf)
+	if err := pdf.Error(); err != nil {
+		return nil, documentLayout{}, fmt.Errorf("error creating document: %w", err)
+	}
+
+	margins := g.margins(settings.Margins, unit)
+	pdf.SetMargins(margins.Left, margins.Top, margins.Right)
+
+	hooks := &regionHooks{}
+	hooks.install(pdf)
+	return pdf, documentLayout{margins: margins, continuous: settings.Continuous, hooks: hooks}, nil
+}
+
+// pageSize returns the page size for the settings in the given unit, falling
+// back to the generator's page size and orientation
+func (g *PDFGenerator) pageSize(settings models.PageSettings, unit string) (width, height float64) {
+	points, _ := models.UnitPoints(unit)
+	scale := 1 / points
+
+	defaults := models.PageSettings{Size: g.config.PageSize, Orientation: g.config.Orientation}
+	if _, _, ok := models.LookupPageSize(defaults.Size); !ok {
+		defaults.Size = "A4"
+	}
+	width, height = defaults.Dimensions(0, 0, scale)
+	return settings.Dimensions(width, height, scale)
+}
+
+// margins returns the template's margins, using the generator's margins
+// converted to the given unit for those that aren't set. Left and right
+// default to fpdf's 1 cm.
+func (g *PDFGenerator) margins(margins models.Margins, unit string) models.Margins {
+	from, _ := models.UnitPoints(g.config.Unit)
+	to, _ := models.UnitPoints(unit)
+
+	if margins.Top == 0 {
+		margins.Top = g.config.TopMargin * from / to
+	}
+	if margins.Bottom == 0 {
+		margins.Bottom = g.config.BottomMargin * from / to
+	}
+	if margins.Left == 0 {
+		margins.Left = 10 * pointsPerMillimetre / to
+	}
+	if margins.Right == 0 {
+		margins.Right = 10 * pointsPerMillimetre / to
+	}
+	return margins
+}
+
+// millimetres converts a length in millimetres to the document's unit
+func millimetres(pdf *fpdf.Fpdf, mm float64) float64 {
+	return pdf.PointConvert(mm * pointsPerMillimetre)
+}
@@ -0,0 +1,166 @@
+package generators
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+func TestNewDocument(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        GeneratorConfig
+		settings      models.TemplateSettings
+		unit          string
+		width, height float64
+		margins       models.Margins
+	}{
+		{
+			name:    "defaults",
+			unit:    "mm",
+			width:   210,
+			height:  297,
+			margins: models.Margins{Top: 10, Bottom: 10, Left: 10, Right: 10},
+		},
+		{
+			name:     "named size and orientation",
+			settings: models.TemplateSettings{PageSettings: models.PageSettings{Size: "A5", Orientation: "L"}},
+			unit:     "mm",
+			width:    210,
+			height:   148.5,
+			margins:  models.Margins{Top: 10, Bottom: 10, Left: 10, Right: 10},
+		},
+		{
+			name: "custom size and margins",
+			settings: models.TemplateSettings{
+				PageSettings: models.PageSettings{Width: 100, Height: 150},
+				Margins:      models.Margins{Top: 25, Left: 5},
+			},
+			unit:    "mm",
+			width:   100,
+			height:  150,
+			margins: models.Margins{Top: 25, Bottom: 10, Left: 5, Right: 10},
+		},
+		{
+			// The default margins are converted to the template's unit
+			name:     "unit",
+			settings: models.TemplateSettings{PageSettings: models.PageSettings{Size: "Letter"}, Unit: "in"},
+			unit:     "in",
+			width:    8.5,
+			height:   11,
+			margins:  models.Margins{Top: 10 / 25.4, Bottom: 10 / 25.4, Left: 10 / 25.4, Right: 10 / 25.4},
+		},
+		{
+			name:     "unit of a default page",
+			settings: models.TemplateSettings{Unit: "pt"},
+			unit:     "pt",
+			width:    595.28,
+			height:   841.89,
+			margins:  models.Margins{Top: 28.35, Bottom: 28.35, Left: 28.35, Right: 28.35},
+		},
+		{
+			name:    "generator configuration",
+			config:  GeneratorConfig{PageSize: "A5", Orientation: "L", TopMargin: 15},
+			unit:    "mm",
+			width:   210,
+			height:  148.5,
+			margins: models.Margins{Top: 15, Bottom: 10, Left: 10, Right: 10},
+		},
+		{
+			// Named sizes follow the generator's orientation
+			name:     "generator orientation",
+			config:   GeneratorConfig{Orientation: "L"},
+			settings: models.TemplateSettings{PageSettings: models.PageSettings{Size: "A5"}},
+			unit:     "mm",
+			width:    210,
+			height:   148.5,
+			margins:  models.Margins{Top: 10, Bottom: 10, Left: 10, Right: 10},
+		},
+	}
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 0.01 }
+	for _, tt := range tests {
+		tt.config.FontDir = "../../fonts"
+		g := NewPDFGenerator(tt.config)
+		pdf, layout, err := g.newDocument(tt.settings)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		pdf.AddPage()
+
+		_, _, unit := pdf.PageSize(1)
+		width, height := pdf.GetPageSize()
+		if unit != tt.unit || !near(width, tt.width) || !near(height, tt.height) {
+			t.Errorf("%s: page %.2f x %.2f %s, want %.2f x %.2f %s", tt.name, width, height, unit, tt.width, tt.height, tt.unit)
+		}
+		m := layout.margins
+		if !near(m.Top, tt.margins.Top) || !near(m.Bottom, tt.margins.Bottom) || !near(m.Left, tt.margins.Left) || !near(m.Right, tt.margins.Right) {
+			t.Errorf("%s: margins %+v, want %+v", tt.name, m, tt.margins)
+		}
+		if left, top, right, _ := pdf.GetMargins(); !near(left, m.Left) || !near(top, m.Top) || !near(right, m.Right) {
+			t.Errorf("%s: document margins %.2f, %.2f, %.2f, want %+v", tt.name, left, top, right, m)
+		}
+	}
+}
+
+func TestNewDocumentRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		settings models.TemplateSettings
+		err      string
+	}{
+		{models.TemplateSettings{PageSettings: models.PageSettings{Size: "B5"}}, `unknown page size "B5"`},
+		{models.TemplateSettings{PageSettings: models.PageSettings{Orientation: "sideways"}}, "invalid orientation"},
+		{models.TemplateSettings{Unit: "furlong"}, `unknown unit "furlong"`},
+		{models.TemplateSettings{Margins: models.Margins{Bottom: -5}}, "invalid margins"},
+	}
+	g := NewPDFGenerator(GeneratorConfig{FontDir: "../../fonts"})
+	for _, tt := range tests {
+		_, _, err := g.newDocument(tt.settings)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%+v: error = %v, want %q", tt.settings, err, tt.err)
+		}
+	}
+}
+
+func TestRowsFollowTemplateMargins(t *testing.T) {
+	rows := loopElement(40, 10)
+	elements := []models.PDFElement{
+		{Type: models.ElementTypeSettings, Settings: models.TemplateSettings{
+			PageSettings: models.PageSettings{Width: 100, Height: 100},
+			Margins:      models.Margins{Top: 30, Bottom: 20},
+		}},
+		rows,
+	}
+	g := NewPDFGenerator(GeneratorConfig{FontDir: "../../fonts"})
+	pdf, layout, err := g.newDocument(models.Settings(elements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := newPageRegions(elements)
+	planner := &layoutPlanner{
+		g:          g,
+		elements:   elements,
+		data:       map[string]interface{}{"items": items(6)},
+		topMargin:  math.Max(layout.margins.Top, regions.headerBottom),
+		margins:    layout.margins,
+		rowSpacing: millimetres(pdf, loopRowSpacing),
+		footerTop:  regions.footerTop,
+		done:       regions.members,
+		ends:       make(map[string]flowEnd),
+	}
+	planner.startPage(1, pageFormat{width: 100, height: 100})
+	planner.plan()
+
+	// Rows of 12mm stop above the bottom margin at 80mm and continue at the
+	// top margin
+	if got, want := pagesOf(planner, 1), []int{1, 1, 1, 2, 2, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows on pages %v, want %v", got, want)
+	}
+	if end := planner.ends["items"]; end.page != 2 || end.y != 66 {
+		t.Errorf("rows end at %+v, want page 2 at 66", end)
+	}
+}
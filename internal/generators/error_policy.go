@@ -0,0 +1,82 @@
+package generators
+
+import (
+	"fmt"
+	"strings"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// ErrorPolicy decides what happens when an element can't be drawn
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyLenient logs broken elements and skips them
+	ErrorPolicyLenient ErrorPolicy = "lenient"
+	// ErrorPolicyStrict aborts generation if any element fails
+	ErrorPolicyStrict ErrorPolicy = "strict"
+	// ErrorPolicyReport skips broken elements and returns them as warnings
+	ErrorPolicyReport ErrorPolicy = "report"
+)
+
+// ParseErrorPolicy parses an error policy name. An empty name returns "".
+func ParseErrorPolicy(name string) (ErrorPolicy, error) {
+	policy := ErrorPolicy(strings.ToLower(strings.TrimSpace(name)))
+	switch policy {
+	case "", ErrorPolicyLenient, ErrorPolicyStrict, ErrorPolicyReport:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown error policy %q: use lenient, strict or report", name)
+	}
+}
+
+// GenerateOptions overrides the generator configuration for one document
+type GenerateOptions struct {
+	ErrorPolicy ErrorPolicy
+	// Calculators run on the data before the document is drawn
+	Calculators []Calculator
+}
+
+// ElementError describes a template element that could not be drawn
+type ElementError struct {
+	// Label is the 1-based record of a label sheet the element was drawn for
+	Label   int                `json:"label,omitempty"`
+	Element int                `json:"element"` // 1-based position in the template
+	ID      string             `json:"id,omitempty"`
+	Type    models.ElementType `json:"type"`
+	Message string             `json:"message"`
+}
+
+// Error implements error
+func (e ElementError) Error() string {
+	prefix := ""
+	if e.Label > 0 {
+		prefix = fmt.Sprintf("label %d: ", e.Label)
+	}
+	if e.ID != "" {
+		return fmt.Sprintf("%selement %d (%s %q): %s", prefix, e.Element, e.Type, e.ID, e.Message)
+	}
+	return fmt.Sprintf("%selement %d (%s): %s", prefix, e.Element, e.Type, e.Message)
+}
+
+// RenderError is returned in strict mode when elements fail to draw
+type RenderError struct {
+	Elements []ElementError
+}
+
+// Error implements error
+func (e *RenderError) Error() string {
+	messages := make([]string, len(e.Elements))
+	for i, element := range e.Elements {
+		messages[i] = element.Error()
+	}
+	return fmt.Sprintf("%d element(s) failed to render: %s", len(e.Elements), strings.Join(messages, "; "))
+}
+
+// ErrorPolicy returns the policy used for a document generated with options
+func (g *PDFGenerator) ErrorPolicy(options GenerateOptions) ErrorPolicy {
+	if options.ErrorPolicy != "" {
+		return options.ErrorPolicy
+	}
+	return g.config.ErrorPolicy
+}
@@ -0,0 +1,100 @@
+package generators
+
+import (
+	"errors"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+func TestParseErrorPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		want ErrorPolicy
+	}{
+		{"", ""},
+		{"lenient", ErrorPolicyLenient},
+		{" Strict ", ErrorPolicyStrict},
+		{"REPORT", ErrorPolicyReport},
+	}
+	for _, tt := range tests {
+		if got, err := ParseErrorPolicy(tt.name); err != nil || got != tt.want {
+			t.Errorf("ParseErrorPolicy(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := ParseErrorPolicy("ignore"); err == nil {
+		t.Error(`ParseErrorPolicy("ignore") succeeded`)
+	}
+}
+
+// failingElements returns a text and a QR code, which fails for an empty code
+func failingElements() []models.PDFElement {
+	return []models.PDFElement{
+		{
+			Type:     models.ElementTypeText,
+			Method:   "Cell",
+			Text:     "Invoice",
+			Position: models.Position{X: 10, Y: 10},
+			Size:     models.Size{Width: 50, Height: 8},
+		},
+		{
+			ID:        "code",
+			Type:      models.ElementTypeQR,
+			QRContent: "{{code}}",
+			Position:  models.Position{X: 10, Y: 30},
+			Size:      models.Size{Width: 20, Height: 20},
+		},
+	}
+}
+
+func TestErrorPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ErrorPolicy
+		option ErrorPolicy
+		policy ErrorPolicy
+	}{
+		{"default", "", "", ErrorPolicyLenient},
+		{"configured", ErrorPolicyStrict, "", ErrorPolicyStrict},
+		{"requested", ErrorPolicyLenient, ErrorPolicyReport, ErrorPolicyReport},
+		{"request overrides configuration", ErrorPolicyStrict, ErrorPolicyLenient, ErrorPolicyLenient},
+	}
+
+	for _, tt := range tests {
+		g := NewPDFGenerator(GeneratorConfig{FontDir: "../../fonts", ErrorPolicy: tt.config})
+		options := GenerateOptions{ErrorPolicy: tt.option}
+		if policy := g.ErrorPolicy(options); policy != tt.policy {
+			t.Errorf("%s: policy %q, want %q", tt.name, policy, tt.policy)
+		}
+
+		pdf, elementErrors, err := g.GeneratePDFToBytesWithOptions(failingElements(), map[string]interface{}{"code": ""}, options)
+		// Every policy reports the failed element, only strict mode fails
+		if len(elementErrors) != 1 || elementErrors[0].Element != 2 || elementErrors[0].ID != "code" {
+			t.Errorf("%s: element errors = %+v, want element 2", tt.name, elementErrors)
+		}
+		var renderErr *RenderError
+		if tt.policy == ErrorPolicyStrict {
+			if !errors.As(err, &renderErr) || len(renderErr.Elements) != 1 || pdf != nil {
+				t.Errorf("%s: error = %v with %d bytes, want a RenderError and no PDF", tt.name, err, len(pdf))
+			}
+		} else if err != nil || len(pdf) == 0 {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+
+		// Nothing is reported when every element is drawn
+		if _, elementErrors, err := g.GeneratePDFToBytesWithOptions(failingElements(), map[string]interface{}{"code": "INV-1"}, options); err != nil || len(elementErrors) != 0 {
+			t.Errorf("%s with a code: %v, element errors %+v", tt.name, err, elementErrors)
+		}
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	err := &RenderError{Elements: []ElementError{
+		{Element: 2, ID: "code", Type: models.ElementTypeQR, Message: "QR content is empty"},
+		{Element: 5, Type: models.ElementTypeImage, Message: "image not found"},
+	}}
+	want := `2 element(s) failed to render: element 2 (qr "code"): QR content is empty; element 5 (image): image not found`
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,121 @@
+package generators
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// errLabelOverflow is reported for label content that doesn't fit on the label
+var errLabelOverflow = fmt.Errorf("content does not fit on the label")
+
+// GenerateLabelSheetsToBytes imposes a label template onto sheets of label
+// stock, drawing one label per record, and returns the PDF together with the
+// elements that failed to draw. The options' calculators run on every record.
+func (g *PDFGenerator) GenerateLabelSheetsToBytes(elements []models.PDFElement, records []map[string]interface{}, sheet models.SheetLayout, options GenerateOptions) ([]byte, []ElementError, error) {
+	if err := sheet.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid label sheet: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("no labels to print")
+	}
+
+	// The document is a sheet in the label template's unit
+	settings := models.Settings(elements)
+	settings.PageSettings = sheet.PageSettings
+	settings.Continuous = false
+	pdf, _, err := g.newDocument(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	if settings.Monochrome {
+		elements = monochromeCodes(elements)
+	}
+	pdf.SetAutoPageBreak(false, 0)
+
+	if err := sheet.CheckFit(pdf.GetPageSize()); err != nil {
+		return nil, nil, fmt.Errorf("invalid label sheet: %w", err)
+	}
+	width, height := sheet.LabelSize(pdf.GetPageSize())
+
+	utils.LogInfo("Generating %d labels, %d per sheet", len(records), sheet.LabelsPerSheet())
+
+	var elementErrors []ElementError
+	for i, record := range records {
+		data, err := Calculate(record, options.Calculators)
+		if err != nil {
+			return nil, nil, fmt.Errorf("label %d: %w", i+1, err)
+		}
+
+		cell := (sheet.Skip + i) % sheet.LabelsPerSheet()
+		if i == 0 || cell == 0 {
+			pdf.AddPage()
+		}
+		x, y := sheet.LabelPosition(cell, width, height)
+
+		for _, elementError := range g.drawLabel(pdf, elements, data, x, y, pageFormat{width: width, height: height}) {
+			elementError.Label = i + 1
+			elementErrors = append(elementErrors, elementError)
+		}
+	}
+
+	if len(elementErrors) > 0 && g.ErrorPolicy(options) == ErrorPolicyStrict {
+		return nil, elementErrors, &RenderError{Elements: elementErrors}
+	}
+
+	var buf bytes.Buffer
+	err = pdf.Output(&buf)
+	return buf.Bytes(), elementErrors, err
+}
+
+// drawLabel lays out the first page of a label template for one record and
+// draws it at x, y, clipped to the label. Content that flows past the bottom
+// of the label is reported instead of drawn.
+func (g *PDFGenerator) drawLabel(pdf *fpdf.Fpdf, elements []models.PDFElement, data map[string]interface{}, x, y float64, label pageFormat) []ElementError {
+	data = copyData(data)
+
+	regions := newPageRegions(elements)
+	elementErrors := computeFields(elements, data, regions.members)
+
+	planner := g.newLayoutPlanner(pdf, elements, data, regions, documentLayout{})
+	planner.startPage(1, label)
+	planner.plan()
+
+	for _, failure := range planner.failures {
+		elementErrors = append(elementErrors, newElementError(elements, failure.element, failure.err))
+	}
+
+	pdf.TransformBegin()
+	pdf.TransformTranslate(x, y)
+	pdf.ClipRect(0, 0, label.width, label.height, false)
+
+	overflowed := make(map[int]bool)
+	for _, p := range planner.placements {
+		if p.page != planner.firstPage {
+			if !overflowed[p.element] {
+				overflowed[p.element] = true
+				elementErrors = append(elementErrors, newElementError(elements, p.element, errLabelOverflow))
+			}
+			continue
+		}
+		setPageVariables(p.data, 1, 1)
+		if err := p.draw(pdf, p.data); err != nil {
+			utils.LogError("Error processing element %d: %v", p.element+1, err)
+			elementErrors = append(elementErrors, newElementError(elements, p.element, err))
+		}
+	}
+
+	// Header and footer elements are drawn once on every label
+	elementErrors = append(elementErrors, g.drawRegion(pdf, models.RegionHeader, regions, regions.headers, data, 1, 1, 1, 0)...)
+	elementErrors = append(elementErrors, g.drawRegion(pdf, models.RegionFirstPageOnly, regions, regions.firstPage, data, 1, 1, 1, 0)...)
+	elementErrors = append(elementErrors, g.drawRegion(pdf, models.RegionLastPageOnly, regions, regions.lastPage, data, 1, 1, 1, 0)...)
+	elementErrors = append(elementErrors, g.drawRegion(pdf, models.RegionFooter, regions, regions.footers, data, 1, 1, 1, 0)...)
+
+	pdf.ClipEnd()
+	pdf.TransformEnd()
+	return elementErrors
+}
@@ -0,0 +1,38 @@
+package generators
+
+import (
+	"errors"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+func TestLabelSheetsMustFitNamedSheet(t *testing.T) {
+	elements := []models.PDFElement{{
+		Type:     models.ElementTypeText,
+		Method:   "Cell",
+		Text:     "{{name}}",
+		Position: models.Position{X: 2, Y: 2},
+		Size:     models.Size{Width: 40, Height: 6},
+	}}
+	records := []map[string]interface{}{{"name": "Asha"}, {"name": "Ravi"}}
+	sheet := models.SheetLayout{
+		PageSettings: models.PageSettings{Size: "A4"},
+		Rows:         7,
+		Columns:      2,
+		LabelWidth:   99.1,
+		LabelHeight:  38.1,
+		ColumnGap:    2.5,
+		Margins:      models.Margins{Top: 15.15, Left: 4.65},
+	}
+
+	g := newTestGenerator()
+	if _, _, err := g.GenerateLabelSheetsToBytes(elements, records, sheet, GenerateOptions{}); err != nil {
+		t.Fatalf("labels that fit: %v", err)
+	}
+
+	sheet.Columns = 3
+	if _, _, err := g.GenerateLabelSheetsToBytes(elements, records, sheet, GenerateOptions{}); !errors.Is(err, models.ErrLabelsDontFit) {
+		t.Errorf("3 columns of 99.1mm on A4: error = %v, want ErrLabelsDontFit", err)
+	}
+}
@@ -0,0 +1,652 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// loopRowSpacing is the gap in millimetres added below each row of a loop group
+const loopRowSpacing = 2
+
+// placement is a drawing operation scheduled onto a page by the layout planner
+type placement struct {
+	page    int
+	element int // index of the template element, for error reporting
+	bottom  float64
+	data    map[string]interface{}
+	draw    func(pdf *fpdf.Fpdf, data map[string]interface{}) error
+}
+
+// elementFailure records an element that could not be laid out
+type elementFailure struct {
+	element int
+	err     error
+}
+
+// flowAnchor maps template Y coordinates at or below templateY onto a page.
+// Anchors are added when a loop or table grows past the space the template
+// reserved for it, so that the elements below it move along.
+type flowAnchor struct {
+	templateY float64
+	page      int
+	offset    float64
+}
+
+// flowEnd is where a laid out element, loop or table ended
+type flowEnd struct {
+	page int
+	y    float64
+}
+
+// layoutPlanner assigns template elements to pages, breaking loops and tables
+// that overflow the bottom margin onto continuation pages. Each template page
+// is laid out in turn, starting on a new physical page.
+type layoutPlanner struct {
+	g          *PDFGenerator
+	elements   []models.PDFElement
+	data       map[string]interface{}
+	topMargin  float64
+	margins    models.Margins
+	rowSpacing float64
+	continuous bool
+	footerTop  float64
+	pageLimit  float64
+	anchors    []flowAnchor
+	placements []placement
+	failures   []elementFailure
+	pages      int
+	done       map[int]bool
+
+	// templatePage is the template page being laid out and firstPage the
+	// physical page it starts on. formats and templatePages record the size
+	// and template page of every physical page.
+	templatePage  int
+	firstPage     int
+	format        pageFormat
+	formats       []pageFormat
+	templatePages []int
+
+	// ends records where elements (by ID) and loops and tables (by array
+	// name) ended, for elements anchored with "after:"
+	ends     map[string]flowEnd
+	previous flowEnd
+}
+
+// renderElements lays out the elements and draws them page by page after the
+// pages already in the document, returning the elements that could not be
+// laid out or drawn, page regions included. Loops and tables break pages at
+// the top and bottom margins, except on continuous pages, which grow to fit
+// them.
+func (g *PDFGenerator) renderElements(pdf *fpdf.Fpdf, elements []models.PDFElement, data map[string]interface{}, layout documentLayout) []ElementError {
+	// Page breaks are handled by the planner
+	pdf.SetAutoPageBreak(false, 0)
+
+	// Work on a copy so page variables never leak into the caller's data
+	data = copyData(data)
+
+	regions := newPageRegions(elements)
+	elementErrors := computeFields(elements, data, regions.members)
+
+	defaultWidth, defaultHeight := pdf.GetPageSize()
+	planner := g.newLayoutPlanner(pdf, elements, data, regions, layout)
+	for _, page := range templatePages(elements, regions.members) {
+		width, height := page.settings.Dimensions(defaultWidth, defaultHeight, pdf.PointToUnitConvert(1))
+		planner.startPage(page.number, pageFormat{width: width, height: height})
+		planner.plan()
+	}
+
+	var footerOffsets []float64
+	if planner.continuous {
+		footerOffsets = planner.fitPages(regions)
+	}
+
+	for _, failure := range planner.failures {
+		utils.LogError("Error processing element %d: %v", failure.element+1, failure.err)
+		elementErrors = append(elementErrors, newElementError(elements, failure.element, failure.err))
+	}
+
+	// Header and footer elements are replayed on every page through fpdf's hooks
+	document := g.setPageRegionHooks(pdf, layout.hooks, regions, data, pdf.PageNo(), planner.pages, planner.templatePages, footerOffsets)
+
+	// Draw pages in order; placements on the same page keep template order
+	sort.SliceStable(planner.placements, func(i, j int) bool {
+		return planner.placements[i].page < planner.placements[j].page
+	})
+
+	page := 0
+	for _, p := range planner.placements {
+		for page < p.page {
+			planner.formats[page].addPage(pdf)
+			page++
+		}
+		utils.LogDebug("Processing element %d: %s", p.element+1, elements[p.element].Type)
+		setPageVariables(p.data, page, planner.pages)
+		if err := p.draw(pdf, p.data); err != nil {
+			utils.LogError("Error processing element %d: %v", p.element+1, err)
+			elementErrors = append(elementErrors, newElementError(elements, p.element, err))
+		}
+	}
+	for page < planner.pages {
+		planner.formats[page].addPage(pdf)
+		page++
+	}
+
+	return append(elementErrors, document.finish()...)
+}
+
+// newLayoutPlanner creates a planner for the elements outside the page regions
+func (g *PDFGenerator) newLayoutPlanner(pdf *fpdf.Fpdf, elements []models.PDFElement, data map[string]interface{}, regions pageRegions, layout documentLayout) *layoutPlanner {
+	return &layoutPlanner{
+		g:          g,
+		elements:   elements,
+		data:       data,
+		topMargin:  math.Max(layout.margins.Top, regions.headerBottom),
+		margins:    layout.margins,
+		continuous: layout.continuous,
+		rowSpacing: millimetres(pdf, loopRowSpacing),
+		footerTop:  regions.footerTop,
+		done:       regions.members,
+		ends:       make(map[string]flowEnd),
+	}
+}
+
+// newElementError describes the failure of the element at index
+func newElementError(elements []models.PDFElement, index int, err error) ElementError {
+	return ElementError{
+		Element: index + 1,
+		ID:      elements[index].ID,
+		Type:    elements[index].Type,
+		Message: err.Error(),
+	}
+}
+
+// startPage begins laying out a template page on a new physical page
+func (p *layoutPlanner) startPage(templatePage int, format pageFormat) {
+	p.templatePage = templatePage
+	p.format = format
+	p.pageLimit = math.Min(format.height-p.margins.Bottom, p.footerTop)
+	if p.continuous {
+		p.pageLimit = math.Inf(1)
+	}
+
+	p.firstPage = p.nextPage(p.pages)
+	p.anchors = []flowAnchor{{templateY: math.Inf(-1), page: p.firstPage}}
+	p.previous = flowEnd{page: p.firstPage, y: p.margins.Top}
+}
+
+// onPage returns true if the element at index is on the template page being laid out
+func (p *layoutPlanner) onPage(index int) bool {
+	return p.elements[index].PageNumber() == p.templatePage
+}
+
+// plan walks the elements of the current template page in template order and
+// schedules their placements
+func (p *layoutPlanner) plan() {
+	for i, element := range p.elements {
+		if p.done[i] || !p.onPage(i) {
+			continue
+		}
+		if element.IsPageSetup() {
+			p.done[i] = true
+			continue
+		}
+
+		// Hidden elements take no space; anchors after them follow the element before
+		if element.IsConditional() && !element.IsLoopElement() {
+			visible, err := isVisible(element, p.data)
+			if err != nil {
+				p.fail(i, err)
+			}
+			if err != nil || !visible {
+				p.done[i] = true
+				p.recordEnd(element.ID, p.previous)
+				continue
+			}
+		}
+
+		switch {
+		case element.IsLoopElement():
+			p.planLoop(i)
+		case element.Type == models.ElementTypeTable:
+			p.planTable(i)
+		default:
+			p.planElement(i)
+		}
+	}
+}
+
+// planElement places a static element, moving it below any loop that grew above it
+func (p *layoutPlanner) planElement(index int) {
+	element := p.elements[index]
+	page, y, displaced, err := p.position(element)
+	if err != nil {
+		p.fail(index, err)
+		return
+	}
+
+	// Elements pushed down by a loop may no longer fit on their page
+	if displaced && y+element.Size.Height > p.pageLimit {
+		page = p.nextPage(page)
+		if !element.Position.IsAnchored() {
+			p.addAnchor(flowAnchor{templateY: element.Position.Y, page: page, offset: p.topMargin - element.Position.Y})
+		}
+		y = p.topMargin
+	}
+
+	element.Position.Y = y
+	p.place(page, index, y+element.Size.Height, p.data, func(pdf *fpdf.Fpdf, data map[string]interface{}) error {
+		return p.g.processElement(pdf, element, data)
+	})
+	p.recordEnd(element.ID, flowEnd{page: page, y: y + element.Size.Height})
+}
+
+// planLoop lays out all loop elements iterating over the same array as one row group
+func (p *layoutPlanner) planLoop(index int) {
+	arrayName := p.elements[index].LoopArray()
+
+	var group []int
+	for i, element := range p.elements {
+		if !p.done[i] && p.onPage(i) && element.IsLoopElement() && element.LoopArray() == arrayName {
+			group = append(group, i)
+			p.done[i] = true
+		}
+	}
+
+	rows, err := loopRows(p.elements[index], p.data)
+	if err != nil {
+		p.fail(index, err)
+		return
+	}
+
+	// Rows are as tall as the group's combined extent
+	startY := math.Inf(1)
+	continueY := 0.0
+	for _, i := range group {
+		startY = math.Min(startY, p.elements[i].Position.Y)
+		continueY = math.Max(continueY, p.elements[i].ContinueY)
+	}
+	extent := 0.0
+	for _, i := range group {
+		element := p.elements[i]
+		extent = math.Max(extent, element.Position.Y-startY+element.Size.Height)
+	}
+	spacing := extent + p.rowSpacing
+
+	startPage, y, _, err := p.position(p.elements[index])
+	if err != nil {
+		p.fail(index, err)
+		return
+	}
+	y += startY - p.elements[index].Position.Y
+	page := startPage
+	rowsOnPage := 0
+	freshPage := false
+
+	for _, row := range rows {
+		// A row that doesn't fit moves to a continuation page, unless it is
+		// the first row on a page it started, where it could never fit
+		if y+extent > p.pageLimit && (rowsOnPage > 0 || !freshPage) {
+			page = p.nextPage(page)
+			y = p.placeHeaders(page, arrayName, startY, continueY)
+			rowsOnPage = 0
+			freshPage = true
+		}
+
+		for _, i := range group {
+			element := *p.elements[i].Clone()
+			element.LoopField = ""
+			element.Position.Y = y + (p.elements[i].Position.Y - startY)
+
+			rowData := loopRowData(p.elements[i], row)
+			p.place(page, i, element.Position.Y+element.Size.Height, rowData, func(pdf *fpdf.Fpdf, data map[string]interface{}) error {
+				return p.g.processElement(pdf, element, data)
+			})
+		}
+
+		y += spacing
+		rowsOnPage++
+	}
+
+	p.finishFlow(arrayName, startY, startPage, page, y, group)
+}
+
+// planTable splits a table into per-page chunks, repeating the header row on each page
+func (p *layoutPlanner) planTable(index int) {
+	element := p.elements[index]
+	p.done[index] = true
+
+	if err := element.Validate(); err != nil {
+		p.fail(index, fmt.Errorf("element validation failed: %w", err))
+		return
+	}
+
+	items, err := tableItems(element, p.data)
+	if err != nil {
+		p.fail(index, err)
+		return
+	}
+
+	// Validate has checked that the row height is positive
+	rowHeight := element.Size.Height
+	headerHeight := 0.0
+	if !element.Table.HideHeader {
+		headerHeight = rowHeight
+	}
+
+	startPage, y, _, err := p.position(element)
+	if err != nil {
+		p.fail(index, err)
+		return
+	}
+	page := startPage
+	freshPage := false
+	first := 0
+
+	for {
+		fit := len(items) - first
+		if room := (p.pageLimit - y - headerHeight + 1e-9) / rowHeight; room < float64(fit) {
+			fit = int(room)
+		}
+		if fit < 1 && !freshPage && first < len(items) {
+			// Not even one row fits below the table's position
+			page = p.nextPage(page)
+			y = p.placeHeaders(page, element.VariableName, element.Position.Y, element.ContinueY)
+			freshPage = true
+			continue
+		}
+		if fit < 1 {
+			fit = 1
+		}
+		if fit > len(items)-first {
+			fit = len(items) - first
+		}
+
+		chunk := element
+		chunk.Position.Y = y
+		chunkItems := items[first : first+fit]
+		chunkFirst := first
+		p.place(page, index, y+headerHeight+float64(fit)*rowHeight, p.data, func(pdf *fpdf.Fpdf, data map[string]interface{}) error {
+			p.g.drawTable(pdf, chunk, chunkItems, chunkFirst, chunk.Position.Y)
+			return nil
+		})
+
+		y += headerHeight + float64(fit)*rowHeight
+		first += fit
+		if first >= len(items) {
+			break
+		}
+
+		page = p.nextPage(page)
+		y = p.placeHeaders(page, element.VariableName, element.Position.Y, element.ContinueY)
+		freshPage = true
+	}
+
+	p.finishFlow(element.VariableName, element.Position.Y, startPage, page, y, []int{index})
+}
+
+// placeHeaders replays the elements marked as headers for arrayName on a
+// continuation page and returns the Y where the rows continue
+func (p *layoutPlanner) placeHeaders(page int, arrayName string, startY, continueY float64) float64 {
+	if continueY <= 0 {
+		continueY = p.topMargin
+	}
+
+	var headers []int
+	top := math.Inf(1)
+	bottom := 0.0
+	for i, element := range p.elements {
+		if element.HeaderFor == arrayName && p.onPage(i) {
+			headers = append(headers, i)
+			top = math.Min(top, element.Position.Y)
+			bottom = math.Max(bottom, element.Position.Y+element.Size.Height)
+		}
+	}
+	if len(headers) == 0 {
+		return continueY
+	}
+
+	for _, i := range headers {
+		element := p.elements[i]
+		element.Position.Y = continueY + (element.Position.Y - top)
+		p.place(page, i, element.Position.Y+element.Size.Height, p.data, func(pdf *fpdf.Fpdf, data map[string]interface{}) error {
+			return p.g.processElement(pdf, element, data)
+		})
+	}
+
+	// Keep the header's original distance to the first row
+	return continueY + math.Max(startY-top, bottom-top)
+}
+
+// finishFlow records where a loop or table ended and shifts the elements
+// positioned below it when it grew past the next element or onto another page
+func (p *layoutPlanner) finishFlow(arrayName string, startY float64, startPage, endPage int, endY float64, group []int) {
+	end := flowEnd{page: endPage, y: endY}
+	p.recordEnd(arrayName, end)
+
+	inGroup := make(map[int]bool, len(group))
+	for _, i := range group {
+		inGroup[i] = true
+		p.recordEnd(p.elements[i].ID, end)
+	}
+
+	// The next element below the loop marks the end of its reserved space
+	reservedEnd := math.Inf(1)
+	for i, element := range p.elements {
+		if inGroup[i] || !p.onPage(i) || element.HeaderFor == arrayName || element.Position.IsAnchored() || element.Region.IsPageRegion() {
+			continue
+		}
+		if element.Position.Y > startY {
+			reservedEnd = math.Min(reservedEnd, element.Position.Y)
+		}
+	}
+	if math.IsInf(reservedEnd, 1) {
+		return
+	}
+
+	page, y, _ := p.resolve(reservedEnd)
+	if endPage > page || (endPage == page && endY > y) {
+		p.addAnchor(flowAnchor{templateY: reservedEnd, page: endPage, offset: endY - reservedEnd})
+	}
+
+	utils.LogDebug("Flow for %s ended on page %d at y=%.1f (started on page %d)", arrayName, endPage, endY, startPage)
+}
+
+// position returns the page and Y for an element, following its flow anchor if it has one
+func (p *layoutPlanner) position(element models.PDFElement) (page int, y float64, displaced bool, err error) {
+	if !element.Position.IsAnchored() {
+		page, y, displaced = p.resolve(element.Position.Y)
+		return page, y, displaced, nil
+	}
+
+	end := p.previous
+	if element.Position.After != models.AnchorPrevious {
+		var ok bool
+		if end, ok = p.ends[element.Position.After]; !ok {
+			return 0, 0, false, fmt.Errorf("unknown flow anchor %q: it must name an earlier element id or loop array", element.Position.After)
+		}
+	}
+
+	return end.page, end.y + element.Position.Gap, true, nil
+}
+
+// recordEnd remembers where an element, loop or table ended
+func (p *layoutPlanner) recordEnd(name string, end flowEnd) {
+	p.previous = end
+	if name != "" {
+		p.ends[name] = end
+	}
+}
+
+// resolve maps a template Y coordinate to a page and position
+func (p *layoutPlanner) resolve(templateY float64) (page int, y float64, displaced bool) {
+	anchor := p.anchors[0]
+	for _, a := range p.anchors[1:] {
+		if a.templateY <= templateY {
+			anchor = a
+		}
+	}
+	return anchor.page, templateY + anchor.offset, anchor.page > p.firstPage || anchor.offset != 0
+}
+
+// addAnchor inserts an anchor keeping the list ordered by template Y
+func (p *layoutPlanner) addAnchor(anchor flowAnchor) {
+	for i, a := range p.anchors {
+		if a.templateY == anchor.templateY {
+			p.anchors[i] = anchor
+			return
+		}
+	}
+	p.anchors = append(p.anchors, anchor)
+	sort.SliceStable(p.anchors, func(i, j int) bool {
+		return p.anchors[i].templateY < p.anchors[j].templateY
+	})
+}
+
+// nextPage returns the page after the given one, growing the document if needed
+func (p *layoutPlanner) nextPage(page int) int {
+	page++
+	if page > p.pages {
+		p.pages = page
+		p.formats = append(p.formats, p.format)
+		p.templatePages = append(p.templatePages, p.templatePage)
+	}
+	return page
+}
+
+// place schedules a drawing operation on a page. bottom is where the drawing
+// ends, for sizing continuous pages.
+func (p *layoutPlanner) place(page, element int, bottom float64, data map[string]interface{}, draw func(pdf *fpdf.Fpdf, data map[string]interface{}) error) {
+	p.placements = append(p.placements, placement{page: page, element: element, bottom: bottom, data: data, draw: draw})
+}
+
+// fail records an element that could not be laid out
+func (p *layoutPlanner) fail(element int, err error) {
+	p.failures = append(p.failures, elementFailure{element: element, err: err})
+}
+
+// loopRows returns the data for each row of a loop: the request data plus the
+// fields of the current item. Nested loops such as "orders[].lines[].sku" have
+// one row per inner item, carrying the fields of the outer items as well.
+func loopRows(element models.PDFElement, data map[string]interface{}) ([]loopRow, error) {
+	arrays, _ := element.LoopPath()
+	rows := []loopRow{{data: data}}
+
+	for depth, arrayPath := range arrays {
+		var next []loopRow
+		for _, row := range rows {
+			items, err := arrayItems(row.data, arrayPath)
+			if err != nil {
+				if depth > 0 && errors.Is(err, errArrayNotFound) {
+					continue // an outer item without the inner array has no rows
+				}
+				return nil, err
+			}
+			for _, item := range items {
+				next = append(next, loopRow{data: itemData(row.data, item), item: item})
+			}
+		}
+		rows = next
+	}
+
+	return rows, nil
+}
+
+// loopRow is the data for one row of a loop and the item it was built from
+type loopRow struct {
+	data map[string]interface{}
+	item interface{}
+}
+
+// errArrayNotFound is returned when a loop or table array is missing from the data
+var errArrayNotFound = errors.New("array field not found")
+
+// arrayItems resolves the array at path
+func arrayItems(data map[string]interface{}, path string) ([]interface{}, error) {
+	arrayData, ok := utils.ResolvePath(data, path)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errArrayNotFound, path)
+	}
+
+	items, isArray := utils.ToSlice(arrayData)
+	if !isArray {
+		if _, isMap := arrayData.(map[string]interface{}); isMap {
+			return nil, fmt.Errorf("field is not an array: %s (mark nested arrays with [], as in %s.items[].name)", path, path)
+		}
+		return nil, fmt.Errorf("field is not an array: %s", path)
+	}
+
+	return items, nil
+}
+
+// tableItems returns the array a table element renders
+func tableItems(element models.PDFElement, data map[string]interface{}) ([]interface{}, error) {
+	return arrayItems(data, element.VariableName)
+}
+
+// itemField returns the text of a field of an array item. An empty path
+// returns the item itself. Table columns may apply filters to the field, as
+// in "amount|currency:INR"; if a filter fails the plain value is used.
+func itemField(item interface{}, path string) string {
+	if path == "" {
+		return utils.FormatValue(item)
+	}
+	fields, isMap := item.(map[string]interface{})
+	if !isMap {
+		return ""
+	}
+	if !strings.Contains(path, "|") {
+		value, _ := utils.ResolveString(fields, path)
+		return value
+	}
+
+	placeholder, err := utils.ParsePlaceholder(path)
+	if err != nil {
+		utils.LogWarn("Invalid field %q: %v", path, err)
+		return ""
+	}
+	value, _ := utils.ResolvePath(fields, placeholder.Path)
+	filtered, err := placeholder.Apply(value, utils.GetFilterRegistry())
+	if err != nil {
+		utils.LogWarn("Field %q: %v", path, err)
+		return utils.FormatValue(value)
+	}
+	return utils.FormatValue(filtered)
+}
+
+// copyData returns a shallow copy of the request data
+func copyData(data map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(data)+2)
+	for k, v := range data {
+		copied[k] = v
+	}
+	return copied
+}
+
+// itemData returns a copy of data with the fields of a loop item added
+func itemData(data map[string]interface{}, item interface{}) map[string]interface{} {
+	row := copyData(data)
+	if fields, isMap := item.(map[string]interface{}); isMap {
+		for k, v := range fields {
+			row[k] = v
+		}
+	}
+	return row
+}
+
+// loopRowData returns the data an element draws for one loop row, with the
+// loop field itself set under its full key, such as "items.description"
+func loopRowData(element models.PDFElement, row loopRow) map[string]interface{} {
+	rowData := copyData(row.data)
+	if _, field := element.LoopPath(); field != "" || strings.HasSuffix(element.LoopField, "[]") {
+		rowData[element.LoopField] = itemField(row.item, field)
+	}
+	return rowData
+}
@@ -0,0 +1,276 @@
+package generators
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// planA4 lays out elements on an A4 page with 10mm margins
+func planA4(elements []models.PDFElement, data map[string]interface{}) *layoutPlanner {
+	regions := newPageRegions(elements)
+	planner := &layoutPlanner{
+		g:          NewPDFGenerator(GeneratorConfig{}),
+		elements:   elements,
+		data:       data,
+		topMargin:  math.Max(10, regions.headerBottom),
+		margins:    models.Margins{Top: 10, Bottom: 10, Left: 10, Right: 10},
+		rowSpacing: loopRowSpacing,
+		footerTop:  regions.footerTop,
+		done:       regions.members,
+		ends:       make(map[string]flowEnd),
+	}
+	planner.startPage(1, pageFormat{width: 210, height: 297})
+	planner.plan()
+	return planner
+}
+
+// items returns n loop rows
+func items(n int) []interface{} {
+	rows := make([]interface{}, n)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"name": "item"}
+	}
+	return rows
+}
+
+// pagesOf returns the page of every placement of the element at index
+func pagesOf(planner *layoutPlanner, index int) []int {
+	var pages []int
+	for _, p := range planner.placements {
+		if p.element == index {
+			pages = append(pages, p.page)
+		}
+	}
+	return pages
+}
+
+func loopElement(y, height float64) models.PDFElement {
+	return models.PDFElement{
+		Type:      models.ElementTypeText,
+		Method:    "Cell",
+		Text:      "{{name}}",
+		LoopField: "items.name",
+		Position:  models.Position{X: 10, Y: y},
+		Size:      models.Size{Width: 50, Height: height},
+	}
+}
+
+func tableElement(height float64) models.PDFElement {
+	return models.PDFElement{
+		Type:         models.ElementTypeTable,
+		VariableName: "items",
+		Position:     models.Position{X: 10, Y: 20},
+		Size:         models.Size{Width: 100, Height: height},
+		Columns:      []models.TableColumn{{Field: "name", Width: 100}},
+	}
+}
+
+func TestPlanTableRejectsNonPositiveRowHeight(t *testing.T) {
+	for _, height := range []float64{0, -6, math.NaN()} {
+		planner := planA4([]models.PDFElement{tableElement(height)}, map[string]interface{}{"items": items(3)})
+
+		if len(planner.failures) != 1 {
+			t.Errorf("height %v: got %d failures, want 1", height, len(planner.failures))
+		}
+		if len(planner.placements) != 0 {
+			t.Errorf("height %v: got %d placements, want none", height, len(planner.placements))
+		}
+	}
+}
+
+func TestPlanTableBreaksPages(t *testing.T) {
+	// 267mm below y=20 leaves room for a header and 43 rows of 6mm
+	planner := planA4([]models.PDFElement{tableElement(6)}, map[string]interface{}{"items": items(50)})
+
+	if len(planner.failures) != 0 {
+		t.Fatalf("unexpected failures: %v", planner.failures)
+	}
+	if got := pagesOf(planner, 0); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("table chunks on pages %v, want [1 2]", got)
+	}
+}
+
+func TestPlanLoopMovesFirstRowThatDoesNotFit(t *testing.T) {
+	// The page ends at 287mm, so a 10mm row at 280mm overflows
+	planner := planA4([]models.PDFElement{loopElement(280, 10)}, map[string]interface{}{"items": items(2)})
+
+	got := pagesOf(planner, 0)
+	if len(got) != 2 || got[0] != 2 || got[1] != 2 {
+		t.Errorf("loop rows on pages %v, want [2 2]", got)
+	}
+}
+
+func TestPlanLoopBreaksAfterRowsThatFit(t *testing.T) {
+	// Rows are 8mm apart (6mm plus 2mm spacing): 270 and 278 fit, 286 doesn't
+	planner := planA4([]models.PDFElement{loopElement(270, 6)}, map[string]interface{}{"items": items(4)})
+
+	got := pagesOf(planner, 0)
+	want := []int{1, 1, 2, 2}
+	if len(got) != len(want) {
+		t.Fatalf("loop rows on pages %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("loop rows on pages %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPlanLoopPlacesRowTallerThanPage(t *testing.T) {
+	// A row that can never fit is drawn once per page instead of paging forever
+	planner := planA4([]models.PDFElement{loopElement(20, 400)}, map[string]interface{}{"items": items(2)})
+
+	got := pagesOf(planner, 0)
+	if len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("loop rows on pages %v, want [2 3]", got)
+	}
+}
+
+// anchored returns a text element of the given height anchored to after
+func anchored(id, after string, gap, height float64) models.PDFElement {
+	return models.PDFElement{
+		ID:       id,
+		Type:     models.ElementTypeText,
+		Method:   "Cell",
+		Text:     id,
+		Position: models.Position{X: 10, After: after, Gap: gap},
+		Size:     models.Size{Width: 50, Height: height},
+	}
+}
+
+func TestPlanFlowAnchors(t *testing.T) {
+	fixed := loopElement(60, 6)
+	fixed.ID = "fixed"
+	fixed.LoopField = ""
+	elements := []models.PDFElement{
+		loopElement(50, 6),
+		// Rows take 8mm, so three rows end at 74mm, past this element at 60mm
+		fixed,
+		anchored("subtotal", "items", 4, 8),
+		anchored("tax", "subtotal", 2, 6),
+		anchored("total", models.AnchorPrevious, 1, 6),
+		anchored("unknown", "totals", 0, 6),
+	}
+	planner := planA4(elements, map[string]interface{}{"items": items(3)})
+
+	tests := []struct {
+		name string
+		want float64
+	}{
+		{"items", 74},
+		{"fixed", 80},
+		{"subtotal", 86},
+		{"tax", 94},
+		{"total", 101},
+	}
+	for _, tt := range tests {
+		if got := planner.ends[tt.name]; got.page != 1 || got.y != tt.want {
+			t.Errorf("%s ended at %+v, want page 1 at %v", tt.name, got, tt.want)
+		}
+	}
+	if len(planner.failures) != 1 || planner.failures[0].element != 5 {
+		t.Errorf("failures = %v, want the unknown anchor of element 5", planner.failures)
+	}
+}
+
+func TestPlanFlowAnchorsFollowPageBreaks(t *testing.T) {
+	// 40 rows of 8mm from 50mm break onto a second page, which starts at the
+	// 10mm top margin; the anchored element follows the last row there
+	elements := []models.PDFElement{loopElement(50, 6), anchored("total", "items", 4, 6)}
+	planner := planA4(elements, map[string]interface{}{"items": items(40)})
+
+	if got := pagesOf(planner, 1); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("anchored element on pages %v, want [2]", got)
+	}
+	if rows, total := planner.ends["items"], planner.ends["total"]; total.y != rows.y+4+6 {
+		t.Errorf("anchored element ended at %v, want %v", total.y, rows.y+4+6)
+	}
+}
+
+func TestLoopRows(t *testing.T) {
+	data := map[string]interface{}{
+		"invoiceNumber": "INV-1",
+		"items":         []interface{}{map[string]interface{}{"name": "Pen"}, map[string]interface{}{"name": "Ink"}},
+		"orders": []interface{}{
+			map[string]interface{}{"order": "A", "lines": []interface{}{
+				map[string]interface{}{"sku": "A1"},
+				map[string]interface{}{"sku": "A2"},
+			}},
+			map[string]interface{}{"order": "B"},
+			map[string]interface{}{"order": "C", "lines": []interface{}{
+				map[string]interface{}{"sku": "C1"},
+			}},
+		},
+		"shipment": map[string]interface{}{
+			"packages": []interface{}{map[string]interface{}{"weight": 2.5}},
+		},
+		"customer": map[string]interface{}{"name": "Acme"},
+	}
+
+	tests := []struct {
+		loopField string
+		// outer is a field of the request or outer item shown with each row
+		outer string
+		want  []string
+	}{
+		{"items.name", "invoiceNumber", []string{"INV-1 Pen", "INV-1 Ink"}},
+		{"shipment.packages[].weight", "invoiceNumber", []string{"INV-1 2.5"}},
+		// Outer items without the inner array have no rows
+		{"orders[].lines[].sku", "order", []string{"A A1", "A A2", "C C1"}},
+	}
+	for _, tt := range tests {
+		element := models.PDFElement{LoopField: tt.loopField}
+		rows, err := loopRows(element, data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.loopField, err)
+			continue
+		}
+		var got []string
+		for _, row := range rows {
+			rowData := loopRowData(element, row)
+			got = append(got, utils.FormatValue(rowData[tt.outer])+" "+utils.FormatValue(rowData[tt.loopField]))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: rows = %q, want %q", tt.loopField, got, tt.want)
+		}
+	}
+
+	for _, loopField := range []string{"missing.name", "customer.name", "customer[].name"} {
+		if _, err := loopRows(models.PDFElement{LoopField: loopField}, data); err == nil {
+			t.Errorf("%s: loopRows succeeded without an array", loopField)
+		}
+	}
+}
+
+func TestItemField(t *testing.T) {
+	item := map[string]interface{}{
+		"name":  "pen",
+		"price": 1250,
+		"tax":   map[string]interface{}{"rate": 18},
+	}
+	tests := []struct {
+		item interface{}
+		path string
+		want string
+	}{
+		{item, "name", "pen"},
+		{item, "tax.rate", "18"},
+		{item, "missing", ""},
+		{item, "name|upper", "PEN"},
+		{item, "price|currency:INR", "₹1,250.00"},
+		{item, `price|currency:INR:"Rs. "`, "Rs. 1,250.00"},
+		// A failing filter falls back to the plain value
+		{item, "name|number", "pen"},
+		{"plain", "", "plain"},
+		{"plain", "name", ""},
+	}
+	for _, tt := range tests {
+		if got := itemField(tt.item, tt.path); got != tt.want {
+			t.Errorf("itemField(%v, %q) = %q, want %q", tt.item, tt.path, got, tt.want)
+		}
+	}
+}
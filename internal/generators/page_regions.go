@@ -0,0 +1,183 @@
+package generators
+
+import (
+	"math"
+
+	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// pageRegions groups the elements that are drawn outside the body flow
+type pageRegions struct {
+	elements []models.PDFElement
+	// headers, footers, firstPage and lastPage hold the indexes of each
+	// region's elements
+	headers   []int
+	footers   []int
+	firstPage []int
+	lastPage  []int
+
+	// members holds the indexes of region elements so the planner skips them
+	members map[int]bool
+	// headerBottom and footerTop bound the space left for body content
+	headerBottom float64
+	footerTop    float64
+}
+
+// newPageRegions collects the header, footer, first-page and last-page elements
+func newPageRegions(elements []models.PDFElement) pageRegions {
+	regions := pageRegions{
+		elements:  elements,
+		members:   make(map[int]bool),
+		footerTop: math.Inf(1),
+	}
+
+	for i, element := range elements {
+		switch element.Region {
+		case models.RegionHeader:
+			regions.headers = append(regions.headers, i)
+			regions.headerBottom = math.Max(regions.headerBottom, element.Position.Y+element.Size.Height)
+		case models.RegionFooter:
+			regions.footers = append(regions.footers, i)
+			regions.footerTop = math.Min(regions.footerTop, element.Position.Y)
+		case models.RegionFirstPageOnly:
+			regions.firstPage = append(regions.firstPage, i)
+		case models.RegionLastPageOnly:
+			regions.lastPage = append(regions.lastPage, i)
+		default:
+			continue
+		}
+		regions.members[i] = true
+	}
+
+	return regions
+}
+
+// regionHooks draws the page regions from fpdf's header and footer hooks. A
+// merged batch draws several documents into one PDF, each with its own
+// regions and page numbers, so the hooks look up the document a page belongs to.
+type regionHooks struct {
+	documents []*regionDocument
+}
+
+// regionDocument draws the regions of a document on its range of physical
+// pages and collects the region elements that failed to draw
+type regionDocument struct {
+	firstPage, lastPage int
+	header, footer      func(page int)
+	errors              []ElementError
+	// lastFooterDrawn is set once finish has drawn the footer of the last page
+	lastFooterDrawn bool
+}
+
+// finish draws the footer of the document's last page, which fpdf would
+// only draw once the next page is added or the PDF is closed, and returns
+// the region elements that failed to draw
+func (d *regionDocument) finish() []ElementError {
+	if d.lastPage >= d.firstPage {
+		d.footer(d.lastPage - d.firstPage + 1)
+	}
+	return d.errors
+}
+
+// install sets the document's header and footer hooks
+func (h *regionHooks) install(pdf *fpdf.Fpdf) {
+	pdf.SetHeaderFunc(func() {
+		if document, page, ok := h.lookup(pdf.PageNo()); ok {
+			document.header(page)
+		}
+	})
+	pdf.SetFooterFunc(func() {
+		if document, page, ok := h.lookup(pdf.PageNo()); ok {
+			document.footer(page)
+		}
+	})
+}
+
+// lookup returns the document a physical page belongs to and the page's
+// number within it
+func (h *regionHooks) lookup(physicalPage int) (*regionDocument, int, bool) {
+	for _, document := range h.documents {
+		if physicalPage >= document.firstPage && physicalPage <= document.lastPage {
+			return document, physicalPage - document.firstPage + 1, true
+		}
+	}
+	return nil, 0, false
+}
+
+// setPageRegionHooks registers the region elements of a document whose pages
+// follow the first pages already in the PDF. templatePages maps each of its
+// pages to its template page, and footerOffsets holds how far the footer of
+// each continuous page moves down. The document's finish must be called once
+// its last page is drawn.
+func (g *PDFGenerator) setPageRegionHooks(pdf *fpdf.Fpdf, hooks *regionHooks, regions pageRegions, data map[string]interface{}, firstPage, totalPages int, templatePages []int, footerOffsets []float64) *regionDocument {
+	templatePage := func(page int) int {
+		if page >= 1 && page <= len(templatePages) {
+			return templatePages[page-1]
+		}
+		return 1
+	}
+	footerOffset := func(page int) float64 {
+		if page >= 1 && page <= len(footerOffsets) {
+			return footerOffsets[page-1]
+		}
+		return 0
+	}
+
+	document := &regionDocument{
+		firstPage: firstPage + 1,
+		lastPage:  firstPage + totalPages,
+	}
+	document.header = func(page int) {
+		document.errors = append(document.errors, g.drawRegion(pdf, models.RegionHeader, regions, regions.headers, data, page, totalPages, templatePage(page), 0)...)
+		if page == 1 {
+			document.errors = append(document.errors, g.drawRegion(pdf, models.RegionFirstPageOnly, regions, regions.firstPage, data, page, totalPages, templatePage(page), 0)...)
+		}
+	}
+	document.footer = func(page int) {
+		if page == totalPages {
+			if document.lastFooterDrawn {
+				return
+			}
+			document.lastFooterDrawn = true
+			document.errors = append(document.errors, g.drawRegion(pdf, models.RegionLastPageOnly, regions, regions.lastPage, data, page, totalPages, templatePage(page), 0)...)
+		}
+		document.errors = append(document.errors, g.drawRegion(pdf, models.RegionFooter, regions, regions.footers, data, page, totalPages, templatePage(page), footerOffset(page))...)
+	}
+	hooks.documents = append(hooks.documents, document)
+	return document
+}
+
+// drawRegion draws the region elements at indexes with the page number
+// variables set, moved down by offset, and returns those that failed.
+// Elements limited to another template page are skipped.
+func (g *PDFGenerator) drawRegion(pdf *fpdf.Fpdf, region models.PageRegion, regions pageRegions, indexes []int, data map[string]interface{}, page, totalPages, templatePage int, offset float64) []ElementError {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	pageData := copyData(data)
+	setPageVariables(pageData, page, totalPages)
+
+	var elementErrors []ElementError
+	for _, i := range indexes {
+		element := regions.elements[i]
+		if element.Page > 0 && element.Page != templatePage {
+			continue
+		}
+		element.Position.Y += offset
+		if err := g.processElement(pdf, element, pageData); err != nil {
+			utils.LogError("Error processing %s element %d on page %d: %v", region, i+1, page, err)
+			elementErrors = append(elementErrors, newElementError(regions.elements, i, err))
+		}
+	}
+	return elementErrors
+}
+
+// setPageVariables sets {{pageNumber}} and {{totalPages}} for the page being drawn
+func setPageVariables(data map[string]interface{}, page, totalPages int) {
+	data[models.PageNumberVariable] = page
+	data[models.TotalPagesVariable] = totalPages
+}
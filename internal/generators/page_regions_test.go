@@ -0,0 +1,189 @@
+package generators
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// renderContent renders elements into an uncompressed document and returns
+// its output, so that tests can read the text of core fonts
+func renderContent(t *testing.T, elements []models.PDFElement, data map[string]interface{}) string {
+	t.Helper()
+	g := NewPDFGenerator(GeneratorConfig{FontDir: "../../fonts"})
+	pdf, layout, err := g.newDocument(models.Settings(elements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf.SetCompression(false)
+	g.renderElements(pdf, elements, data, layout)
+	return contentOf(t, pdf)
+}
+
+// regionText returns a Helvetica text element in region
+func regionText(region models.PageRegion, text string, y float64) models.PDFElement {
+	return models.PDFElement{
+		Type:     models.ElementTypeText,
+		Method:   "Cell",
+		Text:     text,
+		Region:   region,
+		Position: models.Position{X: 10, Y: y},
+		Size:     models.Size{Width: 80, Height: 10},
+		Style:    models.Style{Font: models.Font{Family: "Helvetica", Size: 10}},
+	}
+}
+
+func TestPageRegions(t *testing.T) {
+	rows := loopElement(30, 6)
+	rows.Style.Font.Family = "Helvetica"
+	elements := []models.PDFElement{
+		regionText(models.RegionHeader, "Acme Ltd", 10),
+		regionText(models.RegionFooter, "Page {{pageNumber}} of {{totalPages}}", 280),
+		regionText(models.RegionFirstPageOnly, "Tax Invoice", 20),
+		regionText(models.RegionLastPageOnly, "Authorised Signatory", 260),
+		rows,
+	}
+	// 40 rows of 8mm need two pages between the header and the footer
+	content := renderContent(t, elements, map[string]interface{}{"items": items(40)})
+
+	tests := []struct {
+		text  string
+		count int
+	}{
+		{"(Acme Ltd)Tj", 2},
+		{"(Page 1 of 2)Tj", 1},
+		{"(Page 2 of 2)Tj", 1},
+		{"(Tax Invoice)Tj", 1},
+		{"(Authorised Signatory)Tj", 1},
+		{"(item)Tj", 40},
+	}
+	for _, tt := range tests {
+		if got := strings.Count(content, tt.text); got != tt.count {
+			t.Errorf("%s drawn %d times, want %d", tt.text, got, tt.count)
+		}
+	}
+	// The first page's header comes before its first row and the last page's
+	// signature after the last row
+	if strings.Index(content, "(Tax Invoice)Tj") > strings.Index(content, "(item)Tj") ||
+		strings.LastIndex(content, "(Authorised Signatory)Tj") < strings.LastIndex(content, "(item)Tj") {
+		t.Error("first and last page elements are out of place")
+	}
+}
+
+func TestPlanBetweenHeaderAndFooter(t *testing.T) {
+	elements := []models.PDFElement{
+		regionText(models.RegionHeader, "Acme Ltd", 10),
+		regionText(models.RegionFooter, "Page {{pageNumber}}", 270),
+		loopElement(30, 6),
+	}
+	planner := planA4(elements, map[string]interface{}{"items": items(40)})
+
+	// Region elements are drawn by the page hooks, not the planner
+	if len(pagesOf(planner, 0)) != 0 || len(pagesOf(planner, 1)) != 0 {
+		t.Error("region elements were laid out as body elements")
+	}
+	// Rows stop above the footer at 270mm and continue below the header,
+	// which ends at 20mm
+	if planner.pageLimit != 270 || planner.topMargin != 20 {
+		t.Errorf("body runs from %.1f to %.1f, want 20 to 270", planner.topMargin, planner.pageLimit)
+	}
+	if pages := pagesOf(planner, 2); pages[len(pages)-1] != 2 {
+		t.Errorf("rows end on page %d, want 2", pages[len(pages)-1])
+	}
+}
+
+// regionElements returns a body text and a QR code in region, which fails
+// for an empty code
+func regionElements(region models.PageRegion) []models.PDFElement {
+	return []models.PDFElement{
+		{
+			Type:     models.ElementTypeText,
+			Method:   "Cell",
+			Text:     "Invoice",
+			Position: models.Position{X: 10, Y: 100},
+			Size:     models.Size{Width: 50, Height: 8},
+		},
+		{
+			ID:        "code",
+			Type:      models.ElementTypeQR,
+			QRContent: "{{code}}",
+			Region:    region,
+			Position:  models.Position{X: 10, Y: 270},
+			Size:      models.Size{Width: 20, Height: 20},
+		},
+	}
+}
+
+func TestRegionErrorsFollowTheErrorPolicy(t *testing.T) {
+	g := newTestGenerator()
+	failing := map[string]interface{}{"code": ""}
+	regions := []models.PageRegion{models.RegionHeader, models.RegionFooter, models.RegionFirstPageOnly, models.RegionLastPageOnly}
+
+	for _, region := range regions {
+		elements := regionElements(region)
+		if region == models.RegionHeader || region == models.RegionFirstPageOnly {
+			elements[1].Position.Y = 5
+		}
+
+		pdf, _, err := g.GeneratePDFToBytesWithOptions(elements, failing, GenerateOptions{ErrorPolicy: ErrorPolicyStrict})
+		var renderErr *RenderError
+		if !errors.As(err, &renderErr) || pdf != nil {
+			t.Errorf("%s, strict: error = %v with %d bytes, want a RenderError and no PDF", region, err, len(pdf))
+		} else if len(renderErr.Elements) != 1 || renderErr.Elements[0].Element != 2 || renderErr.Elements[0].ID != "code" {
+			t.Errorf("%s, strict: failed elements = %+v, want element 2", region, renderErr.Elements)
+		}
+
+		pdf, warnings, err := g.GeneratePDFToBytesWithOptions(elements, failing, GenerateOptions{ErrorPolicy: ErrorPolicyReport})
+		if err != nil || len(pdf) == 0 {
+			t.Errorf("%s, report: %v", region, err)
+		}
+		if len(warnings) != 1 || warnings[0].Element != 2 {
+			t.Errorf("%s, report: warnings = %+v, want element 2", region, warnings)
+		}
+
+		if _, warnings, err := g.GeneratePDFToBytesWithOptions(elements, map[string]interface{}{"code": "INV-1"}, GenerateOptions{ErrorPolicy: ErrorPolicyStrict}); err != nil || len(warnings) != 0 {
+			t.Errorf("%s with a code: %v, warnings %+v", region, err, warnings)
+		}
+	}
+}
+
+func TestRegionErrorsOnEveryPage(t *testing.T) {
+	g := newTestGenerator()
+	elements := regionElements(models.RegionFooter)
+	elements = append(elements, models.PDFElement{
+		Type:     models.ElementTypeText,
+		Method:   "Cell",
+		Text:     "Terms",
+		Page:     2,
+		Position: models.Position{X: 10, Y: 20},
+		Size:     models.Size{Width: 50, Height: 8},
+	})
+
+	// The footer fails on both pages, the last one being drawn at the end
+	_, warnings, err := g.GeneratePDFToBytesWithOptions(elements, map[string]interface{}{"code": ""}, GenerateOptions{ErrorPolicy: ErrorPolicyReport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("warnings = %+v, want the footer of both pages", warnings)
+	}
+}
+
+func TestMergedBatchRegionErrorsBelongToTheirRecord(t *testing.T) {
+	g := newTestGenerator()
+	records := []map[string]interface{}{{"code": "INV-1"}, {"code": ""}, {"code": "INV-3"}}
+	options := BatchOptions{GenerateOptions: GenerateOptions{ErrorPolicy: ErrorPolicyStrict}}
+
+	pdf, results, err := g.GenerateMergedBatch(context.Background(), regionElements(models.RegionFooter), records, options)
+	if err != nil || len(pdf) == 0 {
+		t.Fatalf("GenerateMergedBatch: %v", err)
+	}
+	for i, result := range results {
+		if failed := result.Err != nil; failed != (i == 1) {
+			t.Errorf("record %d: error = %v", i+1, result.Err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package generators
+
+import (
+	"sort"
+
+	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// pageFormat is the size of a physical page in the document's unit
+type pageFormat struct {
+	width, height float64
+}
+
+// addPage adds a page of this size to the document
+func (f pageFormat) addPage(pdf *fpdf.Fpdf) {
+	if f.width > f.height {
+		pdf.AddPageFormat("L", fpdf.SizeType{Wd: f.height, Ht: f.width})
+		return
+	}
+	pdf.AddPageFormat("P", fpdf.SizeType{Wd: f.width, Ht: f.height})
+}
+
+// templatePageInfo is a page of the template with its settings
+type templatePageInfo struct {
+	number   int
+	settings models.PageSettings
+}
+
+// templatePages returns the pages a template uses, in order. Header and
+// footer elements only add their page if they are limited to one. A template
+// without elements still has one page.
+func templatePages(elements []models.PDFElement, regionMembers map[int]bool) []templatePageInfo {
+	settings := make(map[int]models.PageSettings)
+	used := make(map[int]bool)
+
+	for i, element := range elements {
+		switch {
+		case element.Type == models.ElementTypePage:
+			settings[element.PageNumber()] = element.PageSetup
+			used[element.PageNumber()] = true
+		case element.Type == models.ElementTypeComputed, element.Type == models.ElementTypeSettings, element.IsComposition():
+			continue
+		case regionMembers[i]:
+			if element.Page > 0 {
+				used[element.Page] = true
+			}
+		default:
+			used[element.PageNumber()] = true
+		}
+	}
+	if len(used) == 0 {
+		used[1] = true
+	}
+
+	pages := make([]templatePageInfo, 0, len(used))
+	for number := range used {
+		pages = append(pages, templatePageInfo{number: number, settings: settings[number]})
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].number < pages[j].number
+	})
+	return pages
+}
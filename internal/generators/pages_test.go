@@ -0,0 +1,137 @@
+package generators
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/models"
+)
+
+func TestTemplatePages(t *testing.T) {
+	a5 := models.PageSettings{Size: "A5", Orientation: "L"}
+	tests := []struct {
+		name     string
+		elements []models.PDFElement
+		regions  map[int]bool
+		want     []templatePageInfo
+	}{
+		{"no elements", nil, nil, []templatePageInfo{{number: 1}}},
+		{
+			"pages in order",
+			[]models.PDFElement{{Page: 3}, {}, {Type: models.ElementTypePage, Page: 2, PageSetup: a5}},
+			nil,
+			[]templatePageInfo{{number: 1}, {number: 2, settings: a5}, {number: 3}},
+		},
+		{
+			// Headers only add the page they are limited to
+			"regions",
+			[]models.PDFElement{{Region: models.RegionHeader}, {Region: models.RegionFooter, Page: 2}},
+			map[int]bool{0: true, 1: true},
+			[]templatePageInfo{{number: 2}},
+		},
+		{
+			"computed fields",
+			[]models.PDFElement{{Type: models.ElementTypeComputed, Page: 4}, {Page: 2}},
+			nil,
+			[]templatePageInfo{{number: 2}},
+		},
+	}
+	for _, tt := range tests {
+		if got := templatePages(tt.elements, tt.regions); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: pages = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// renderPages renders elements and returns the document and its output
+func renderPages(t *testing.T, elements []models.PDFElement, data map[string]interface{}) (*fpdf.Fpdf, string) {
+	t.Helper()
+	g := NewPDFGenerator(GeneratorConfig{FontDir: "../../fonts"})
+	pdf, layout, err := g.newDocument(models.Settings(elements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf.SetCompression(false)
+	if elementErrors := g.renderElements(pdf, elements, data, layout); len(elementErrors) != 0 {
+		t.Fatalf("element errors: %+v", elementErrors)
+	}
+	return pdf, contentOf(t, pdf)
+}
+
+func TestMultiPageTemplate(t *testing.T) {
+	rows := loopElement(30, 6)
+	rows.Style.Font.Family = "Helvetica"
+	terms := regionText("", "Terms", 20)
+	terms.Page = 2
+	annexure := regionText("", "Annexure", 20)
+	annexure.Page = 3
+	annexureHeader := regionText(models.RegionHeader, "Annexure header", 5)
+	annexureHeader.Page = 3
+
+	elements := []models.PDFElement{
+		regionText(models.RegionHeader, "Acme Ltd", 5),
+		rows,
+		terms,
+		{Type: models.ElementTypePage, Page: 3, PageSetup: models.PageSettings{Size: "A5", Orientation: "landscape"}},
+		annexure,
+		annexureHeader,
+	}
+	// 50 rows of 6mm flow onto a second page before the terms page
+	pdf, content := renderPages(t, elements, map[string]interface{}{"items": items(50)})
+
+	sizes := [][2]float64{{210, 297}, {210, 297}, {210, 297}, {210, 148.5}}
+	if pdf.PageCount() != len(sizes) {
+		t.Fatalf("got %d pages, want %d", pdf.PageCount(), len(sizes))
+	}
+	for i, size := range sizes {
+		width, height, _ := pdf.PageSize(i + 1)
+		if math.Abs(width-size[0]) > 0.1 || math.Abs(height-size[1]) > 0.1 {
+			t.Errorf("page %d is %.1f x %.1f, want %.1f x %.1f", i+1, width, height, size[0], size[1])
+		}
+	}
+
+	// Headers without a page repeat on every page, those with one only on it
+	tests := []struct {
+		text  string
+		count int
+	}{
+		{"(Acme Ltd)Tj", 4},
+		{"(Annexure header)Tj", 1},
+		{"(item)Tj", 50},
+		{"(Terms)Tj", 1},
+		{"(Annexure)Tj", 1},
+	}
+	for _, tt := range tests {
+		if got := strings.Count(content, tt.text); got != tt.count {
+			t.Errorf("%s drawn %d times, want %d", tt.text, got, tt.count)
+		}
+	}
+	if strings.LastIndex(content, "(item)Tj") > strings.Index(content, "(Terms)Tj") ||
+		strings.Index(content, "(Terms)Tj") > strings.Index(content, "(Annexure)Tj") {
+		t.Error("pages are drawn out of order")
+	}
+}
+
+func TestContinuationPagesKeepTheirSize(t *testing.T) {
+	rows := loopElement(30, 6)
+	rows.Page = 2
+	elements := []models.PDFElement{
+		regionText("", "Invoice", 20),
+		{Type: models.ElementTypePage, Page: 2, PageSetup: models.PageSettings{Width: 100, Height: 150}},
+		rows,
+	}
+	pdf, _ := renderPages(t, elements, map[string]interface{}{"items": items(40)})
+
+	if pdf.PageCount() < 3 {
+		t.Fatalf("got %d pages, want the rows to continue on a third page", pdf.PageCount())
+	}
+	for page := 2; page <= pdf.PageCount(); page++ {
+		if width, height, _ := pdf.PageSize(page); math.Abs(width-100) > 0.1 || math.Abs(height-150) > 0.1 {
+			t.Errorf("page %d is %.1f x %.1f, want 100 x 150", page, width, height)
+		}
+	}
+}
@@ -8,8 +8,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/boombuler/barcode"
 	"github.com/boombuler/barcode/code128"
@@ -26,11 +24,9 @@ import (
 
 // PDFGenerator handles PDF generation with enhanced features
 type PDFGenerator struct {
-	fontCache      *cache.FontCache
-	tempDir        string
-	pdfPool        sync.Pool
-	lastYPositions map[string]float64
-	mu             sync.RWMutex
+	config    GeneratorConfig
+	fontCache *cache.FontCache
+	tempDir   string
 }
 
 // GeneratorConfig contains configuration for the PDF generator
@@ -40,10 +36,27 @@ type GeneratorConfig struct {
 	DefaultFont string
 	PageSize    string
 	Orientation string
+	// Unit is the measurement unit of templates without settings: mm, cm, in or pt
+	Unit string
+
+	// ImageDir, if set, is the directory image paths are resolved in; images
+	// outside it can't be used
+	ImageDir string
+
+	// TopMargin is where loops and tables continue on a new page
+	TopMargin float64
+	// BottomMargin is the space kept free below loops and tables before breaking
+	BottomMargin float64
+
+	// ErrorPolicy decides what happens to elements that fail to draw
+	ErrorPolicy ErrorPolicy
 }
 
 // NewPDFGenerator creates a new PDF generator with configuration
 func NewPDFGenerator(config GeneratorConfig) *PDFGenerator {
+	if config.FontDir == "" {
+		config.FontDir = "./fonts"
+	}
 	if config.TempDir == "" {
 		config.TempDir = os.TempDir()
 	}
@@ -56,20 +69,23 @@ func NewPDFGenerator(config GeneratorConfig) *PDFGenerator {
 	if config.Orientation == "" {
 		config.Orientation = "P"
 	}
-
-	generator := &PDFGenerator{
-		fontCache:      cache.GetFontCache(),
-		tempDir:        config.TempDir,
-		lastYPositions: make(map[string]float64),
+	if config.Unit = models.NormalizeUnit(config.Unit); config.Unit == "" {
+		config.Unit = "mm"
+	}
+	if config.TopMargin == 0 {
+		config.TopMargin = 10
+	}
+	if config.BottomMargin == 0 {
+		config.BottomMargin = 10
+	}
+	if config.ErrorPolicy == "" {
+		config.ErrorPolicy = ErrorPolicyLenient
 	}
 
-	// Initialize PDF object pool for better performance
-	generator.pdfPool = sync.Pool{
-		New: func() interface{} {
-			pdf := fpdf.New(config.Orientation, "mm", config.PageSize, config.FontDir)
-			generator.setupFonts(pdf)
-			return pdf
-		},
+	generator := &PDFGenerator{
+		config:    config,
+		fontCache: cache.GetFontCacheFor(config.FontDir),
+		tempDir:   config.TempDir,
 	}
 
 	return generator
@@ -77,64 +93,79 @@ func NewPDFGenerator(config GeneratorConfig) *PDFGenerator {
 
 // GeneratePDF generates a PDF from elements and data
 func (g *PDFGenerator) GeneratePDF(elements []models.PDFElement, data map[string]interface{}, outputFile string) error {
-	// Get PDF instance from pool
-	pdf := g.pdfPool.Get().(*fpdf.Fpdf)
-	defer func() {
-		// Reset PDF for reuse
-		pdf = fpdf.New("P", "mm", "A4", "./fonts")
-		g.setupFonts(pdf)
-		g.pdfPool.Put(pdf)
-	}()
-
-	pdf.AddPage()
-	g.setupFonts(pdf)
-
-	utils.LogInfo("Generating PDF with %d elements", len(elements))
-
-	// Process elements
-	for i, element := range elements {
-		utils.LogDebug("Processing element %d: %s", i+1, element.Type)
+	_, err := g.GeneratePDFWithOptions(elements, data, outputFile, GenerateOptions{})
+	return err
+}
 
-		if err := g.processElement(pdf, element, data); err != nil {
-			utils.LogError("Error processing element %d: %v", i+1, err)
-			continue
-		}
+// GeneratePDFWithOptions generates a PDF file and returns the elements that
+// failed to draw. In strict mode no file is written if any element failed.
+// The options' calculators run on data first.
+func (g *PDFGenerator) GeneratePDFWithOptions(elements []models.PDFElement, data map[string]interface{}, outputFile string, options GenerateOptions) ([]ElementError, error) {
+	pdf, elementErrors, err := g.render(elements, data, options)
+	if err != nil {
+		return elementErrors, err
 	}
 
 	// Save PDF
 	utils.LogInfo("Saving PDF to: %s", outputFile)
-	return pdf.OutputFileAndClose(outputFile)
+	return elementErrors, pdf.OutputFileAndClose(outputFile)
 }
 
 // GeneratePDFToBytes generates a PDF and returns it as bytes
 func (g *PDFGenerator) GeneratePDFToBytes(elements []models.PDFElement, data map[string]interface{}) ([]byte, error) {
-	// Get PDF instance from pool
-	pdf := g.pdfPool.Get().(*fpdf.Fpdf)
-	defer g.pdfPool.Put(pdf)
-
-	pdf.AddPage()
-	g.setupFonts(pdf)
+	pdfBytes, _, err := g.GeneratePDFToBytesWithOptions(elements, data, GenerateOptions{})
+	return pdfBytes, err
+}
 
-	// Process elements
-	for _, element := range elements {
-		if err := g.processElement(pdf, element, data); err != nil {
-			utils.LogError("Error processing element: %v", err)
-			continue
-		}
+// GeneratePDFToBytesWithOptions generates a PDF as bytes and returns the
+// elements that failed to draw. In strict mode no PDF is returned if any
+// element failed. The options' calculators run on data first.
+func (g *PDFGenerator) GeneratePDFToBytesWithOptions(elements []models.PDFElement, data map[string]interface{}, options GenerateOptions) ([]byte, []ElementError, error) {
+	pdf, elementErrors, err := g.render(elements, data, options)
+	if err != nil {
+		return nil, elementErrors, err
 	}
 
 	// Output to bytes
 	var buf bytes.Buffer
-	err := pdf.Output(&buf)
-	return buf.Bytes(), err
+	err = pdf.Output(&buf)
+	return buf.Bytes(), elementErrors, err
 }
 
-// setupFonts sets up the fonts for the PDF
-func (g *PDFGenerator) setupFonts(pdf *fpdf.Fpdf) {
-	if g.fontCache.IsSystemLoaded() {
-		return
+// render runs the options' calculators on data, then lays out and draws the
+// elements on a document set up with the template's settings. In strict mode
+// it fails if any element failed.
+func (g *PDFGenerator) render(elements []models.PDFElement, data map[string]interface{}, options GenerateOptions) (*fpdf.Fpdf, []ElementError, error) {
+	data, err := Calculate(data, options.Calculators)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	settings := models.Settings(elements)
+	pdf, layout, err := g.newDocument(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	if settings.Monochrome {
+		elements = monochromeCodes(elements)
+	}
+	elements = compileConditions(elements)
+
+	utils.LogInfo("Generating PDF with %d elements", len(elements))
+
+	// Lay out and draw elements
+	elementErrors := g.renderElements(pdf, elements, data, layout)
+	if len(elementErrors) > 0 && g.ErrorPolicy(options) == ErrorPolicyStrict {
+		return nil, elementErrors, &RenderError{Elements: elementErrors}
+	}
+	return pdf, elementErrors, nil
+}
+
+// setupFonts sets up the fonts for the PDF. The font cache remembers which
+// font files exist, but the fonts must be added to every new document.
+func (g *PDFGenerator) setupFonts(pdf *fpdf.Fpdf) {
+	checked := g.fontCache.IsSystemLoaded()
+
 	// Add UTF8 fonts
 	fonts := map[string]string{
 		"Tahoma":  "tahoma.ttf",
@@ -142,18 +173,22 @@ func (g *PDFGenerator) setupFonts(pdf *fpdf.Fpdf) {
 	}
 
 	for fontName, fontFile := range fonts {
-		if !g.fontCache.IsLoaded(fontName) {
-			fontPath := filepath.Join("./fonts", fontFile)
+		if !checked {
+			fontPath := filepath.Join(g.config.FontDir, fontFile)
 			if _, err := os.Stat(fontPath); err == nil {
-				if fontName == "TahomaB" {
-					pdf.AddUTF8Font("Tahoma", "B", fontFile)
-				} else {
-					pdf.AddUTF8Font(fontName, "", fontFile)
-				}
 				g.fontCache.MarkLoaded(fontName)
 				utils.LogDebug("Loaded font: %s", fontName)
 			}
 		}
+		if !g.fontCache.IsLoaded(fontName) {
+			continue
+		}
+
+		if fontName == "TahomaB" {
+			pdf.AddUTF8Font("Tahoma", "B", fontFile)
+		} else {
+			pdf.AddUTF8Font(fontName, "", fontFile)
+		}
 	}
 
 	pdf.SetFont("Tahoma", "", 10)
@@ -167,11 +202,15 @@ func (g *PDFGenerator) processElement(pdf *fpdf.Fpdf, element models.PDFElement,
 		return fmt.Errorf("element validation failed: %w", err)
 	}
 
-	// Handle loop elements
+	// Handle loop elements; their conditions are checked for every row
 	if element.IsLoopElement() {
 		return g.processLoopElement(pdf, element, data)
 	}
 
+	if visible, err := isVisible(element, data); err != nil || !visible {
+		return err
+	}
+
 	// Process based on element type
 	switch element.Type {
 	case models.ElementTypeText:
@@ -186,61 +225,38 @@ func (g *PDFGenerator) processElement(pdf *fpdf.Fpdf, element models.PDFElement,
 		return g.processBarcodeElement(pdf, element, data)
 	case models.ElementTypeTable:
 		return g.processTableElement(pdf, element, data)
+	case models.ElementTypeComputed, models.ElementTypePage, models.ElementTypeSettings:
+		// Computed fields are evaluated and page settings applied before layout
+		return nil
 	default:
 		return fmt.Errorf("unsupported element type: %s", element.Type)
 	}
 }
 
-// processLoopElement processes elements that should be repeated for array data
+// processLoopElement processes elements that should be repeated for array data.
+// It does not break pages; GeneratePDF lays out loops through the layout planner.
 func (g *PDFGenerator) processLoopElement(pdf *fpdf.Fpdf, element models.PDFElement, data map[string]interface{}) error {
-	parts := strings.Split(element.LoopField, ".")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid loopField format: %s", element.LoopField)
-	}
-
-	arrayName := parts[0]
-	fieldName := parts[1]
-
-	arrayData, ok := data[arrayName]
-	if !ok {
-		return fmt.Errorf("array field not found: %s", arrayName)
-	}
-
-	items, isArray := arrayData.([]interface{})
-	if !isArray {
-		return fmt.Errorf("field is not an array: %s", arrayName)
+	rows, err := loopRows(element, data)
+	if err != nil {
+		return err
 	}
 
 	currentY := element.Position.Y
-	spacing := element.Size.Height + 2 // Add small spacing between items
+	spacing := element.Size.Height + millimetres(pdf, loopRowSpacing) // Add small spacing between items
 
-	for _, item := range items {
+	for _, row := range rows {
 		// Create a copy of the element for this iteration
 		elementCopy := element.Clone()
+		elementCopy.LoopField = ""
 		elementCopy.Position.Y = currentY
 
-		// Get field value from item
-		itemValue := utils.GetArrayFieldValue(item, fieldName)
-
-		// Process the element with the item value
-		itemData := make(map[string]interface{})
-		for k, v := range data {
-			itemData[k] = v
-		}
-		itemData[element.LoopField] = itemValue
-
-		if err := g.processElement(pdf, *elementCopy, itemData); err != nil {
+		if err := g.processElement(pdf, *elementCopy, loopRowData(element, row)); err != nil {
 			utils.LogError("Error processing loop element: %v", err)
 		}
 
 		currentY += spacing
 	}
 
-	// Update the last Y position for this array
-	g.mu.Lock()
-	g.lastYPositions[arrayName] = currentY
-	g.mu.Unlock()
-
 	return nil
 }
 
@@ -254,8 +270,9 @@ func (g *PDFGenerator) processTextElement(pdf *fpdf.Fpdf, element models.PDFElem
 		pdf.SetTextColor(element.Style.TextColor.R, element.Style.TextColor.G, element.Style.TextColor.B)
 	}
 
-	// Get text content with variable replacement
-	text := g.replaceVariables(element.Text, element.VariableName, data)
+	// Get text content with variable replacement. A failing filter leaves its
+	// placeholder in the text, which is still drawn before the error is reported.
+	text, textErr := element.GetTextContent(data)
 
 	// Apply rotation if needed
 	if element.Style.RotateDegree != 0 {
@@ -269,7 +286,7 @@ func (g *PDFGenerator) processTextElement(pdf *fpdf.Fpdf, element models.PDFElem
 
 	switch element.Method {
 	case "MultiCell":
-		lineHeight := element.Style.Font.Size * 0.5
+		lineHeight := millimetres(pdf, element.Style.Font.Size*0.5)
 		pdf.MultiCell(element.Size.Width, lineHeight, text, element.Style.Border, element.Style.Align, false)
 	case "Cell":
 		pdf.CellFormat(element.Size.Width, element.Size.Height, text, element.Style.Border, 0, element.Style.Align, false, 0, "")
@@ -282,7 +299,7 @@ func (g *PDFGenerator) processTextElement(pdf *fpdf.Fpdf, element models.PDFElem
 		pdf.TransformEnd()
 	}
 
-	return nil
+	return textErr
 }
 
 // processBoxElement processes box/rectangle elements
@@ -298,7 +315,7 @@ func (g *PDFGenerator) processBoxElement(pdf *fpdf.Fpdf, element models.PDFEleme
 	}
 
 	// Set line width
-	pdf.SetLineWidth(0.2)
+	pdf.SetLineWidth(millimetres(pdf, 0.2))
 
 	// Draw rectangle
 	if element.Style.Background.IsSet {
@@ -316,14 +333,16 @@ func (g *PDFGenerator) processImageElement(pdf *fpdf.Fpdf, element models.PDFEle
 
 	// Check if image path is a variable
 	if imagePath == "" && element.VariableName != "" {
-		if val, ok := data[element.VariableName]; ok {
-			imagePath = fmt.Sprintf("%v", val)
-		}
+		imagePath, _ = utils.ResolveString(data, element.VariableName)
 	}
 
 	if imagePath == "" {
 		return fmt.Errorf("image path not specified")
 	}
+	imagePath, err := utils.ResolveIn(g.config.ImageDir, imagePath)
+	if err != nil {
+		return fmt.Errorf("image not allowed: %w", err)
+	}
 
 	// Check if file exists
 	if _, err := os.Stat(imagePath); err != nil {
@@ -339,15 +358,19 @@ func (g *PDFGenerator) processImageElement(pdf *fpdf.Fpdf, element models.PDFEle
 // processQRElement processes QR code elements
 func (g *PDFGenerator) processQRElement(pdf *fpdf.Fpdf, element models.PDFElement, data map[string]interface{}) error {
 	// Get QR content
-	content := element.GetTextContent(data)
-	if content == "" {
-		content = g.replaceVariables(element.QRContent, element.VariableName, data)
+	content, err := element.GetTextContent(data)
+	if err != nil {
+		return err
 	}
 
 	if content == "" {
 		return fmt.Errorf("QR content is empty")
 	}
 
+	if element.Style.Monochrome {
+		return g.drawMonochromeQR(pdf, element, content)
+	}
+
 	// Generate QR code
 	qrCode, err := qrcode.Encode(content, qrcode.Medium, 256)
 	if err != nil {
@@ -355,8 +378,8 @@ func (g *PDFGenerator) processQRElement(pdf *fpdf.Fpdf, element models.PDFElemen
 	}
 
 	// Save QR code to temporary file
-	tempFile := filepath.Join(g.tempDir, fmt.Sprintf("qr_%d.png", time.Now().UnixNano()))
-	if err := os.WriteFile(tempFile, qrCode, 0644); err != nil {
+	tempFile, err := g.writeTempImage("qr", qrCode)
+	if err != nil {
 		return fmt.Errorf("failed to save QR code: %w", err)
 	}
 	defer os.Remove(tempFile) // Clean up
@@ -371,9 +394,9 @@ func (g *PDFGenerator) processQRElement(pdf *fpdf.Fpdf, element models.PDFElemen
 // processBarcodeElement processes barcode elements
 func (g *PDFGenerator) processBarcodeElement(pdf *fpdf.Fpdf, element models.PDFElement, data map[string]interface{}) error {
 	// Get barcode content
-	content := element.GetTextContent(data)
-	if content == "" {
-		content = g.replaceVariables(element.BarcodeContent, element.VariableName, data)
+	content, err := element.GetTextContent(data)
+	if err != nil {
+		return err
 	}
 
 	if content == "" {
@@ -382,7 +405,6 @@ func (g *PDFGenerator) processBarcodeElement(pdf *fpdf.Fpdf, element models.PDFE
 
 	// Generate barcode based on format
 	var barcodeImg barcode.Barcode
-	var err error
 
 	switch strings.ToUpper(element.BarcodeFormat) {
 	case "CODE128":
@@ -401,22 +423,25 @@ func (g *PDFGenerator) processBarcodeElement(pdf *fpdf.Fpdf, element models.PDFE
 		return fmt.Errorf("failed to generate barcode: %w", err)
 	}
 
+	if element.Style.Monochrome {
+		return g.drawMonochromeBarcode(pdf, element, barcodeImg)
+	}
+
 	// Scale barcode to desired size
-	scaledBarcode, err := barcode.Scale(barcodeImg, int(element.Size.Width*10), int(element.Size.Height*10))
+	pixels := barcodePixelsPerMillimetre / millimetres(pdf, 1)
+	scaledBarcode, err := barcode.Scale(barcodeImg, int(element.Size.Width*pixels), int(element.Size.Height*pixels))
 	if err != nil {
 		return fmt.Errorf("failed to scale barcode: %w", err)
 	}
 
 	// Convert to PNG and save to temporary file
-	tempFile := filepath.Join(g.tempDir, fmt.Sprintf("barcode_%d.png", time.Now().UnixNano()))
-
-	// Create a buffer for the PNG data
 	var buf bytes.Buffer
 	if err := g.imageToPNG(scaledBarcode, &buf); err != nil {
 		return fmt.Errorf("failed to convert barcode to PNG: %w", err)
 	}
 
-	if err := os.WriteFile(tempFile, buf.Bytes(), 0644); err != nil {
+	tempFile, err := g.writeTempImage("barcode", buf.Bytes())
+	if err != nil {
 		return fmt.Errorf("failed to save barcode: %w", err)
 	}
 	defer os.Remove(tempFile) // Clean up
@@ -430,12 +455,75 @@ func (g *PDFGenerator) processBarcodeElement(pdf *fpdf.Fpdf, element models.PDFE
 
 // processTableElement processes table elements
 func (g *PDFGenerator) processTableElement(pdf *fpdf.Fpdf, element models.PDFElement, data map[string]interface{}) error {
-	// This is a placeholder for table processing
-	// Tables are complex and would need additional implementation
-	utils.LogWarn("Table elements are not yet fully implemented")
+	items, err := tableItems(element, data)
+	if err != nil {
+		return err
+	}
+
+	g.drawTable(pdf, element, items, 0, element.Position.Y)
+
+	utils.LogDebug("Rendered table %s with %d rows", element.VariableName, len(items))
 	return nil
 }
 
+// drawTable draws the header row and the given items at y and returns the Y below the last row.
+// firstIndex is the position of items[0] in the full array, used for zebra striping.
+func (g *PDFGenerator) drawTable(pdf *fpdf.Fpdf, element models.PDFElement, items []interface{}, firstIndex int, y float64) float64 {
+	rowHeight := element.Size.Height
+	currentY := y
+
+	g.setFont(pdf, element.Style.Font)
+	if element.Style.TextColor.IsSet {
+		pdf.SetTextColor(element.Style.TextColor.R, element.Style.TextColor.G, element.Style.TextColor.B)
+	}
+	pdf.SetLineWidth(millimetres(pdf, 0.2))
+
+	// Draw header row
+	if !element.Table.HideHeader {
+		fill := element.Style.Background.IsSet
+		if fill {
+			pdf.SetFillColor(element.Style.Background.R, element.Style.Background.G, element.Style.Background.B)
+		}
+
+		headerFont := element.Style.Font
+		headerFont.Style = "B"
+		g.setFont(pdf, headerFont)
+
+		x := element.Position.X
+		for _, column := range element.Columns {
+			pdf.SetXY(x, currentY)
+			pdf.CellFormat(column.Width, rowHeight, column.Header, element.Style.Border, 0, column.Align, fill, 0, "")
+			x += column.Width
+		}
+		currentY += rowHeight
+	}
+
+	// Draw one row per item
+	zebra := element.Table.ZebraFill
+	if zebra.IsSet {
+		pdf.SetFillColor(zebra.R, zebra.G, zebra.B)
+	}
+
+	for i, item := range items {
+		fill := zebra.IsSet && (firstIndex+i)%2 == 1
+
+		x := element.Position.X
+		for _, column := range element.Columns {
+			cellFont := element.Style.Font
+			cellFont.Style = column.FontStyle
+			g.setFont(pdf, cellFont)
+
+			pdf.SetXY(x, currentY)
+			pdf.CellFormat(column.Width, rowHeight, itemField(item, column.Field),
+				element.Style.Border, 0, column.Align, fill, 0, "")
+			x += column.Width
+		}
+		currentY += rowHeight
+	}
+
+	return currentY
+}
+
 // Helper methods
 
 // setFont sets the font for the PDF
@@ -454,14 +542,6 @@ func (g *PDFGenerator) setFont(pdf *fpdf.Fpdf, font models.Font) {
 	pdf.SetFont(family, style, size)
 }
 
-// replaceVariables replaces variables in text
-func (g *PDFGenerator) replaceVariables(text, variableName string, data map[string]interface{}) string {
-	if variableName != "" {
-		return utils.ReplaceVariablesInArray(text, variableName, data)
-	}
-	return utils.ReplaceVariables(text, data)
-}
-
 // calculateRotationPoint calculates the rotation point based on rotation type
 func (g *PDFGenerator) calculateRotationPoint(element models.PDFElement) (float64, float64) {
 	switch element.Style.RotateType {
@@ -478,3 +558,19 @@ func (g *PDFGenerator) calculateRotationPoint(element models.PDFElement) (float6
 func (g *PDFGenerator) imageToPNG(img image.Image, buf *bytes.Buffer) error {
 	return png.Encode(buf, img)
 }
+
+// writeTempImage saves PNG data to a new temporary file and returns its path.
+// Every file gets a unique name, so documents can render concurrently.
+func (g *PDFGenerator) writeTempImage(prefix string, data []byte) (string, error) {
+	file, err := os.CreateTemp(g.tempDir, prefix+"_*.png")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
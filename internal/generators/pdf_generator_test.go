@@ -0,0 +1,148 @@
+package generators
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// newContentPDF creates an uncompressed A4 page, so that tests can read the
+// drawing operations and the text of core fonts from the output
+func newContentPDF() *fpdf.Fpdf {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	return pdf
+}
+
+// contentOf returns the output of a PDF created by newContentPDF
+func contentOf(t *testing.T, pdf *fpdf.Fpdf) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// chargesTable returns a bordered table of the charges array in Helvetica
+func chargesTable() models.PDFElement {
+	return models.PDFElement{
+		Type:         models.ElementTypeTable,
+		VariableName: "charges",
+		Position:     models.Position{X: 10, Y: 20},
+		Size:         models.Size{Width: 120, Height: 6},
+		Style: models.Style{
+			Font:   models.Font{Family: "Helvetica", Size: 10},
+			Border: "1",
+		},
+		Columns: []models.TableColumn{
+			{Field: "name", Width: 80, Align: "L", Header: "Charge"},
+			{Field: "amount", Width: 40, Align: "R", FontStyle: "B", Header: "Amount"},
+		},
+	}
+}
+
+// charges returns the items of the charges table
+func charges() []interface{} {
+	return []interface{}{
+		map[string]interface{}{"name": "Freight", "amount": 100},
+		map[string]interface{}{"name": "Insurance", "amount": 25.5},
+		map[string]interface{}{"name": "Handling"},
+	}
+}
+
+func TestDrawTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		element func(element *models.PDFElement)
+		endY    float64
+		texts   []string
+		hidden  []string
+		filled  int
+	}{
+		{
+			name:  "header and rows",
+			endY:  44,
+			texts: []string{"(Charge)Tj", "(Amount)Tj", "(Freight)Tj", "(100)Tj", "(Insurance)Tj", "(25.5)Tj", "(Handling)Tj"},
+		},
+		{
+			name:    "hidden header",
+			element: func(element *models.PDFElement) { element.Table.HideHeader = true },
+			endY:    38,
+			texts:   []string{"(Freight)Tj", "(Handling)Tj"},
+			hidden:  []string{"(Charge)Tj", "(Amount)Tj"},
+		},
+		{
+			// Only the second row is filled, with both of its cells
+			name: "zebra fill",
+			element: func(element *models.PDFElement) {
+				element.Table.ZebraFill = models.Color{R: 240, G: 240, B: 240, IsSet: true}
+			},
+			endY:   44,
+			texts:  []string{"0.941 g"},
+			filled: 2,
+		},
+		{
+			name: "header background",
+			element: func(element *models.PDFElement) {
+				element.Style.Background = models.Color{R: 200, G: 200, B: 200, IsSet: true}
+			},
+			endY:   44,
+			filled: 2,
+		},
+	}
+
+	g := NewPDFGenerator(GeneratorConfig{})
+	for _, tt := range tests {
+		element := chargesTable()
+		if tt.element != nil {
+			tt.element(&element)
+		}
+		pdf := newContentPDF()
+		if endY := g.drawTable(pdf, element, charges(), 0, element.Position.Y); endY != tt.endY {
+			t.Errorf("%s: table ends at %v, want %v", tt.name, endY, tt.endY)
+		}
+
+		content := contentOf(t, pdf)
+		for _, text := range tt.texts {
+			if !strings.Contains(content, text) {
+				t.Errorf("%s: %q wasn't drawn", tt.name, text)
+			}
+		}
+		for _, text := range tt.hidden {
+			if strings.Contains(content, text) {
+				t.Errorf("%s: %q was drawn", tt.name, text)
+			}
+		}
+		// Filled and bordered cells are drawn with "re B", others with "re S"
+		if filled := strings.Count(content, " re B"); filled != tt.filled {
+			t.Errorf("%s: %d filled cells, want %d", tt.name, filled, tt.filled)
+		}
+	}
+}
+
+func TestProcessTableElementNeedsAnArray(t *testing.T) {
+	g := NewPDFGenerator(GeneratorConfig{})
+	tests := []struct {
+		data map[string]interface{}
+		err  string
+	}{
+		{map[string]interface{}{}, "array field not found: charges"},
+		{map[string]interface{}{"charges": "Freight"}, "field is not an array: charges"},
+	}
+	for _, tt := range tests {
+		err := g.processTableElement(newContentPDF(), chargesTable(), tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("data %v: error = %v, want %q", tt.data, err, tt.err)
+		}
+	}
+
+	if err := g.processTableElement(newContentPDF(), chargesTable(), map[string]interface{}{"charges": charges()}); err != nil {
+		t.Errorf("charges: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package generators
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+
+	"github.com/boombuler/barcode"
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// thermalDotsPerMillimetre is the resolution of 203 dpi thermal printers
+const thermalDotsPerMillimetre = 8
+
+// fitPages sets the height of each continuous page to its content plus the
+// bottom margin, and returns how far the footer of each page moves down to
+// stay below content that grew past it
+func (p *layoutPlanner) fitPages(regions pageRegions) []float64 {
+	bottoms := make([]float64, p.pages)
+	for _, placed := range p.placements {
+		bottoms[placed.page-1] = math.Max(bottoms[placed.page-1], placed.bottom)
+	}
+
+	offsets := make([]float64, p.pages)
+	for i := range p.formats {
+		page, templatePage := i+1, p.templatePages[i]
+		content := bottoms[i]
+		bottom := math.Max(content, p.margins.Top)
+
+		if _, end, ok := regionExtent(regions.elements, regions.headers, templatePage); ok {
+			bottom = math.Max(bottom, end)
+		}
+		if _, end, ok := regionExtent(regions.elements, regions.firstPage, templatePage); ok && page == 1 {
+			bottom = math.Max(bottom, end)
+		}
+		if _, end, ok := regionExtent(regions.elements, regions.lastPage, templatePage); ok && page == p.pages {
+			bottom = math.Max(bottom, end)
+		}
+		if top, end, ok := regionExtent(regions.elements, regions.footers, templatePage); ok {
+			offsets[i] = math.Max(0, content-top)
+			bottom = math.Max(bottom, end+offsets[i])
+		}
+
+		p.formats[i].height = bottom + p.margins.Bottom
+	}
+	return offsets
+}
+
+// regionExtent returns the top and bottom of the region elements at indexes
+// that are drawn on a template page
+func regionExtent(elements []models.PDFElement, indexes []int, templatePage int) (top, bottom float64, ok bool) {
+	top = math.Inf(1)
+	for _, i := range indexes {
+		element := elements[i]
+		if element.Page > 0 && element.Page != templatePage {
+			continue
+		}
+		top = math.Min(top, element.Position.Y)
+		bottom = math.Max(bottom, element.Position.Y+element.Size.Height)
+		ok = true
+	}
+	return top, bottom, ok
+}
+
+// monochromeCodes returns the elements with monochrome rendering turned on
+// for every QR code and barcode
+func monochromeCodes(elements []models.PDFElement) []models.PDFElement {
+	result := append([]models.PDFElement(nil), elements...)
+	for i := range result {
+		if result[i].Type == models.ElementTypeQR || result[i].Type == models.ElementTypeBarcode {
+			result[i].Style.Monochrome = true
+		}
+	}
+	return result
+}
+
+// drawMonochromeQR draws a QR code with whole printer dots per module
+func (g *PDFGenerator) drawMonochromeQR(pdf *fpdf.Fpdf, element models.PDFElement, content string) error {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("failed to generate QR code: %w", err)
+	}
+
+	bitmap := code.Bitmap()
+	modules := len(bitmap)
+	dots := thermalDots(pdf, math.Min(element.Size.Width, element.Size.Height))
+	if dots < modules {
+		return codeTooSmall("QR code", modules, dots)
+	}
+	scale := dots / modules
+
+	img := image.NewGray(image.Rect(0, 0, modules*scale, modules*scale))
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			img.SetGray(x, y, dotColor(bitmap[y/scale][x/scale]))
+		}
+	}
+
+	utils.LogDebug("Generated monochrome QR code for content: %s", utils.TruncateString(content, 50))
+	return g.drawDots(pdf, element, img, "qr")
+}
+
+// drawMonochromeBarcode draws a barcode with whole printer dots per bar
+func (g *PDFGenerator) drawMonochromeBarcode(pdf *fpdf.Fpdf, element models.PDFElement, code barcode.Barcode) error {
+	bounds := code.Bounds()
+	width, height := thermalDots(pdf, element.Size.Width), thermalDots(pdf, element.Size.Height)
+	if width < bounds.Dx() {
+		return codeTooSmall("barcode", bounds.Dx(), width)
+	}
+	if bounds.Dy() > 1 && height < bounds.Dy() {
+		return codeTooSmall("barcode", bounds.Dy(), height)
+	}
+	scaleX := width / bounds.Dx()
+	scaleY := max(1, height/bounds.Dy())
+	if bounds.Dy() > 1 {
+		// Two-dimensional codes keep square modules
+		scaleX = min(scaleX, scaleY)
+		scaleY = scaleX
+	}
+
+	img := image.NewGray(image.Rect(0, 0, bounds.Dx()*scaleX, bounds.Dy()*scaleY))
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			gray := color.GrayModel.Convert(code.At(bounds.Min.X+x/scaleX, bounds.Min.Y+y/scaleY)).(color.Gray)
+			img.SetGray(x, y, dotColor(gray.Y < 128))
+		}
+	}
+
+	utils.LogDebug("Generated monochrome %s barcode for content: %s", element.BarcodeFormat, utils.TruncateString(code.Content(), 50))
+	return g.drawDots(pdf, element, img, "barcode")
+}
+
+// codeTooSmall reports a code with more modules than its element has printer
+// dots. Shrinking or clipping it would make it unreadable.
+func codeTooSmall(name string, modules, dots int) error {
+	return fmt.Errorf("%s needs %d printer dots (%.1fmm) but the element only has room for %d; make it larger or shorten the content",
+		name, modules, float64(modules)/thermalDotsPerMillimetre, dots)
+}
+
+// drawDots draws a printer-resolution image at its natural size, centred in
+// the element's box
+func (g *PDFGenerator) drawDots(pdf *fpdf.Fpdf, element models.PDFElement, img *image.Gray, name string) error {
+	var buf bytes.Buffer
+	if err := g.imageToPNG(img, &buf); err != nil {
+		return fmt.Errorf("failed to convert %s to PNG: %w", name, err)
+	}
+
+	tempFile, err := g.writeTempImage(name, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", name, err)
+	}
+	defer os.Remove(tempFile) // Clean up
+
+	dot := millimetres(pdf, 1.0/thermalDotsPerMillimetre)
+	width, height := float64(img.Rect.Dx())*dot, float64(img.Rect.Dy())*dot
+	x := element.Position.X + math.Max(0, element.Size.Width-width)/2
+	y := element.Position.Y + math.Max(0, element.Size.Height-height)/2
+	pdf.Image(tempFile, x, y, width, height, false, "", 0, "")
+	return nil
+}
+
+// thermalDots converts a length in the document's unit to printer dots
+func thermalDots(pdf *fpdf.Fpdf, length float64) int {
+	return int(length / millimetres(pdf, 1) * thermalDotsPerMillimetre)
+}
+
+// dotColor returns black for printed dots and white otherwise
+func dotColor(printed bool) color.Gray {
+	if printed {
+		return color.Gray{Y: 0}
+	}
+	return color.Gray{Y: 255}
+}
@@ -0,0 +1,54 @@
+package generators
+
+import (
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+func monochromeCode(elementType models.ElementType, content string, width, height float64) models.PDFElement {
+	element := models.PDFElement{
+		Type:     elementType,
+		Position: models.Position{X: 10, Y: 10},
+		Size:     models.Size{Width: width, Height: height},
+		Style:    models.Style{Monochrome: true},
+	}
+	if elementType == models.ElementTypeQR {
+		element.QRContent = content
+	} else {
+		element.BarcodeContent = content
+		element.BarcodeFormat = "CODE128"
+	}
+	return element
+}
+
+func TestMonochromeCodesMustFitTheirBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		element models.PDFElement
+		wantErr string
+	}{
+		{"QR that fits", monochromeCode(models.ElementTypeQR, "INV-001", 30, 30), ""},
+		// A 21 module QR code with its quiet zone needs 29 dots, 3.6mm
+		{"QR in a 2mm box", monochromeCode(models.ElementTypeQR, "INV-001", 2, 2), "QR code needs 29 printer dots"},
+		{"QR limited by height", monochromeCode(models.ElementTypeQR, "INV-001", 30, 3), "QR code needs"},
+		{"QR with long content", monochromeCode(models.ElementTypeQR, strings.Repeat("x", 1500), 15, 15), "QR code needs"},
+		{"barcode that fits", monochromeCode(models.ElementTypeBarcode, "INV-001", 40, 10), ""},
+		{"barcode too narrow", monochromeCode(models.ElementTypeBarcode, "INV-001", 5, 10), "barcode needs"},
+	}
+
+	g := newTestGenerator()
+	for _, tt := range tests {
+		_, elementErrors, err := g.GeneratePDFToBytesWithOptions([]models.PDFElement{tt.element}, nil, GenerateOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		switch {
+		case tt.wantErr == "" && len(elementErrors) > 0:
+			t.Errorf("%s: %s", tt.name, elementErrors[0].Message)
+		case tt.wantErr != "" && (len(elementErrors) != 1 || !strings.Contains(elementErrors[0].Message, tt.wantErr)):
+			t.Errorf("%s: element errors = %+v, want %q", tt.name, elementErrors, tt.wantErr)
+		}
+	}
+}
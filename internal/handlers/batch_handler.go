@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/generators"
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/parsers"
+	"pdf-gen-simple/internal/utils"
+)
+
+// Batch output formats
+const (
+	batchOutputZip = "zip"
+	batchOutputPDF = "pdf"
+)
+
+// Response headers of batch renders
+const (
+	batchCountHeader        = "X-Batch-Count"
+	batchFailedCountHeader  = "X-Batch-Failed-Count"
+	batchManifestHeader     = "X-Batch-Manifest"
+	batchManifestFileHeader = "X-Batch-Manifest-File"
+)
+
+// batchManifestFile is the name of the manifest in a batch ZIP, and of the
+// manifest attached to a merged batch PDF
+const batchManifestFile = generators.ManifestFile
+
+// Limits of batch requests
+const (
+	// maxBatchSize limits the size of a batch request body
+	maxBatchSize = 32 << 20
+	// maxManifestHeaderSize limits the X-Batch-Manifest header; larger
+	// manifests are only in the manifest file
+	maxManifestHeaderSize = 4 << 10
+)
+
+// unsafeFilenameChars matches characters replaced in batch filenames
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// batchItem is the manifest entry for one record of a batch
+type batchItem struct {
+	Index    int                       `json:"index"` // 1-based position in the request
+	Filename string                    `json:"filename,omitempty"`
+	Status   string                    `json:"status"` // ok or failed
+	Error    string                    `json:"error,omitempty"`
+	Fields   []models.FieldError       `json:"fields,omitempty"`
+	Warnings []generators.ElementError `json:"warnings,omitempty"`
+}
+
+// HandleBatch handles POST /invoice/template/:template_name/batch
+// The body is a JSON array or a JSON Lines stream of field maps, one per
+// document. ?output=zip (default) returns a ZIP of PDFs named by ?filename,
+// such as {{invoiceNumber}}.pdf, plus a manifest; ?output=pdf returns one
+// merged PDF. Records that fail are reported in the manifest without failing
+// the batch.
+func (h *CSVTemplateHandler) HandleBatch(c *gin.Context) {
+	templateName := c.Param("template_name")
+	utils.LogInfo("Received batch request for template: %s", templateName)
+
+	templatePath, err := h.resolveTemplate(templateName, c.Query("version"))
+	if err != nil {
+		utils.LogError("Invalid template %s: %v", templateName, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid template name or template not found",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+
+	output := strings.ToLower(c.DefaultQuery("output", batchOutputZip))
+	if output != batchOutputZip && output != batchOutputPDF {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    fmt.Sprintf("unknown output %q: use zip or pdf", output),
+			"template": templateName,
+		})
+		return
+	}
+
+	options, err := batchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    err.Error(),
+			"template": templateName,
+		})
+		return
+	}
+
+	records, err := readBatchRecords(http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    fmt.Sprintf("Batch is larger than %d MB", maxBatchSize>>20),
+			"template": templateName,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    fmt.Sprintf("Invalid request format: %v", err),
+			"template": templateName,
+		})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "At least one record is required",
+			"template": templateName,
+		})
+		return
+	}
+
+	elements, err := h.loaders.Load(templatePath)
+	if err != nil {
+		utils.LogError("Error parsing template %s: %v", templatePath, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Failed to parse template",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+
+	schema, err := parsers.LoadTemplateSchema(h.store, h.buildTemplatePath(templateName), elements)
+	if err != nil {
+		utils.LogError("Error loading schema for template %s: %v", templatePath, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Failed to load template schema",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+
+	b := newBatch(templateName, elements, schema, records, options)
+	utils.LogInfo("Rendering batch of %d records (%d valid) from template %s", len(records), len(b.records), templateName)
+
+	if output == batchOutputPDF {
+		h.writeMergedBatch(c, b)
+		return
+	}
+	h.writeZipBatch(c, b, c.DefaultQuery("filename", templateName+"_{{index}}.pdf"))
+}
+
+// batchOptions reads the error policy and worker count of a batch request.
+// The worker count is capped at the number of CPUs.
+func batchOptions(c *gin.Context) (generators.BatchOptions, error) {
+	options, err := generateOptions(models.CSVTemplateRequest{ErrorPolicy: c.Query("errorPolicy")})
+	if err != nil {
+		return generators.BatchOptions{}, err
+	}
+
+	batch := generators.BatchOptions{GenerateOptions: options}
+	if value := c.Query("workers"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 1 {
+			return generators.BatchOptions{}, fmt.Errorf("invalid workers %q", value)
+		}
+		batch.Workers = min(workers, runtime.NumCPU())
+	}
+	return batch, nil
+}
+
+// readBatchRecords reads a JSON array or a JSON Lines stream of field maps
+func readBatchRecords(body io.Reader) ([]map[string]interface{}, error) {
+	reader := bufio.NewReader(body)
+	decoder := json.NewDecoder(reader)
+
+	first, err := peekNonSpace(reader)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]interface{}
+	if first == '[' {
+		if err := decoder.Decode(&records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	for {
+		var record map[string]interface{}
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// peekNonSpace returns the first byte of the reader that isn't white space,
+// leaving it unread
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.Discard(1)
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+// batch is a set of records checked against a template's schema
+type batch struct {
+	templateName string
+	elements     []models.PDFElement
+	records      []map[string]interface{} // records that passed the check
+	indexes      []int                    // manifest entry of each record
+	items        []batchItem
+	options      generators.BatchOptions
+}
+
+// newBatch runs the options' calculators on the records and checks them
+// against the schema. Records that fail are marked in the manifest and left
+// out of the batch.
+func newBatch(templateName string, elements []models.PDFElement, schema models.TemplateSchema, records []map[string]interface{}, options generators.BatchOptions) *batch {
+	b := &batch{
+		templateName: templateName,
+		elements:     elements,
+		items:        make([]batchItem, len(records)),
+		options:      options,
+	}
+	b.options.Calculators = nil
+
+	for i, record := range records {
+		item := &b.items[i]
+		*item = batchItem{Index: i + 1, Status: "ok"}
+
+		fields, err := generators.Calculate(schema.ApplyDefaults(record), options.Calculators)
+		if err != nil {
+			item.Status = "failed"
+			item.Error = err.Error()
+			continue
+		}
+		if problems := schema.Check(fields); len(problems) > 0 {
+			item.Status = "failed"
+			item.Error = "Request fields do not match the template schema"
+			item.Fields = problems
+			continue
+		}
+		b.records = append(b.records, fields)
+		b.indexes = append(b.indexes, i)
+	}
+	return b
+}
+
+// failed returns the number of failed records
+func (b *batch) failed() int {
+	failed := 0
+	for _, item := range b.items {
+		if item.Status == "failed" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// failures returns the manifest entries of the failed records
+func (b *batch) failures() []batchItem {
+	var failures []batchItem
+	for _, item := range b.items {
+		if item.Status == "failed" {
+			failures = append(failures, item)
+		}
+	}
+	return failures
+}
+
+// record marks the outcome of rendering record i of the batch
+func (b *batch) record(i int, document generators.BatchDocument) *batchItem {
+	item := &b.items[b.indexes[i]]
+	item.Warnings = document.Warnings
+	if document.Err != nil {
+		item.Status = "failed"
+		item.Error = document.Err.Error()
+	}
+	return item
+}
+
+// batchZip writes a batch ZIP. The ZIP is started by open when the first
+// file is added, so that a response can still be an error until then.
+type batchZip struct {
+	open    func() io.Writer
+	archive *zip.Writer
+}
+
+// started returns true once a file has been added
+func (z *batchZip) started() bool {
+	return z.archive != nil
+}
+
+// add writes a file to the ZIP, starting it if needed
+func (z *batchZip) add(name string, data []byte) error {
+	if z.archive == nil {
+		z.archive = zip.NewWriter(z.open())
+	}
+	file, err := z.archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	return err
+}
+
+// finish adds the batch's manifest and closes the ZIP
+func (z *batchZip) finish(b *batch) error {
+	manifest, err := json.MarshalIndent(b.items, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := z.add(batchManifestFile, manifest); err != nil {
+		return err
+	}
+	return z.archive.Close()
+}
+
+// streamZip renders one PDF per record and adds each to the ZIP as soon as
+// it is rendered, so only the documents being rendered are held in memory.
+// PDFs are named by the filename pattern; the manifest isn't added.
+func (h *CSVTemplateHandler) streamZip(ctx context.Context, b *batch, pattern string, z *batchZip) error {
+	// Name the files in record order, so repeated names get the same
+	// suffixes whichever document finishes first
+	names := make(map[string]bool)
+	filenames := make([]string, len(b.records))
+	for i, record := range b.records {
+		filenames[i] = batchFilename(pattern, record, b.items[b.indexes[i]].Index, names)
+	}
+
+	err := h.generator.GenerateBatch(ctx, b.elements, b.records, b.options, func(i int, document generators.BatchDocument) error {
+		item := b.record(i, document)
+		if document.Err != nil {
+			return nil
+		}
+		item.Filename = filenames[i]
+		return z.add(item.Filename, document.PDF)
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// renderZip renders one PDF per record and returns a ZIP holding the PDFs,
+// named by the filename pattern, and the manifest
+func (h *CSVTemplateHandler) renderZip(ctx context.Context, b *batch, pattern string) ([]byte, error) {
+	var buf bytes.Buffer
+	z := &batchZip{open: func() io.Writer { return &buf }}
+	if err := h.streamZip(ctx, b, pattern, z); err != nil {
+		return nil, err
+	}
+	if err := z.finish(b); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderMerged renders every record into one PDF. With attachManifest the
+// manifest is embedded in the PDF as a file attachment.
+func (h *CSVTemplateHandler) renderMerged(ctx context.Context, b *batch, attachManifest bool) ([]byte, error) {
+	if len(b.records) == 0 {
+		return nil, nil
+	}
+
+	options := b.options
+	if attachManifest {
+		options.Manifest = func(documents []generators.BatchDocument) ([]byte, error) {
+			for i, document := range documents {
+				b.record(i, document)
+			}
+			return json.MarshalIndent(b.items, "", "  ")
+		}
+	}
+	pdfBytes, documents, err := h.generator.GenerateMergedBatch(ctx, b.elements, b.records, options)
+	if err != nil {
+		return nil, err
+	}
+	for i, document := range documents {
+		b.record(i, document)
+	}
+	return pdfBytes, nil
+}
+
+// writeZipBatch streams a ZIP of one PDF per record and the manifest. The
+// response starts with the first PDF; the number of failed records is only
+// known at the end and is sent in the X-Batch-Failed-Count trailer.
+func (h *CSVTemplateHandler) writeZipBatch(c *gin.Context, b *batch, pattern string) {
+	z := &batchZip{open: func() io.Writer {
+		c.Header(batchCountHeader, strconv.Itoa(len(b.items)))
+		c.Header("Trailer", batchFailedCountHeader)
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=batch_%s.zip", b.templateName))
+		c.Status(http.StatusOK)
+		return c.Writer
+	}}
+
+	err := h.streamZip(c.Request.Context(), b, pattern, z)
+	if err == nil && z.started() {
+		err = z.finish(b)
+	}
+	if err != nil {
+		utils.LogError("Error generating batch for template %s: %v", b.templateName, err)
+		if !z.started() {
+			writeGenerationError(c, b.templateName, err)
+		}
+		// Once the ZIP has started the response can only be cut short
+		return
+	}
+
+	failed := b.failed()
+	if !z.started() {
+		writeBatchFailure(c, b.templateName, b.items)
+		return
+	}
+	c.Writer.Header().Set(batchFailedCountHeader, strconv.Itoa(failed))
+
+	utils.LogInfo("Generated batch of %d documents from template %s (%d failed), size: %d bytes", len(b.items), b.templateName, failed, c.Writer.Size())
+}
+
+// writeMergedBatch responds with one PDF holding every record, with the
+// manifest attached as manifest.json. The manifest is also returned in a JSON
+// envelope if the client accepts JSON, and otherwise the failed records are
+// listed in the X-Batch-Manifest header if they fit.
+func (h *CSVTemplateHandler) writeMergedBatch(c *gin.Context, b *batch) {
+	pdfBytes, err := h.renderMerged(c.Request.Context(), b, true)
+	if err != nil {
+		utils.LogError("Error generating merged batch for template %s: %v", b.templateName, err)
+		writeGenerationError(c, b.templateName, err)
+		return
+	}
+
+	failed := b.failed()
+	if failed == len(b.items) {
+		writeBatchFailure(c, b.templateName, b.items)
+		return
+	}
+
+	utils.LogInfo("Generated merged batch of %d documents from template %s (%d failed), size: %d bytes", len(b.items), b.templateName, failed, len(pdfBytes))
+
+	filename := fmt.Sprintf("batch_%s.pdf", b.templateName)
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.JSON(http.StatusOK, gin.H{
+			"filename": filename,
+			"pdf":      base64.StdEncoding.EncodeToString(pdfBytes),
+			"manifest": b.items,
+		})
+		return
+	}
+
+	if failures := b.failures(); failures != nil {
+		encoded, err := json.Marshal(failures)
+		switch {
+		case err != nil:
+			utils.LogError("Error encoding batch manifest: %v", err)
+		case len(encoded) > maxManifestHeaderSize:
+			utils.LogInfo("Manifest of %d failed records is only attached to the PDF", len(failures))
+		default:
+			c.Header(batchManifestHeader, string(encoded))
+		}
+	}
+	c.Header(batchManifestFileHeader, batchManifestFile)
+	c.Header(batchCountHeader, strconv.Itoa(len(b.items)))
+	c.Header(batchFailedCountHeader, strconv.Itoa(failed))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+}
+
+// writeBatchFailure responds to a batch in which every record failed
+func writeBatchFailure(c *gin.Context, templateName string, items []batchItem) {
+	utils.LogWarn("Every record of the batch for template %s failed", templateName)
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":    "Every record of the batch failed",
+		"template": templateName,
+		"manifest": items,
+	})
+}
+
+// batchFilename expands a filename pattern for a record. Unsafe characters,
+// including path separators, are replaced, the name is given a .pdf extension
+// and repeated names get a suffix.
+func batchFilename(pattern string, record map[string]interface{}, index int, used map[string]bool) string {
+	data := make(map[string]interface{}, len(record)+1)
+	for k, v := range record {
+		data[k] = v
+	}
+	data["index"] = index
+
+	name, err := utils.ExpandPlaceholders(pattern, data)
+	if err != nil {
+		utils.LogWarn("Error expanding batch filename %q for record %d: %v", pattern, index, err)
+	}
+	if strings.EqualFold(filepath.Ext(name), ".pdf") {
+		name = name[:len(name)-len(".pdf")]
+	}
+	name = strings.Trim(unsafeFilenameChars.ReplaceAllString(name, "_"), "._")
+	if name == "" {
+		name = fmt.Sprintf("document_%d", index)
+	}
+
+	filename := name + ".pdf"
+	for n := 2; used[filename]; n++ {
+		filename = fmt.Sprintf("%s-%d.pdf", name, n)
+	}
+	used[filename] = true
+	return filename
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/storage"
+)
+
+// batchTemplate draws an invoice number and a QR code, which fails for
+// records with an empty code
+const batchTemplate = "type,method,x,y,width,height,text,qrContent\n" +
+	"text,Cell,10,10,80,8,{{invoiceNumber}},\n" +
+	"qr,,10,30,30,30,,{{code}}\n"
+
+// newTestHandler creates a handler for templates written to a temporary directory
+func newTestHandler(t *testing.T, files map[string]string) *CSVTemplateHandler {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newCSVTemplateHandler(storage.NewDirStore(dir), "", "../../fonts")
+}
+
+// postBatch sends a batch request to the handler
+func postBatch(h *CSVTemplateHandler, query string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/invoice/template/:template_name/batch", h.HandleBatch)
+
+	req := httptest.NewRequest(http.MethodPost, "/invoice/template/invoice/batch"+query, bytes.NewReader(body))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// batchRecords returns n records, with an empty code for the records in failing
+func batchRecords(n int, failing ...int) []byte {
+	records := make([]map[string]interface{}, n)
+	for i := range records {
+		records[i] = map[string]interface{}{"invoiceNumber": fmt.Sprintf("INV-%d", i+1), "code": "QR"}
+	}
+	for _, i := range failing {
+		records[i]["code"] = ""
+	}
+	body, _ := json.Marshal(records)
+	return body
+}
+
+func TestBatchZipStreamsDocumentsAndManifest(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"invoice.csv": batchTemplate})
+	body := []byte(`{"invoiceNumber": "INV-1", "code": "a"}
+{"invoiceNumber": "INV-2", "code": ""}
+{"invoiceNumber": "INV-1", "code": "c"}
+`)
+
+	w := postBatch(h, "?errorPolicy=strict&filename={{invoiceNumber}}.pdf", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(batchCountHeader); got != "3" {
+		t.Errorf("%s = %q, want 3", batchCountHeader, got)
+	}
+	if got := w.Result().Trailer.Get(batchFailedCountHeader); got != "1" {
+		t.Errorf("%s trailer = %q, want 1", batchFailedCountHeader, got)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var manifest []batchItem
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		if file.Name == batchManifestFile {
+			reader, _ := file.Open()
+			if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	sort.Strings(names)
+	// Repeated names are numbered in record order, not the order documents finish
+	if want := []string{"INV-1-2.pdf", "INV-1.pdf", "manifest.json"}; fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("ZIP holds %v, want %v", names, want)
+	}
+	if len(manifest) != 3 || manifest[0].Filename != "INV-1.pdf" || manifest[1].Status != "failed" || manifest[2].Filename != "INV-1-2.pdf" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+}
+
+func TestBatchZipEveryRecordFailed(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"invoice.csv": batchTemplate})
+
+	w := postBatch(h, "?errorPolicy=strict", batchRecords(2, 0, 1), nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "Every record of the batch failed") {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
+
+func TestBatchRejectsLargeBody(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"invoice.csv": batchTemplate})
+
+	body := append(bytes.Repeat([]byte(" "), maxBatchSize), batchRecords(1)...)
+	w := postBatch(h, "", body, nil)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBatchMergedStrictLeavesOutFailedRecords(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"invoice.csv": batchTemplate})
+
+	w := postBatch(h, "?output=pdf&errorPolicy=strict", batchRecords(3, 1), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(batchFailedCountHeader); got != "1" {
+		t.Errorf("%s = %q, want 1", batchFailedCountHeader, got)
+	}
+
+	var failures []batchItem
+	if err := json.Unmarshal([]byte(w.Header().Get(batchManifestHeader)), &failures); err != nil {
+		t.Fatalf("%s: %v", batchManifestHeader, err)
+	}
+	if len(failures) != 1 || failures[0].Index != 2 || len(failures[0].Warnings) != 1 {
+		t.Errorf("failures = %+v, want the QR code of record 2", failures)
+	}
+
+	pdf := w.Body.Bytes()
+	if !bytes.Contains(pdf, []byte("/Count 2")) {
+		t.Error("the merged PDF doesn't have one page for each of the 2 records that passed")
+	}
+	if w.Header().Get(batchManifestFileHeader) != batchManifestFile || !bytes.Contains(pdf, []byte("/EmbeddedFiles")) {
+		t.Error("the manifest isn't attached to the merged PDF")
+	}
+}
+
+func TestBatchMergedCapsManifestHeader(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"invoice.csv": batchTemplate})
+
+	failing := make([]int, 0, 100)
+	for i := 0; i < 200; i += 2 {
+		failing = append(failing, i)
+	}
+	w := postBatch(h, "?output=pdf&errorPolicy=strict", batchRecords(200, failing...), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(batchManifestHeader); got != "" {
+		t.Errorf("%s has %d bytes, want it left out", batchManifestHeader, len(got))
+	}
+	if got := w.Header().Get(batchFailedCountHeader); got != "100" {
+		t.Errorf("%s = %q, want 100", batchFailedCountHeader, got)
+	}
+	if got := w.Header().Get(batchManifestFileHeader); got != batchManifestFile {
+		t.Errorf("%s = %q", batchManifestFileHeader, got)
+	}
+}
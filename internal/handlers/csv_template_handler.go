@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -12,28 +13,65 @@ import (
 	"pdf-gen-simple/internal/generators"
 	"pdf-gen-simple/internal/models"
 	"pdf-gen-simple/internal/parsers"
+	"pdf-gen-simple/internal/storage"
+	"pdf-gen-simple/internal/templates"
+	"pdf-gen-simple/internal/tenants"
 	"pdf-gen-simple/internal/utils"
 )
 
+// defaultTemplate is the template of the fixed CSV template endpoints
+const defaultTemplate = "pdf_template_1.csv"
+
 // CSVTemplateHandler handles CSV template-based PDF generation
 type CSVTemplateHandler struct {
-	parser    *parsers.CSVParser
+	loaders   *parsers.TemplateLoaders
+	validator *parsers.TemplateValidator
 	generator *generators.PDFGenerator
+	store     storage.TemplateStore
+	templates *templates.Registry
 }
 
-// NewCSVTemplateHandler creates a new CSV template handler
+// NewCSVTemplateHandler creates a new CSV template handler for the templates in ./assets
 func NewCSVTemplateHandler() *CSVTemplateHandler {
+	return NewCSVTemplateHandlerWithStore(storage.NewDirStore("./assets"))
+}
+
+// NewCSVTemplateHandlerWithStore creates a CSV template handler for the
+// templates in store
+func NewCSVTemplateHandlerWithStore(store storage.TemplateStore) *CSVTemplateHandler {
+	return newCSVTemplateHandler(store, "", "./fonts")
+}
+
+// NewTenantCSVTemplateHandler creates a CSV template handler for a tenant's
+// templates, images and fonts
+func NewTenantCSVTemplateHandler(tenant *tenants.Tenant) *CSVTemplateHandler {
+	return newCSVTemplateHandler(tenant.Store, tenant.ImageDir, tenant.FontDir)
+}
+
+// newCSVTemplateHandler creates a CSV template handler. Image paths are
+// resolved in imageDir, or used as they are if it is empty.
+func newCSVTemplateHandler(store storage.TemplateStore, imageDir, fontDir string) *CSVTemplateHandler {
 	generator := generators.NewPDFGenerator(generators.GeneratorConfig{
-		FontDir:     "./fonts",
+		FontDir:     fontDir,
+		ImageDir:    imageDir,
 		TempDir:     os.TempDir(),
 		DefaultFont: "Tahoma",
 		PageSize:    "A4",
 		Orientation: "P",
 	})
 
+	loaders := parsers.NewTemplateLoaders(store)
+	validationOptions := parsers.DefaultValidationOptions()
+	validationOptions.FontDir = fontDir
+	validationOptions.ImageDir = imageDir
+	validator := parsers.NewTemplateValidator(validationOptions)
+
 	return &CSVTemplateHandler{
-		parser:    parsers.NewCSVParser(),
+		loaders:   loaders,
+		validator: validator,
 		generator: generator,
+		store:     store,
+		templates: templates.NewRegistry(loaders, validator),
 	}
 }
 
@@ -50,11 +88,18 @@ func (h *CSVTemplateHandler) HandleCSVTemplate(c *gin.Context) {
 		return
 	}
 
+	options, err := generateOptions(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	utils.LogDebug("Processing CSV template request with %d fields", len(req.Fields))
 
 	// Parse CSV template
-	templatePath := "./assets/pdf_template_1.csv"
-	elements, err := h.parser.ParseCSV(templatePath)
+	elements, err := h.loaders.Load(defaultTemplate)
 	if err != nil {
 		utils.LogError("Error parsing CSV template: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -66,26 +111,16 @@ func (h *CSVTemplateHandler) HandleCSVTemplate(c *gin.Context) {
 	utils.LogInfo("Successfully parsed %d elements from CSV template", len(elements))
 
 	// Generate PDF in memory
-	pdfBytes, err := h.generator.GeneratePDFToBytes(elements, req.Fields)
+	pdfBytes, warnings, err := h.generator.GeneratePDFToBytesWithOptions(elements, req.Fields, options)
 	if err != nil {
 		utils.LogError("Error generating PDF: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "PDF generation failed",
-		})
+		writeGenerationError(c, "", err)
 		return
 	}
 
 	utils.LogInfo("Successfully generated PDF of size: %d bytes", len(pdfBytes))
 
-	// Set headers for PDF download
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Content-Disposition", "attachment; filename=invoice.pdf")
-	c.Header("Content-Type", "application/pdf")
-	c.Header("Content-Length", fmt.Sprintf("%d", len(pdfBytes)))
-
-	// Return PDF as downloadable file
-	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+	writePDF(c, "invoice.pdf", pdfBytes, h.generator.ErrorPolicy(options), warnings)
 }
 
 // HandleCSVTemplateToFile handles POST /invoice/template_csv/file (saves to file)
@@ -101,9 +136,16 @@ func (h *CSVTemplateHandler) HandleCSVTemplateToFile(c *gin.Context) {
 		return
 	}
 
+	options, err := generateOptions(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	// Parse CSV template
-	templatePath := "./assets/pdf_template_1.csv"
-	elements, err := h.parser.ParseCSV(templatePath)
+	elements, err := h.loaders.Load(defaultTemplate)
 	if err != nil {
 		utils.LogError("Error parsing CSV template: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -115,12 +157,10 @@ func (h *CSVTemplateHandler) HandleCSVTemplateToFile(c *gin.Context) {
 	// Generate PDF to file
 	outputFile := filepath.Join(os.TempDir(), fmt.Sprintf("invoice_%d.pdf",
 		c.Request.Context().Value("timestamp")))
-	err = h.generator.GeneratePDF(elements, req.Fields, outputFile)
+	warnings, err := h.generator.GeneratePDFWithOptions(elements, req.Fields, outputFile, options)
 	if err != nil {
 		utils.LogError("Error generating PDF: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "PDF generation failed",
-		})
+		writeGenerationError(c, "", err)
 		return
 	}
 
@@ -137,28 +177,21 @@ func (h *CSVTemplateHandler) HandleCSVTemplateToFile(c *gin.Context) {
 	// Clean up temporary file
 	defer os.Remove(outputFile)
 
-	// Set headers for PDF download
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Content-Disposition", "attachment; filename=invoice.pdf")
-	c.Header("Content-Type", "application/pdf")
-	c.Header("Content-Length", fmt.Sprintf("%d", len(pdfBytes)))
-
-	// Return PDF as downloadable file
-	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+	writePDF(c, "invoice.pdf", pdfBytes, h.generator.ErrorPolicy(options), warnings)
 }
 
-// HandleCacheStats handles GET /cache/stats
+// HandleCacheStats handles GET /cache/stats for the handler's template store
 func (h *CSVTemplateHandler) HandleCacheStats(c *gin.Context) {
-	stats := h.parser.GetCacheStats()
+	stats := h.loaders.CacheStats()
 	c.JSON(http.StatusOK, gin.H{
 		"cache_stats": stats,
 	})
 }
 
-// HandleCacheClear handles POST /cache/clear
+// HandleCacheClear handles POST /cache/clear for the handler's template
+// store; templates cached from other stores are kept
 func (h *CSVTemplateHandler) HandleCacheClear(c *gin.Context) {
-	h.parser.ClearCache()
+	h.loaders.ClearCache()
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Cache cleared successfully",
 	})
@@ -168,11 +201,13 @@ func (h *CSVTemplateHandler) HandleCacheClear(c *gin.Context) {
 func (h *CSVTemplateHandler) HandleCustomTemplate(c *gin.Context) {
 	utils.LogInfo("Received request for custom template-based PDF generation")
 
-	// Get template path from query parameter
+	// Get template path from query parameter. Paths such as
+	// ./assets/invoice.csv name invoice.csv in the template store.
 	templatePath := c.Query("template")
 	if templatePath == "" {
-		templatePath = "./assets/pdf_template_1.csv" // Default template
+		templatePath = defaultTemplate
 	}
+	templatePath = strings.TrimPrefix(path.Clean(templatePath), "assets/")
 
 	var req models.CSVTemplateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -183,79 +218,46 @@ func (h *CSVTemplateHandler) HandleCustomTemplate(c *gin.Context) {
 		return
 	}
 
-	// Validate template path (security check)
-	if !h.isValidTemplatePath(templatePath) {
-		utils.LogError("Invalid template path: %s", templatePath)
+	options, err := generateOptions(req)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid template path",
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// Parse CSV template
-	elements, err := h.parser.ParseCSV(templatePath)
+	// Validate template path (security check)
+	templatePath, err = h.templateFile(templatePath, 0)
 	if err != nil {
-		utils.LogError("Error parsing CSV template: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to parse CSV template",
+		utils.LogError("Invalid template path %s: %v", c.Query("template"), err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid template path",
+			"details": err.Error(),
 		})
 		return
 	}
 
-	// Generate PDF
-	pdfBytes, err := h.generator.GeneratePDFToBytes(elements, req.Fields)
+	// Parse template
+	elements, err := h.loaders.Load(templatePath)
 	if err != nil {
-		utils.LogError("Error generating PDF: %v", err)
+		utils.LogError("Error parsing template: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "PDF generation failed",
+			"error": "Failed to parse template",
 		})
 		return
 	}
 
-	utils.LogInfo("Successfully generated custom template PDF of size: %d bytes", len(pdfBytes))
-
-	// Set headers for PDF download
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Content-Disposition", "attachment; filename=custom_invoice.pdf")
-	c.Header("Content-Type", "application/pdf")
-	c.Header("Content-Length", fmt.Sprintf("%d", len(pdfBytes)))
-
-	// Return PDF
-	c.Data(http.StatusOK, "application/pdf", pdfBytes)
-}
-
-// isValidTemplatePath validates that the template path is safe
-func (h *CSVTemplateHandler) isValidTemplatePath(templatePath string) bool {
-	// Only allow files in the assets directory
-	absPath, err := filepath.Abs(templatePath)
-	if err != nil {
-		return false
-	}
-
-	assetsDir, err := filepath.Abs("./assets")
-	if err != nil {
-		return false
-	}
-
-	// Check if the path is within the assets directory
-	relPath, err := filepath.Rel(assetsDir, absPath)
+	// Generate PDF
+	pdfBytes, warnings, err := h.generator.GeneratePDFToBytesWithOptions(elements, req.Fields, options)
 	if err != nil {
-		return false
-	}
-
-	// Prevent directory traversal
-	if strings.Contains(relPath, "..") {
-		return false
+		utils.LogError("Error generating PDF: %v", err)
+		writeGenerationError(c, templatePath, err)
+		return
 	}
 
-	// Check if file exists and is a CSV file
-	if !strings.HasSuffix(strings.ToLower(templatePath), ".csv") {
-		return false
-	}
+	utils.LogInfo("Successfully generated custom template PDF of size: %d bytes", len(pdfBytes))
 
-	_, err = os.Stat(templatePath)
-	return err == nil
+	writePDF(c, "custom_invoice.pdf", pdfBytes, h.generator.ErrorPolicy(options), warnings)
 }
 
 // HandleDynamicTemplate handles GET/POST /invoice/template/:template_name
@@ -282,16 +284,15 @@ func (h *CSVTemplateHandler) HandleDynamicTemplate(c *gin.Context) {
 		return
 	}
 
-	// Construct full template path
-	templatePath := h.buildTemplatePath(templateName)
-
-	// Validate template path for security
-	if !h.isValidTemplatePath(templatePath) {
-		utils.LogError("Invalid or unsafe template path: %s", templatePath)
+	// Find the template, or the version pinned with ?version=N
+	templatePath, err := h.resolveTemplate(templateName, c.Query("version"))
+	if err != nil {
+		utils.LogError("Invalid template %s: %v", templateName, err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":    "Invalid template name or template not found",
 			"template": templateName,
-			"note":     "Template must exist in assets directory and be a .csv file",
+			"details":  err.Error(),
+			"note":     "Template must exist in the template store and be a .csv, .json, .yaml or .yml file",
 		})
 		return
 	}
@@ -307,14 +308,23 @@ func (h *CSVTemplateHandler) HandleDynamicTemplate(c *gin.Context) {
 		return
 	}
 
+	options, err := generateOptions(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    err.Error(),
+			"template": templateName,
+		})
+		return
+	}
+
 	utils.LogDebug("Processing dynamic template request for %s with %d fields", templateName, len(req.Fields))
 
-	// Parse CSV template
-	elements, err := h.parser.ParseCSV(templatePath)
+	// Parse template
+	elements, err := h.loaders.Load(templatePath)
 	if err != nil {
-		utils.LogError("Error parsing CSV template %s: %v", templatePath, err)
+		utils.LogError("Error parsing template %s: %v", templatePath, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":    "Failed to parse CSV template",
+			"error":    "Failed to parse template",
 			"template": templateName,
 			"details":  err.Error(),
 		})
@@ -323,30 +333,50 @@ func (h *CSVTemplateHandler) HandleDynamicTemplate(c *gin.Context) {
 
 	utils.LogInfo("Successfully parsed %d elements from template: %s", len(elements), templateName)
 
-	// Generate PDF in memory
-	pdfBytes, err := h.generator.GeneratePDFToBytes(elements, req.Fields)
+	// Check the request fields against the template's variables. Pinned
+	// versions share the template's schema file.
+	schema, err := parsers.LoadTemplateSchema(h.store, h.buildTemplatePath(templateName), elements)
 	if err != nil {
-		utils.LogError("Error generating PDF for template %s: %v", templateName, err)
+		utils.LogError("Error loading schema for template %s: %v", templatePath, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":    "PDF generation failed",
+			"error":    "Failed to load template schema",
 			"template": templateName,
 			"details":  err.Error(),
 		})
 		return
 	}
 
+	// Computed fields such as GST totals are checked along with the request fields
+	fields, err := generators.Calculate(schema.ApplyDefaults(req.Fields), options.Calculators)
+	if err != nil {
+		utils.LogWarn("Calculation failed for template %s: %v", templateName, err)
+		writeGenerationError(c, templateName, err)
+		return
+	}
+	options.Calculators = nil
+
+	if problems := schema.Check(fields); len(problems) > 0 {
+		utils.LogWarn("Request for template %s has %d invalid fields", templateName, len(problems))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "Request fields do not match the template schema",
+			"template": templateName,
+			"fields":   problems,
+		})
+		return
+	}
+
+	// Generate PDF in memory
+	pdfBytes, warnings, err := h.generator.GeneratePDFToBytesWithOptions(elements, fields, options)
+	if err != nil {
+		utils.LogError("Error generating PDF for template %s: %v", templateName, err)
+		writeGenerationError(c, templateName, err)
+		return
+	}
+
 	utils.LogInfo("Successfully generated PDF from template %s, size: %d bytes", templateName, len(pdfBytes))
 
-	// Set headers for PDF download
 	filename := fmt.Sprintf("invoice_%s.pdf", templateName)
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	c.Header("Content-Type", "application/pdf")
-	c.Header("Content-Length", fmt.Sprintf("%d", len(pdfBytes)))
-
-	// Return PDF as downloadable file
-	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+	writePDF(c, filename, pdfBytes, h.generator.ErrorPolicy(options), warnings)
 }
 
 // HandleTemplateInfo handles GET /invoice/template/:template_name (for template info)
@@ -354,11 +384,9 @@ func (h *CSVTemplateHandler) HandleTemplateInfo(c *gin.Context) {
 	templateName := c.Param("template_name")
 	utils.LogInfo("Received template info request for: %s", templateName)
 
-	// Construct full template path
-	templatePath := h.buildTemplatePath(templateName)
-
-	// Validate template path
-	if !h.isValidTemplatePath(templatePath) {
+	// Find the template file
+	templatePath, err := h.templateFile(templateName, 0)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error":    "Template not found",
 			"template": templateName,
@@ -367,7 +395,7 @@ func (h *CSVTemplateHandler) HandleTemplateInfo(c *gin.Context) {
 	}
 
 	// Get template info without full parsing (for performance)
-	fileInfo, err := os.Stat(templatePath)
+	fileInfo, err := h.store.Stat(templatePath)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error":    "Template file not accessible",
@@ -376,56 +404,123 @@ func (h *CSVTemplateHandler) HandleTemplateInfo(c *gin.Context) {
 		return
 	}
 
-	// Try to parse template to get element count
-	elements, err := h.parser.ParseCSV(templatePath)
+	// Try to parse template to get element count and variables
+	elements, err := h.loaders.Load(templatePath)
 	elementCount := 0
-	var parseError string
+	var parseError, schemaError string
+	var schema models.TemplateSchema
 	if err != nil {
 		parseError = err.Error()
 	} else {
 		elementCount = len(elements)
+		if schema, err = parsers.LoadTemplateSchema(h.store, templatePath, elements); err != nil {
+			schemaError = err.Error()
+		}
+	}
+	if schema.Variables == nil {
+		schema.Variables = []models.TemplateVariable{}
 	}
 
 	// Get cache stats for this template
-	cacheStats := h.parser.GetCacheStats()
+	cacheStats := h.loaders.CacheStats()
 
 	c.JSON(http.StatusOK, gin.H{
 		"template": templateName,
 		"path":     templatePath,
 		"file_info": gin.H{
-			"size":     fileInfo.Size(),
-			"modified": fileInfo.ModTime(),
+			"size":     fileInfo.Size,
+			"modified": fileInfo.Modified,
+			"version":  fileInfo.Version,
 		},
-		"elements":    elementCount,
-		"parse_error": parseError,
-		"cache_stats": cacheStats,
+		"elements":     elementCount,
+		"parse_error":  parseError,
+		"schema":       schema,
+		"schema_error": schemaError,
+		"cache_stats":  cacheStats,
 		"usage": gin.H{
 			"method":       "POST",
 			"url":          fmt.Sprintf("/invoice/template/%s", templateName),
 			"content_type": "application/json",
 			"body_example": gin.H{
-				"fields": gin.H{
-					"invoiceNumber": "INV-001",
-					"customerName":  "John Doe",
-					"qrData":        "https://example.com",
-					"barcodeData":   "INV001",
-				},
+				"fields": schema.Example(),
 			},
 		},
 	})
 }
 
-// buildTemplatePath constructs the full path to a template file
+// HandleValidateTemplate handles POST /templates/validate
+// With ?template=name it lints a template from the template store, otherwise
+// it lints the request body using ?format=csv|json|yaml (csv by default).
+func (h *CSVTemplateHandler) HandleValidateTemplate(c *gin.Context) {
+	var diagnostics []models.Diagnostic
+	var err error
+
+	templateName := c.Query("template")
+	if templateName != "" {
+		utils.LogInfo("Received template validation request for: %s", templateName)
+
+		templatePath, err := h.templateFile(templateName, 0)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":    "Template not found",
+				"template": templateName,
+			})
+			return
+		}
+		diagnostics, err = h.validator.ValidateFile(h.store, templatePath)
+	} else {
+		format := c.DefaultQuery("format", "csv")
+		utils.LogInfo("Received template validation request for %s body", format)
+		diagnostics, err = h.validator.Validate(c.Request.Body, format)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Failed to validate template",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == models.SeverityError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+	if diagnostics == nil {
+		diagnostics = []models.Diagnostic{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"template":    templateName,
+		"valid":       errorCount == 0,
+		"errors":      errorCount,
+		"warnings":    warningCount,
+		"diagnostics": diagnostics,
+	})
+}
+
+// buildTemplatePath constructs the path of a template file in the template store
 func (h *CSVTemplateHandler) buildTemplatePath(templateName string) string {
 	// Clean the template name
 	templateName = strings.TrimSpace(templateName)
 
-	// Remove any existing .csv extension to avoid double extension
-	templateName = strings.TrimSuffix(templateName, ".csv")
+	// Keep an explicit template extension
+	if h.loaders.Supports(templateName) {
+		return templateName
+	}
 
-	// Add .csv extension
-	filename := templateName + ".csv"
+	// Otherwise use the first supported format that exists
+	for _, extension := range h.loaders.Extensions() {
+		if _, err := h.store.Stat(templateName + extension); err == nil {
+			return templateName + extension
+		}
+	}
 
-	// Construct full path
-	return filepath.Join("./assets", filename)
+	// Default to a CSV template
+	return templateName + ".csv"
 }
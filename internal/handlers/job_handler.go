@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/generators"
+	"pdf-gen-simple/internal/jobs"
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/parsers"
+	"pdf-gen-simple/internal/tenants"
+	"pdf-gen-simple/internal/utils"
+)
+
+// JobHandler serves the asynchronous job API
+type JobHandler struct {
+	templates *CSVTemplateHandler
+	tenants   *TenantHandlers
+	manager   *jobs.Manager
+}
+
+// NewJobHandler creates a job handler that renders with the template handler
+// and keeps jobs in store. Unfinished jobs found in the store are run again.
+func NewJobHandler(templates *CSVTemplateHandler, store jobs.Store, config jobs.Config) (*JobHandler, error) {
+	return startJobHandler(&JobHandler{templates: templates}, store, config)
+}
+
+// NewTenantJobHandler creates a job handler that renders each job with the
+// template handler of the tenant that submitted it. Tenants only see their
+// own jobs and dead letters.
+func NewTenantJobHandler(tenants *TenantHandlers, store jobs.Store, config jobs.Config) (*JobHandler, error) {
+	return startJobHandler(&JobHandler{tenants: tenants}, store, config)
+}
+
+// startJobHandler starts the job manager of a job handler
+func startJobHandler(h *JobHandler, store jobs.Store, config jobs.Config) (*JobHandler, error) {
+	h.manager = jobs.NewManager(store, h.run, config)
+	if err := h.manager.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start jobs: %w", err)
+	}
+	return h, nil
+}
+
+// Stop stops the job manager, see jobs.Manager.Stop. Call it when the server
+// shuts down.
+func (h *JobHandler) Stop(ctx context.Context) error {
+	return h.manager.Stop(ctx)
+}
+
+// templatesFor returns the template handler and the tenant of a request. The
+// tenant is empty without tenants.
+func (h *JobHandler) templatesFor(c *gin.Context) (*CSVTemplateHandler, string, bool) {
+	if h.tenants == nil {
+		return h.templates, "", true
+	}
+	templates, ok := h.tenants.handler(c)
+	return templates, c.GetString(tenantKey), ok
+}
+
+// run renders a job with the template handler of its tenant
+func (h *JobHandler) run(ctx context.Context, job jobs.Job, request models.JobRequest, progress func(done, total int)) (*jobs.Output, error) {
+	if h.tenants == nil {
+		return h.templates.runJob(ctx, request, progress)
+	}
+	templates, ok := h.tenants.handlers[job.Tenant]
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant %q", job.Tenant)
+	}
+	return templates.runJob(ctx, request, progress)
+}
+
+// job returns the job named by the request, if it belongs to the request's
+// tenant. Other tenants' jobs are reported as not found, and requests without
+// a tenant get tenants.ErrUnauthorized.
+func (h *JobHandler) job(c *gin.Context) (*jobs.Job, error) {
+	_, tenant, ok := h.templatesFor(c)
+	if !ok {
+		return nil, tenants.ErrUnauthorized
+	}
+	job, err := h.manager.Get(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if job.Tenant != tenant {
+		return nil, jobs.ErrNotFound
+	}
+	return job, nil
+}
+
+// HandleSubmitJob handles POST /jobs
+func (h *JobHandler) HandleSubmitJob(c *gin.Context) {
+	templates, tenant, ok := h.templatesFor(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": tenants.ErrUnauthorized.Error(),
+		})
+		return
+	}
+
+	var req models.JobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request format: %v", err),
+		})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if _, err := generators.ParseErrorPolicy(req.ErrorPolicy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    err.Error(),
+			"template": req.Template,
+		})
+		return
+	}
+	if _, err := templates.templateFile(req.Template, req.Version); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid template name or template not found",
+			"template": req.Template,
+			"details":  err.Error(),
+		})
+		return
+	}
+
+	job, err := h.manager.Submit(tenant, req)
+	if errors.Is(err, jobs.ErrCallbacksDisabled) || errors.Is(err, jobs.ErrCallbackNotAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrStopped) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		utils.LogError("Error submitting job for template %s: %v", req.Template, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to submit job",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Location", "/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, jobResponse(job))
+}
+
+// HandleJobStatus handles GET /jobs/:id
+func (h *JobHandler) HandleJobStatus(c *gin.Context) {
+	job, err := h.job(c)
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, jobResponse(job))
+}
+
+// HandleJobResult handles GET /jobs/:id/result
+func (h *JobHandler) HandleJobResult(c *gin.Context) {
+	if _, err := h.job(c); err != nil {
+		writeJobError(c, err)
+		return
+	}
+
+	job, data, err := h.manager.Result(c.Param("id"))
+	if errors.Is(err, jobs.ErrNotFinished) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Job has no result",
+			"job":   jobResponse(job),
+		})
+		return
+	}
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", job.Result.Filename))
+	c.Data(http.StatusOK, job.Result.ContentType, data)
+}
+
+// HandleCancelJob handles DELETE /jobs/:id
+func (h *JobHandler) HandleCancelJob(c *gin.Context) {
+	if _, err := h.job(c); err != nil {
+		writeJobError(c, err)
+		return
+	}
+
+	job, err := h.manager.Cancel(c.Param("id"))
+	if errors.Is(err, jobs.ErrFinished) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"job":   jobResponse(job),
+		})
+		return
+	}
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, jobResponse(job))
+}
+
+// HandleDeadLetters handles GET /webhooks/dead-letters
+func (h *JobHandler) HandleDeadLetters(c *gin.Context) {
+	_, tenant, ok := h.templatesFor(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": tenants.ErrUnauthorized.Error(),
+		})
+		return
+	}
+
+	letters, err := h.manager.DeadLetters()
+	if err != nil {
+		utils.LogError("Error listing dead letters: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list dead letters",
+			"details": err.Error(),
+		})
+		return
+	}
+	own := []*jobs.DeadLetter{}
+	for _, letter := range letters {
+		if letter.Tenant == tenant {
+			own = append(own, letter)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"deadLetters": own,
+		"count":       len(own),
+	})
+}
+
+// jobResponse describes a job without its request
+func jobResponse(job *jobs.Job) gin.H {
+	response := gin.H{
+		"id":        job.ID,
+		"status":    job.Status,
+		"template":  job.Template,
+		"progress":  job.Progress,
+		"createdAt": job.CreatedAt,
+	}
+	if job.StartedAt != nil {
+		response["startedAt"] = job.StartedAt
+	}
+	if job.FinishedAt != nil {
+		response["finishedAt"] = job.FinishedAt
+	}
+	if job.ExpiresAt != nil {
+		response["expiresAt"] = job.ExpiresAt
+	}
+	if job.Error != "" {
+		response["error"] = job.Error
+	}
+	if job.Manifest != nil {
+		response["manifest"] = job.Manifest
+	}
+	if job.Callback != nil {
+		response["callback"] = job.Callback
+	}
+	if job.Result != nil {
+		response["result"] = job.Result
+		response["resultUrl"] = "/jobs/" + job.ID + "/result"
+	}
+	return response
+}
+
+// writeJobError responds to a failed job lookup
+func writeJobError(c *gin.Context, err error) {
+	if errors.Is(err, tenants.ErrUnauthorized) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, jobs.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Job not found or expired",
+			"id":    c.Param("id"),
+		})
+		return
+	}
+	utils.LogError("Error reading job %s: %v", c.Param("id"), err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "Failed to read job",
+		"details": err.Error(),
+	})
+}
+
+// runJob renders a job's records as a batch. A job with fields renders one
+// PDF; a job with records renders a ZIP or a merged PDF.
+func (h *CSVTemplateHandler) runJob(ctx context.Context, req models.JobRequest, progress func(done, total int)) (*jobs.Output, error) {
+	templatePath, err := h.templateFile(req.Template, req.Version)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %w", req.Template, err)
+	}
+	options, err := generateOptions(models.CSVTemplateRequest{ErrorPolicy: req.ErrorPolicy, GST: req.GST})
+	if err != nil {
+		return nil, err
+	}
+	elements, err := h.loaders.Load(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	schema, err := parsers.LoadTemplateSchema(h.store, h.buildTemplatePath(req.Template), elements)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template schema: %w", err)
+	}
+
+	b := newBatch(req.Template, elements, schema, req.JobRecords(), generators.BatchOptions{GenerateOptions: options})
+	total := len(b.items)
+	checked := total - len(b.records)
+	progress(checked, total)
+	b.options.Progress = func(done int) {
+		progress(checked+done, total)
+	}
+
+	output := &jobs.Output{}
+	switch {
+	case req.Records == nil:
+		output.Filename = fmt.Sprintf("invoice_%s.pdf", req.Template)
+		output.ContentType = "application/pdf"
+		output.Data, err = h.renderMerged(ctx, b, false)
+	case req.Output == batchOutputPDF:
+		output.Filename = fmt.Sprintf("batch_%s.pdf", req.Template)
+		output.ContentType = "application/pdf"
+		output.Data, err = h.renderMerged(ctx, b, true)
+	default:
+		pattern := req.Filename
+		if pattern == "" {
+			pattern = req.Template + "_{{index}}.pdf"
+		}
+		output.Filename = fmt.Sprintf("batch_%s.zip", req.Template)
+		output.ContentType = "application/zip"
+		output.Data, err = h.renderZip(ctx, b, pattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if output.Manifest, err = json.Marshal(b.items); err != nil {
+		return nil, err
+	}
+	if b.failed() == total {
+		if req.Records == nil {
+			return output, errors.New(b.items[0].Error)
+		}
+		return output, errors.New("every record of the batch failed")
+	}
+	return output, nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/jobs"
+	"pdf-gen-simple/internal/tenants"
+)
+
+// newTestTenantJobHandler creates a job handler for the tenants of
+// newTestTenantHandlers
+func newTestTenantJobHandler(t *testing.T) *JobHandler {
+	t.Helper()
+	h, err := NewTenantJobHandler(newTestTenantHandlers(t), jobs.NewMemoryStore(), jobs.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Stop(context.Background()) })
+	return h
+}
+
+func TestTenantJobs(t *testing.T) {
+	h := newTestTenantJobHandler(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	authenticated := r.Group("/", h.tenants.Middleware())
+	authenticated.POST("/jobs", h.HandleSubmitJob)
+	authenticated.GET("/jobs/:id", h.HandleJobStatus)
+	// Routes mounted without the middleware have no tenant
+	r.GET("/open/jobs/:id", h.HandleJobStatus)
+	r.GET("/open/jobs/:id/result", h.HandleJobResult)
+	r.DELETE("/open/jobs/:id", h.HandleCancelJob)
+	r.GET("/open/webhooks/dead-letters", h.HandleDeadLetters)
+
+	send := func(method, target, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set(tenants.DefaultAPIKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/jobs", "acme", `{"template": "invoice", "fields": {"invoiceNumber": "INV-1", "code": "QR"}}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("submit: status %d: %s", w.Code, w.Body.String())
+	}
+	var job struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := send(http.MethodGet, "/jobs/"+job.ID, "acme", ""); w.Code != http.StatusOK {
+		t.Errorf("status for its tenant: %d: %s", w.Code, w.Body.String())
+	}
+	// Other tenants can't tell the job exists
+	if w := send(http.MethodGet, "/jobs/"+job.ID, "globex", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status for another tenant: %d, want 404", w.Code)
+	}
+
+	tests := []struct {
+		method, target string
+	}{
+		{http.MethodGet, "/open/jobs/" + job.ID},
+		{http.MethodGet, "/open/jobs/" + job.ID + "/result"},
+		{http.MethodDelete, "/open/jobs/" + job.ID},
+		{http.MethodGet, "/open/jobs/unknown"},
+		{http.MethodGet, "/open/webhooks/dead-letters"},
+	}
+	for _, tt := range tests {
+		if w := send(tt.method, tt.target, "", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a tenant: status %d, want 401", tt.method, tt.target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/parsers"
+	"pdf-gen-simple/internal/utils"
+)
+
+// HandleLabelSheet handles POST /labels/template/:template_name
+// It prints one label per record onto sheets of label stock.
+func (h *CSVTemplateHandler) HandleLabelSheet(c *gin.Context) {
+	templateName := c.Param("template_name")
+	utils.LogInfo("Received label sheet request for template: %s", templateName)
+
+	templatePath, err := h.resolveTemplate(templateName, c.Query("version"))
+	if err != nil {
+		utils.LogError("Invalid template %s: %v", templateName, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid template name or template not found",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+
+	var req models.LabelSheetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.LogError("Error binding JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    fmt.Sprintf("Invalid request format: %v", err),
+			"template": templateName,
+		})
+		return
+	}
+
+	if len(req.Records) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "At least one record is required",
+			"template": templateName,
+		})
+		return
+	}
+	if err := req.Sheet.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    fmt.Sprintf("Invalid label sheet: %v", err),
+			"template": templateName,
+		})
+		return
+	}
+
+	options, err := generateOptions(models.CSVTemplateRequest{ErrorPolicy: req.ErrorPolicy})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    err.Error(),
+			"template": templateName,
+		})
+		return
+	}
+
+	elements, err := h.loaders.Load(templatePath)
+	if err != nil {
+		utils.LogError("Error parsing template %s: %v", templatePath, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Failed to parse template",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+
+	// Check every record against the template's variables
+	schema, err := parsers.LoadTemplateSchema(h.store, h.buildTemplatePath(templateName), elements)
+	if err != nil {
+		utils.LogError("Error loading schema for template %s: %v", templatePath, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Failed to load template schema",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+
+	records := req.LabelRecords()
+	var problems []models.FieldError
+	for i, record := range records {
+		records[i] = schema.ApplyDefaults(record)
+		for _, problem := range schema.Check(records[i]) {
+			problem.Field = fmt.Sprintf("records[%d].%s", i, problem.Field)
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		utils.LogWarn("Label request for template %s has %d invalid fields", templateName, len(problems))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "Request records do not match the template schema",
+			"template": templateName,
+			"fields":   problems,
+		})
+		return
+	}
+
+	pdfBytes, warnings, err := h.generator.GenerateLabelSheetsToBytes(elements, records, req.Sheet, options)
+	if errors.Is(err, models.ErrLabelsDontFit) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid label sheet",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		utils.LogError("Error generating labels for template %s: %v", templateName, err)
+		writeGenerationError(c, templateName, err)
+		return
+	}
+
+	utils.LogInfo("Successfully generated %d labels from template %s, size: %d bytes", len(records), templateName, len(pdfBytes))
+
+	filename := fmt.Sprintf("labels_%s.pdf", templateName)
+	writePDF(c, filename, pdfBytes, h.generator.ErrorPolicy(options), warnings)
+}
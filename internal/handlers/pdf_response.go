@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/generators"
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/tax"
+	"pdf-gen-simple/internal/utils"
+)
+
+// Response headers used in report mode
+const (
+	warningCountHeader = "X-PDF-Warning-Count"
+	warningsHeader     = "X-PDF-Warnings"
+)
+
+// generateOptions builds the generator options for a request
+func generateOptions(req models.CSVTemplateRequest) (generators.GenerateOptions, error) {
+	policy, err := generators.ParseErrorPolicy(req.ErrorPolicy)
+	if err != nil {
+		return generators.GenerateOptions{}, err
+	}
+
+	options := generators.GenerateOptions{ErrorPolicy: policy}
+	if req.GST != nil {
+		options.Calculators = append(options.Calculators, tax.NewGSTCalculator(*req.GST))
+	}
+	return options, nil
+}
+
+// writeGenerationError responds to a failed PDF generation. Rejected request
+// data and elements that failed in strict mode are reported with a 422 status.
+func writeGenerationError(c *gin.Context, templateName string, err error) {
+	var calculationErr *generators.CalculationError
+	if errors.As(err, &calculationErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "Calculation failed",
+			"template": templateName,
+			"details":  calculationErr.Err.Error(),
+		})
+		return
+	}
+
+	var renderErr *generators.RenderError
+	if errors.As(err, &renderErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "PDF generation failed",
+			"template": templateName,
+			"details":  err.Error(),
+			"elements": renderErr.Elements,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":    "PDF generation failed",
+		"template": templateName,
+		"details":  err.Error(),
+	})
+}
+
+// writePDF sends a generated PDF. In report mode the elements that failed are
+// returned in the X-PDF-Warnings header, or in a JSON envelope together with
+// the base64 encoded PDF if the client accepts JSON.
+func writePDF(c *gin.Context, filename string, pdfBytes []byte, policy generators.ErrorPolicy, warnings []generators.ElementError) {
+	if policy == generators.ErrorPolicyReport {
+		if warnings == nil {
+			warnings = []generators.ElementError{}
+		}
+
+		if strings.Contains(c.GetHeader("Accept"), "application/json") {
+			c.JSON(http.StatusOK, gin.H{
+				"filename": filename,
+				"pdf":      base64.StdEncoding.EncodeToString(pdfBytes),
+				"warnings": warnings,
+			})
+			return
+		}
+
+		encoded, err := json.Marshal(warnings)
+		if err != nil {
+			utils.LogError("Error encoding render warnings: %v", err)
+		} else {
+			c.Header(warningsHeader, string(encoded))
+		}
+		c.Header(warningCountHeader, fmt.Sprintf("%d", len(warnings)))
+	}
+
+	// Set headers for PDF download
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Length", fmt.Sprintf("%d", len(pdfBytes)))
+
+	// Return PDF as downloadable file
+	c.Data(http.StatusOK, "application/pdf", pdfBytes)
+}
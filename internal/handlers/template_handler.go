@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/storage"
+	"pdf-gen-simple/internal/templates"
+	"pdf-gen-simple/internal/utils"
+)
+
+// maxTemplateSize limits the size of uploaded templates
+const maxTemplateSize = 5 << 20
+
+// templateContentTypes are the content types template sources are served as
+var templateContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"json": "application/json; charset=utf-8",
+	"yaml": "application/yaml; charset=utf-8",
+	"yml":  "application/yaml; charset=utf-8",
+}
+
+// HandleListTemplates handles GET /templates
+// Archived templates are included with ?archived=true.
+func (h *CSVTemplateHandler) HandleListTemplates(c *gin.Context) {
+	list, err := h.templates.List(c.Query("archived") == "true")
+	if err != nil {
+		utils.LogError("Error listing templates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list templates",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": list,
+		"count":     len(list),
+	})
+}
+
+// HandleGetTemplate handles GET /templates/:template_name
+func (h *CSVTemplateHandler) HandleGetTemplate(c *gin.Context) {
+	templateName := c.Param("template_name")
+
+	template, err := h.templates.Get(templateName)
+	if err != nil {
+		writeTemplateError(c, templateName, err)
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// HandleUploadTemplate handles PUT /templates/:template_name
+// The body is the template source in the format given by ?format=csv|json|yaml
+// (csv by default). The template is validated, stored as a new version and
+// becomes the template's current source.
+func (h *CSVTemplateHandler) HandleUploadTemplate(c *gin.Context) {
+	templateName := c.Param("template_name")
+	format := c.DefaultQuery("format", "csv")
+	utils.LogInfo("Received upload of %s template: %s", format, templateName)
+
+	source, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxTemplateSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "Template is too large",
+			"template": templateName,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Failed to read template",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+		return
+	}
+	if len(source) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Template source is required",
+			"template": templateName,
+		})
+		return
+	}
+
+	version, diagnostics, err := h.templates.Upload(templateName, format, source)
+	if err != nil {
+		writeTemplateError(c, templateName, err)
+		return
+	}
+	if diagnostics == nil {
+		diagnostics = []models.Diagnostic{}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"template":    templateName,
+		"version":     version,
+		"diagnostics": diagnostics,
+	})
+}
+
+// HandleTemplateSource handles GET /templates/:template_name/source
+// A version is returned with ?version=N, otherwise the current source.
+func (h *CSVTemplateHandler) HandleTemplateSource(c *gin.Context) {
+	templateName := c.Param("template_name")
+
+	version, err := parseTemplateVersion(c.Query("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    err.Error(),
+			"template": templateName,
+		})
+		return
+	}
+	source, format, err := h.templates.Source(templateName, version)
+	if err != nil {
+		writeTemplateError(c, templateName, err)
+		return
+	}
+
+	c.Data(http.StatusOK, templateContentTypes[format], source)
+}
+
+// HandleArchiveTemplate handles POST /templates/:template_name/archive
+func (h *CSVTemplateHandler) HandleArchiveTemplate(c *gin.Context) {
+	templateName := c.Param("template_name")
+
+	if err := h.templates.Archive(templateName); err != nil {
+		writeTemplateError(c, templateName, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Template archived",
+		"template": templateName,
+	})
+}
+
+// HandleDeleteTemplate handles DELETE /templates/:template_name
+// The template is removed together with all its versions.
+func (h *CSVTemplateHandler) HandleDeleteTemplate(c *gin.Context) {
+	templateName := c.Param("template_name")
+
+	if err := h.templates.Delete(templateName); err != nil {
+		writeTemplateError(c, templateName, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Template deleted",
+		"template": templateName,
+	})
+}
+
+// resolveTemplate returns the file to generate a template from: its current
+// source, or the version pinned by a ?version value
+func (h *CSVTemplateHandler) resolveTemplate(templateName, version string) (string, error) {
+	number, err := parseTemplateVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return h.templateFile(templateName, number)
+}
+
+// templateFile returns the current source of a template, or a pinned version
+// if version is greater than 0. Archived templates and hidden files such as
+// old versions are refused, see templates.Registry.File.
+func (h *CSVTemplateHandler) templateFile(templateName string, version int) (string, error) {
+	return h.templates.File(strings.TrimSpace(templateName), version)
+}
+
+// parseTemplateVersion parses a ?version value; an empty value is 0
+func parseTemplateVersion(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid version %q", value)
+	}
+	return version, nil
+}
+
+// writeTemplateError responds to a failed template operation
+func writeTemplateError(c *gin.Context, templateName string, err error) {
+	var invalid *templates.InvalidTemplateError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":       "Template is invalid",
+			"template":    templateName,
+			"diagnostics": invalid.Diagnostics,
+		})
+	case errors.Is(err, templates.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":    "Template not found",
+			"template": templateName,
+		})
+	case errors.Is(err, storage.ErrReadOnly):
+		c.JSON(http.StatusMethodNotAllowed, gin.H{
+			"error":    err.Error(),
+			"template": templateName,
+		})
+	case errors.Is(err, templates.ErrArchived), errors.Is(err, templates.ErrInvalidName), errors.Is(err, templates.ErrUnsupportedFormat):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    err.Error(),
+			"template": templateName,
+		})
+	default:
+		utils.LogError("Template operation on %s failed: %v", templateName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Template operation failed",
+			"template": templateName,
+			"details":  err.Error(),
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/templates"
+)
+
+func TestArchivedTemplateCantBeGenerated(t *testing.T) {
+	h := newTestHandler(t, nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/templates/:template_name", h.HandleUploadTemplate)
+	r.POST("/templates/:template_name/archive", h.HandleArchiveTemplate)
+	r.POST("/invoice/template/:template_name", h.HandleDynamicTemplate)
+	r.POST("/invoice/template/:template_name/batch", h.HandleBatch)
+	r.POST("/invoice/custom_template", h.HandleCustomTemplate)
+
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	for _, source := range []string{batchTemplate, strings.Replace(batchTemplate, "{{invoiceNumber}}", "Invoice {{invoiceNumber}}", 1)} {
+		if w := send(http.MethodPut, "/templates/invoice", source); w.Code != http.StatusCreated {
+			t.Fatalf("upload: status %d: %s", w.Code, w.Body.String())
+		}
+	}
+	fields := `{"fields": {"invoiceNumber": "INV-1", "code": "QR"}}`
+	records := `[{"invoiceNumber": "INV-1", "code": "QR"}]`
+	for _, target := range []string{"/invoice/template/invoice", "/invoice/template/invoice?version=1", "/invoice/template/invoice.csv", "/invoice/custom_template?template=invoice.csv"} {
+		if w := send(http.MethodPost, target, fields); w.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", target, w.Code, w.Body.String())
+		}
+	}
+	if w := send(http.MethodPost, "/invoice/template/invoice/batch", records); w.Code != http.StatusOK {
+		t.Errorf("batch: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// The hidden version files can only be used through ?version
+	hidden := []string{
+		"/invoice/template/.invoice.v1.csv",
+		"/invoice/template/.invoice.v1",
+		"/invoice/template/.invoice.versions.json",
+		"/invoice/custom_template?template=.invoice.v1.csv",
+		"/invoice/custom_template?template=./assets/.invoice.v1.csv",
+	}
+	for _, target := range hidden {
+		if w := send(http.MethodPost, target, fields); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, w.Code)
+		}
+	}
+	if w := send(http.MethodPost, "/invoice/template/.invoice.v1.csv/batch", records); w.Code != http.StatusBadRequest {
+		t.Errorf("batch of a hidden version: status %d, want 400", w.Code)
+	}
+
+	if w := send(http.MethodPost, "/templates/invoice/archive", ""); w.Code != http.StatusOK {
+		t.Fatalf("archive: status %d: %s", w.Code, w.Body.String())
+	}
+	archived := append([]string{"/invoice/template/invoice", "/invoice/template/invoice?version=1", "/invoice/template/invoice.csv"}, hidden...)
+	for _, target := range archived {
+		if w := send(http.MethodPost, target, fields); w.Code != http.StatusBadRequest {
+			t.Errorf("%s of an archived template: status %d, want 400", target, w.Code)
+		}
+	}
+	if w := send(http.MethodPost, "/invoice/template/invoice/batch", records); w.Code != http.StatusBadRequest {
+		t.Errorf("batch of an archived template: status %d, want 400", w.Code)
+	}
+}
+
+// TestArchivedTemplateCopyCantBeGenerated covers a template file copied back
+// into the store after the template was archived
+func TestArchivedTemplateCopyCantBeGenerated(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"invoice.csv": batchTemplate})
+	if _, _, err := h.templates.Upload("invoice", "csv", []byte(batchTemplate)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.templates.Archive("invoice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.store.WriteFile("invoice.csv", []byte(batchTemplate)); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"invoice", "invoice.csv"} {
+		if _, err := h.templateFile(name, 0); !errors.Is(err, templates.ErrArchived) {
+			t.Errorf("templateFile(%q): error = %v, want ErrArchived", name, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/tenants"
+	"pdf-gen-simple/internal/utils"
+)
+
+// tenantKey is the gin context key of the request's tenant
+const tenantKey = "tenant"
+
+// TenantHandlers serves every tenant from its own templates, images and fonts
+type TenantHandlers struct {
+	registry *tenants.Registry
+	handlers map[string]*CSVTemplateHandler
+}
+
+// NewTenantHandlers creates a template handler for each tenant of registry
+func NewTenantHandlers(registry *tenants.Registry) *TenantHandlers {
+	t := &TenantHandlers{
+		registry: registry,
+		handlers: make(map[string]*CSVTemplateHandler),
+	}
+	for _, tenant := range registry.Tenants() {
+		t.handlers[tenant.ID] = NewTenantCSVTemplateHandler(tenant)
+	}
+	return t
+}
+
+// Middleware identifies the tenant of each request and applies its rate
+// limit. Requests without a valid API key are refused with 401 and requests
+// over the limit with 429.
+func (t *TenantHandlers) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := t.registry.Identify(c.Request)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, tenants.ErrUnknownTenant) {
+				status = http.StatusForbidden
+			}
+			c.AbortWithStatusJSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if ok, wait := t.registry.Allow(tenant); !ok {
+			utils.LogWarn("Rate limit reached for tenant %s", tenant.ID)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":  "Rate limit exceeded",
+				"tenant": tenant.ID,
+			})
+			return
+		}
+
+		c.Set(tenantKey, tenant.ID)
+		c.Next()
+	}
+}
+
+// Route serves a request with the template handler of its tenant, for
+// example:
+//
+//	r.POST("/invoice/template/:template_name", t.Route((*CSVTemplateHandler).HandleDynamicTemplate))
+func (t *TenantHandlers) Route(handle func(*CSVTemplateHandler, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h, ok := t.handler(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": tenants.ErrUnauthorized.Error(),
+			})
+			return
+		}
+		handle(h, c)
+	}
+}
+
+// handler returns the template handler of the request's tenant, set by Middleware
+func (t *TenantHandlers) handler(c *gin.Context) (*CSVTemplateHandler, bool) {
+	h, ok := t.handlers[c.GetString(tenantKey)]
+	return h, ok
+}
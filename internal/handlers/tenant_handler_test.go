@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"pdf-gen-simple/internal/storage"
+	"pdf-gen-simple/internal/tenants"
+)
+
+// newTestTenantHandlers creates handlers for the tenants acme and globex,
+// whose API keys are their IDs and whose stores hold batchTemplate as invoice.csv
+func newTestTenantHandlers(t *testing.T) *TenantHandlers {
+	t.Helper()
+	var config tenants.Config
+	for _, id := range []string{"acme", "globex"} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "invoice.csv"), []byte(batchTemplate), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config.Tenants = append(config.Tenants, tenants.Tenant{
+			ID:       id,
+			APIKeys:  []string{id},
+			Store:    storage.NewDirStore(dir),
+			ImageDir: dir,
+			FontDir:  "../../fonts",
+		})
+	}
+	registry, err := tenants.NewRegistry(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTenantHandlers(registry)
+}
+
+func TestTenantCacheIsolation(t *testing.T) {
+	tenantHandlers := newTestTenantHandlers(t)
+	for _, h := range tenantHandlers.handlers {
+		if _, err := h.loaders.Load("invoice.csv"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/", tenantHandlers.Middleware())
+	api.GET("/cache/stats", tenantHandlers.Route((*CSVTemplateHandler).HandleCacheStats))
+	api.POST("/cache/clear", tenantHandlers.Route((*CSVTemplateHandler).HandleCacheClear))
+
+	entries := func(apiKey string) float64 {
+		req := httptest.NewRequest(http.MethodGet, "/cache/stats", nil)
+		req.Header.Set(tenants.DefaultAPIKeyHeader, apiKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var response struct {
+			Stats map[string]interface{} `json:"cache_stats"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("stats: %v: %s", err, w.Body.String())
+		}
+		return response.Stats["entries"].(float64)
+	}
+
+	// Each tenant only sees its own cached template
+	if got := entries("acme"); got != 1 {
+		t.Errorf("acme entries = %v, want 1", got)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/cache/clear", nil)
+	req.Header.Set(tenants.DefaultAPIKeyHeader, "acme")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("clear: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := entries("acme"); got != 0 {
+		t.Errorf("acme entries after clearing = %v, want 0", got)
+	}
+	if got := entries("globex"); got != 1 {
+		t.Errorf("globex entries after acme cleared its cache = %v, want 1", got)
+	}
+}
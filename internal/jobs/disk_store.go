@@ -0,0 +1,338 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// jobIDPattern matches the IDs of jobs, which are used as file names
+var jobIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// deadLetterDir is the subdirectory of a disk store holding dead letters
+const deadLetterDir = "dead-letters"
+
+// DiskStore keeps each job in a directory as <id>.json, with its request in
+// <id>.request and its output in <id>.result, so that jobs survive restarts.
+// Progress updates only rewrite <id>.json. Dead letters are kept in the
+// dead-letters subdirectory.
+type DiskStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewDiskStore creates a job store in dir, creating the directory if needed
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, deadLetterDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// Create adds a new job with its request. The request is written first, so
+// a job file always has its request.
+func (s *DiskStore) Create(job *Job, request models.JobRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(job.ID, ".json")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("job %s already exists", job.ID)
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request of job %s: %w", job.ID, err)
+	}
+	requestPath, err := s.path(job.ID, ".request")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(requestPath, data); err != nil {
+		return err
+	}
+	return s.write(job)
+}
+
+// Get returns a job
+func (s *DiskStore) Get(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read(id)
+}
+
+// Request returns the request of a job
+func (s *DiskStore) Request(id string) (*models.JobRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(id, ".request")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request of job %s: %w", id, err)
+	}
+
+	var request models.JobRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, fmt.Errorf("failed to decode request of job %s: %w", id, err)
+	}
+	return &request, nil
+}
+
+// Update changes a job atomically
+func (s *DiskStore) Update(id string, update func(job *Job) error) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := s.read(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(job); err != nil {
+		return nil, err
+	}
+	if err := s.write(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// List returns every job. Files that can't be read are skipped.
+func (s *DiskStore) List() ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	var jobs []*Job
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !jobIDPattern.MatchString(id) {
+			continue
+		}
+		job, err := s.read(id)
+		if err != nil {
+			utils.LogWarn("Skipping job %s: %v", id, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// SaveResult stores the output of a job
+func (s *DiskStore) SaveResult(id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(id, ".result")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Result returns the output of a job
+func (s *DiskStore) Result(id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(id, ".result")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Delete removes a job, its request and its result
+func (s *DiskStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ext := range []string{".result", ".request", ".json"} {
+		path, err := s.path(id, ext)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete job %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// SaveDeadLetter records a callback that could not be delivered
+func (s *DiskStore) SaveDeadLetter(letter *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !jobIDPattern.MatchString(letter.JobID) {
+		return ErrNotFound
+	}
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter for job %s: %w", letter.JobID, err)
+	}
+	name := fmt.Sprintf("%s-%d.json", letter.JobID, letter.FailedAt.UnixNano())
+	return writeFileAtomic(filepath.Join(s.dir, deadLetterDir, name), data)
+}
+
+// DeadLetters returns the callbacks that could not be delivered, oldest
+// first. Files that can't be read are skipped.
+func (s *DiskStore) DeadLetters() ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dir, deadLetterDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	var letters []*DeadLetter
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			utils.LogWarn("Skipping dead letter %s: %v", entry.Name(), err)
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(data, &letter); err != nil {
+			utils.LogWarn("Skipping dead letter %s: %v", entry.Name(), err)
+			continue
+		}
+		letters = append(letters, &letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+// DeleteDeadLetters removes the dead letters that failed before the given
+// time. The failure time is read from the file name written by
+// SaveDeadLetter; other files are left alone.
+func (s *DiskStore) DeleteDeadLetters(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dir, deadLetterDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	deleted := 0
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || strings.HasPrefix(name, ".") {
+			continue
+		}
+		_, failedAt, ok := strings.Cut(name, "-")
+		if !ok {
+			continue
+		}
+		nanos, err := strconv.ParseInt(failedAt, 10, 64)
+		if err != nil || !time.Unix(0, nanos).Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return deleted, fmt.Errorf("failed to delete dead letter %s: %w", entry.Name(), err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// path returns the file of a job with the given extension
+func (s *DiskStore) path(id, ext string) (string, error) {
+	if !jobIDPattern.MatchString(id) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, id+ext), nil
+}
+
+// read loads a job from its file
+func (s *DiskStore) read(id string) (*Job, error) {
+	path, err := s.path(id, ".json")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job %s: %w", id, err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// write saves a job to its file
+func (s *DiskStore) write(job *Job) error {
+	path, err := s.path(job.ID, ".json")
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so a crash never leaves a partly written file behind
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// Status is the state of a job
+type Status string
+
+const (
+	// StatusQueued jobs are waiting for a worker
+	StatusQueued Status = "queued"
+	// StatusRunning jobs are being rendered
+	StatusRunning Status = "running"
+	// StatusSucceeded jobs have a result to download
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed jobs stopped with an error
+	StatusFailed Status = "failed"
+	// StatusCancelled jobs were cancelled before they finished
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished reports whether a job in this state will not change any more
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+var (
+	// ErrNotFound is returned for jobs that don't exist or have expired
+	ErrNotFound = errors.New("job not found")
+	// ErrNotFinished is returned when the result of an unfinished job is requested
+	ErrNotFinished = errors.New("job has not finished")
+	// ErrFinished is returned when a finished job is cancelled
+	ErrFinished = errors.New("job has already finished")
+	// ErrQueueFull is returned when no more jobs can be queued
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrCallbacksDisabled is returned for callbacks when no webhook secret is configured
+	ErrCallbacksDisabled = errors.New("callbacks are not configured: a webhook secret is required")
+	// ErrStopped is returned for jobs submitted after the manager was stopped
+	ErrStopped = errors.New("job manager is stopped")
+)
+
+// Job is the status of an asynchronous render. Its request, which can hold
+// thousands of records, is stored separately so that progress updates stay
+// small.
+type Job struct {
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	// Template is the name of the template the job renders
+	Template string `json:"template"`
+	// CallbackURL and CallbackInline are copied from the request
+	CallbackURL    string   `json:"callbackUrl,omitempty"`
+	CallbackInline bool     `json:"callbackInline,omitempty"`
+	Progress       Progress `json:"progress"`
+	Error          string   `json:"error,omitempty"`
+	// Manifest lists the outcome of each record
+	Manifest json.RawMessage `json:"manifest,omitempty"`
+	// Result describes the output of a succeeded job
+	Result *Result `json:"result,omitempty"`
+	// Callback records the delivery of the job's callback, if it has one
+	Callback   *Callback  `json:"callback,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// ExpiresAt is when a finished job and its result are deleted
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Tenant is the tenant that submitted the job, if tenants are configured
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Expired reports whether the job has expired at now
+func (j *Job) Expired(now time.Time) bool {
+	return j.ExpiresAt != nil && now.After(*j.ExpiresAt)
+}
+
+// Progress counts the records of a job that have been processed
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// Result describes the output of a job
+type Result struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+}
+
+// Store persists jobs, their requests and their results
+type Store interface {
+	// Create adds a new job with its request
+	Create(job *Job, request models.JobRequest) error
+	// Get returns a copy of a job
+	Get(id string) (*Job, error)
+	// Request returns the request of a job
+	Request(id string) (*models.JobRequest, error)
+	// Update changes a job atomically. The job is not saved if update fails.
+	Update(id string, update func(job *Job) error) (*Job, error)
+	// List returns copies of every job
+	List() ([]*Job, error)
+	// SaveResult stores the output of a job
+	SaveResult(id string, data []byte) error
+	// Result returns the output of a job
+	Result(id string) ([]byte, error)
+	// Delete removes a job, its request and its result
+	Delete(id string) error
+	// SaveDeadLetter records a callback that could not be delivered
+	SaveDeadLetter(letter *DeadLetter) error
+	// DeadLetters returns the callbacks that could not be delivered
+	DeadLetters() ([]*DeadLetter, error)
+	// DeleteDeadLetters removes the dead letters that failed before the
+	// given time and returns how many were removed
+	DeleteDeadLetters(before time.Time) (int, error)
+}
+
+// newJobID returns a random job ID
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
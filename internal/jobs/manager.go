@@ -0,0 +1,499 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// progressInterval limits how often the progress of a running job is saved
+const progressInterval = 500 * time.Millisecond
+
+// Config controls how jobs are run and kept
+type Config struct {
+	// Workers is the number of jobs rendered at once; it defaults to 2
+	Workers int
+	// QueueSize is the number of jobs that can wait for a worker; it defaults to 100
+	QueueSize int
+	// ResultTTL is how long finished jobs and dead letters are kept; it
+	// defaults to an hour
+	ResultTTL time.Duration
+	// CleanupInterval is how often expired jobs and dead letters are deleted;
+	// it defaults to a minute
+	CleanupInterval time.Duration
+	// Webhooks controls the delivery of job callbacks
+	Webhooks WebhookConfig
+}
+
+// Output is what a runner produced for a job
+type Output struct {
+	Data        []byte
+	Filename    string
+	ContentType string
+	// Manifest lists the outcome of each record; it is kept for failed jobs too
+	Manifest json.RawMessage
+}
+
+// Runner renders the request of a job, calling progress as records are
+// processed. It should stop once ctx is done. A runner that fails may still
+// return an output for its manifest.
+type Runner func(ctx context.Context, job Job, request models.JobRequest, progress func(done, total int)) (*Output, error)
+
+// Manager queues jobs and runs them on a pool of workers
+type Manager struct {
+	store    Store
+	run      Runner
+	config   Config
+	queue    chan string
+	notifier *notifier
+
+	// ctx is cancelled by Stop; wg tracks the goroutines that Stop waits for
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	stopped bool
+	// expiries holds when finished jobs expire, so that cleanup doesn't
+	// have to read every job
+	expiries map[string]time.Time
+}
+
+// NewManager creates a job manager. Call Start to begin running jobs.
+func NewManager(store Store, run Runner, config Config) *Manager {
+	if config.Workers <= 0 {
+		config.Workers = 2
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.ResultTTL <= 0 {
+		config.ResultTTL = time.Hour
+	}
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = time.Minute
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	return &Manager{
+		store:    store,
+		run:      run,
+		config:   config,
+		queue:    make(chan string, config.QueueSize),
+		notifier: newNotifier(store, config.Webhooks),
+		ctx:      ctx,
+		stop:     stop,
+		cancels:  make(map[string]context.CancelFunc),
+		expiries: make(map[string]time.Time),
+	}
+}
+
+// Start starts the workers. Jobs left queued or running by an earlier process
+// are queued again, and callbacks it didn't deliver are sent again. This is
+// the only time the store is listed.
+func (m *Manager) Start() error {
+	jobs, err := m.store.List()
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, job := range jobs {
+		if job.Status.Finished() {
+			m.finished(job, job.Callback != nil && job.Callback.Status == CallbackPending && !job.Expired(time.Now()))
+			continue
+		}
+		_, err := m.store.Update(job.ID, func(job *Job) error {
+			job.Status = StatusQueued
+			job.Progress = Progress{}
+			job.StartedAt = nil
+			return nil
+		})
+		if err != nil {
+			utils.LogError("Error requeueing job %s: %v", job.ID, err)
+			continue
+		}
+		pending = append(pending, job.ID)
+	}
+	if len(pending) > 0 {
+		utils.LogInfo("Requeueing %d unfinished jobs", len(pending))
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			for _, id := range pending {
+				select {
+				case m.queue <- id:
+				case <-m.ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	m.wg.Add(m.config.Workers + 1)
+	for w := 0; w < m.config.Workers; w++ {
+		go m.work()
+	}
+	go m.cleanup()
+	return nil
+}
+
+// Stop stops accepting jobs, interrupts the running jobs and the cleanup,
+// and waits until the workers and the callbacks being delivered have
+// returned or ctx is done. Interrupted jobs are left queued and undelivered
+// callbacks pending, so that the next Start picks them up. A stopped manager
+// can't be started again.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopped = true
+	m.mu.Unlock()
+	m.stop()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		utils.LogInfo("Stopped job manager")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CallbacksEnabled reports whether jobs can have callbacks, which needs a
+// webhook secret to sign them
+func (m *Manager) CallbacksEnabled() bool {
+	return m.config.Webhooks.Secret != ""
+}
+
+// Submit queues a job for a request of tenant, which is empty without tenants
+func (m *Manager) Submit(tenant string, request models.JobRequest) (*Job, error) {
+	if request.CallbackURL != "" {
+		if !m.CallbacksEnabled() {
+			return nil, ErrCallbacksDisabled
+		}
+		if err := m.notifier.checkURL(request.CallbackURL); err != nil {
+			return nil, err
+		}
+	}
+	m.mu.Lock()
+	stopped := m.stopped
+	m.mu.Unlock()
+	if stopped {
+		return nil, ErrStopped
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:             id,
+		Tenant:         tenant,
+		Status:         StatusQueued,
+		Template:       request.Template,
+		CallbackURL:    request.CallbackURL,
+		CallbackInline: request.CallbackInline,
+		CreatedAt:      time.Now(),
+	}
+	if request.CallbackURL != "" {
+		job.Callback = &Callback{Status: CallbackPending}
+	}
+	if err := m.store.Create(job, request); err != nil {
+		return nil, err
+	}
+
+	select {
+	case m.queue <- id:
+		utils.LogInfo("Queued job %s for template %s", id, request.Template)
+		return job, nil
+	default:
+		if err := m.store.Delete(id); err != nil {
+			utils.LogError("Error deleting job %s: %v", id, err)
+		}
+		return nil, ErrQueueFull
+	}
+}
+
+// Get returns a job
+func (m *Manager) Get(id string) (*Job, error) {
+	job, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return job, nil
+}
+
+// Result returns a job together with its output. ErrNotFinished is returned
+// for jobs that haven't succeeded yet.
+func (m *Manager) Result(id string) (*Job, []byte, error) {
+	job, err := m.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Status != StatusSucceeded {
+		return job, nil, ErrNotFinished
+	}
+	data, err := m.store.Result(id)
+	if err != nil {
+		return job, nil, err
+	}
+	return job, data, nil
+}
+
+// Cancel cancels a queued or running job. Running jobs stop once the record
+// being rendered is done.
+func (m *Manager) Cancel(id string) (*Job, error) {
+	m.mu.Lock()
+	job, err := m.store.Update(id, func(job *Job) error {
+		if job.Status.Finished() {
+			return ErrFinished
+		}
+		m.finish(job, StatusCancelled)
+		return nil
+	})
+	if cancel, running := m.cancels[id]; running && err == nil {
+		cancel()
+	}
+	m.mu.Unlock()
+
+	if errors.Is(err, ErrFinished) {
+		job, getErr := m.Get(id)
+		if getErr != nil {
+			return nil, getErr
+		}
+		return job, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	utils.LogInfo("Cancelled job %s", id)
+	m.finished(job, job.CallbackURL != "")
+	return job, nil
+}
+
+// work runs queued jobs until the manager is stopped
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for {
+		select {
+		case id := <-m.queue:
+			m.process(id)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// process runs one job
+func (m *Manager) process(id string) {
+	if m.ctx.Err() != nil {
+		// Stopped: the job stays queued for the next Start
+		return
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+
+	m.mu.Lock()
+	job, err := m.store.Update(id, func(job *Job) error {
+		if job.Status != StatusQueued {
+			return ErrFinished
+		}
+		now := time.Now()
+		job.Status = StatusRunning
+		job.StartedAt = &now
+		return nil
+	})
+	if err == nil {
+		m.cancels[id] = cancel
+	}
+	m.mu.Unlock()
+	if err != nil {
+		// The job was cancelled or deleted while it was queued
+		return
+	}
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.cancels, id)
+		m.mu.Unlock()
+	}()
+
+	utils.LogInfo("Running job %s", id)
+
+	var saved time.Time
+	progress := func(done, total int) {
+		if done < total && time.Since(saved) < progressInterval {
+			return
+		}
+		saved = time.Now()
+		m.update(id, func(job *Job) {
+			job.Progress = Progress{Done: done, Total: total}
+		})
+	}
+
+	var output *Output
+	request, err := m.store.Request(id)
+	if err == nil {
+		output, err = m.run(ctx, *job, *request, progress)
+	} else {
+		err = fmt.Errorf("failed to read request: %w", err)
+	}
+	if ctx.Err() != nil && m.ctx.Err() != nil {
+		m.update(id, func(job *Job) {
+			job.Status = StatusQueued
+			job.Progress = Progress{}
+			job.StartedAt = nil
+		})
+		utils.LogInfo("Job %s was interrupted and runs again after a restart", id)
+		return
+	}
+	if err == nil && ctx.Err() == nil {
+		if saveErr := m.store.SaveResult(id, output.Data); saveErr != nil {
+			err = saveErr
+		}
+	}
+
+	finished := m.update(id, func(job *Job) {
+		if output != nil {
+			job.Manifest = output.Manifest
+		}
+		switch {
+		case ctx.Err() != nil:
+			m.finish(job, StatusCancelled)
+		case err != nil:
+			job.Error = err.Error()
+			m.finish(job, StatusFailed)
+		default:
+			job.Result = &Result{
+				Filename:    output.Filename,
+				ContentType: output.ContentType,
+				Size:        len(output.Data),
+			}
+			m.finish(job, StatusSucceeded)
+		}
+	})
+
+	if err != nil {
+		utils.LogWarn("Job %s failed: %v", id, err)
+	} else {
+		utils.LogInfo("Job %s finished", id)
+	}
+	if finished != nil {
+		m.finished(finished, finished.CallbackURL != "")
+	}
+}
+
+// update changes a running job and returns it. Jobs that were cancelled
+// meanwhile are left as they are and nil is returned.
+func (m *Manager) update(id string, update func(job *Job)) *Job {
+	job, err := m.store.Update(id, func(job *Job) error {
+		if job.Status != StatusRunning {
+			return ErrFinished
+		}
+		update(job)
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrFinished) {
+		utils.LogError("Error updating job %s: %v", id, err)
+	}
+	return job
+}
+
+// finished records when a finished job expires and, if notify is set, sends
+// its callback in the background. No callbacks are sent once the manager is
+// stopped; they stay pending until the next Start.
+func (m *Manager) finished(job *Job, notify bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job.ExpiresAt != nil {
+		m.expiries[job.ID] = *job.ExpiresAt
+	}
+	if notify && !m.stopped {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.notifier.notify(m.ctx, job)
+		}()
+	}
+}
+
+// DeadLetters returns the callbacks that could not be delivered
+func (m *Manager) DeadLetters() ([]*DeadLetter, error) {
+	return m.store.DeadLetters()
+}
+
+// finish moves a job to a final state and sets when it expires
+func (m *Manager) finish(job *Job, status Status) {
+	now := time.Now()
+	expires := now.Add(m.config.ResultTTL)
+	job.Status = status
+	job.FinishedAt = &now
+	job.ExpiresAt = &expires
+}
+
+// cleanup periodically deletes expired jobs until the manager is stopped
+func (m *Manager) cleanup() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			m.deleteExpired(now)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// deleteExpired deletes the jobs that have expired at now, and the dead
+// letters older than ResultTTL. Jobs that can't be deleted are tried again at
+// the next cleanup.
+func (m *Manager) deleteExpired(now time.Time) {
+	expired := make(map[string]time.Time)
+	m.mu.Lock()
+	for id, expires := range m.expiries {
+		if now.After(expires) {
+			expired[id] = expires
+			delete(m.expiries, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for id, expires := range expired {
+		if err := m.store.Delete(id); err != nil {
+			utils.LogError("Error deleting expired job %s: %v", id, err)
+			m.mu.Lock()
+			m.expiries[id] = expires
+			m.mu.Unlock()
+			continue
+		}
+		utils.LogInfo("Deleted expired job %s", id)
+	}
+
+	deleted, err := m.store.DeleteDeadLetters(now.Add(-m.config.ResultTTL))
+	if err != nil {
+		utils.LogError("Error deleting expired dead letters: %v", err)
+	}
+	if deleted > 0 {
+		utils.LogInfo("Deleted %d expired dead letters", deleted)
+	}
+}
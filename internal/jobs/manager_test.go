@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// listCounter counts how often a store is listed
+type listCounter struct {
+	Store
+	lists atomic.Int32
+}
+
+func (s *listCounter) List() ([]*Job, error) {
+	s.lists.Add(1)
+	return s.Store.List()
+}
+
+// waitForStatus polls a job until it has status
+func waitForStatus(t *testing.T, m *Manager, id string, status Status) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.store.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s", id, job.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// jobRequest returns a request with n records
+func jobRequest(n int) models.JobRequest {
+	records := make([]map[string]interface{}, n)
+	for i := range records {
+		records[i] = map[string]interface{}{"invoiceNumber": "INV-RECORD"}
+	}
+	return models.JobRequest{Template: "invoice", Records: records}
+}
+
+func TestManagerRunsJobWithItsRequest(t *testing.T) {
+	store := &listCounter{Store: NewMemoryStore()}
+	run := func(ctx context.Context, job Job, request models.JobRequest, progress func(done, total int)) (*Output, error) {
+		progress(len(request.Records), len(request.Records))
+		return &Output{Data: []byte("%PDF"), Filename: job.Template + ".pdf"}, nil
+	}
+	m := NewManager(store, run, Config{ResultTTL: time.Millisecond, CleanupInterval: time.Hour})
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop(context.Background())
+
+	job, err := m.Submit("", jobRequest(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := waitForStatus(t, m, job.ID, StatusSucceeded)
+	if done.Progress.Done != 3 || done.Result.Filename != "invoice.pdf" {
+		t.Errorf("job = %+v", done)
+	}
+
+	// Expired jobs are deleted without listing the store again
+	m.deleteExpired(time.Now().Add(time.Second))
+	if _, err := store.Get(job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired job wasn't deleted: %v", err)
+	}
+	if _, err := store.Request(job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("request of the expired job wasn't deleted: %v", err)
+	}
+	if n := store.lists.Load(); n != 1 {
+		t.Errorf("store listed %d times, want only on Start", n)
+	}
+}
+
+func TestManagerStop(t *testing.T) {
+	started := make(chan struct{})
+	run := func(ctx context.Context, job Job, request models.JobRequest, progress func(done, total int)) (*Output, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	m := NewManager(NewMemoryStore(), run, Config{Workers: 1})
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := m.Submit("", jobRequest(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	// The interrupted job is left for the next Start
+	stopped, err := m.store.Get(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped.Status != StatusQueued || stopped.StartedAt != nil {
+		t.Errorf("interrupted job is %s, want queued", stopped.Status)
+	}
+	if _, err := m.Submit("", jobRequest(1)); !errors.Is(err, ErrStopped) {
+		t.Errorf("Submit after Stop: error = %v, want ErrStopped", err)
+	}
+}
+
+func TestManagerStopTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	run := func(ctx context.Context, job Job, request models.JobRequest, progress func(done, total int)) (*Output, error) {
+		close(started)
+		<-release
+		return nil, ctx.Err()
+	}
+	m := NewManager(NewMemoryStore(), run, Config{Workers: 1})
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Submit("", jobRequest(1)); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop with a busy runner: error = %v, want DeadlineExceeded", err)
+	}
+	close(release)
+}
+
+func TestDiskStoreKeepsRequestApart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &Job{ID: "0123456789abcdef0123456789abcdef", Status: StatusQueued, Template: "invoice"}
+	if err := store.Create(job, jobRequest(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Update(job.ID, func(job *Job) error {
+		job.Progress = Progress{Done: 50, Total: 100}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := os.ReadFile(filepath.Join(dir, job.ID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(status, []byte("INV-RECORD")) {
+		t.Error("the job's status file holds its records")
+	}
+	request, err := store.Request(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Records) != 100 || request.Template != "invoice" {
+		t.Errorf("request has %d records for %q", len(request.Records), request.Template)
+	}
+
+	if err := store.Delete(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left after Delete, want only the dead letter directory", len(entries))
+	}
+}
+
+func TestDeadLettersExpireWithJobs(t *testing.T) {
+	disk, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{"memory": NewMemoryStore(), "disk": disk}
+
+	now := time.Now()
+	for name, store := range stores {
+		m := NewManager(store, nil, Config{ResultTTL: time.Hour})
+		for _, failedAt := range []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Minute)} {
+			letter := &DeadLetter{JobID: "0123456789abcdef0123456789abcdef", URL: "https://example.com/hook", FailedAt: failedAt}
+			if err := store.SaveDeadLetter(letter); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		m.deleteExpired(now)
+		letters, err := store.DeadLetters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(letters) != 1 || !letters[0].FailedAt.Equal(now.Add(-time.Minute)) {
+			t.Errorf("%s: dead letters after cleanup = %+v, want the one that failed a minute ago", name, letters)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// MemoryStore keeps jobs in memory. Jobs are lost when the process exits.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	jobs        map[string]*Job
+	requests    map[string]models.JobRequest
+	results     map[string][]byte
+	deadLetters []*DeadLetter
+}
+
+// NewMemoryStore creates an empty in-memory job store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:     make(map[string]*Job),
+		requests: make(map[string]models.JobRequest),
+		results:  make(map[string][]byte),
+	}
+}
+
+// Create adds a new job with its request
+func (s *MemoryStore) Create(job *Job, request models.JobRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.ID]; exists {
+		return fmt.Errorf("job %s already exists", job.ID)
+	}
+	stored := *job
+	s.jobs[job.ID] = &stored
+	s.requests[job.ID] = request
+	return nil
+}
+
+// Get returns a copy of a job
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	found := *job
+	return &found, nil
+}
+
+// Request returns the request of a job
+func (s *MemoryStore) Request(id string) (*models.JobRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	request, exists := s.requests[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &request, nil
+}
+
+// Update changes a job atomically
+func (s *MemoryStore) Update(id string, update func(job *Job) error) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	updated := *job
+	if err := update(&updated); err != nil {
+		return nil, err
+	}
+	s.jobs[id] = &updated
+
+	result := updated
+	return &result, nil
+}
+
+// List returns copies of every job
+func (s *MemoryStore) List() ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		found := *job
+		jobs = append(jobs, &found)
+	}
+	return jobs, nil
+}
+
+// SaveResult stores the output of a job
+func (s *MemoryStore) SaveResult(id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[id]; !exists {
+		return ErrNotFound
+	}
+	s.results[id] = data
+	return nil
+}
+
+// Result returns the output of a job
+func (s *MemoryStore) Result(id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, exists := s.results[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// Delete removes a job, its request and its result
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, id)
+	delete(s.requests, id)
+	delete(s.results, id)
+	return nil
+}
+
+// SaveDeadLetter records a callback that could not be delivered
+func (s *MemoryStore) SaveDeadLetter(letter *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *letter
+	s.deadLetters = append(s.deadLetters, &stored)
+	return nil
+}
+
+// DeadLetters returns the callbacks that could not be delivered
+func (s *MemoryStore) DeadLetters() ([]*DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	letters := make([]*DeadLetter, len(s.deadLetters))
+	for i, letter := range s.deadLetters {
+		found := *letter
+		letters[i] = &found
+	}
+	return letters, nil
+}
+
+// DeleteDeadLetters removes the dead letters that failed before the given time
+func (s *MemoryStore) DeleteDeadLetters(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.deadLetters[:0]
+	for _, letter := range s.deadLetters {
+		if !letter.FailedAt.Before(before) {
+			kept = append(kept, letter)
+		}
+	}
+	deleted := len(s.deadLetters) - len(kept)
+	for i := len(kept); i < len(s.deadLetters); i++ {
+		s.deadLetters[i] = nil
+	}
+	s.deadLetters = kept
+	return deleted, nil
+}
@@ -0,0 +1,399 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"pdf-gen-simple/internal/utils"
+)
+
+// Headers of callback requests
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	AttemptHeader   = "X-Webhook-Attempt"
+	JobIDHeader     = "X-Webhook-Job-ID"
+)
+
+// signaturePrefix names the algorithm of a callback signature
+const signaturePrefix = "sha256="
+
+// DefaultSignatureTolerance is how far the timestamp of a callback may be
+// from the receiver's clock when VerifySignature is given no tolerance
+const DefaultSignatureTolerance = 5 * time.Minute
+
+var (
+	// ErrCallbackNotAllowed is returned for callback URLs that the webhook
+	// configuration doesn't allow
+	ErrCallbackNotAllowed = errors.New("callbackUrl is not allowed")
+	// errPrivateAddress is returned when a callback host resolves to an
+	// address that isn't public
+	errPrivateAddress = errors.New("callback address is not public")
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, which isn't public
+// although net/netip doesn't count it as private
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// CallbackStatus is the state of a job's callback
+type CallbackStatus string
+
+const (
+	// CallbackPending callbacks are waiting to be delivered
+	CallbackPending CallbackStatus = "pending"
+	// CallbackDelivered callbacks were accepted by the receiver
+	CallbackDelivered CallbackStatus = "delivered"
+	// CallbackFailed callbacks gave up and were dead-lettered
+	CallbackFailed CallbackStatus = "failed"
+)
+
+// Callback records the delivery of a job's callback
+type Callback struct {
+	Status      CallbackStatus `json:"status"`
+	Attempts    int            `json:"attempts"`
+	LastError   string         `json:"lastError,omitempty"`
+	DeliveredAt *time.Time     `json:"deliveredAt,omitempty"`
+}
+
+// CallbackPayload is the body of a callback request
+type CallbackPayload struct {
+	JobID    string          `json:"jobId"`
+	Status   Status          `json:"status"`
+	Template string          `json:"template"`
+	Error    string          `json:"error,omitempty"`
+	Manifest json.RawMessage `json:"manifest,omitempty"`
+	Result   *Result         `json:"result,omitempty"`
+	// ResultURL is where the output can be downloaded
+	ResultURL string `json:"resultUrl,omitempty"`
+	// Content is the base64 encoded output for inline callbacks
+	Content    string     `json:"content,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// DeadLetter records a callback that could not be delivered
+type DeadLetter struct {
+	JobID    string          `json:"jobId"`
+	Tenant   string          `json:"tenant,omitempty"`
+	URL      string          `json:"url"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failedAt"`
+}
+
+// WebhookConfig controls how callbacks are delivered
+type WebhookConfig struct {
+	// Secret signs every callback; callbacks are refused without one
+	Secret string
+	// BaseURL is prepended to result links, such as https://pdf.example.com
+	BaseURL string
+	// MaxAttempts is the number of deliveries tried before a callback is
+	// dead-lettered; it defaults to 5
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling after each
+	// attempt; it defaults to a second
+	Backoff time.Duration
+	// MaxBackoff caps the wait between retries; it defaults to a minute
+	MaxBackoff time.Duration
+	// AllowedHosts, if set, limits callbacks to these hosts. An entry such
+	// as *.example.com also allows every subdomain of example.com.
+	AllowedHosts []string
+	// AllowHTTP allows callbacks over plain http; only https is allowed by
+	// default
+	AllowHTTP bool
+	// AllowPrivateNetworks allows callbacks to loopback, private and
+	// link-local addresses, which are refused by default
+	AllowPrivateNetworks bool
+	// Client sends the callbacks; it defaults to a client with a 10 second
+	// timeout that refuses non-public addresses. Redirects are never
+	// followed, whichever client is used.
+	Client *http.Client
+}
+
+// SignPayload returns the signature of a callback body sent at timestamp,
+// in Unix seconds, as sent in the X-Webhook-Signature header. The timestamp
+// is signed with the body so that old callbacks can't be replayed.
+func SignPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is a valid signature of body
+// and timestamp, the X-Webhook-Timestamp header, and whether timestamp is
+// within tolerance of now. A tolerance of 0 uses DefaultSignatureTolerance.
+func VerifySignature(secret string, body []byte, timestamp, signature string, tolerance time.Duration) bool {
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+	sent, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(SignPayload(secret, sent, body)), []byte(strings.TrimSpace(signature)))
+}
+
+// notifier delivers job callbacks
+type notifier struct {
+	store  Store
+	config WebhookConfig
+}
+
+// newNotifier creates a notifier, filling in the config's defaults
+func newNotifier(store Store, config WebhookConfig) *notifier {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Minute
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: callbackTransport(config.AllowPrivateNetworks),
+		}
+	}
+	client := *config.Client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	config.Client = &client
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	return &notifier{store: store, config: config}
+}
+
+// callbackTransport returns the transport of the default callback client.
+// It doesn't use a proxy, whose address the dialer would check instead of
+// the receiver's.
+func callbackTransport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = publicAddressOnly
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// publicAddressOnly is a net.Dialer Control function that refuses to connect
+// to addresses that aren't public. It runs after the host is resolved, so a
+// public name that resolves to a private address is refused too.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, ip)
+	}
+	return nil
+}
+
+// checkURL returns ErrCallbackNotAllowed if the configuration doesn't allow
+// callbacks to rawURL
+func (n *notifier) checkURL(rawURL string) error {
+	callback, err := url.Parse(rawURL)
+	if err != nil || callback.Host == "" {
+		return fmt.Errorf("%w: %q is not an absolute URL", ErrCallbackNotAllowed, rawURL)
+	}
+	switch {
+	case callback.Scheme == "https":
+	case callback.Scheme == "http" && n.config.AllowHTTP:
+	default:
+		return fmt.Errorf("%w: use https", ErrCallbackNotAllowed)
+	}
+	if len(n.config.AllowedHosts) == 0 {
+		return nil
+	}
+	host := strings.ToLower(callback.Hostname())
+	for _, allowed := range n.config.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return nil
+			}
+		} else if host == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %s is not in the allowed hosts", ErrCallbackNotAllowed, host)
+}
+
+// notify delivers the callback of a finished job, retrying with backoff.
+// Callbacks that can't be delivered are saved as dead letters. Once ctx is
+// done, notify gives up and leaves the callback pending.
+func (n *notifier) notify(ctx context.Context, job *Job) {
+	url := job.CallbackURL
+	body, err := n.payload(job)
+	if err != nil {
+		utils.LogError("Error building callback for job %s: %v", job.ID, err)
+		n.deadLetter(job, body, 0, err)
+		return
+	}
+
+	backoff := n.config.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.deliver(ctx, job.ID, url, body, attempt)
+		if err == nil {
+			now := time.Now()
+			n.record(job.ID, func(callback *Callback) {
+				callback.Status = CallbackDelivered
+				callback.Attempts = attempt
+				callback.LastError = ""
+				callback.DeliveredAt = &now
+			})
+			utils.LogInfo("Delivered callback for job %s to %s", job.ID, url)
+			return
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		utils.LogWarn("Callback %d for job %s to %s failed: %v", attempt, job.ID, url, err)
+		n.record(job.ID, func(callback *Callback) {
+			callback.Attempts = attempt
+			callback.LastError = err.Error()
+		})
+		if !retry || attempt >= n.config.MaxAttempts {
+			n.deadLetter(job, body, attempt, err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, n.config.MaxBackoff)
+	}
+}
+
+// payload builds the body of a job's callback
+func (n *notifier) payload(job *Job) ([]byte, error) {
+	payload := CallbackPayload{
+		JobID:      job.ID,
+		Status:     job.Status,
+		Template:   job.Template,
+		Error:      job.Error,
+		Manifest:   job.Manifest,
+		Result:     job.Result,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.Status == StatusSucceeded {
+		if job.CallbackInline {
+			data, err := n.store.Result(job.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read result: %w", err)
+			}
+			payload.Content = base64.StdEncoding.EncodeToString(data)
+		} else {
+			payload.ResultURL = n.config.BaseURL + "/jobs/" + job.ID + "/result"
+		}
+	}
+	return json.Marshal(payload)
+}
+
+// deliver sends a callback once. retry is false for errors that another
+// attempt won't fix, such as the receiver rejecting the request or a URL
+// that isn't allowed.
+func (n *notifier) deliver(ctx context.Context, jobID, url string, body []byte, attempt int) (retry bool, err error) {
+	if err := n.checkURL(url); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, SignPayload(n.config.Secret, timestamp, body))
+	req.Header.Set(AttemptHeader, strconv.Itoa(attempt))
+	req.Header.Set(JobIDHeader, jobID)
+
+	resp, err := n.config.Client.Do(req)
+	if errors.Is(err, errPrivateAddress) {
+		return false, err
+	}
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("receiver responded %s", resp.Status)
+	default:
+		return false, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+}
+
+// record updates the callback state of a job
+func (n *notifier) record(id string, update func(callback *Callback)) {
+	_, err := n.store.Update(id, func(job *Job) error {
+		callback := Callback{Status: CallbackPending}
+		if job.Callback != nil {
+			callback = *job.Callback
+		}
+		update(&callback)
+		job.Callback = &callback
+		return nil
+	})
+	if err != nil {
+		utils.LogError("Error recording callback for job %s: %v", id, err)
+	}
+}
+
+// deadLetter gives up on a callback
+func (n *notifier) deadLetter(job *Job, body []byte, attempts int, err error) {
+	n.record(job.ID, func(callback *Callback) {
+		callback.Status = CallbackFailed
+	})
+
+	letter := &DeadLetter{
+		JobID:    job.ID,
+		Tenant:   job.Tenant,
+		URL:      job.CallbackURL,
+		Payload:  body,
+		Attempts: attempts,
+		Error:    err.Error(),
+		FailedAt: time.Now(),
+	}
+	if err := n.store.SaveDeadLetter(letter); err != nil {
+		utils.LogError("Error saving dead letter for job %s: %v", job.ID, err)
+		return
+	}
+	utils.LogError("Gave up on callback for job %s to %s after %d attempts: %v", job.ID, letter.URL, attempts, err)
+}
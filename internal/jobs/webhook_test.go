@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"pdf-gen-simple/internal/models"
+)
+
+const testSecret = "webhook-secret"
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"jobId":"1"}`)
+	now := time.Now().Unix()
+	timestamp := strconv.FormatInt(now, 10)
+	signature := SignPayload(testSecret, now, body)
+
+	tests := []struct {
+		name                 string
+		body                 []byte
+		timestamp, signature string
+		want                 bool
+	}{
+		{"valid", body, timestamp, signature, true},
+		{"other body", []byte(`{"jobId":"2"}`), timestamp, signature, false},
+		{"other timestamp", body, strconv.FormatInt(now+1, 10), signature, false},
+		{"replayed", body, strconv.FormatInt(now-600, 10), SignPayload(testSecret, now-600, body), false},
+		{"from the future", body, strconv.FormatInt(now+600, 10), SignPayload(testSecret, now+600, body), false},
+		{"invalid timestamp", body, "yesterday", signature, false},
+		{"other secret", body, timestamp, SignPayload("other", now, body), false},
+	}
+	for _, tt := range tests {
+		if got := VerifySignature(testSecret, tt.body, tt.timestamp, tt.signature, 0); got != tt.want {
+			t.Errorf("%s: VerifySignature = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	old := strconv.FormatInt(now-600, 10)
+	if !VerifySignature(testSecret, body, old, SignPayload(testSecret, now-600, body), 15*time.Minute) {
+		t.Error("a wider tolerance rejected a 10 minute old callback")
+	}
+}
+
+func TestCheckCallbackURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		config WebhookConfig
+		ok     bool
+	}{
+		{"https://hooks.example.com/pdf", WebhookConfig{}, true},
+		{"http://hooks.example.com/pdf", WebhookConfig{}, false},
+		{"http://hooks.example.com/pdf", WebhookConfig{AllowHTTP: true}, true},
+		{"file:///etc/passwd", WebhookConfig{AllowHTTP: true}, false},
+		{"/relative", WebhookConfig{}, false},
+		{"https://hooks.example.com/pdf", WebhookConfig{AllowedHosts: []string{"hooks.example.com"}}, true},
+		{"https://HOOKS.example.com:8443/pdf", WebhookConfig{AllowedHosts: []string{"hooks.example.com"}}, true},
+		{"https://evil.example.net/pdf", WebhookConfig{AllowedHosts: []string{"hooks.example.com"}}, false},
+		{"https://a.example.com/pdf", WebhookConfig{AllowedHosts: []string{"*.example.com"}}, true},
+		{"https://example.com/pdf", WebhookConfig{AllowedHosts: []string{"*.example.com"}}, false},
+		{"https://badexample.com/pdf", WebhookConfig{AllowedHosts: []string{"*.example.com"}}, false},
+	}
+	for _, tt := range tests {
+		err := newNotifier(NewMemoryStore(), tt.config).checkURL(tt.url)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrCallbackNotAllowed) {
+			t.Errorf("%s: error = %v, want ErrCallbackNotAllowed", tt.url, err)
+		}
+	}
+}
+
+func TestPublicAddressOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:4700::6810:84e5]:443", true},
+		{"127.0.0.1:80", false},
+		{"10.0.0.5:443", false},
+		{"172.16.0.1:443", false},
+		{"192.168.1.1:443", false},
+		{"169.254.169.254:80", false},
+		{"100.64.0.1:443", false},
+		{"0.0.0.0:80", false},
+		{"[::1]:80", false},
+		{"[fe80::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	}
+	for _, tt := range tests {
+		err := publicAddressOnly("tcp", tt.address, nil)
+		if tt.public && err != nil {
+			t.Errorf("%s: %v", tt.address, err)
+		}
+		if !tt.public && !errors.Is(err, errPrivateAddress) {
+			t.Errorf("%s: error = %v, want errPrivateAddress", tt.address, err)
+		}
+	}
+}
+
+func TestDefaultClientRefusesPrivateAddresses(t *testing.T) {
+	hit := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer receiver.Close()
+
+	n := newNotifier(NewMemoryStore(), WebhookConfig{Secret: testSecret, AllowHTTP: true})
+	retry, err := n.deliver(context.Background(), "job", receiver.URL, []byte("{}"), 1)
+	if !errors.Is(err, errPrivateAddress) || retry {
+		t.Errorf("deliver to %s: retry %v, error %v; want errPrivateAddress without retry", receiver.URL, retry, err)
+	}
+	if hit {
+		t.Error("the loopback receiver was called")
+	}
+}
+
+func TestCallbackRedirectsAreNotFollowed(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the redirect was followed")
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	n := newNotifier(NewMemoryStore(), WebhookConfig{Secret: testSecret, AllowHTTP: true, AllowPrivateNetworks: true})
+	retry, err := n.deliver(context.Background(), "job", receiver.URL, []byte("{}"), 1)
+	if err == nil || retry {
+		t.Errorf("deliver: retry %v, error %v; want a redirect error without retry", retry, err)
+	}
+}
+
+// callbackReceiver answers callbacks with the given statuses in turn, repeating
+// the last one, and records when each attempt arrived
+type callbackReceiver struct {
+	t        *testing.T
+	statuses []int
+
+	mu       sync.Mutex
+	attempts []time.Time
+}
+
+func (c *callbackReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !VerifySignature(testSecret, body, r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), 0) {
+		c.t.Errorf("invalid signature %q at %q", r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts = append(c.attempts, time.Now())
+	if got := r.Header.Get(AttemptHeader); got != strconv.Itoa(len(c.attempts)) {
+		c.t.Errorf("%s = %s, want %d", AttemptHeader, got, len(c.attempts))
+	}
+	w.WriteHeader(c.statuses[min(len(c.attempts), len(c.statuses))-1])
+}
+
+func TestCallbackDelivery(t *testing.T) {
+	const backoff = 20 * time.Millisecond
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		status   CallbackStatus
+	}{
+		{"delivered", []int{http.StatusOK}, 1, CallbackDelivered},
+		{"retried after 5xx and 429", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}, 3, CallbackDelivered},
+		{"4xx is not retried", []int{http.StatusBadRequest}, 1, CallbackFailed},
+		{"dead-lettered after MaxAttempts", []int{http.StatusInternalServerError}, 3, CallbackFailed},
+	}
+	for _, tt := range tests {
+		receiver := &callbackReceiver{t: t, statuses: tt.statuses}
+		server := httptest.NewServer(receiver)
+
+		store := NewMemoryStore()
+		finished := time.Now()
+		job := &Job{
+			ID:          "0123456789abcdef0123456789abcdef",
+			Status:      StatusSucceeded,
+			Template:    "invoice",
+			CallbackURL: server.URL,
+			Callback:    &Callback{Status: CallbackPending},
+			FinishedAt:  &finished,
+		}
+		if err := store.Create(job, models.JobRequest{Template: "invoice", CallbackURL: server.URL}); err != nil {
+			t.Fatal(err)
+		}
+		n := newNotifier(store, WebhookConfig{
+			Secret:               testSecret,
+			MaxAttempts:          3,
+			Backoff:              backoff,
+			AllowHTTP:            true,
+			AllowPrivateNetworks: true,
+		})
+		n.notify(context.Background(), job)
+		server.Close()
+
+		if len(receiver.attempts) != tt.attempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, len(receiver.attempts), tt.attempts)
+		}
+		// The wait doubles after each attempt
+		for i := 1; i < len(receiver.attempts); i++ {
+			want := backoff << (i - 1)
+			if gap := receiver.attempts[i].Sub(receiver.attempts[i-1]); gap < want {
+				t.Errorf("%s: retry %d after %v, want at least %v", tt.name, i, gap, want)
+			}
+		}
+
+		stored, _ := store.Get(job.ID)
+		if stored.Callback.Status != tt.status || stored.Callback.Attempts != tt.attempts {
+			t.Errorf("%s: callback = %+v", tt.name, stored.Callback)
+		}
+		letters, _ := store.DeadLetters()
+		if tt.status == CallbackFailed {
+			if len(letters) != 1 || letters[0].Attempts != tt.attempts || letters[0].URL != server.URL {
+				t.Errorf("%s: dead letters = %+v", tt.name, letters)
+			}
+		} else if len(letters) != 0 {
+			t.Errorf("%s: delivered callback was dead-lettered", tt.name)
+		}
+	}
+}
+
+func TestCallbackGivesUpWhenStopped(t *testing.T) {
+	receiver := &callbackReceiver{t: t, statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	store := NewMemoryStore()
+	job := &Job{ID: "0123456789abcdef0123456789abcdef", Status: StatusFailed, CallbackURL: server.URL, Callback: &Callback{Status: CallbackPending}}
+	if err := store.Create(job, models.JobRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	n := newNotifier(store, WebhookConfig{Secret: testSecret, Backoff: time.Hour, AllowHTTP: true, AllowPrivateNetworks: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	n.notify(ctx, job)
+
+	// The callback stays pending so that the next Start sends it again
+	stored, _ := store.Get(job.ID)
+	letters, _ := store.DeadLetters()
+	if stored.Callback.Status != CallbackPending || len(letters) != 0 {
+		t.Errorf("callback = %+v with %d dead letters, want it pending", stored.Callback, len(letters))
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+
+	"pdf-gen-simple/internal/expr"
+)
+
+// Conditions are the compiled showIf and hideIf conditions of an element.
+// A condition the element doesn't have is nil.
+type Conditions struct {
+	ShowIf *expr.Program
+	HideIf *expr.Program
+
+	// showSource and hideSource are the conditions that were compiled
+	showSource string
+	hideSource string
+	err        error
+}
+
+// CompileConditions compiles the element's showIf and hideIf conditions and
+// keeps them with the element. Template loaders compile the elements they
+// parse before caching them, so conditions are compiled once per template
+// rather than for every element and loop row drawn.
+func (e *PDFElement) CompileConditions() {
+	e.conditions = compileConditions(e.ShowIf, e.HideIf)
+}
+
+// Conditions returns the element's compiled conditions, or the error of a
+// condition that doesn't compile. Conditions that weren't compiled, or were
+// changed after CompileConditions, are compiled on each call.
+func (e *PDFElement) Conditions() (*Conditions, error) {
+	if e.HasCompiledConditions() {
+		return e.conditions, e.conditions.err
+	}
+	c := compileConditions(e.ShowIf, e.HideIf)
+	return c, c.err
+}
+
+// HasCompiledConditions returns true if CompileConditions has compiled the
+// element's current conditions
+func (e *PDFElement) HasCompiledConditions() bool {
+	c := e.conditions
+	return c != nil && c.showSource == e.ShowIf && c.hideSource == e.HideIf
+}
+
+// compileConditions compiles a showIf and hideIf condition
+func compileConditions(showIf, hideIf string) *Conditions {
+	c := &Conditions{showSource: showIf, hideSource: hideIf}
+	if showIf != "" {
+		if c.ShowIf, c.err = expr.Compile(showIf); c.err != nil {
+			c.err = fmt.Errorf("showIf: %w", c.err)
+			return c
+		}
+	}
+	if hideIf != "" {
+		if c.HideIf, c.err = expr.Compile(hideIf); c.err != nil {
+			c.err = fmt.Errorf("hideIf: %w", c.err)
+		}
+	}
+	return c
+}
@@ -0,0 +1,40 @@
+package models
+
+import "fmt"
+
+// Severity represents how serious a template diagnostic is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic describes a problem found in a template. Row is the CSV line
+// number (the header is row 1) or the 1-based element number in JSON and YAML
+// templates; it is 0 for problems that concern the whole template.
+type Diagnostic struct {
+	Row      int      `json:"row"`
+	Column   string   `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String returns a human readable form of the diagnostic
+func (d Diagnostic) String() string {
+	location := fmt.Sprintf("row %d", d.Row)
+	if d.Column != "" {
+		location += fmt.Sprintf(", column %s", d.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, d.Severity, d.Message)
+}
+
+// HasErrors returns true if any diagnostic is an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package models
+
+// GSTSettings configures the GST calculation run before a tax invoice is
+// rendered. State codes are the two-digit GST state codes ("27" for
+// Maharashtra); when they are empty they are taken from the GSTINs, which
+// start with the state code. String settings may contain placeholders that
+// are resolved from the request fields, as in "{{customer.stateCode}}".
+type GSTSettings struct {
+	SupplierState  string `json:"supplierState,omitempty"`
+	SupplierGSTIN  string `json:"supplierGstin,omitempty"`
+	PlaceOfSupply  string `json:"placeOfSupply,omitempty"`
+	RecipientGSTIN string `json:"recipientGstin,omitempty"`
+
+	// ItemsField is the array of line items, "items" by default
+	ItemsField string `json:"itemsField,omitempty"`
+	// OutputField is where the totals and HSN summary are stored, "gst" by default
+	OutputField string `json:"outputField,omitempty"`
+
+	// DefaultRate is the GST rate in percent for items without a gstRate
+	DefaultRate float64 `json:"defaultRate,omitempty"`
+	// RoundOff rounds the grand total to whole rupees and reports the difference
+	RoundOff bool `json:"roundOff,omitempty"`
+	// Rounding is GSTRoundingLine (the default) to round tax to paise on each
+	// line, or GSTRoundingInvoice to round only the invoice and HSN totals
+	Rounding string `json:"rounding,omitempty"`
+}
+
+// GST rounding modes
+const (
+	GSTRoundingLine    = "line"
+	GSTRoundingInvoice = "invoice"
+)
+
+// Line item fields read by the GST calculation
+const (
+	GSTFieldHSN          = "hsn"
+	GSTFieldTaxableValue = "taxableValue"
+	GSTFieldQuantity     = "quantity"
+	GSTFieldUnitPrice    = "unitPrice"
+	GSTFieldDiscount     = "discount"
+	GSTFieldRate         = "gstRate"
+)
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// JobRequest represents the JSON input for an asynchronous render. Fields
+// renders one document and Records renders a batch, one document per record.
+type JobRequest struct {
+	Template string `json:"template"`
+	// Version pins an uploaded version of the template; 0 uses the current source
+	Version int                      `json:"version,omitempty"`
+	Fields  map[string]interface{}   `json:"fields,omitempty"`
+	Records []map[string]interface{} `json:"records,omitempty"`
+	// Output of a batch: zip (default) or pdf for one merged PDF
+	Output string `json:"output,omitempty"`
+	// Filename names the PDFs in a ZIP batch, such as {{invoiceNumber}}.pdf
+	Filename string `json:"filename,omitempty"`
+	// ErrorPolicy overrides the generator's error policy: lenient, strict or report
+	ErrorPolicy string `json:"errorPolicy,omitempty"`
+	// GST computes CGST/SGST/IGST for the line items before rendering
+	GST *GSTSettings `json:"gst,omitempty"`
+	// CallbackURL is sent a signed notification when the job finishes
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	// CallbackInline puts the base64 encoded output in the notification
+	// instead of a download link
+	CallbackInline bool `json:"callbackInline,omitempty"`
+}
+
+// Validate checks that the request names a template and one kind of input
+func (r JobRequest) Validate() error {
+	if r.Template == "" {
+		return fmt.Errorf("template is required")
+	}
+	if r.Version < 0 {
+		return fmt.Errorf("invalid version %d", r.Version)
+	}
+	if r.Fields != nil && r.Records != nil {
+		return fmt.Errorf("use either fields or records, not both")
+	}
+	if r.Fields == nil && len(r.Records) == 0 {
+		return fmt.Errorf("fields or records are required")
+	}
+	switch r.Output {
+	case "", "zip", "pdf":
+	default:
+		return fmt.Errorf("unknown output %q: use zip or pdf", r.Output)
+	}
+	if r.CallbackURL != "" {
+		callback, err := url.Parse(r.CallbackURL)
+		if err != nil || (callback.Scheme != "http" && callback.Scheme != "https") || callback.Host == "" {
+			return fmt.Errorf("invalid callbackUrl %q: use an absolute http or https URL", r.CallbackURL)
+		}
+	} else if r.CallbackInline {
+		return fmt.Errorf("callbackInline requires a callbackUrl")
+	}
+	return nil
+}
+
+// JobRecords returns the records to render
+func (r JobRequest) JobRecords() []map[string]interface{} {
+	if r.Records != nil {
+		return r.Records
+	}
+	return []map[string]interface{}{r.Fields}
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"pdf-gen-simple/internal/utils"
+)
+
+// PageSettings sets the size and orientation of a template page. Fields left
+// empty use the generator's defaults.
+type PageSettings struct {
+	// Size is a named page size such as A4, A5 or Letter
+	Size string `json:"size,omitempty"`
+	// Orientation is P (portrait) or L (landscape)
+	Orientation string `json:"orientation,omitempty"`
+	// Width and Height set a custom page size, taking precedence over Size
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+}
+
+// pageSizes are the named page sizes in points, portrait
+var pageSizes = map[string][2]float64{
+	"a1":      {1683.78, 2383.94},
+	"a2":      {1190.55, 1683.78},
+	"a3":      {841.89, 1190.55},
+	"a4":      {595.28, 841.89},
+	"a5":      {420.94, 595.28},
+	"a6":      {297.64, 420.94},
+	"letter":  {612, 792},
+	"legal":   {612, 1008},
+	"tabloid": {792, 1224},
+}
+
+// LookupPageSize returns the portrait width and height of a named page size in points
+func LookupPageSize(name string) (width, height float64, ok bool) {
+	size, ok := pageSizes[strings.ToLower(strings.TrimSpace(name))]
+	return size[0], size[1], ok
+}
+
+// IsSet returns true if any setting is given
+func (s PageSettings) IsSet() bool {
+	return s.Size != "" || s.Orientation != "" || s.Width != 0 || s.Height != 0
+}
+
+// OrientationCode returns P or L, or "" if no orientation is set. The words
+// portrait and landscape are accepted as well.
+func (s PageSettings) OrientationCode() string {
+	switch strings.ToLower(strings.TrimSpace(s.Orientation)) {
+	case "p", "portrait":
+		return "P"
+	case "l", "landscape":
+		return "L"
+	default:
+		return ""
+	}
+}
+
+// Validate checks the page size and orientation
+func (s PageSettings) Validate() error {
+	if s.Orientation != "" && s.OrientationCode() == "" {
+		return fmt.Errorf("invalid orientation %q: use P or L", s.Orientation)
+	}
+	if s.Width < 0 || s.Height < 0 || (s.Width > 0) != (s.Height > 0) {
+		return fmt.Errorf("invalid page size: width=%.2f, height=%.2f", s.Width, s.Height)
+	}
+	if s.Size != "" && s.Width == 0 {
+		if _, _, ok := LookupPageSize(s.Size); !ok {
+			return fmt.Errorf("unknown page size %q", s.Size)
+		}
+	}
+	return nil
+}
+
+// Dimensions returns the width and height of a page with these settings.
+// The defaults are the generator's page size; their orientation applies to
+// named sizes when no orientation is set. scale is the size of a point in the
+// page unit, used to convert named sizes.
+func (s PageSettings) Dimensions(defaultWidth, defaultHeight, scale float64) (width, height float64) {
+	width, height = defaultWidth, defaultHeight
+	orientation := s.OrientationCode()
+
+	switch {
+	case s.Width > 0 && s.Height > 0:
+		width, height = s.Width, s.Height
+	case s.Size != "":
+		if w, h, ok := LookupPageSize(s.Size); ok {
+			width, height = w*scale, h*scale
+			if orientation == "" && defaultWidth > defaultHeight {
+				orientation = "L"
+			}
+		}
+	}
+
+	if (orientation == "L" && width < height) || (orientation == "P" && width > height) {
+		width, height = height, width
+	}
+	return width, height
+}
+
+// TemplateSettings are the page settings of a whole template. Page elements
+// can still change the size and orientation of single pages.
+type TemplateSettings struct {
+	PageSettings
+	// Unit is the unit of all positions and sizes: mm, cm, in or pt
+	Unit    string  `json:"unit,omitempty"`
+	Margins Margins `json:"margins,omitempty"`
+
+	// Continuous lays each template page out on one page as tall as its
+	// content, as on a receipt roll. Only the page width is used.
+	Continuous bool `json:"continuous,omitempty"`
+	// Monochrome renders QR codes and barcodes as black and white images at
+	// thermal printer resolution
+	Monochrome bool `json:"monochrome,omitempty"`
+}
+
+// Margins are the page margins. Top is where loops and tables continue on a
+// new page, and Bottom is the space they keep free at the bottom of a page.
+// Zero margins use the generator's defaults.
+type Margins struct {
+	Top    float64 `json:"top,omitempty"`
+	Bottom float64 `json:"bottom,omitempty"`
+	Left   float64 `json:"left,omitempty"`
+	Right  float64 `json:"right,omitempty"`
+}
+
+// unitPoints is the size of each measurement unit in points
+var unitPoints = map[string]float64{
+	"pt": 1,
+	"mm": 72 / 25.4,
+	"cm": 72 / 2.54,
+	"in": 72,
+}
+
+// NormalizeUnit returns the short name of a unit (mm, cm, in or pt), or "" if
+// the unit is unknown
+func NormalizeUnit(unit string) string {
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "mm", "millimeter", "millimetre":
+		return "mm"
+	case "cm", "centimeter", "centimetre":
+		return "cm"
+	case "in", "inch", "inches":
+		return "in"
+	case "pt", "point", "points":
+		return "pt"
+	default:
+		return ""
+	}
+}
+
+// UnitPoints returns the size of a unit in points
+func UnitPoints(unit string) (float64, bool) {
+	points, ok := unitPoints[NormalizeUnit(unit)]
+	return points, ok
+}
+
+// Validate checks the page settings, unit and margins
+func (s TemplateSettings) Validate() error {
+	if err := s.Page().Validate(); err != nil {
+		return err
+	}
+	if s.Unit != "" && NormalizeUnit(s.Unit) == "" {
+		return fmt.Errorf("unknown unit %q: use mm, cm, in or pt", s.Unit)
+	}
+	m := s.Margins
+	if m.Top < 0 || m.Bottom < 0 || m.Left < 0 || m.Right < 0 {
+		return fmt.Errorf("invalid margins: top=%.2f, bottom=%.2f, left=%.2f, right=%.2f", m.Top, m.Bottom, m.Left, m.Right)
+	}
+	return nil
+}
+
+// Page returns the settings of the template's pages. Continuous pages only
+// need a width; until the content is laid out they are as tall as they are wide.
+func (s TemplateSettings) Page() PageSettings {
+	page := s.PageSettings
+	if s.Continuous && page.Width > 0 && page.Height == 0 {
+		page.Height = page.Width
+	}
+	return page
+}
+
+// Merge returns the settings with the fields set in other replacing its own
+func (s TemplateSettings) Merge(other TemplateSettings) TemplateSettings {
+	if other.Width > 0 {
+		s.Size, s.Width, s.Height = "", other.Width, other.Height
+	} else if other.Size != "" {
+		s.Size, s.Width, s.Height = other.Size, 0, 0
+	}
+	s.Orientation = utils.Coalesce(other.Orientation, s.Orientation)
+	s.Unit = utils.Coalesce(other.Unit, s.Unit)
+	s.Continuous = s.Continuous || other.Continuous
+	s.Monochrome = s.Monochrome || other.Monochrome
+	s.Margins.Top = nonZero(other.Margins.Top, s.Margins.Top)
+	s.Margins.Bottom = nonZero(other.Margins.Bottom, s.Margins.Bottom)
+	s.Margins.Left = nonZero(other.Margins.Left, s.Margins.Left)
+	s.Margins.Right = nonZero(other.Margins.Right, s.Margins.Right)
+	return s
+}
+
+// nonZero returns value, or fallback if value is zero
+func nonZero(value, fallback float64) float64 {
+	if value != 0 {
+		return value
+	}
+	return fallback
+}
+
+// Settings returns the merged settings of the template's settings elements,
+// in template order
+func Settings(elements []PDFElement) TemplateSettings {
+	var settings TemplateSettings
+	for i := range elements {
+		if elements[i].Type == ElementTypeSettings {
+			settings = settings.Merge(elements[i].Settings)
+		}
+	}
+	return settings
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPageSettingsDimensions(t *testing.T) {
+	// Sizes are converted to millimetres; the default page is A4 portrait
+	const scale = 25.4 / 72
+	tests := []struct {
+		settings      PageSettings
+		width, height float64
+	}{
+		{PageSettings{}, 210, 297},
+		{PageSettings{Size: "A5"}, 148.5, 210},
+		{PageSettings{Size: "a5", Orientation: "L"}, 210, 148.5},
+		{PageSettings{Size: "Letter", Orientation: "landscape"}, 279.4, 215.9},
+		{PageSettings{Orientation: "L"}, 297, 210},
+		{PageSettings{Width: 100, Height: 150}, 100, 150},
+		{PageSettings{Width: 100, Height: 150, Orientation: "L"}, 150, 100},
+		// Custom sizes take precedence over named ones
+		{PageSettings{Size: "A3", Width: 80, Height: 200}, 80, 200},
+	}
+	for _, tt := range tests {
+		width, height := tt.settings.Dimensions(210, 297, scale)
+		if math.Abs(width-tt.width) > 0.1 || math.Abs(height-tt.height) > 0.1 {
+			t.Errorf("%+v: %.1f x %.1f, want %.1f x %.1f", tt.settings, width, height, tt.width, tt.height)
+		}
+	}
+
+	// Named sizes follow a landscape default page unless they set an orientation
+	if width, height := (PageSettings{Size: "A5"}).Dimensions(297, 210, scale); math.Abs(width-210) > 0.1 || math.Abs(height-148.5) > 0.1 {
+		t.Errorf("A5 on a landscape default: %.1f x %.1f, want 210.0 x 148.5", width, height)
+	}
+}
+
+func TestPageSettingsValidate(t *testing.T) {
+	tests := []struct {
+		settings PageSettings
+		valid    bool
+	}{
+		{PageSettings{}, true},
+		{PageSettings{Size: "Tabloid", Orientation: "portrait"}, true},
+		{PageSettings{Width: 80, Height: 200}, true},
+		{PageSettings{Size: "B5"}, false},
+		{PageSettings{Orientation: "sideways"}, false},
+		{PageSettings{Width: 80}, false},
+		{PageSettings{Width: -80, Height: 200}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.settings.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%+v: Validate() = %v", tt.settings, err)
+		}
+	}
+}
+
+func TestUnits(t *testing.T) {
+	tests := []struct {
+		unit   string
+		short  string
+		points float64
+	}{
+		{"mm", "mm", 72 / 25.4},
+		{" Millimetre ", "mm", 72 / 25.4},
+		{"centimetre", "cm", 72 / 2.54},
+		{"inch", "in", 72},
+		{"PT", "pt", 1},
+		{"furlong", "", 0},
+	}
+	for _, tt := range tests {
+		points, ok := UnitPoints(tt.unit)
+		if NormalizeUnit(tt.unit) != tt.short || ok != (tt.short != "") || points != tt.points {
+			t.Errorf("unit %q: %q, %v points, want %q, %v points", tt.unit, NormalizeUnit(tt.unit), points, tt.short, tt.points)
+		}
+	}
+}
+
+func TestTemplateSettings(t *testing.T) {
+	tests := []struct {
+		settings TemplateSettings
+		valid    bool
+	}{
+		{TemplateSettings{}, true},
+		{TemplateSettings{PageSettings: PageSettings{Size: "A5"}, Unit: "inch", Margins: Margins{Top: 1}}, true},
+		{TemplateSettings{PageSettings: PageSettings{Size: "B5"}}, false},
+		{TemplateSettings{Unit: "furlong"}, false},
+		{TemplateSettings{Margins: Margins{Left: -1}}, false},
+		// Continuous pages only need a width
+		{TemplateSettings{PageSettings: PageSettings{Width: 80}, Continuous: true}, true},
+		{TemplateSettings{PageSettings: PageSettings{Width: 80}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.settings.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%+v: Validate() = %v", tt.settings, err)
+		}
+	}
+
+	// Later settings elements replace the fields they set
+	elements := []PDFElement{
+		{Type: ElementTypeSettings, Settings: TemplateSettings{
+			PageSettings: PageSettings{Width: 100, Height: 150, Orientation: "L"},
+			Unit:         "mm",
+			Margins:      Margins{Top: 20, Bottom: 15},
+		}},
+		{Type: ElementTypeText},
+		{Type: ElementTypeSettings, Settings: TemplateSettings{
+			PageSettings: PageSettings{Size: "A5"},
+			Margins:      Margins{Top: 25},
+		}},
+	}
+	want := TemplateSettings{
+		PageSettings: PageSettings{Size: "A5", Orientation: "L"},
+		Unit:         "mm",
+		Margins:      Margins{Top: 25, Bottom: 15},
+	}
+	if got := Settings(elements); got != want {
+		t.Errorf("Settings = %+v, want %+v", got, want)
+	}
+}
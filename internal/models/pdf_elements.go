@@ -3,6 +3,9 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+
+	"pdf-gen-simple/internal/utils"
 )
 
 // ElementType represents the type of PDF element
@@ -15,10 +18,45 @@ const (
 	ElementTypeQR      ElementType = "qr"
 	ElementTypeBarcode ElementType = "barcode"
 	ElementTypeTable   ElementType = "table"
+
+	// ElementTypeComputed defines a variable computed from the request data.
+	// It draws nothing.
+	ElementTypeComputed ElementType = "computed"
+
+	// Composition elements include or extend other templates and remove
+	// inherited elements. The parser resolves them before rendering.
+	ElementTypeInclude ElementType = "include"
+	ElementTypeExtends ElementType = "extends"
+	ElementTypeRemove  ElementType = "remove"
+
+	// ElementTypePage sets the size and orientation of its page. It draws nothing.
+	ElementTypePage ElementType = "page"
+
+	// ElementTypeSettings sets the page size, orientation, margins and unit
+	// of the whole template. It draws nothing.
+	ElementTypeSettings ElementType = "settings"
+)
+
+// PageRegion controls which pages an element is drawn on
+type PageRegion string
+
+const (
+	RegionBody          PageRegion = "body"
+	RegionHeader        PageRegion = "header"
+	RegionFooter        PageRegion = "footer"
+	RegionFirstPageOnly PageRegion = "first-page-only"
+	RegionLastPageOnly  PageRegion = "last-page-only"
+)
+
+// Variables available to every element while a page is drawn
+const (
+	PageNumberVariable = "pageNumber"
+	TotalPagesVariable = "totalPages"
 )
 
 // PDFElement represents a single element in the PDF template
 type PDFElement struct {
+	ID           string        `json:"id,omitempty" csv:"id"`
 	Type         ElementType   `json:"type" csv:"type"`
 	Method       string        `json:"method" csv:"method"`
 	Text         string        `json:"text" csv:"text"`
@@ -28,17 +66,102 @@ type PDFElement struct {
 	Style        Style         `json:"style"`
 	LoopField    string        `json:"loopField" csv:"loopField"`
 	Columns      []TableColumn `json:"columns,omitempty"`
+	Table        TableOptions  `json:"table"`
+
+	// Pagination fields for loop and table elements
+	HeaderFor string  `json:"headerFor,omitempty" csv:"headerFor"`
+	ContinueY float64 `json:"continueY,omitempty" csv:"continueY"`
+
+	// Region places the element in the page header or footer, or on the first or last page only
+	Region PageRegion `json:"region,omitempty" csv:"region"`
+
+	// ShowIf and HideIf are conditions on the request data, such as
+	// "supplierState != placeOfSupply", that control whether the element is drawn
+	ShowIf string `json:"showIf,omitempty" csv:"showIf"`
+	HideIf string `json:"hideIf,omitempty" csv:"hideIf"`
+
+	// Source is the template file an include or extends element refers to,
+	// relative to the template it appears in
+	Source string `json:"src,omitempty" csv:"src"`
+
+	// Page is the template page the element is drawn on, starting at 1.
+	// Body elements without a page are on page 1; header and footer elements
+	// without a page repeat on every page.
+	Page int `json:"page,omitempty" csv:"page"`
+	// PageSetup holds the settings of page elements
+	PageSetup PageSettings `json:"pageSetup,omitempty"`
+	// Settings holds the settings of settings elements
+	Settings TemplateSettings `json:"settings,omitempty"`
 
 	// QR/Barcode specific fields
 	QRContent      string `json:"qrContent,omitempty" csv:"qrContent"`
 	BarcodeFormat  string `json:"barcodeFormat,omitempty" csv:"barcodeFormat"`
 	BarcodeContent string `json:"barcodeContent,omitempty" csv:"barcodeContent"`
+
+	// conditions holds ShowIf and HideIf compiled by CompileConditions. It is
+	// a pointer so that copies of the element, such as loop rows, share it.
+	conditions *Conditions
+}
+
+// IsPageRegion returns true for regions that are drawn outside the body flow
+func (r PageRegion) IsPageRegion() bool {
+	switch r {
+	case RegionHeader, RegionFooter, RegionFirstPageOnly, RegionLastPageOnly:
+		return true
+	default:
+		return false
+	}
 }
 
 // Position represents the position of an element
 type Position struct {
 	X float64 `json:"x" csv:"x"`
 	Y float64 `json:"y" csv:"y"`
+
+	// After anchors Y below the end of a previous element or loop, written as
+	// "after:charges+4" in CSV templates. Gap is the distance below that end.
+	After string  `json:"after,omitempty"`
+	Gap   float64 `json:"gap,omitempty"`
+}
+
+// UnmarshalJSON accepts y either as a number or as a flow anchor string such
+// as "after:charges+4", matching the CSV template syntax
+func (p *Position) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		X     float64         `json:"x"`
+		Y     json.RawMessage `json:"y"`
+		After string          `json:"after"`
+		Gap   float64         `json:"gap"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	p.X, p.After, p.Gap = raw.X, raw.After, raw.Gap
+	p.Y = 0
+
+	var anchor string
+	if err := json.Unmarshal(raw.Y, &anchor); err == nil {
+		name, gap, ok := utils.ParseAnchor(anchor)
+		if !ok {
+			return fmt.Errorf("invalid y position: %q", anchor)
+		}
+		p.After, p.Gap = name, gap
+		return nil
+	}
+
+	if len(raw.Y) > 0 {
+		return json.Unmarshal(raw.Y, &p.Y)
+	}
+	return nil
+}
+
+// AnchorPrevious refers to the element laid out just before an anchored element
+const AnchorPrevious = "previous"
+
+// IsAnchored returns true if Y is resolved from a previous element at render time
+func (p Position) IsAnchored() bool {
+	return p.After != ""
 }
 
 // Size represents the dimensions of an element
@@ -57,6 +180,8 @@ type Style struct {
 	TextColor    Color  `json:"textColor"`
 	Background   Color  `json:"background"`
 	ImageSrc     string `json:"imageSrc" csv:"imageSrc"`
+	// Monochrome renders QR codes and barcodes for thermal printers
+	Monochrome bool `json:"monochrome,omitempty"`
 }
 
 // Font represents font styling
@@ -74,17 +199,56 @@ type Color struct {
 	IsSet bool `json:"isSet,omitempty"`
 }
 
+// UnmarshalJSON marks a color as set when it appears in a JSON or YAML template
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		R     int   `json:"r"`
+		G     int   `json:"g"`
+		B     int   `json:"b"`
+		IsSet *bool `json:"isSet"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	c.R, c.G, c.B = raw.R, raw.G, raw.B
+	c.IsSet = raw.IsSet == nil || *raw.IsSet
+	return nil
+}
+
 // TableColumn represents a column in a table
 type TableColumn struct {
 	Field     string  `json:"field"`
 	Width     float64 `json:"width"`
 	Align     string  `json:"align"`
 	FontStyle string  `json:"fontStyle"`
+	Header    string  `json:"header"`
+}
+
+// TableOptions contains rendering options for table elements
+type TableOptions struct {
+	HideHeader bool  `json:"hideHeader" csv:"tableHeader"`
+	ZebraFill  Color `json:"zebraFill"`
+}
+
+// ComputedField is an entry of the computed section of a JSON or YAML template
+type ComputedField struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// Element returns the computed element defining the field
+func (f ComputedField) Element() PDFElement {
+	return PDFElement{Type: ElementTypeComputed, VariableName: f.Name, Text: f.Expression}
 }
 
 // CSVTemplateRequest represents the JSON input for the CSV template endpoint
 type CSVTemplateRequest struct {
 	Fields map[string]interface{} `json:"fields"`
+	// ErrorPolicy overrides the generator's error policy: lenient, strict or report
+	ErrorPolicy string `json:"errorPolicy,omitempty"`
+	// GST computes CGST/SGST/IGST for the line items before rendering
+	GST *GSTSettings `json:"gst,omitempty"`
 }
 
 // Validate checks if the PDF element has valid values
@@ -93,6 +257,43 @@ func (e *PDFElement) Validate() error {
 		return fmt.Errorf("element type is required")
 	}
 
+	if e.Page < 0 {
+		return fmt.Errorf("invalid page: %d", e.Page)
+	}
+
+	// Composition elements are replaced by the elements they refer to
+	switch e.Type {
+	case ElementTypeInclude, ElementTypeExtends:
+		if e.Source == "" {
+			return fmt.Errorf("%s element requires src", e.Type)
+		}
+		return nil
+	case ElementTypeRemove:
+		if e.ID == "" {
+			return fmt.Errorf("remove element requires the id of the element to remove")
+		}
+		return nil
+	}
+
+	if e.Type == ElementTypePage {
+		return e.PageSetup.Validate()
+	}
+	if e.Type == ElementTypeSettings {
+		return e.Settings.Validate()
+	}
+
+	// Computed elements are not drawn, so they have no position or size
+	if e.Type == ElementTypeComputed {
+		name, expression := e.Computation()
+		if name == "" || expression == "" {
+			return fmt.Errorf("computed element requires a name and an expression")
+		}
+		if !isIdentifier(name) {
+			return fmt.Errorf("invalid computed field name: %s", name)
+		}
+		return nil
+	}
+
 	if e.Position.X < 0 || e.Position.Y < 0 {
 		return fmt.Errorf("invalid position: x=%.2f, y=%.2f", e.Position.X, e.Position.Y)
 	}
@@ -101,6 +302,12 @@ func (e *PDFElement) Validate() error {
 		return fmt.Errorf("invalid size: width=%.2f, height=%.2f", e.Size.Width, e.Size.Height)
 	}
 
+	switch e.Region {
+	case "", RegionBody, RegionHeader, RegionFooter, RegionFirstPageOnly, RegionLastPageOnly:
+	default:
+		return fmt.Errorf("invalid region: %s", e.Region)
+	}
+
 	// Type-specific validation
 	switch e.Type {
 	case ElementTypeQR:
@@ -118,6 +325,16 @@ func (e *PDFElement) Validate() error {
 		if e.Style.ImageSrc == "" && e.VariableName == "" {
 			return fmt.Errorf("image element requires either imageSrc or variableName")
 		}
+	case ElementTypeTable:
+		if e.VariableName == "" {
+			return fmt.Errorf("table element requires variableName pointing to an array field")
+		}
+		if len(e.Columns) == 0 {
+			return fmt.Errorf("table element requires at least one column")
+		}
+		if !(e.Size.Height > 0) {
+			return fmt.Errorf("table element requires a row height greater than 0")
+		}
 	}
 
 	return nil
@@ -128,33 +345,129 @@ func (e *PDFElement) IsLoopElement() bool {
 	return e.LoopField != ""
 }
 
-// GetTextContent returns the text content for the element, processing variables
-func (e *PDFElement) GetTextContent(data map[string]interface{}) string {
+// LoopPath splits LoopField into the paths of the arrays the loop iterates
+// over and the path of the field within each item. "items.description"
+// iterates over items; arrays below the top level are marked with [], as in
+// "shipment.packages[].weight", and "orders[].lines[].sku" iterates over the
+// lines of every order.
+func (e *PDFElement) LoopPath() (arrays []string, field string) {
+	if !strings.Contains(e.LoopField, "[]") {
+		parts := strings.SplitN(e.LoopField, ".", 2)
+		if len(parts) == 2 {
+			return []string{parts[0]}, parts[1]
+		}
+		return []string{parts[0]}, ""
+	}
+
+	parts := strings.Split(e.LoopField, "[]")
+	for _, part := range parts[:len(parts)-1] {
+		arrays = append(arrays, strings.TrimPrefix(part, "."))
+	}
+	return arrays, strings.TrimPrefix(parts[len(parts)-1], ".")
+}
+
+// LoopArray returns the name of the array a loop element iterates over.
+// Loop elements with the same array are laid out as one row group.
+func (e *PDFElement) LoopArray() string {
+	arrays, _ := e.LoopPath()
+	return strings.Join(arrays, "[].")
+}
+
+// GetTextContent returns the content drawn by text, QR and barcode elements,
+// with placeholders replaced and filtered. QR codes and barcodes without their
+// own content use the value of VariableName. A filter error is returned along
+// with the content.
+func (e *PDFElement) GetTextContent(data map[string]interface{}) (string, error) {
 	content := e.Text
 
-	// Process QR content
-	if e.Type == ElementTypeQR {
-		if e.QRContent != "" {
-			content = e.QRContent
-		} else if e.VariableName != "" {
-			if val, ok := data[e.VariableName]; ok {
-				content = fmt.Sprintf("%v", val)
-			}
+	switch e.Type {
+	case ElementTypeQR:
+		content = e.variableContent(e.QRContent, content, data)
+	case ElementTypeBarcode:
+		content = e.variableContent(e.BarcodeContent, content, data)
+	}
+
+	return utils.ExpandPlaceholders(content, data)
+}
+
+// variableContent returns own if set, otherwise the value of VariableName,
+// falling back to text
+func (e *PDFElement) variableContent(own, text string, data map[string]interface{}) string {
+	if own != "" {
+		return own
+	}
+	if e.VariableName != "" {
+		if value, ok := utils.ResolveString(data, e.VariableName); ok {
+			return value
 		}
 	}
+	return text
+}
 
-	// Process barcode content
-	if e.Type == ElementTypeBarcode {
-		if e.BarcodeContent != "" {
-			content = e.BarcodeContent
-		} else if e.VariableName != "" {
-			if val, ok := data[e.VariableName]; ok {
-				content = fmt.Sprintf("%v", val)
-			}
+// PageNumber returns the template page of the element, treating no page as page 1
+func (e *PDFElement) PageNumber() int {
+	if e.Page < 1 {
+		return 1
+	}
+	return e.Page
+}
+
+// IsComposition returns true for include, extends and remove elements
+func (e *PDFElement) IsComposition() bool {
+	switch e.Type {
+	case ElementTypeInclude, ElementTypeExtends, ElementTypeRemove:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsPageSetup returns true for page and settings elements, which set up the
+// pages and draw nothing
+func (e *PDFElement) IsPageSetup() bool {
+	return e.Type == ElementTypePage || e.Type == ElementTypeSettings
+}
+
+// IsConditional returns true if the element has a showIf or hideIf condition
+func (e *PDFElement) IsConditional() bool {
+	return e.ShowIf != "" || e.HideIf != ""
+}
+
+// Computation returns the variable a computed element defines and its
+// expression. The name is VariableName and the expression is Text, or Text
+// holds both as "name = expression".
+func (e *PDFElement) Computation() (name, expression string) {
+	if e.VariableName != "" {
+		return strings.TrimSpace(e.VariableName), strings.TrimSpace(e.Text)
+	}
+
+	for i := 0; i < len(e.Text); i++ {
+		if e.Text[i] != '=' {
+			continue
+		}
+		// Skip the comparison operators ==, !=, <= and >=
+		if i+1 < len(e.Text) && e.Text[i+1] == '=' {
+			i++
+			continue
+		}
+		if i > 0 && strings.ContainsRune("!<>=", rune(e.Text[i-1])) {
+			continue
 		}
+		return strings.TrimSpace(e.Text[:i]), strings.TrimSpace(e.Text[i+1:])
 	}
+	return "", strings.TrimSpace(e.Text)
+}
 
-	return content
+// isIdentifier returns true for names made of ASCII letters, digits and
+// underscores that don't start with a digit
+func isIdentifier(name string) bool {
+	for i, c := range name {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return name != ""
 }
 
 // Clone creates a deep copy of the PDFElement
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoopPath(t *testing.T) {
+	tests := []struct {
+		loopField string
+		arrays    []string
+		field     string
+		array     string
+	}{
+		{"items.description", []string{"items"}, "description", "items"},
+		{"items.tax.rate", []string{"items"}, "tax.rate", "items"},
+		{"tags", []string{"tags"}, "", "tags"},
+		{"shipment.packages[].weight", []string{"shipment.packages"}, "weight", "shipment.packages"},
+		{"orders[].lines[].sku", []string{"orders", "lines"}, "sku", "orders[].lines"},
+		{"orders[].tags[]", []string{"orders", "tags"}, "", "orders[].tags"},
+	}
+	for _, tt := range tests {
+		element := PDFElement{LoopField: tt.loopField}
+		arrays, field := element.LoopPath()
+		if !reflect.DeepEqual(arrays, tt.arrays) || field != tt.field {
+			t.Errorf("LoopPath(%q) = %q, %q; want %q, %q", tt.loopField, arrays, field, tt.arrays, tt.field)
+		}
+		if got := element.LoopArray(); got != tt.array {
+			t.Errorf("LoopArray(%q) = %q, want %q", tt.loopField, got, tt.array)
+		}
+	}
+}
+
+func TestGetTextContent(t *testing.T) {
+	data := map[string]interface{}{
+		"invoiceNumber": "INV-1",
+		"customer": map[string]interface{}{
+			"address": map[string]interface{}{"city": "Pune"},
+		},
+		"shipment": map[string]interface{}{
+			"packages": []interface{}{map[string]interface{}{"tracking": "TRK-9"}},
+		},
+	}
+	tests := []struct {
+		name    string
+		element PDFElement
+		want    string
+	}{
+		{"text", PDFElement{Type: ElementTypeText, Text: "{{invoiceNumber}}, {{customer.address.city}}"}, "INV-1, Pune"},
+		{"unresolved text", PDFElement{Type: ElementTypeText, Text: "{{customer.phone}}"}, "{{customer.phone}}"},
+		{"QR content", PDFElement{Type: ElementTypeQR, QRContent: "{{shipment.packages[0].tracking}}"}, "TRK-9"},
+		{"QR variable", PDFElement{Type: ElementTypeQR, VariableName: "shipment.packages[0].tracking"}, "TRK-9"},
+		{"barcode variable", PDFElement{Type: ElementTypeBarcode, VariableName: "invoiceNumber"}, "INV-1"},
+		{"missing barcode variable", PDFElement{Type: ElementTypeBarcode, VariableName: "missing", Text: "fallback"}, "fallback"},
+	}
+	for _, tt := range tests {
+		got, err := tt.element.GetTextContent(data)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: GetTextContent = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateRegion(t *testing.T) {
+	tests := []struct {
+		region PageRegion
+		valid  bool
+	}{
+		{"", true},
+		{RegionBody, true},
+		{RegionHeader, true},
+		{RegionFooter, true},
+		{RegionFirstPageOnly, true},
+		{RegionLastPageOnly, true},
+		{"sidebar", false},
+	}
+	for _, tt := range tests {
+		element := PDFElement{
+			Type:     ElementTypeText,
+			Text:     "Page {{pageNumber}} of {{totalPages}}",
+			Region:   tt.region,
+			Position: Position{X: 10, Y: 280},
+			Size:     Size{Width: 50, Height: 6},
+		}
+		if err := element.Validate(); (err == nil) != tt.valid {
+			t.Errorf("region %q: Validate() = %v", tt.region, err)
+		}
+		if tt.region.IsPageRegion() != (tt.valid && tt.region != "" && tt.region != RegionBody) {
+			t.Errorf("region %q: IsPageRegion() = %v", tt.region, tt.region.IsPageRegion())
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"pdf-gen-simple/internal/utils"
+)
+
+// VariableType is the type of a template variable
+type VariableType string
+
+const (
+	VariableTypeString  VariableType = "string"
+	VariableTypeNumber  VariableType = "number"
+	VariableTypeBoolean VariableType = "boolean"
+	VariableTypeDate    VariableType = "date"
+	VariableTypeArray   VariableType = "array"
+	VariableTypeObject  VariableType = "object"
+)
+
+// DefaultDateFormat is the Go time layout used for date variables without a format
+const DefaultDateFormat = "2006-01-02"
+
+// TemplateVariable describes a value a template expects in the request fields.
+// Format is a regular expression for strings and a Go time layout for dates.
+// Fields describes the items of an array variable.
+type TemplateVariable struct {
+	Name     string             `json:"name"`
+	Type     VariableType       `json:"type"`
+	Required bool               `json:"required"`
+	Default  interface{}        `json:"default,omitempty"`
+	Format   string             `json:"format,omitempty"`
+	Fields   []TemplateVariable `json:"fields,omitempty"`
+}
+
+// UnmarshalJSON decodes a declared variable. Declared variables are required
+// unless "required": false is given.
+func (v *TemplateVariable) UnmarshalJSON(data []byte) error {
+	type variable TemplateVariable
+	var raw struct {
+		variable
+		Required *bool `json:"required"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*v = TemplateVariable(raw.variable)
+	v.Required = raw.Required == nil || *raw.Required
+	return nil
+}
+
+// TemplateSchema lists the variables a template uses
+type TemplateSchema struct {
+	Variables []TemplateVariable `json:"variables"`
+}
+
+// FieldError describes a request field that doesn't match the template schema
+type FieldError struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"` // missing, type or format
+	Message string `json:"message"`
+}
+
+// Error implements error
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Lookup returns the variable with the given name
+func (s *TemplateSchema) Lookup(name string) (*TemplateVariable, bool) {
+	for i := range s.Variables {
+		if s.Variables[i].Name == name {
+			return &s.Variables[i], true
+		}
+	}
+	return nil, false
+}
+
+// Merge overrides the schema's variables with declared ones, adding any that
+// are missing. Array fields are merged the same way.
+func (s *TemplateSchema) Merge(declared []TemplateVariable) {
+	s.Variables = mergeVariables(s.Variables, declared)
+}
+
+// mergeVariables overrides variables with declared ones by name
+func mergeVariables(variables, declared []TemplateVariable) []TemplateVariable {
+	for _, d := range declared {
+		found := false
+		for i := range variables {
+			if variables[i].Name != d.Name {
+				continue
+			}
+			fields := mergeVariables(variables[i].Fields, d.Fields)
+			if d.Type == "" {
+				d.Type = variables[i].Type
+			}
+			variables[i] = d
+			variables[i].Fields = fields
+			found = true
+			break
+		}
+		if !found {
+			variables = append(variables, d)
+		}
+	}
+	return variables
+}
+
+// Validate checks the declared variables for unknown types and bad formats
+func (s *TemplateSchema) Validate() error {
+	return validateVariables(s.Variables, "")
+}
+
+// validateVariables checks a list of variables and their fields
+func validateVariables(variables []TemplateVariable, prefix string) error {
+	for _, v := range variables {
+		name := prefix + v.Name
+		if v.Name == "" {
+			return fmt.Errorf("variable name is required")
+		}
+		switch v.Type {
+		case "", VariableTypeString:
+			if v.Format != "" {
+				if _, err := regexp.Compile(v.Format); err != nil {
+					return fmt.Errorf("variable %s: invalid format: %w", name, err)
+				}
+			}
+		case VariableTypeNumber, VariableTypeBoolean, VariableTypeDate, VariableTypeObject:
+		case VariableTypeArray:
+			if err := validateVariables(v.Fields, name+"[]."); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("variable %s: unknown type %q", name, v.Type)
+		}
+	}
+	return nil
+}
+
+// ApplyDefaults returns a copy of fields with defaults set for missing
+// variables, including the fields of array items
+func (s *TemplateSchema) ApplyDefaults(fields map[string]interface{}) map[string]interface{} {
+	return applyDefaults(s.Variables, fields)
+}
+
+// applyDefaults copies fields and fills in defaults for a list of variables
+func applyDefaults(variables []TemplateVariable, fields map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		result[k] = v
+	}
+
+	for _, v := range variables {
+		value, ok := utils.ResolvePath(result, v.Name)
+		if (!ok || value == nil) && v.Default != nil {
+			result[v.Name] = v.Default
+			continue
+		}
+		if v.Type != VariableTypeArray || !hasDefaults(v.Fields) {
+			continue
+		}
+		if items, isArray := utils.ToSlice(value); isArray {
+			withDefaults := make([]interface{}, len(items))
+			for i, item := range items {
+				if itemFields, isMap := item.(map[string]interface{}); isMap {
+					item = applyDefaults(v.Fields, itemFields)
+				}
+				withDefaults[i] = item
+			}
+			result[v.Name] = withDefaults
+		}
+	}
+	return result
+}
+
+// hasDefaults returns true if any of the variables has a default
+func hasDefaults(variables []TemplateVariable) bool {
+	for _, v := range variables {
+		if v.Default != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns the request fields that are missing or don't match their
+// variable's type or format
+func (s *TemplateSchema) Check(fields map[string]interface{}) []FieldError {
+	var problems []FieldError
+	for _, v := range s.Variables {
+		problems = append(problems, checkVariable(v, v.Name, fields)...)
+	}
+	return problems
+}
+
+// checkVariable checks one variable against the values in fields
+func checkVariable(v TemplateVariable, path string, fields map[string]interface{}) []FieldError {
+	value, ok := utils.ResolvePath(fields, v.Name)
+	if !ok || value == nil {
+		if v.Required && v.Default == nil {
+			return []FieldError{{Field: path, Problem: "missing", Message: "required field is missing"}}
+		}
+		return nil
+	}
+
+	switch v.Type {
+	case VariableTypeArray:
+		items, isArray := utils.ToSlice(value)
+		if !isArray {
+			return []FieldError{typeError(path, v.Type, value)}
+		}
+		var problems []FieldError
+		for i, item := range items {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			itemFields, isMap := item.(map[string]interface{})
+			if !isMap {
+				if len(v.Fields) > 0 {
+					problems = append(problems, typeError(itemPath, VariableTypeObject, item))
+				}
+				continue
+			}
+			for _, field := range v.Fields {
+				problems = append(problems, checkVariable(field, itemPath+"."+field.Name, itemFields)...)
+			}
+		}
+		return problems
+
+	case VariableTypeObject:
+		if _, isMap := value.(map[string]interface{}); !isMap {
+			return []FieldError{typeError(path, v.Type, value)}
+		}
+
+	case VariableTypeNumber:
+		switch n := value.(type) {
+		case float64, float32, int, int64:
+		case string:
+			if _, err := strconv.ParseFloat(n, 64); err != nil {
+				return []FieldError{typeError(path, v.Type, value)}
+			}
+		default:
+			return []FieldError{typeError(path, v.Type, value)}
+		}
+
+	case VariableTypeBoolean:
+		if _, isBool := value.(bool); !isBool {
+			return []FieldError{typeError(path, v.Type, value)}
+		}
+
+	case VariableTypeDate:
+		text, isString := value.(string)
+		if !isString {
+			return []FieldError{typeError(path, v.Type, value)}
+		}
+		layout := v.Format
+		if layout == "" {
+			layout = DefaultDateFormat
+		}
+		if _, err := time.Parse(layout, text); err != nil {
+			return []FieldError{{Field: path, Problem: "format",
+				Message: fmt.Sprintf("%q is not a date in the format %s", text, layout)}}
+		}
+
+	default: // string
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return []FieldError{typeError(path, VariableTypeString, value)}
+		}
+		if v.Format != "" {
+			pattern, err := regexp.Compile(v.Format)
+			if err == nil && !pattern.MatchString(fmt.Sprintf("%v", value)) {
+				return []FieldError{{Field: path, Problem: "format",
+					Message: fmt.Sprintf("value does not match the format %s", v.Format)}}
+			}
+		}
+	}
+
+	return nil
+}
+
+// typeError describes a value of the wrong type
+func typeError(path string, expected VariableType, value interface{}) FieldError {
+	return FieldError{
+		Field:   path,
+		Problem: "type",
+		Message: fmt.Sprintf("expected %s, got %s", expected, jsonType(value)),
+	}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64, float32, int, int64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}, []map[string]interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// Example returns request fields that satisfy the schema, for documentation
+func (s *TemplateSchema) Example() map[string]interface{} {
+	return exampleFields(s.Variables)
+}
+
+// exampleFields builds example values for a list of variables
+func exampleFields(variables []TemplateVariable) map[string]interface{} {
+	example := make(map[string]interface{}, len(variables))
+	for _, v := range variables {
+		if v.Default != nil {
+			example[v.Name] = v.Default
+			continue
+		}
+		switch v.Type {
+		case VariableTypeNumber:
+			example[v.Name] = 0
+		case VariableTypeBoolean:
+			example[v.Name] = false
+		case VariableTypeDate:
+			layout := v.Format
+			if layout == "" {
+				layout = DefaultDateFormat
+			}
+			example[v.Name] = time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC).Format(layout)
+		case VariableTypeArray:
+			example[v.Name] = []interface{}{exampleFields(v.Fields)}
+		case VariableTypeObject:
+			example[v.Name] = map[string]interface{}{}
+		default:
+			example[v.Name] = v.Name
+		}
+	}
+	return example
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// invoiceSchema declares one variable of every type
+func invoiceSchema() TemplateSchema {
+	return TemplateSchema{Variables: []TemplateVariable{
+		{Name: "invoiceNumber", Type: VariableTypeString, Required: true, Format: `^INV-\d+$`},
+		{Name: "total", Type: VariableTypeNumber, Required: true},
+		{Name: "paid", Type: VariableTypeBoolean},
+		{Name: "dueDate", Type: VariableTypeDate, Format: "02/01/2006"},
+		{Name: "customer", Type: VariableTypeObject},
+		{Name: "currency", Type: VariableTypeString, Required: true, Default: "INR"},
+		{Name: "items", Type: VariableTypeArray, Required: true, Fields: []TemplateVariable{
+			{Name: "description", Type: VariableTypeString, Required: true},
+			{Name: "qty", Type: VariableTypeNumber},
+		}},
+	}}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	valid := map[string]interface{}{
+		"invoiceNumber": "INV-1",
+		"total":         "118.00",
+		"paid":          true,
+		"dueDate":       "31/01/2024",
+		"customer":      map[string]interface{}{"name": "Acme"},
+		"items":         []interface{}{map[string]interface{}{"description": "Freight", "qty": 2}},
+	}
+	tests := []struct {
+		name   string
+		change map[string]interface{}
+		want   []FieldError
+	}{
+		{"valid", nil, nil},
+		{"missing", map[string]interface{}{"invoiceNumber": nil, "total": nil}, []FieldError{
+			{Field: "invoiceNumber", Problem: "missing"},
+			{Field: "total", Problem: "missing"},
+		}},
+		{"format", map[string]interface{}{"invoiceNumber": "1", "dueDate": "2024-01-31"}, []FieldError{
+			{Field: "invoiceNumber", Problem: "format"},
+			{Field: "dueDate", Problem: "format"},
+		}},
+		{"types", map[string]interface{}{"total": "a lot", "paid": "yes", "customer": "Acme", "items": "Freight"}, []FieldError{
+			{Field: "total", Problem: "type", Message: "expected number, got string"},
+			{Field: "paid", Problem: "type", Message: "expected boolean, got string"},
+			{Field: "customer", Problem: "type", Message: "expected object, got string"},
+			{Field: "items", Problem: "type", Message: "expected array, got string"},
+		}},
+		{"items", map[string]interface{}{"items": []interface{}{
+			map[string]interface{}{"qty": "two"},
+			"Insurance",
+		}}, []FieldError{
+			{Field: "items[0].description", Problem: "missing"},
+			{Field: "items[0].qty", Problem: "type"},
+			{Field: "items[1]", Problem: "type", Message: "expected object, got string"},
+		}},
+	}
+
+	schema := invoiceSchema()
+	for _, tt := range tests {
+		fields := make(map[string]interface{}, len(valid))
+		for k, v := range valid {
+			fields[k] = v
+		}
+		for k, v := range tt.change {
+			fields[k] = v
+		}
+
+		problems := schema.Check(fields)
+		if len(problems) != len(tt.want) {
+			t.Errorf("%s: problems = %+v, want %+v", tt.name, problems, tt.want)
+			continue
+		}
+		for i, problem := range problems {
+			want := tt.want[i]
+			if problem.Field != want.Field || problem.Problem != want.Problem || (want.Message != "" && problem.Message != want.Message) {
+				t.Errorf("%s: problem %d = %+v, want %+v", tt.name, i+1, problem, want)
+			}
+		}
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	schema := TemplateSchema{Variables: []TemplateVariable{
+		{Name: "currency", Type: VariableTypeString, Default: "INR"},
+		{Name: "items", Type: VariableTypeArray, Fields: []TemplateVariable{
+			{Name: "qty", Type: VariableTypeNumber, Default: 1.0},
+		}},
+	}}
+	fields := map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"qty": 2.0}, map[string]interface{}{}},
+	}
+
+	got := schema.ApplyDefaults(fields)
+	want := map[string]interface{}{
+		"currency": "INR",
+		"items":    []interface{}{map[string]interface{}{"qty": 2.0}, map[string]interface{}{"qty": 1.0}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyDefaults = %v, want %v", got, want)
+	}
+	if _, ok := fields["currency"]; ok {
+		t.Error("ApplyDefaults changed the request fields")
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		variables []TemplateVariable
+		valid     bool
+	}{
+		{invoiceSchema().Variables, true},
+		{[]TemplateVariable{{Type: VariableTypeString}}, false},
+		{[]TemplateVariable{{Name: "total", Type: "money"}}, false},
+		{[]TemplateVariable{{Name: "code", Format: "[A-Z"}}, false},
+		{[]TemplateVariable{{Name: "items", Type: VariableTypeArray, Fields: []TemplateVariable{{Name: "qty", Type: "count"}}}}, false},
+	}
+	for _, tt := range tests {
+		schema := TemplateSchema{Variables: tt.variables}
+		if err := schema.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v", tt.variables, err)
+		}
+	}
+}
+
+func TestDeclaredVariables(t *testing.T) {
+	var schema TemplateSchema
+	declared := `{"variables": [{"name": "total", "type": "number"}, {"name": "notes", "required": false}]}`
+	if err := json.Unmarshal([]byte(declared), &schema); err != nil {
+		t.Fatal(err)
+	}
+	// Declared variables are required unless they say otherwise
+	if !schema.Variables[0].Required || schema.Variables[1].Required {
+		t.Errorf("variables = %+v, want total required and notes optional", schema.Variables)
+	}
+
+	// Declared variables replace inferred ones, keeping the inferred type if
+	// they don't give one
+	inferred := TemplateSchema{Variables: []TemplateVariable{
+		{Name: "total", Type: VariableTypeString, Required: true},
+		{Name: "notes", Type: VariableTypeString, Required: true},
+		{Name: "invoiceNumber", Type: VariableTypeString, Required: true},
+	}}
+	inferred.Merge(append(schema.Variables, TemplateVariable{Name: "paid", Type: VariableTypeBoolean}))
+	want := []TemplateVariable{
+		{Name: "total", Type: VariableTypeNumber, Required: true},
+		{Name: "notes", Type: VariableTypeString},
+		{Name: "invoiceNumber", Type: VariableTypeString, Required: true},
+		{Name: "paid", Type: VariableTypeBoolean},
+	}
+	if !reflect.DeepEqual(inferred.Variables, want) {
+		t.Errorf("merged variables = %+v, want %+v", inferred.Variables, want)
+	}
+}
+
+func TestSchemaExample(t *testing.T) {
+	// Examples of strings are their names, so they don't follow a format
+	schema := invoiceSchema()
+	schema.Variables[0].Format = ""
+	example := schema.Example()
+	if problems := schema.Check(example); len(problems) != 0 {
+		t.Errorf("the example doesn't satisfy the schema: %+v", problems)
+	}
+	if example["dueDate"] != "31/01/2024" || example["currency"] != "INR" {
+		t.Errorf("example = %v", example)
+	}
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLabelsDontFit is returned for label grids larger than their sheet
+var ErrLabelsDontFit = errors.New("labels don't fit on the sheet")
+
+// SheetLayout describes label stock: a grid of labels printed row by row onto
+// each sheet. Sizes are in the label template's unit.
+type SheetLayout struct {
+	// PageSettings is the sheet size; it defaults to the generator's page size
+	PageSettings
+	Rows    int `json:"rows"`
+	Columns int `json:"columns"`
+	// LabelWidth and LabelHeight default to the grid filling the sheet inside its margins
+	LabelWidth  float64 `json:"labelWidth,omitempty"`
+	LabelHeight float64 `json:"labelHeight,omitempty"`
+	// ColumnGap and RowGap are the gutters between labels
+	ColumnGap float64 `json:"columnGap,omitempty"`
+	RowGap    float64 `json:"rowGap,omitempty"`
+	Margins   Margins `json:"margins,omitempty"`
+	// Skip is the number of labels already used on the first sheet
+	Skip int `json:"skip,omitempty"`
+}
+
+// Validate checks the grid, gaps and margins
+func (s SheetLayout) Validate() error {
+	if err := s.PageSettings.Validate(); err != nil {
+		return err
+	}
+	if s.Rows < 1 || s.Columns < 1 {
+		return fmt.Errorf("invalid grid: rows=%d, columns=%d", s.Rows, s.Columns)
+	}
+	if s.LabelWidth < 0 || s.LabelHeight < 0 || s.ColumnGap < 0 || s.RowGap < 0 {
+		return fmt.Errorf("invalid label size or gap: width=%.2f, height=%.2f, columnGap=%.2f, rowGap=%.2f",
+			s.LabelWidth, s.LabelHeight, s.ColumnGap, s.RowGap)
+	}
+	m := s.Margins
+	if m.Top < 0 || m.Bottom < 0 || m.Left < 0 || m.Right < 0 {
+		return fmt.Errorf("invalid margins: top=%.2f, bottom=%.2f, left=%.2f, right=%.2f", m.Top, m.Bottom, m.Left, m.Right)
+	}
+	if s.Skip < 0 || s.Skip >= s.LabelsPerSheet() {
+		return fmt.Errorf("invalid skip %d: a sheet has %d labels", s.Skip, s.LabelsPerSheet())
+	}
+	// A custom sheet size is in the template's unit, like the labels, so the
+	// grid can be checked here; named sizes are checked by CheckFit when the
+	// unit is known
+	if s.Width > 0 && s.Height > 0 {
+		return s.CheckFit(s.PageSettings.Dimensions(s.Width, s.Height, 1))
+	}
+	return nil
+}
+
+// CheckFit checks that the grid of labels, with its gaps and margins, fits
+// on a sheet of the given size
+func (s SheetLayout) CheckFit(sheetWidth, sheetHeight float64) error {
+	width, height := s.LabelSize(sheetWidth, sheetHeight)
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("%w: the margins and gaps leave no room for %d x %d labels", ErrLabelsDontFit, s.Columns, s.Rows)
+	}
+
+	// Allow for rounding in sizes such as 63.5mm
+	const tolerance = 1e-6
+	across := s.Margins.Left + float64(s.Columns)*width + float64(s.Columns-1)*s.ColumnGap + s.Margins.Right
+	if across > sheetWidth+tolerance {
+		return fmt.Errorf("%w: %d columns of %.2f need a width of %.2f, the sheet is %.2f",
+			ErrLabelsDontFit, s.Columns, width, across, sheetWidth)
+	}
+	down := s.Margins.Top + float64(s.Rows)*height + float64(s.Rows-1)*s.RowGap + s.Margins.Bottom
+	if down > sheetHeight+tolerance {
+		return fmt.Errorf("%w: %d rows of %.2f need a height of %.2f, the sheet is %.2f",
+			ErrLabelsDontFit, s.Rows, height, down, sheetHeight)
+	}
+	return nil
+}
+
+// LabelsPerSheet returns the number of labels on a sheet
+func (s SheetLayout) LabelsPerSheet() int {
+	return s.Rows * s.Columns
+}
+
+// LabelSize returns the size of a label on a sheet of the given size
+func (s SheetLayout) LabelSize(sheetWidth, sheetHeight float64) (width, height float64) {
+	width, height = s.LabelWidth, s.LabelHeight
+	if width == 0 {
+		width = (sheetWidth - s.Margins.Left - s.Margins.Right - float64(s.Columns-1)*s.ColumnGap) / float64(s.Columns)
+	}
+	if height == 0 {
+		height = (sheetHeight - s.Margins.Top - s.Margins.Bottom - float64(s.Rows-1)*s.RowGap) / float64(s.Rows)
+	}
+	return width, height
+}
+
+// LabelPosition returns the top left corner of label n on a sheet, counting
+// row by row from 0
+func (s SheetLayout) LabelPosition(n int, labelWidth, labelHeight float64) (x, y float64) {
+	row, column := n/s.Columns, n%s.Columns
+	x = s.Margins.Left + float64(column)*(labelWidth+s.ColumnGap)
+	y = s.Margins.Top + float64(row)*(labelHeight+s.RowGap)
+	return x, y
+}
+
+// LabelSheetRequest represents the JSON input for the label sheet endpoint
+type LabelSheetRequest struct {
+	// Fields are shared by every label; a record's own fields take precedence
+	Fields  map[string]interface{}   `json:"fields"`
+	Records []map[string]interface{} `json:"records"`
+	Sheet   SheetLayout              `json:"sheet"`
+	// ErrorPolicy overrides the generator's error policy: lenient, strict or report
+	ErrorPolicy string `json:"errorPolicy,omitempty"`
+}
+
+// LabelRecords returns the records with the shared fields added
+func (r LabelSheetRequest) LabelRecords() []map[string]interface{} {
+	records := make([]map[string]interface{}, len(r.Records))
+	for i, record := range r.Records {
+		merged := make(map[string]interface{}, len(r.Fields)+len(record))
+		for k, v := range r.Fields {
+			merged[k] = v
+		}
+		for k, v := range record {
+			merged[k] = v
+		}
+		records[i] = merged
+	}
+	return records
+}
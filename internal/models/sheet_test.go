@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// a4Labels is 14 labels of 99.1 x 38.1mm on an A4 sheet
+func a4Labels() SheetLayout {
+	return SheetLayout{
+		PageSettings: PageSettings{Width: 210, Height: 297},
+		Rows:         7,
+		Columns:      2,
+		LabelWidth:   99.1,
+		LabelHeight:  38.1,
+		ColumnGap:    2.5,
+		Margins:      Margins{Top: 15.15, Bottom: 15.15, Left: 4.65, Right: 4.65},
+	}
+}
+
+func TestSheetLayoutValidateFit(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*SheetLayout)
+		fits   bool
+	}{
+		{"labels that fill the sheet", func(s *SheetLayout) {}, true},
+		{"derived label size", func(s *SheetLayout) { s.LabelWidth, s.LabelHeight = 0, 0 }, true},
+		{"too many columns", func(s *SheetLayout) { s.Columns = 3 }, false},
+		{"too many rows", func(s *SheetLayout) { s.Rows = 8 }, false},
+		{"column gap too wide", func(s *SheetLayout) { s.ColumnGap = 5 }, false},
+		{"row gap too tall", func(s *SheetLayout) { s.RowGap = 1 }, false},
+		{"margins too wide", func(s *SheetLayout) { s.Margins.Left = 10 }, false},
+		{"margins leave no room", func(s *SheetLayout) {
+			s.LabelWidth, s.LabelHeight = 0, 0
+			s.Margins.Left, s.Margins.Right = 105, 105
+		}, false},
+		{"landscape sheet", func(s *SheetLayout) {
+			s.Orientation = "L"
+			s.Rows, s.Columns, s.LabelWidth = 4, 3, 90
+		}, true},
+		{"portrait sheet", func(s *SheetLayout) { s.Rows, s.Columns, s.LabelWidth = 4, 3, 90 }, false},
+	}
+	for _, tt := range tests {
+		sheet := a4Labels()
+		tt.change(&sheet)
+		err := sheet.Validate()
+		switch {
+		case tt.fits && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case !tt.fits && !errors.Is(err, ErrLabelsDontFit):
+			t.Errorf("%s: error = %v, want ErrLabelsDontFit", tt.name, err)
+		}
+	}
+}
+
+func TestSheetLayoutCheckFitNamedSize(t *testing.T) {
+	// The size of named sheets depends on the template's unit, so the grid
+	// is only checked once the sheet size is known
+	sheet := a4Labels()
+	sheet.PageSettings = PageSettings{Size: "A4"}
+	sheet.Columns = 3
+	if err := sheet.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if err := sheet.CheckFit(210, 297); !errors.Is(err, ErrLabelsDontFit) {
+		t.Errorf("CheckFit error = %v, want ErrLabelsDontFit", err)
+	}
+	sheet.Columns = 2
+	if err := sheet.CheckFit(210, 297); err != nil {
+		t.Errorf("CheckFit: %v", err)
+	}
+}
+
+func TestSheetLayoutLabelPosition(t *testing.T) {
+	sheet := a4Labels()
+	width, height := sheet.LabelSize(210, 297)
+	if width != 99.1 || height != 38.1 {
+		t.Fatalf("LabelSize = %v x %v", width, height)
+	}
+
+	x, y := sheet.LabelPosition(3, width, height)
+	if x != 4.65+99.1+2.5 || y != 15.15+38.1 {
+		t.Errorf("label 3 at (%v, %v)", x, y)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 
 	"pdf-gen-simple/internal/cache"
@@ -24,38 +23,14 @@ func NewCSVParser() *CSVParser {
 	}
 }
 
-// ParseCSV parses a CSV template file and returns PDF elements
+// ParseCSV parses a local CSV template file and returns PDF elements
 func (p *CSVParser) ParseCSV(filePath string) ([]models.PDFElement, error) {
-	// Check cache first
-	if elements, found := p.cache.Get(filePath); found {
-		utils.LogDebug("CSV template loaded from cache: %s", filePath)
-		return elements, nil
-	}
-
-	utils.LogInfo("Parsing CSV template: %s", filePath)
-
-	// Open and parse CSV file
-	elements, err := p.parseCSVFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse CSV file: %w", err)
-	}
-
-	// Cache the parsed elements
-	p.cache.Set(filePath, elements)
-
-	utils.LogInfo("Successfully parsed %d elements from CSV", len(elements))
-	return elements, nil
+	return loadLocalTemplate(filePath, p, p.cache)
 }
 
-// parseCSVFile performs the actual CSV parsing
-func (p *CSVParser) parseCSVFile(filePath string) ([]models.PDFElement, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error opening CSV file: %w", err)
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
+// parseCSVData performs the actual CSV parsing
+func (p *CSVParser) parseCSVData(data io.Reader) ([]models.PDFElement, error) {
+	reader := csv.NewReader(data)
 	reader.TrimLeadingSpace = true
 	reader.ReuseRecord = true // Performance optimization
 
@@ -64,6 +39,8 @@ func (p *CSVParser) parseCSVFile(filePath string) ([]models.PDFElement, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error reading CSV headers: %w", err)
 	}
+	// Copy headers since ReuseRecord lets later reads overwrite the slice
+	headers = append([]string(nil), headers...)
 
 	utils.LogDebug("CSV Headers: %v", headers)
 
@@ -120,16 +97,21 @@ func (p *CSVParser) createElementFromRow(headers, record []string, rowIndex int)
 
 	// Parse basic properties
 	element := &models.PDFElement{
+		ID:           data["id"],
 		Type:         p.parseElementType(data["type"], data["method"]),
 		Method:       data["method"],
 		Text:         data["text"],
 		VariableName: data["variableName"],
 		LoopField:    data["loopField"],
+		HeaderFor:    data["headerFor"],
+		ContinueY:    utils.ParseFloat(data["continueY"]),
+		Region:       models.PageRegion(strings.ToLower(strings.TrimSpace(data["region"]))),
+		ShowIf:       strings.TrimSpace(data["showIf"]),
+		HideIf:       strings.TrimSpace(data["hideIf"]),
+		Source:       strings.TrimSpace(data["src"]),
+		Page:         utils.ParseInt(data["page"]),
 
-		Position: models.Position{
-			X: utils.ParseFloat(data["x"]),
-			Y: utils.ParseFloat(data["y"]),
-		},
+		Position: p.parsePosition(data["x"], data["y"]),
 
 		Size: models.Size{
 			Width:  utils.ParseFloat(data["width"]),
@@ -165,6 +147,48 @@ func (p *CSVParser) createElementFromRow(headers, record []string, rowIndex int)
 		QRContent:      data["qrContent"],
 		BarcodeFormat:  utils.Coalesce(data["barcodeFormat"], "Code128"),
 		BarcodeContent: data["barcodeContent"],
+
+		// Table specific fields
+		Table: models.TableOptions{
+			HideHeader: data["tableHeader"] == "0",
+			ZebraFill: models.Color{
+				R:     utils.ParseInt(data["zebraColorR"]),
+				G:     utils.ParseInt(data["zebraColorG"]),
+				B:     utils.ParseInt(data["zebraColorB"]),
+				IsSet: data["zebraColorR"] != "" || data["zebraColorG"] != "" || data["zebraColorB"] != "",
+			},
+		},
+	}
+
+	// Page rows set the size and orientation of their page
+	if element.Type == models.ElementTypePage {
+		element.PageSetup = models.PageSettings{
+			Size:        strings.TrimSpace(data["pageSize"]),
+			Orientation: strings.TrimSpace(data["orientation"]),
+			Width:       element.Size.Width,
+			Height:      element.Size.Height,
+		}
+	}
+
+	// Settings rows set the page size, orientation, unit and margins of the template
+	if element.Type == models.ElementTypeSettings {
+		element.Settings = models.TemplateSettings{
+			PageSettings: models.PageSettings{
+				Size:        strings.TrimSpace(data["pageSize"]),
+				Orientation: strings.TrimSpace(data["orientation"]),
+				Width:       element.Size.Width,
+				Height:      element.Size.Height,
+			},
+			Unit: strings.TrimSpace(data["unit"]),
+			Margins: models.Margins{
+				Top:    utils.ParseFloat(data["marginTop"]),
+				Bottom: utils.ParseFloat(data["marginBottom"]),
+				Left:   utils.ParseFloat(data["marginLeft"]),
+				Right:  utils.ParseFloat(data["marginRight"]),
+			},
+			Continuous: data["continuous"] == "1",
+			Monochrome: data["monochrome"] == "1",
+		}
 	}
 
 	// Set default font size if not specified
@@ -189,40 +213,88 @@ func (p *CSVParser) createElementFromRow(headers, record []string, rowIndex int)
 	return element, nil
 }
 
+// parsePosition parses x and y, where y may be a flow anchor like "after:charges+4"
+func (p *CSVParser) parsePosition(x, y string) models.Position {
+	position := models.Position{X: utils.ParseFloat(x)}
+
+	if name, gap, ok := utils.ParseAnchor(y); ok {
+		position.After = name
+		position.Gap = gap
+	} else {
+		position.Y = utils.ParseFloat(y)
+	}
+
+	return position
+}
+
 // parseElementType determines the element type from type and method fields
 func (p *CSVParser) parseElementType(typeField, methodField string) models.ElementType {
+	return elementType(typeField, methodField)
+}
+
+// elementType determines the element type from type and method fields
+func elementType(typeField, methodField string) models.ElementType {
 	// If type is explicitly set, use it
-	if typeField != "" {
-		switch strings.ToLower(typeField) {
-		case "text":
-			return models.ElementTypeText
-		case "box":
-			return models.ElementTypeBox
-		case "image":
-			return models.ElementTypeImage
-		case "qr":
-			return models.ElementTypeQR
-		case "barcode":
-			return models.ElementTypeBarcode
-		case "table":
-			return models.ElementTypeTable
-		}
+	if elementType, ok := lookupElementType(typeField); ok {
+		return elementType
 	}
 
 	// Infer from method if type is not set
+	if elementType, ok := lookupMethod(methodField); ok {
+		return elementType
+	}
+	return models.ElementTypeText // Default fallback
+}
+
+// lookupElementType maps a type field to a known element type
+func lookupElementType(typeField string) (models.ElementType, bool) {
+	switch strings.ToLower(strings.TrimSpace(typeField)) {
+	case "text":
+		return models.ElementTypeText, true
+	case "box":
+		return models.ElementTypeBox, true
+	case "image":
+		return models.ElementTypeImage, true
+	case "qr":
+		return models.ElementTypeQR, true
+	case "barcode":
+		return models.ElementTypeBarcode, true
+	case "table":
+		return models.ElementTypeTable, true
+	case "computed":
+		return models.ElementTypeComputed, true
+	case "include":
+		return models.ElementTypeInclude, true
+	case "extends":
+		return models.ElementTypeExtends, true
+	case "remove":
+		return models.ElementTypeRemove, true
+	case "page":
+		return models.ElementTypePage, true
+	case "settings":
+		return models.ElementTypeSettings, true
+	default:
+		return "", false
+	}
+}
+
+// lookupMethod maps a method field to the element type it implies
+func lookupMethod(methodField string) (models.ElementType, bool) {
 	switch methodField {
 	case "MultiCell", "Cell":
-		return models.ElementTypeText
+		return models.ElementTypeText, true
 	case "Rect":
-		return models.ElementTypeBox
+		return models.ElementTypeBox, true
 	case "Image":
-		return models.ElementTypeImage
+		return models.ElementTypeImage, true
 	case "QR":
-		return models.ElementTypeQR
+		return models.ElementTypeQR, true
 	case "Barcode":
-		return models.ElementTypeBarcode
+		return models.ElementTypeBarcode, true
+	case "Table":
+		return models.ElementTypeTable, true
 	default:
-		return models.ElementTypeText // Default fallback
+		return "", false
 	}
 }
 
@@ -232,14 +304,24 @@ func (p *CSVParser) parseColumns(columnsData string) ([]models.TableColumn, erro
 	// to support JSON format or a more sophisticated parsing mechanism
 
 	// For now, assume comma-separated format: "field1:width1:align1,field2:width2:align2"
+	// An optional fourth and fifth part set the font style and header label:
+	// "amount:30:R:B:Amount (INR)". A field or header containing ":" or ","
+	// is double quoted, as a field with filter arguments must be:
+	// "amount|currency:INR":30:R
 	var columns []models.TableColumn
 
-	parts := strings.Split(columnsData, ",")
+	parts, err := utils.SplitQuoted(columnsData, ',')
+	if err != nil {
+		return nil, err
+	}
 	for _, part := range parts {
-		columnParts := strings.Split(strings.TrimSpace(part), ":")
+		columnParts, err := utils.SplitQuoted(strings.TrimSpace(part), ':')
+		if err != nil {
+			return nil, err
+		}
 		if len(columnParts) >= 2 {
 			column := models.TableColumn{
-				Field: strings.TrimSpace(columnParts[0]),
+				Field: utils.Unquote(strings.TrimSpace(columnParts[0])),
 				Width: utils.ParseFloat(columnParts[1]),
 			}
 
@@ -250,7 +332,15 @@ func (p *CSVParser) parseColumns(columnsData string) ([]models.TableColumn, erro
 			}
 
 			if len(columnParts) >= 4 {
-				column.FontStyle = columnParts[3]
+				column.FontStyle = strings.TrimSpace(columnParts[3])
+			}
+
+			if len(columnParts) >= 5 {
+				column.Header = utils.Unquote(strings.TrimSpace(strings.Join(columnParts[4:], ":")))
+			}
+			if column.Header == "" {
+				column.Header, _, _ = strings.Cut(column.Field, "|")
+				column.Header = strings.TrimSpace(column.Header)
 			}
 
 			columns = append(columns, column)
@@ -270,6 +360,11 @@ func (p *CSVParser) ClearCache() {
 	p.cache.Clear()
 }
 
+// Parse implements TemplateLoader
+func (p *CSVParser) Parse(reader io.Reader) ([]models.PDFElement, error) {
+	return p.parseCSVData(reader)
+}
+
 // ParseCSVFromReader parses CSV data from an io.Reader (for testing or dynamic content)
 func (p *CSVParser) ParseCSVFromReader(reader io.Reader) ([]models.PDFElement, error) {
 	csvReader := csv.NewReader(reader)
@@ -281,6 +376,7 @@ func (p *CSVParser) ParseCSVFromReader(reader io.Reader) ([]models.PDFElement, e
 	if err != nil {
 		return nil, fmt.Errorf("error reading CSV headers: %w", err)
 	}
+	headers = append([]string(nil), headers...)
 
 	var elements []models.PDFElement
 	rowIndex := 1
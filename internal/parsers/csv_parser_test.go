@@ -0,0 +1,169 @@
+package parsers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+func TestParseTableRow(t *testing.T) {
+	template := "type,method,x,y,width,height,variableName,columns,tableHeader,zebraColorR,zebraColorG,zebraColorB,border\n" +
+		"text,Cell,10,10,50,6,,,,,,,\n" +
+		"table,Table,10,20,120,6,charges,name:80:L::Charge,0,240,240,240,1\n" +
+		"table,Table,10,80,120,6,charges,name:80,,,,,\n" +
+		// Tables need an array and columns
+		"table,Table,10,80,120,6,,name:80,,,,,\n" +
+		"table,Table,10,80,120,6,charges,,,,,,\n"
+	elements, err := NewCSVParser().ParseCSVFromReader(strings.NewReader(template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every row is read with the header of the first line
+	if len(elements) != 3 {
+		t.Fatalf("got %d elements, want 3", len(elements))
+	}
+
+	table := elements[1]
+	if table.Type != models.ElementTypeTable || table.VariableName != "charges" || table.Style.Border != "1" {
+		t.Errorf("table = %+v", table)
+	}
+	want := []models.TableColumn{{Field: "name", Width: 80, Align: "L", Header: "Charge"}}
+	if !reflect.DeepEqual(table.Columns, want) {
+		t.Errorf("columns = %+v, want %+v", table.Columns, want)
+	}
+	if !table.Table.HideHeader || table.Table.ZebraFill != (models.Color{R: 240, G: 240, B: 240, IsSet: true}) {
+		t.Errorf("table options = %+v, want a hidden header and zebra fill", table.Table)
+	}
+	if elements[2].Table.HideHeader || elements[2].Table.ZebraFill.IsSet {
+		t.Errorf("table options = %+v, want the defaults", elements[2].Table)
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		x, y string
+		want models.Position
+	}{
+		{"10", "20.5", models.Position{X: 10, Y: 20.5}},
+		{"10", "after:charges+4", models.Position{X: 10, After: "charges", Gap: 4}},
+		{"", "after:previous", models.Position{After: "previous"}},
+		{"10", "", models.Position{X: 10}},
+	}
+	p := NewCSVParser()
+	for _, tt := range tests {
+		if got := p.parsePosition(tt.x, tt.y); got != tt.want {
+			t.Errorf("parsePosition(%q, %q) = %+v, want %+v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	template := "type,method,x,y,width,height,text,region\n" +
+		"text,Cell,10,5,50,6,Acme Ltd, Header \n" +
+		"text,Cell,10,280,50,6,Page {{pageNumber}} of {{totalPages}},FOOTER\n" +
+		"text,Cell,10,20,50,6,Tax Invoice,first-page-only\n" +
+		"text,Cell,10,30,50,6,Body,\n" +
+		"text,Cell,10,40,50,6,Sidebar,sidebar\n"
+	elements, err := NewCSVParser().ParseCSVFromReader(strings.NewReader(template))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The row with an unknown region is dropped
+	want := []models.PageRegion{models.RegionHeader, models.RegionFooter, models.RegionFirstPageOnly, ""}
+	if len(elements) != len(want) {
+		t.Fatalf("got %d elements, want %d", len(elements), len(want))
+	}
+	for i, element := range elements {
+		if element.Region != want[i] {
+			t.Errorf("element %d: region %q, want %q", i+1, element.Region, want[i])
+		}
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns string
+		want    []models.TableColumn
+	}{
+		{
+			"plain columns",
+			"description:100,amount:40:R:B:Amount",
+			[]models.TableColumn{
+				{Field: "description", Width: 100, Align: "L", Header: "description"},
+				{Field: "amount", Width: 40, Align: "R", FontStyle: "B", Header: "Amount"},
+			},
+		},
+		{
+			"header containing a colon",
+			"time:30:C::Time (hh:mm)",
+			[]models.TableColumn{{Field: "time", Width: 30, Align: "C", Header: "Time (hh:mm)"}},
+		},
+		{
+			"quoted header containing a comma",
+			`amount:40:R::"Amount, INR",qty:10`,
+			[]models.TableColumn{
+				{Field: "amount", Width: 40, Align: "R", Header: "Amount, INR"},
+				{Field: "qty", Width: 10, Align: "L", Header: "qty"},
+			},
+		},
+		{
+			"filter without arguments",
+			"name|upper:60",
+			[]models.TableColumn{{Field: "name|upper", Width: 60, Align: "L", Header: "name"}},
+		},
+		{
+			"quoted filter arguments",
+			`"price|currency:INR":40:R,"date|date:\"02 Jan 2006\"":30:L:B:Date`,
+			[]models.TableColumn{
+				{Field: "price|currency:INR", Width: 40, Align: "R", Header: "price"},
+				{Field: `date|date:"02 Jan 2006"`, Width: 30, Align: "L", FontStyle: "B", Header: "Date"},
+			},
+		},
+	}
+
+	p := NewCSVParser()
+	for _, tt := range tests {
+		got, err := p.parseColumns(tt.columns)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: columns = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := p.parseColumns(`"price|currency:INR:40:R`); err == nil {
+		t.Error("an unterminated quote was accepted")
+	}
+}
+
+func TestCSVColumnFilterArguments(t *testing.T) {
+	// The CSV cell quotes the column definition and doubles its quotes
+	template := "type,method,x,y,width,height,variableName,columns\n" +
+		`table,Table,10,10,190,60,items,"""date|date:""02 Jan 2006"""":40:L,""amount|currency:INR:""Rs. """":30:R"` + "\n"
+	elements, err := NewCSVParser().ParseCSVFromReader(strings.NewReader(template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 1 || len(elements[0].Columns) != 2 {
+		t.Fatalf("elements = %+v, want a table with two columns", elements)
+	}
+
+	wantArgs := [][]string{{"02 Jan 2006"}, {"INR", "Rs. "}}
+	for i, column := range elements[0].Columns {
+		placeholder, err := utils.ParsePlaceholder(column.Field)
+		if err != nil {
+			t.Errorf("column %d: %v", i+1, err)
+			continue
+		}
+		if len(placeholder.Filters) != 1 || !reflect.DeepEqual(placeholder.Filters[0].Args, wantArgs[i]) {
+			t.Errorf("column %d: filters = %+v, want arguments %q", i+1, placeholder.Filters, wantArgs[i])
+		}
+	}
+}
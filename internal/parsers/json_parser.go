@@ -0,0 +1,165 @@
+package parsers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"pdf-gen-simple/internal/cache"
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// JSONParser handles parsing JSON templates
+type JSONParser struct {
+	cache *cache.TemplateCache
+}
+
+// templateDocument is the structured template format shared by JSON and YAML.
+// A bare array of elements is accepted as well. Computed fields are evaluated
+// before the elements, in order. Extends names a base template, as an extends
+// element would. Settings hold the page settings of the whole template, as a
+// settings element would. Pages hold the elements of each page along with the
+// page's settings.
+type templateDocument struct {
+	Extends  string                   `json:"extends"`
+	Settings *models.TemplateSettings `json:"settings"`
+	Computed []models.ComputedField   `json:"computed"`
+	Elements []models.PDFElement      `json:"elements"`
+	Pages    []templatePage           `json:"pages"`
+}
+
+// templatePage is a page section of a structured template
+type templatePage struct {
+	models.PageSettings
+	// Page is the page number; it defaults to the section's position
+	Page     int                 `json:"page"`
+	Elements []models.PDFElement `json:"elements"`
+}
+
+// allElements returns the document's settings and elements followed by those
+// of its page sections. Each section starts with a page element holding its
+// settings.
+func (d templateDocument) allElements() []models.PDFElement {
+	var elements []models.PDFElement
+	if d.Settings != nil {
+		elements = append(elements, models.PDFElement{Type: models.ElementTypeSettings, Settings: *d.Settings})
+	}
+	elements = append(elements, d.Elements...)
+	for i, section := range d.Pages {
+		page := section.Page
+		if page == 0 {
+			page = i + 1
+		}
+		if section.PageSettings.IsSet() {
+			elements = append(elements, models.PDFElement{Type: models.ElementTypePage, Page: page, PageSetup: section.PageSettings})
+		}
+		for _, element := range section.Elements {
+			if element.Page == 0 {
+				element.Page = page
+			}
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// NewJSONParser creates a new JSON parser with caching
+func NewJSONParser() *JSONParser {
+	return &JSONParser{
+		cache: cache.GetTemplateCache(),
+	}
+}
+
+// ParseJSON parses a local JSON template file and returns PDF elements
+func (p *JSONParser) ParseJSON(filePath string) ([]models.PDFElement, error) {
+	return loadLocalTemplate(filePath, p, p.cache)
+}
+
+// ParseJSONFromReader parses JSON template data from an io.Reader
+func (p *JSONParser) ParseJSONFromReader(reader io.Reader) ([]models.PDFElement, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading JSON template: %w", err)
+	}
+	return parseStructuredElements(data)
+}
+
+// Parse implements TemplateLoader
+func (p *JSONParser) Parse(reader io.Reader) ([]models.PDFElement, error) {
+	return p.ParseJSONFromReader(reader)
+}
+
+// decodeTemplateDocument decodes a JSON template document or bare element array
+func decodeTemplateDocument(data []byte) (templateDocument, error) {
+	var document templateDocument
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &document.Elements); err != nil {
+			return document, fmt.Errorf("error decoding template elements: %w", err)
+		}
+	} else if err := json.Unmarshal(trimmed, &document); err != nil {
+		return document, fmt.Errorf("error decoding template document: %w", err)
+	}
+
+	return document, nil
+}
+
+// parseStructuredElements decodes a JSON template document and validates its elements
+func parseStructuredElements(data []byte) ([]models.PDFElement, error) {
+	document, err := decodeTemplateDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var elements []models.PDFElement
+	if document.Extends != "" {
+		elements = append(elements, models.PDFElement{Type: models.ElementTypeExtends, Source: document.Extends})
+	}
+
+	for i, field := range document.Computed {
+		element := field.Element()
+		if err := element.Validate(); err != nil {
+			utils.LogWarn("Invalid computed field %d: %v", i+1, err)
+			continue
+		}
+		elements = append(elements, element)
+	}
+
+	sections := document.allElements()
+	for i := range sections {
+		element := &sections[i]
+		normalizeElement(element)
+
+		if err := element.Validate(); err != nil {
+			utils.LogWarn("Invalid element %d: %v", i+1, err)
+			continue
+		}
+
+		elements = append(elements, *element)
+	}
+
+	return elements, nil
+}
+
+// normalizeElement applies the same defaults the CSV parser uses
+func normalizeElement(element *models.PDFElement) {
+	element.Type = elementType(string(element.Type), element.Method)
+	element.Region = models.PageRegion(strings.ToLower(strings.TrimSpace(string(element.Region))))
+	element.Style.Align = utils.NormalizeAlign(element.Style.Align)
+	element.Style.Font.Family = utils.Coalesce(element.Style.Font.Family, "Tahoma")
+	element.BarcodeFormat = utils.Coalesce(element.BarcodeFormat, "Code128")
+
+	if element.Style.Font.Size == 0 {
+		element.Style.Font.Size = 10
+	}
+
+	for i := range element.Columns {
+		column := &element.Columns[i]
+		column.Align = utils.NormalizeAlign(column.Align)
+		column.Header = utils.Coalesce(column.Header, column.Field)
+	}
+}
@@ -0,0 +1,272 @@
+package parsers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/storage"
+)
+
+// The same invoice in each template format
+const (
+	csvInvoice = "type,method,x,y,width,height,text,variableName,columns,fontStyle,fontSize,region\n" +
+		"text,Cell,10,10,80,8,Invoice {{invoiceNumber}},,,B,14,header\n" +
+		"table,Table,10,30,120,6,,charges,\"description:80:L::Charge,amount:40:R:B:Amount\",,,\n" +
+		"text,Cell,10,after:charges+4,80,6,Total {{total}},,,,,\n"
+
+	jsonInvoice = `{
+  "elements": [
+    {"type": "text", "method": "Cell", "position": {"x": 10, "y": 10}, "size": {"width": 80, "height": 8},
+     "text": "Invoice {{invoiceNumber}}", "region": "Header",
+     "style": {"font": {"style": "B", "size": 14}}},
+    {"type": "table", "variableName": "charges", "position": {"x": 10, "y": 30}, "size": {"width": 120, "height": 6},
+     "columns": [
+       {"field": "description", "width": 80, "align": "left", "header": "Charge"},
+       {"field": "amount", "width": 40, "align": "R", "fontStyle": "B", "header": "Amount"}
+     ]},
+    {"type": "text", "method": "Cell", "position": {"x": 10, "y": "after:charges+4"}, "size": {"width": 80, "height": 6},
+     "text": "Total {{total}}"}
+  ]
+}`
+
+	yamlInvoice = `elements:
+  - type: text
+    method: Cell
+    position: {x: 10, y: 10}
+    size: {width: 80, height: 8}
+    text: "Invoice {{invoiceNumber}}"
+    region: header
+    style:
+      font: {style: B, size: 14}
+  - type: table
+    variableName: charges
+    position: {x: 10, y: 30}
+    size: {width: 120, height: 6}
+    columns:
+      - {field: description, width: 80, header: Charge}
+      - {field: amount, width: 40, align: R, fontStyle: B, header: Amount}
+  - type: text
+    method: Cell
+    position: {x: 10, y: "after:charges+4"}
+    size: {width: 80, height: 6}
+    text: "Total {{total}}"
+`
+)
+
+// summary is the part of an element the format tests compare
+type summary struct {
+	Type     models.ElementType
+	Text     string
+	Region   models.PageRegion
+	Position models.Position
+	Size     models.Size
+	Font     models.Font
+	Columns  []models.TableColumn
+}
+
+func summarize(elements []models.PDFElement) []summary {
+	summaries := make([]summary, len(elements))
+	for i, e := range elements {
+		summaries[i] = summary{e.Type, e.Text, e.Region, e.Position, e.Size, e.Style.Font, e.Columns}
+	}
+	return summaries
+}
+
+func TestTemplateFormatsAgree(t *testing.T) {
+	csvElements, err := NewCSVParser().parseCSVData(strings.NewReader(csvInvoice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonElements, err := NewJSONParser().ParseJSONFromReader(strings.NewReader(jsonInvoice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlElements, err := NewYAMLParser().ParseYAMLFromReader(strings.NewReader(yamlInvoice))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := summarize(csvElements)
+	if len(want) != 3 {
+		t.Fatalf("CSV template has %d elements, want 3", len(want))
+	}
+	if got := summarize(jsonElements); !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON elements = %+v\nwant %+v", got, want)
+	}
+	if got := summarize(yamlElements); !reflect.DeepEqual(got, want) {
+		t.Errorf("YAML elements = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     int
+	}{
+		{"bare array", `[{"type": "text", "position": {"x": 10, "y": 10}, "size": {"width": 50, "height": 6}, "text": "Invoice"}]`, 1},
+		{"method only", `[{"method": "Rect", "position": {"x": 10, "y": 10}, "size": {"width": 50, "height": 6}}]`, 1},
+		// Elements that fail validation are left out
+		{"invalid element", `[{"type": "table", "position": {"x": 10, "y": 10}, "size": {"width": 50, "height": 6}},
+			{"type": "text", "position": {"x": 10, "y": 20}, "size": {"width": 50, "height": 6}, "text": "Invoice"}]`, 1},
+		{"empty document", `{}`, 0},
+	}
+	for _, tt := range tests {
+		elements, err := NewJSONParser().ParseJSONFromReader(strings.NewReader(tt.template))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(elements) != tt.want {
+			t.Errorf("%s: got %d elements, want %d", tt.name, len(elements), tt.want)
+		}
+	}
+
+	for _, template := range []string{`{"elements": [`, `[{"position": {"y": "below:items"}}]`, `[{"position": {"y": true}}]`} {
+		if _, err := NewJSONParser().ParseJSONFromReader(strings.NewReader(template)); err == nil {
+			t.Errorf("%s: parsed without an error", template)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	// An empty file has no elements
+	elements, err := NewYAMLParser().ParseYAMLFromReader(strings.NewReader(""))
+	if err != nil || len(elements) != 0 {
+		t.Errorf("empty YAML: %d elements, %v", len(elements), err)
+	}
+	if _, err := NewYAMLParser().ParseYAMLFromReader(strings.NewReader("elements: [")); err == nil {
+		t.Error("invalid YAML parsed without an error")
+	}
+}
+
+func TestLoadChoosesLoaderByExtension(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"invoice.csv":  csvInvoice,
+		"invoice.json": jsonInvoice,
+		"invoice.yaml": yamlInvoice,
+		"invoice.YML":  yamlInvoice,
+		"invoice.txt":  csvInvoice,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loaders := NewTemplateLoaders(storage.NewDirStore(dir))
+
+	for _, name := range []string{"invoice.csv", "invoice.json", "invoice.yaml", "invoice.YML"} {
+		if !loaders.Supports(name) {
+			t.Errorf("%s isn't supported", name)
+		}
+		elements, err := loaders.Load(name)
+		if err != nil || len(elements) != 3 {
+			t.Errorf("%s: %d elements, %v", name, len(elements), err)
+		}
+	}
+	if loaders.Supports("invoice.txt") {
+		t.Error("invoice.txt is supported")
+	}
+	if _, err := loaders.Load("invoice.txt"); err == nil || !strings.Contains(err.Error(), "unsupported template format") {
+		t.Errorf("invoice.txt: error = %v", err)
+	}
+}
+
+func TestParsePages(t *testing.T) {
+	csvTemplate := "type,method,x,y,width,height,text,page,pageSize,orientation\n" +
+		"text,Cell,10,10,80,8,Invoice,,,\n" +
+		"page,,0,0,0,0,,2,A5,L\n" +
+		"text,Cell,10,10,80,8,Terms,2,,\n" +
+		"page,,0,0,100,150,,3,,\n"
+	jsonTemplate := `{
+  "elements": [{"type": "text", "method": "Cell", "position": {"x": 10, "y": 10}, "size": {"width": 80, "height": 8}, "text": "Invoice"}],
+  "pages": [
+    {"page": 2, "size": "A5", "orientation": "L",
+     "elements": [{"type": "text", "method": "Cell", "position": {"x": 10, "y": 10}, "size": {"width": 80, "height": 8}, "text": "Terms"}]},
+    {"page": 3, "width": 100, "height": 150}
+  ]
+}`
+
+	csvElements, err := NewCSVParser().parseCSVData(strings.NewReader(csvTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonElements, err := NewJSONParser().ParseJSONFromReader(strings.NewReader(jsonTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type page struct {
+		Type  models.ElementType
+		Page  int
+		Setup models.PageSettings
+	}
+	want := []page{
+		{models.ElementTypeText, 0, models.PageSettings{}},
+		{models.ElementTypePage, 2, models.PageSettings{Size: "A5", Orientation: "L"}},
+		{models.ElementTypeText, 2, models.PageSettings{}},
+		{models.ElementTypePage, 3, models.PageSettings{Width: 100, Height: 150}},
+	}
+	for format, elements := range map[string][]models.PDFElement{"CSV": csvElements, "JSON": jsonElements} {
+		got := make([]page, len(elements))
+		for i, e := range elements {
+			got[i] = page{e.Type, e.Page, e.PageSetup}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s pages = %+v\nwant %+v", format, got, want)
+		}
+	}
+
+	// Sections without a page number are numbered by their position
+	sections := `{"pages": [{"elements": [{"type": "text", "text": "Invoice", "size": {"width": 80, "height": 8}}]},
+	  {"elements": [{"type": "text", "text": "Terms", "size": {"width": 80, "height": 8}}]}]}`
+	elements, err := NewJSONParser().ParseJSONFromReader(strings.NewReader(sections))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 2 || elements[0].Page != 1 || elements[1].Page != 2 {
+		t.Errorf("section elements = %+v, want pages 1 and 2", elements)
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	csvTemplate := "type,x,y,width,height,pageSize,orientation,unit,marginTop,marginBottom,marginLeft,marginRight\n" +
+		"settings,0,0,0,0,Letter,L,in,1,0.75,0.5,0.5\n"
+	jsonTemplate := `{"settings": {"size": "Letter", "orientation": "L", "unit": "in",
+	  "margins": {"top": 1, "bottom": 0.75, "left": 0.5, "right": 0.5}}}`
+
+	csvElements, err := NewCSVParser().parseCSVData(strings.NewReader(csvTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonElements, err := NewJSONParser().ParseJSONFromReader(strings.NewReader(jsonTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := models.TemplateSettings{
+		PageSettings: models.PageSettings{Size: "Letter", Orientation: "L"},
+		Unit:         "in",
+		Margins:      models.Margins{Top: 1, Bottom: 0.75, Left: 0.5, Right: 0.5},
+	}
+	for format, elements := range map[string][]models.PDFElement{"CSV": csvElements, "JSON": jsonElements} {
+		if len(elements) != 1 || elements[0].Type != models.ElementTypeSettings {
+			t.Errorf("%s elements = %+v, want a settings element", format, elements)
+			continue
+		}
+		if got := models.Settings(elements); got != want {
+			t.Errorf("%s settings = %+v, want %+v", format, got, want)
+		}
+	}
+
+	// Settings rows that fail validation are left out like other elements
+	elements, err := NewCSVParser().parseCSVData(strings.NewReader(strings.Replace(csvTemplate, ",in,", ",furlong,", 1)))
+	if err != nil || len(elements) != 0 {
+		t.Errorf("settings with an unknown unit: %d elements, %v", len(elements), err)
+	}
+}
@@ -0,0 +1,224 @@
+package parsers
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/storage"
+	"pdf-gen-simple/internal/utils"
+)
+
+// maxCompositionDepth limits how deeply templates may include or extend each other
+const maxCompositionDepth = 16
+
+// composition resolves the include, extends and remove elements of a template
+type composition struct {
+	store storage.TemplateStore
+	// root is the directory of the template being loaded; included files
+	// must stay inside it
+	root string
+	// stack holds the files being resolved, to detect cycles
+	stack []string
+	// files maps every included or extended file to its content version, for
+	// cache invalidation
+	files map[string]string
+}
+
+// resolveComposition replaces the composition elements of a parsed template
+// with the elements they refer to. It returns the resolved elements and the
+// versions of the files they were read from, besides the template itself.
+//
+// A template extends at most one base template: it starts from the base's
+// elements, replaces those with the same id and drops those named by remove
+// elements. Include elements insert another template's elements in place,
+// offset by the include's x and y.
+func resolveComposition(store storage.TemplateStore, name string, elements []models.PDFElement) ([]models.PDFElement, map[string]string, error) {
+	if !hasComposition(elements) {
+		return elements, nil, nil
+	}
+
+	c := &composition{
+		store: store,
+		root:  path.Dir(name),
+		stack: []string{name},
+		files: make(map[string]string),
+	}
+
+	resolved, err := c.resolve(name, elements)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolved, c.files, nil
+}
+
+// hasComposition returns true if any element includes, extends or removes
+func hasComposition(elements []models.PDFElement) bool {
+	for i := range elements {
+		if elements[i].IsComposition() {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve resolves the composition elements of the template name
+func (c *composition) resolve(name string, elements []models.PDFElement) ([]models.PDFElement, error) {
+	var result []models.PDFElement
+
+	extended := false
+	for _, element := range elements {
+		if element.Type != models.ElementTypeExtends {
+			continue
+		}
+		if extended {
+			return nil, fmt.Errorf("%s: a template can extend only one base template", path.Base(name))
+		}
+		base, err := c.load(name, element.Source)
+		if err != nil {
+			return nil, err
+		}
+		result = base
+		extended = true
+	}
+
+	for _, element := range elements {
+		switch element.Type {
+		case models.ElementTypeExtends:
+			continue
+
+		case models.ElementTypeRemove:
+			if i := indexByID(result, element.ID); i >= 0 {
+				result = append(result[:i], result[i+1:]...)
+			} else {
+				utils.LogWarn("%s: no element with id %q to remove", path.Base(name), element.ID)
+			}
+
+		case models.ElementTypeInclude:
+			included, err := c.load(name, element.Source)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range included {
+				result = merge(result, placeIncluded(element, child))
+			}
+
+		default:
+			result = merge(result, element)
+		}
+	}
+
+	return result, nil
+}
+
+// load parses and resolves a template referenced from the template at from
+func (c *composition) load(from, source string) ([]models.PDFElement, error) {
+	name := path.Join(path.Dir(from), filepath.ToSlash(source))
+	if !insideDir(c.root, name) || path.IsAbs(filepath.ToSlash(source)) {
+		return nil, fmt.Errorf("%s: %s is outside the template directory", path.Base(from), source)
+	}
+	for i, file := range c.stack {
+		if file == name {
+			return nil, fmt.Errorf("template cycle: %s", cycleNames(append(append([]string(nil), c.stack[i:]...), name)))
+		}
+	}
+	if len(c.stack) >= maxCompositionDepth {
+		return nil, fmt.Errorf("%s: templates are nested more than %d levels deep", path.Base(from), maxCompositionDepth)
+	}
+
+	data, info, err := c.store.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error loading %s: %w", path.Base(from), source, err)
+	}
+	elements, err := parseTemplateData(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error loading %s: %w", path.Base(from), source, err)
+	}
+	c.files[name] = info.Version
+
+	c.stack = append(c.stack, name)
+	defer func() { c.stack = c.stack[:len(c.stack)-1] }()
+	return c.resolve(name, elements)
+}
+
+// insideDir reports whether a clean slash-separated name is inside dir
+func insideDir(dir, name string) bool {
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return false
+	}
+	return dir == "." || strings.HasPrefix(name, dir+"/")
+}
+
+// parseTemplateData parses CSV, JSON or YAML template data without resolving
+// it, choosing the format by the file name's extension
+func parseTemplateData(name string, data []byte) ([]models.PDFElement, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv":
+		return (&CSVParser{}).parseCSVData(bytes.NewReader(data))
+	case ".json":
+		return parseStructuredElements(data)
+	case ".yaml", ".yml":
+		converted, err := yamlToJSON(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return parseStructuredElements(converted)
+	default:
+		return nil, fmt.Errorf("unsupported template format: %s", name)
+	}
+}
+
+// merge adds an element, replacing an earlier element with the same id in place
+func merge(elements []models.PDFElement, element models.PDFElement) []models.PDFElement {
+	if i := indexByID(elements, element.ID); i >= 0 {
+		elements[i] = element
+		return elements
+	}
+	return append(elements, element)
+}
+
+// indexByID returns the index of the element with the given id, or -1
+func indexByID(elements []models.PDFElement, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i := range elements {
+		if elements[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// placeIncluded offsets an included element by the include's position and
+// gives it the include's region and page if it has none
+func placeIncluded(include, element models.PDFElement) models.PDFElement {
+	element = *element.Clone()
+	if element.Type == models.ElementTypeComputed || element.Type == models.ElementTypeSettings {
+		return element
+	}
+
+	element.Position.X += include.Position.X
+	if !element.Position.IsAnchored() {
+		element.Position.Y += include.Position.Y
+	}
+	if element.Region == "" {
+		element.Region = include.Region
+	}
+	if element.Page == 0 {
+		element.Page = include.Page
+	}
+	return element
+}
+
+// cycleNames formats a cycle of template files for an error message
+func cycleNames(files []string) string {
+	names := make([]string, len(files))
+	for i, name := range files {
+		names[i] = path.Base(name)
+	}
+	return strings.Join(names, " -> ")
+}
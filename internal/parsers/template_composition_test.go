@@ -0,0 +1,216 @@
+package parsers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/storage"
+)
+
+// compositionHeader is the header of the CSV templates in the composition tests
+const compositionHeader = "id,type,method,x,y,width,height,text,src,region\n"
+
+// writeTemplates writes files into dir, creating subdirectories
+func writeTemplates(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// texts returns the text of each element
+func texts(elements []models.PDFElement) []string {
+	result := make([]string, len(elements))
+	for i, element := range elements {
+		result[i] = element.Text
+	}
+	return result
+}
+
+func TestComposition(t *testing.T) {
+	files := map[string]string{
+		"partials/header.csv": compositionHeader +
+			"logo,text,Cell,0,0,80,8,Acme Ltd,,\n" +
+			"address,text,Cell,0,8,80,6,Pune,,\n",
+		"base.csv": compositionHeader +
+			"title,text,Cell,10,30,80,8,Invoice,,\n" +
+			"terms,text,Cell,10,250,80,6,Terms,,\n" +
+			"sign,text,Cell,10,270,80,6,Signature,,\n",
+		"header.json": `[{"type": "include", "src": "partials/header.csv", "position": {"x": 10, "y": 5}, "region": "header"}]`,
+	}
+	tests := []struct {
+		name     string
+		template string
+		texts    []string
+	}{
+		{
+			"include",
+			compositionHeader +
+				",include,,10,5,0,0,,partials/header.csv,header\n" +
+				",text,Cell,10,30,80,8,Invoice,,\n",
+			[]string{"Acme Ltd", "Pune", "Invoice"},
+		},
+		{
+			// Elements replace base elements with the same id in place
+			"extends with overrides",
+			compositionHeader +
+				",extends,,0,0,0,0,,base.csv,\n" +
+				"title,text,Cell,10,30,80,8,Tax Invoice,,\n" +
+				"sign,remove,,0,0,0,0,,,\n" +
+				",text,Cell,10,280,80,6,Thank you,,\n",
+			[]string{"Tax Invoice", "Terms", "Thank you"},
+		},
+		{
+			"nested includes",
+			compositionHeader +
+				",include,,0,0,0,0,,header.json,\n",
+			[]string{"Acme Ltd", "Pune"},
+		},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeTemplates(t, dir, files)
+		writeTemplates(t, dir, map[string]string{"invoice.csv": tt.template})
+
+		elements, err := NewTemplateLoaders(storage.NewDirStore(dir)).Load("invoice.csv")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := texts(elements); strings.Join(got, "|") != strings.Join(tt.texts, "|") {
+			t.Errorf("%s: texts = %q, want %q", tt.name, got, tt.texts)
+		}
+	}
+}
+
+func TestIncludedElementsArePlaced(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{
+		"header.csv": compositionHeader +
+			"logo,text,Cell,0,0,80,8,Acme Ltd,,\n" +
+			"address,text,Cell,0,8,80,6,Pune,,footer\n",
+		"invoice.csv": compositionHeader + ",include,,10,5,0,0,,header.csv,header\n",
+	})
+
+	elements, err := NewTemplateLoaders(storage.NewDirStore(dir)).Load("invoice.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 2 {
+		t.Fatalf("got %d elements, want 2", len(elements))
+	}
+	// Included elements are offset by the include and keep their own region
+	want := []struct {
+		x, y   float64
+		region models.PageRegion
+	}{{10, 5, models.RegionHeader}, {10, 13, models.RegionFooter}}
+	for i, element := range elements {
+		if element.Position.X != want[i].x || element.Position.Y != want[i].y || element.Region != want[i].region {
+			t.Errorf("element %d at %.0f,%.0f in %q, want %.0f,%.0f in %q", i+1,
+				element.Position.X, element.Position.Y, element.Region, want[i].x, want[i].y, want[i].region)
+		}
+	}
+}
+
+func TestCompositionErrors(t *testing.T) {
+	files := map[string]string{
+		"a.csv":        compositionHeader + ",include,,0,0,0,0,,b.csv,\n",
+		"b.csv":        compositionHeader + ",include,,0,0,0,0,,a.csv,\n",
+		"self.csv":     compositionHeader + ",extends,,0,0,0,0,,self.csv,\n",
+		"outside.csv":  compositionHeader + ",include,,0,0,0,0,,../secret.csv,\n",
+		"absolute.csv": compositionHeader + ",include,,0,0,0,0,,/etc/secret.csv,\n",
+		"missing.csv":  compositionHeader + ",include,,0,0,0,0,,nowhere.csv,\n",
+		"two.csv": compositionHeader +
+			",extends,,0,0,0,0,,base.csv,\n" +
+			",extends,,0,0,0,0,,base.csv,\n",
+		"base.csv": compositionHeader + "title,text,Cell,10,30,80,8,Invoice,,\n",
+		// Included files must stay inside the directory of the template being loaded
+		"partials/escape.csv": compositionHeader + ",include,,0,0,0,0,,../base.csv,\n",
+		"nested.csv":          compositionHeader + ",include,,0,0,0,0,,partials/escape.csv,\n",
+	}
+	tests := []struct {
+		template string
+		err      string
+	}{
+		{"a.csv", "template cycle: a.csv -> b.csv -> a.csv"},
+		{"self.csv", "template cycle: self.csv -> self.csv"},
+		{"outside.csv", "../secret.csv is outside the template directory"},
+		{"absolute.csv", "/etc/secret.csv is outside the template directory"},
+		{"missing.csv", "error loading nowhere.csv"},
+		{"two.csv", "can extend only one base template"},
+	}
+
+	dir := t.TempDir()
+	writeTemplates(t, dir, files)
+	loaders := NewTemplateLoaders(storage.NewDirStore(dir))
+	for _, tt := range tests {
+		_, err := loaders.Load(tt.template)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want %q", tt.template, err, tt.err)
+		}
+	}
+
+	// partials/escape.csv may include ../base.csv only when it is included
+	// from the top directory
+	if _, err := loaders.Load("nested.csv"); err != nil {
+		t.Errorf("nested.csv: %v", err)
+	}
+	if _, err := loaders.Load("partials/escape.csv"); err == nil {
+		t.Error("partials/escape.csv included a template outside its directory")
+	}
+}
+
+func TestCachedTemplateFollowsIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{
+		"header.csv":  compositionHeader + "logo,text,Cell,0,0,80,8,Acme Ltd,,\n",
+		"invoice.csv": compositionHeader + ",include,,10,5,0,0,,header.csv,\n",
+	})
+	loaders := NewTemplateLoaders(storage.NewDirStore(dir))
+
+	load := func() string {
+		t.Helper()
+		elements, err := loaders.Load("invoice.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(texts(elements), "|")
+	}
+
+	if got := load(); got != "Acme Ltd" {
+		t.Fatalf("texts = %q, want Acme Ltd", got)
+	}
+	// Changing only the included file invalidates the cached template
+	writeTemplates(t, dir, map[string]string{"header.csv": compositionHeader + "logo,text,Cell,0,0,80,8,Acme Industries,,\n"})
+	if got := load(); got != "Acme Industries" {
+		t.Errorf("texts = %q after the include changed, want Acme Industries", got)
+	}
+}
+
+func TestValidateFileChecksComposition(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{
+		"invoice.csv": compositionHeader + ",include,,0,0,0,0,,header.csv,\n" +
+			",include,,0,0,0,0,,notes.txt,\n",
+		"header.csv": compositionHeader + ",include,,0,0,0,0,,invoice.csv,\n",
+	})
+
+	diagnostics, err := newTestValidator("").ValidateFile(storage.NewDirStore(dir), "invoice.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDiagnostics(t, "composition", diagnostics, []models.Diagnostic{
+		templateError(0, "", "template cycle: invoice.csv -> header.csv -> invoice.csv"),
+		templateError(3, "src", `"notes.txt" is not a CSV, JSON or YAML template`),
+	})
+}
@@ -0,0 +1,156 @@
+package parsers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"pdf-gen-simple/internal/cache"
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/storage"
+	"pdf-gen-simple/internal/utils"
+)
+
+// TemplateLoader parses template data into PDF elements. Includes and
+// extends are resolved by TemplateLoaders.
+type TemplateLoader interface {
+	Parse(reader io.Reader) ([]models.PDFElement, error)
+}
+
+// TemplateLoaders loads templates from a template store, choosing a
+// TemplateLoader by file extension
+type TemplateLoaders struct {
+	store      storage.TemplateStore
+	cache      *cache.TemplateCache
+	loaders    map[string]TemplateLoader
+	extensions []string
+}
+
+// NewTemplateLoaders creates a loader set for CSV, JSON and YAML templates in store
+func NewTemplateLoaders(store storage.TemplateStore) *TemplateLoaders {
+	loaders := &TemplateLoaders{
+		store:   store,
+		cache:   cache.GetTemplateCache(),
+		loaders: make(map[string]TemplateLoader),
+	}
+
+	yamlParser := NewYAMLParser()
+	loaders.Register(".csv", NewCSVParser())
+	loaders.Register(".json", NewJSONParser())
+	loaders.Register(".yaml", yamlParser)
+	loaders.Register(".yml", yamlParser)
+
+	return loaders
+}
+
+// Register adds or replaces the loader for a file extension such as ".csv"
+func (l *TemplateLoaders) Register(extension string, loader TemplateLoader) {
+	extension = strings.ToLower(extension)
+	if _, exists := l.loaders[extension]; !exists {
+		l.extensions = append(l.extensions, extension)
+	}
+	l.loaders[extension] = loader
+}
+
+// Store returns the store templates are loaded from
+func (l *TemplateLoaders) Store() storage.TemplateStore {
+	return l.store
+}
+
+// Load parses a template from the store with the loader registered for its
+// extension
+func (l *TemplateLoaders) Load(name string) ([]models.PDFElement, error) {
+	loader, ok := l.loaders[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported template format: %s", name)
+	}
+	return loadTemplate(l.store, name, loader, l.cache)
+}
+
+// Supports returns true if a loader is registered for the file's extension
+func (l *TemplateLoaders) Supports(name string) bool {
+	_, ok := l.loaders[strings.ToLower(path.Ext(name))]
+	return ok
+}
+
+// CacheStats returns statistics about the cached templates of the store
+func (l *TemplateLoaders) CacheStats() map[string]interface{} {
+	return l.cache.StoreStats(l.store.Name())
+}
+
+// ClearCache removes the cached templates of the store. Other stores, such
+// as other tenants', keep theirs.
+func (l *TemplateLoaders) ClearCache() {
+	l.cache.ClearStore(l.store.Name())
+}
+
+// Extensions returns the supported extensions in registration order
+func (l *TemplateLoaders) Extensions() []string {
+	return append([]string(nil), l.extensions...)
+}
+
+// loadTemplate parses a template from a store and resolves the templates it
+// includes or extends. Parsed templates are cached by content version.
+func loadTemplate(store storage.TemplateStore, name string, loader TemplateLoader, tc *cache.TemplateCache) ([]models.PDFElement, error) {
+	info, err := store.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening template %s: %w", name, err)
+	}
+
+	// Check cache first
+	if elements, found := tc.Get(store.Name(), name, info.Version, storeVersion(store)); found {
+		utils.LogDebug("Template loaded from cache: %s", name)
+		return elements, nil
+	}
+
+	utils.LogInfo("Parsing template: %s", name)
+
+	data, info, err := store.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening template %s: %w", name, err)
+	}
+	elements, err := loader.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	// Resolve included and extended templates
+	elements, dependencies, err := resolveComposition(store, name, elements)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve template %s: %w", name, err)
+	}
+
+	// Compile showIf and hideIf once, and cache them with the parsed elements
+	for i := range elements {
+		elements[i].CompileConditions()
+	}
+	tc.Set(store.Name(), name, info.Version, elements, dependencies)
+
+	utils.LogInfo("Successfully parsed %d elements from %s", len(elements), name)
+	return elements, nil
+}
+
+// loadLocalTemplate parses a template file outside any configured store
+func loadLocalTemplate(filePath string, loader TemplateLoader, tc *cache.TemplateCache) ([]models.PDFElement, error) {
+	store := storage.NewDirStore(filepath.Dir(filePath))
+	return loadTemplate(store, filepath.Base(filePath), loader, tc)
+}
+
+// storeVersion reports the current versions of files in a store for the
+// template cache
+func storeVersion(store storage.TemplateStore) cache.VersionFunc {
+	return func(name string) (string, error) {
+		info, err := store.Stat(name)
+		return info.Version, err
+	}
+}
+
+// isNotExist reports whether err is a missing file in a template store
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,43 @@
+package parsers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pdf-gen-simple/internal/storage"
+)
+
+func TestLoadCompilesConditionsBeforeCaching(t *testing.T) {
+	dir := t.TempDir()
+	template := "type,method,x,y,width,height,text,showIf,hideIf\n" +
+		"text,Cell,10,10,50,6,Paid,paid,\n" +
+		"text,Cell,10,20,50,6,Due,,paid\n"
+	if err := os.WriteFile(filepath.Join(dir, "invoice.csv"), []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaders := NewTemplateLoaders(storage.NewDirStore(dir))
+
+	first, err := loaders.Load("invoice.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range first {
+		if !first[i].HasCompiledConditions() {
+			t.Errorf("element %d: conditions weren't compiled", i+1)
+		}
+	}
+
+	// The cached template carries the same compiled programs
+	cached, err := loaders.Load("invoice.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range first {
+		a, _ := first[i].Conditions()
+		b, _ := cached[i].Conditions()
+		if a != b {
+			t.Errorf("element %d: conditions compiled again for the cached template", i+1)
+		}
+	}
+}
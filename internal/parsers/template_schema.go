@@ -0,0 +1,254 @@
+package parsers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/storage"
+	"pdf-gen-simple/internal/utils"
+)
+
+// schemaExtensions are the schema file extensions, in lookup order
+var schemaExtensions = []string{".schema.json", ".schema.yaml", ".schema.yml"}
+
+// LoadTemplateSchema infers the schema of a template from its elements and
+// merges the variables declared in the template's schema file, if the store
+// has one
+func LoadTemplateSchema(store storage.TemplateStore, name string, elements []models.PDFElement) (models.TemplateSchema, error) {
+	schema := InferSchema(elements)
+
+	data, schemaName, err := readSchemaFile(store, name)
+	if err != nil || schemaName == "" {
+		return schema, err
+	}
+
+	declared, err := parseSchemaFile(schemaName, data)
+	if err != nil {
+		return schema, err
+	}
+	schema.Merge(declared.Variables)
+	return schema, nil
+}
+
+// readSchemaFile reads the schema file declared next to a template, such as
+// invoice.schema.json for invoice.csv. The name is "" if there is none.
+func readSchemaFile(store storage.TemplateStore, name string) ([]byte, string, error) {
+	base := strings.TrimSuffix(name, path.Ext(name))
+	for _, extension := range schemaExtensions {
+		data, _, err := store.ReadFile(base + extension)
+		if isNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error opening schema file: %w", err)
+		}
+		return data, base + extension, nil
+	}
+	return nil, "", nil
+}
+
+// parseSchemaFile decodes a JSON or YAML schema file
+func parseSchemaFile(schemaName string, data []byte) (models.TemplateSchema, error) {
+	var schema models.TemplateSchema
+
+	if !strings.HasSuffix(schemaName, ".json") {
+		var err error
+		if data, err = yamlToJSON(bytes.NewReader(data)); err != nil {
+			return schema, fmt.Errorf("error reading schema file: %w", err)
+		}
+	}
+
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return schema, fmt.Errorf("error decoding schema file %s: %w", schemaName, err)
+	}
+	if err := schema.Validate(); err != nil {
+		return schema, fmt.Errorf("invalid schema file %s: %w", schemaName, err)
+	}
+	return schema, nil
+}
+
+// InferSchema builds a schema from the variables the elements reference.
+// Inferred variables are required strings, or arrays for loops and tables.
+// Placeholders with a default filter are optional, and those formatted with
+// the number, currency or words filters are numbers. Computed fields aren't
+// part of the request, so they are left out.
+func InferSchema(elements []models.PDFElement) models.TemplateSchema {
+	builder := &schemaBuilder{index: make(map[string]int)}
+
+	computed := make(map[string]bool)
+	for _, element := range elements {
+		if element.Type == models.ElementTypeComputed {
+			name, _ := element.Computation()
+			computed[name] = true
+		}
+	}
+	builder.skip = computed
+
+	for _, element := range elements {
+		texts := []string{element.Text, element.QRContent, element.BarcodeContent}
+
+		switch {
+		case element.Type == models.ElementTypeComputed:
+			continue
+
+		case element.IsLoopElement():
+			arrays, field := element.LoopPath()
+			if field != "" {
+				builder.addField(arrays, field, true)
+			}
+			// In nested loops a placeholder may refer to an outer item instead
+			nested := len(arrays) > 1
+			for _, placeholder := range placeholders(texts...) {
+				if placeholder.Path == element.LoopField {
+					continue
+				}
+				field := strings.TrimPrefix(placeholder.Path, arrays[0]+".")
+				builder.addField(arrays, field, !nested && isRequired(placeholder))
+			}
+			builder.addArray(arrays)
+
+		case element.Type == models.ElementTypeTable:
+			arrays := []string{element.VariableName}
+			for _, column := range element.Columns {
+				for _, placeholder := range utils.Placeholders("{{" + column.Field + "}}") {
+					builder.addField(arrays, placeholder.Path, isRequired(placeholder))
+				}
+			}
+			builder.addArray(arrays)
+
+		default:
+			for _, placeholder := range placeholders(texts...) {
+				builder.addScalar(placeholder.Path, isRequired(placeholder), placeholderType(placeholder))
+			}
+			if element.VariableName != "" && usesVariableValue(element) {
+				builder.addScalar(element.VariableName, true, models.VariableTypeString)
+			}
+		}
+	}
+
+	return models.TemplateSchema{Variables: builder.variables}
+}
+
+// usesVariableValue returns true if the element draws the value of its
+// variableName directly rather than through a placeholder
+func usesVariableValue(element models.PDFElement) bool {
+	switch element.Type {
+	case models.ElementTypeImage:
+		return element.Style.ImageSrc == ""
+	case models.ElementTypeQR:
+		return element.QRContent == ""
+	case models.ElementTypeBarcode:
+		return element.BarcodeContent == ""
+	default:
+		return false
+	}
+}
+
+// placeholders returns the placeholders used in texts, except page numbers
+func placeholders(texts ...string) []utils.Placeholder {
+	var found []utils.Placeholder
+	for _, text := range texts {
+		for _, placeholder := range utils.Placeholders(text) {
+			if placeholder.Path == models.PageNumberVariable || placeholder.Path == models.TotalPagesVariable {
+				continue
+			}
+			found = append(found, placeholder)
+		}
+	}
+	return found
+}
+
+// isRequired returns false for placeholders that supply their own default
+func isRequired(placeholder utils.Placeholder) bool {
+	return !placeholder.HasFilter("default")
+}
+
+// placeholderType infers a variable's type from the filters applied to it
+func placeholderType(placeholder utils.Placeholder) models.VariableType {
+	if placeholder.HasFilter("number") || placeholder.HasFilter("currency") || placeholder.HasFilter("words") {
+		return models.VariableTypeNumber
+	}
+	return models.VariableTypeString
+}
+
+// schemaBuilder collects variables in the order they are first referenced
+type schemaBuilder struct {
+	variables []models.TemplateVariable
+	index     map[string]int
+	// skip holds the names of computed fields
+	skip map[string]bool
+}
+
+// skipped returns true if path refers to a computed field or a value inside one
+func (b *schemaBuilder) skipped(path string) bool {
+	root := path
+	if i := strings.IndexAny(path, ".["); i >= 0 {
+		root = path[:i]
+	}
+	return b.skip[root]
+}
+
+// addScalar adds a variable. A variable referenced several times is required
+// if any reference requires it.
+func (b *schemaBuilder) addScalar(name string, required bool, variableType models.VariableType) {
+	if b.skipped(name) {
+		return
+	}
+	if i, ok := b.index[name]; ok {
+		b.variables[i].Required = b.variables[i].Required || required
+		return
+	}
+	b.index[name] = len(b.variables)
+	b.variables = append(b.variables, models.TemplateVariable{
+		Name:     name,
+		Type:     variableType,
+		Required: required,
+	})
+}
+
+// addArray adds a required array variable, replacing a scalar of the same
+// name. Nested arrays, such as the lines of each order, are added as optional
+// array fields of the outer array's items.
+func (b *schemaBuilder) addArray(arrays []string) *models.TemplateVariable {
+	name := arrays[0]
+	i, ok := b.index[name]
+	if !ok {
+		i = len(b.variables)
+		b.index[name] = i
+		b.variables = append(b.variables, models.TemplateVariable{Name: name, Required: true})
+	}
+
+	variable := &b.variables[i]
+	variable.Type = models.VariableTypeArray
+	for _, inner := range arrays[1:] {
+		variable = itemField(variable, inner, false)
+		variable.Type = models.VariableTypeArray
+	}
+	return variable
+}
+
+// addField adds a string field to the items of an array variable
+func (b *schemaBuilder) addField(arrays []string, field string, required bool) {
+	variable := itemField(b.addArray(arrays), field, required)
+	variable.Required = variable.Required || required
+}
+
+// itemField returns the item field of an array variable, adding it as a
+// string if it doesn't exist
+func itemField(array *models.TemplateVariable, name string, required bool) *models.TemplateVariable {
+	for i := range array.Fields {
+		if array.Fields[i].Name == name {
+			return &array.Fields[i]
+		}
+	}
+	array.Fields = append(array.Fields, models.TemplateVariable{
+		Name:     name,
+		Type:     models.VariableTypeString,
+		Required: required,
+	})
+	return &array.Fields[len(array.Fields)-1]
+}
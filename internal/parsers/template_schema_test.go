@@ -0,0 +1,154 @@
+package parsers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/storage"
+)
+
+func TestInferSchema(t *testing.T) {
+	elements := []models.PDFElement{
+		{Type: models.ElementTypeText, Text: "Invoice {{invoiceNumber}} for {{customer.name}}"},
+		{Type: models.ElementTypeText, Text: "Page {{pageNumber}} of {{totalPages}}"},
+		{Type: models.ElementTypeQR, VariableName: "upiLink"},
+		// QR codes with content don't use their variable
+		{Type: models.ElementTypeQR, VariableName: "unused", QRContent: "{{invoiceNumber}}"},
+		{Type: models.ElementTypeText, LoopField: "items.description", Text: "{{items.description}} x {{items.qty}}"},
+		{
+			Type:         models.ElementTypeTable,
+			VariableName: "charges",
+			Columns:      []models.TableColumn{{Field: "name"}, {Field: "amount"}},
+		},
+	}
+
+	str := models.VariableTypeString
+	want := []models.TemplateVariable{
+		{Name: "invoiceNumber", Type: str, Required: true},
+		{Name: "customer.name", Type: str, Required: true},
+		{Name: "upiLink", Type: str, Required: true},
+		{Name: "items", Type: models.VariableTypeArray, Required: true, Fields: []models.TemplateVariable{
+			{Name: "description", Type: str, Required: true},
+			{Name: "qty", Type: str, Required: true},
+		}},
+		{Name: "charges", Type: models.VariableTypeArray, Required: true, Fields: []models.TemplateVariable{
+			{Name: "name", Type: str, Required: true},
+			{Name: "amount", Type: str, Required: true},
+		}},
+	}
+	if got := InferSchema(elements).Variables; !reflect.DeepEqual(got, want) {
+		t.Errorf("InferSchema = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestLoadTemplateSchema(t *testing.T) {
+	elements := []models.PDFElement{
+		{Type: models.ElementTypeText, Text: "{{invoiceNumber}} {{total}} {{notes}}"},
+	}
+	tests := []struct {
+		name   string
+		files  map[string]string
+		want   []models.TemplateVariable
+		errMsg string
+	}{
+		{
+			"inferred only",
+			nil,
+			[]models.TemplateVariable{
+				{Name: "invoiceNumber", Type: models.VariableTypeString, Required: true},
+				{Name: "total", Type: models.VariableTypeString, Required: true},
+				{Name: "notes", Type: models.VariableTypeString, Required: true},
+			},
+			"",
+		},
+		{
+			"declared in YAML",
+			map[string]string{"invoice.schema.yaml": "variables:\n" +
+				"  - {name: total, type: number}\n" +
+				"  - {name: notes, required: false}\n" +
+				"  - {name: dueDate, type: date, format: 02/01/2006}\n"},
+			[]models.TemplateVariable{
+				{Name: "invoiceNumber", Type: models.VariableTypeString, Required: true},
+				{Name: "total", Type: models.VariableTypeNumber, Required: true},
+				{Name: "notes", Type: models.VariableTypeString},
+				{Name: "dueDate", Type: models.VariableTypeDate, Required: true, Format: "02/01/2006"},
+			},
+			"",
+		},
+		{
+			// The JSON file is used before the YAML one
+			"declared in JSON",
+			map[string]string{
+				"invoice.schema.json": `{"variables": [{"name": "notes", "required": false}]}`,
+				"invoice.schema.yml":  "variables: [{name: total, type: number}]",
+			},
+			[]models.TemplateVariable{
+				{Name: "invoiceNumber", Type: models.VariableTypeString, Required: true},
+				{Name: "total", Type: models.VariableTypeString, Required: true},
+				{Name: "notes", Type: models.VariableTypeString},
+			},
+			"",
+		},
+		{"unknown type", map[string]string{"invoice.schema.json": `{"variables": [{"name": "total", "type": "money"}]}`}, nil, "invalid schema file"},
+		{"invalid JSON", map[string]string{"invoice.schema.json": `{"variables": [`}, nil, "error decoding schema file"},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for name, content := range tt.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		schema, err := LoadTemplateSchema(storage.NewDirStore(dir), "invoice.csv", elements)
+		if tt.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(schema.Variables, tt.want) {
+			t.Errorf("%s: variables = %+v\nwant %+v", tt.name, schema.Variables, tt.want)
+		}
+	}
+}
+
+func TestInferSchemaFromFilters(t *testing.T) {
+	elements := []models.PDFElement{
+		{Type: models.ElementTypeText, Text: `{{total|currency:INR}} {{notes|default:"N/A"}} {{qty|number:0}} {{name|upper}}`},
+		// A reference without a default makes the variable required
+		{Type: models.ElementTypeText, Text: "{{notes}}"},
+		{
+			Type:         models.ElementTypeTable,
+			VariableName: "charges",
+			Columns:      []models.TableColumn{{Field: "description|upper"}, {Field: `hsn|default:"-"`}},
+		},
+	}
+
+	str, number := models.VariableTypeString, models.VariableTypeNumber
+	want := []models.TemplateVariable{
+		{Name: "total", Type: number, Required: true},
+		{Name: "notes", Type: str, Required: true},
+		{Name: "qty", Type: number, Required: true},
+		{Name: "name", Type: str, Required: true},
+		{Name: "charges", Type: models.VariableTypeArray, Required: true, Fields: []models.TemplateVariable{
+			{Name: "description", Type: str, Required: true},
+			{Name: "hsn", Type: str},
+		}},
+	}
+	if got := InferSchema(elements).Variables; !reflect.DeepEqual(got, want) {
+		t.Errorf("InferSchema = %+v\nwant %+v", got, want)
+	}
+	if schema := InferSchema(elements[:1]); schema.Variables[1].Required {
+		t.Errorf("notes = %+v, want it optional with a default filter", schema.Variables[1])
+	}
+}
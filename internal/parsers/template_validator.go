@@ -0,0 +1,642 @@
+package parsers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pdf-gen-simple/internal/expr"
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/storage"
+	"pdf-gen-simple/internal/utils"
+)
+
+// overlapTolerance is how far (in mm) two elements may touch before they are
+// reported as overlapping
+const overlapTolerance = 0.5
+
+// knownColumns lists every CSV column the parser reads
+var knownColumns = []string{
+	"id", "type", "method", "x", "y", "width", "height", "text", "variableName",
+	"font", "fontSize", "fontStyle", "align", "border", "colorR", "colorG", "colorB",
+	"background", "bgColorR", "bgColorG", "bgColorB", "rotateDegree", "rotateType",
+	"imageSrc", "qrContent", "barcodeFormat", "barcodeContent", "loopField",
+	"columns", "tableHeader", "zebraColorR", "zebraColorG", "zebraColorB",
+	"headerFor", "continueY", "region", "showIf", "hideIf", "src",
+	"page", "pageSize", "orientation", "unit",
+	"marginTop", "marginBottom", "marginLeft", "marginRight",
+	"continuous", "monochrome",
+}
+
+// floatColumns and intColumns list the numeric CSV columns
+var (
+	floatColumns = []string{
+		"x", "width", "height", "fontSize", "continueY",
+		"marginTop", "marginBottom", "marginLeft", "marginRight",
+	}
+	intColumns = []string{
+		"colorR", "colorG", "colorB", "bgColorR", "bgColorG", "bgColorB",
+		"zebraColorR", "zebraColorG", "zebraColorB", "rotateDegree", "page",
+	}
+)
+
+// coreFonts are the fonts built into fpdf
+var coreFonts = map[string]bool{
+	"arial": true, "courier": true, "helvetica": true,
+	"times": true, "symbol": true, "zapfdingbats": true,
+}
+
+// ValidationOptions controls the checks made by the template validator
+type ValidationOptions struct {
+	// PageWidth and PageHeight are the default page size in millimetres
+	PageWidth  float64
+	PageHeight float64
+	FontDir    string
+	// ImageDir, if set, is the directory image paths are resolved in
+	ImageDir string
+}
+
+// DefaultValidationOptions returns options for an A4 portrait page
+func DefaultValidationOptions() ValidationOptions {
+	return ValidationOptions{
+		PageWidth:  210,
+		PageHeight: 297,
+		FontDir:    "./fonts",
+	}
+}
+
+// TemplateValidator checks templates for problems without rendering them
+type TemplateValidator struct {
+	options ValidationOptions
+	csv     *CSVParser
+}
+
+// NewTemplateValidator creates a new template validator
+func NewTemplateValidator(options ValidationOptions) *TemplateValidator {
+	defaults := DefaultValidationOptions()
+	if options.PageWidth <= 0 || options.PageHeight <= 0 {
+		options.PageWidth = defaults.PageWidth
+		options.PageHeight = defaults.PageHeight
+	}
+	if options.FontDir == "" {
+		options.FontDir = defaults.FontDir
+	}
+
+	return &TemplateValidator{
+		options: options,
+		csv:     &CSVParser{},
+	}
+}
+
+// ValidateTemplate validates a local template file using the default options
+func ValidateTemplate(filePath string) ([]models.Diagnostic, error) {
+	store := storage.NewDirStore(filepath.Dir(filePath))
+	return NewTemplateValidator(DefaultValidationOptions()).ValidateFile(store, filepath.Base(filePath))
+}
+
+// ValidateFile validates a template in a store, choosing the format by
+// extension. Included and extended templates are resolved to report missing
+// files and cycles.
+func (v *TemplateValidator) ValidateFile(store storage.TemplateStore, name string) ([]models.Diagnostic, error) {
+	data, _, err := store.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening template file: %w", err)
+	}
+
+	diagnostics, err := v.Validate(bytes.NewReader(data), path.Ext(name))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse errors are already reported, so only composition errors are added
+	if elements, err := parseTemplateData(name, data); err == nil {
+		if _, _, err := resolveComposition(store, name, elements); err != nil {
+			diagnostics = append([]models.Diagnostic{templateError(0, "", err.Error())}, diagnostics...)
+		}
+	}
+	return diagnostics, nil
+}
+
+// Validate validates template data in the given format (csv, json, yaml or yml)
+func (v *TemplateValidator) Validate(reader io.Reader, format string) ([]models.Diagnostic, error) {
+	var diagnostics []models.Diagnostic
+
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "", "csv":
+		diagnostics = v.validateCSV(reader)
+	case "json":
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("error reading template: %w", err)
+		}
+		diagnostics = v.validateStructured(data)
+	case "yaml", "yml":
+		data, err := yamlToJSON(reader)
+		if err != nil {
+			diagnostics = append(diagnostics, templateError(0, "", err.Error()))
+			break
+		}
+		diagnostics = v.validateStructured(data)
+	default:
+		return nil, fmt.Errorf("unsupported template format: %s", format)
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Row < diagnostics[j].Row
+	})
+	return diagnostics, nil
+}
+
+// rowElement is an element together with the row it was defined on
+type rowElement struct {
+	row     int
+	element models.PDFElement
+}
+
+// validateCSV checks the columns and values of a CSV template
+func (v *TemplateValidator) validateCSV(reader io.Reader) []models.Diagnostic {
+	var diagnostics []models.Diagnostic
+
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	csvReader.FieldsPerRecord = -1
+
+	headers, err := csvReader.Read()
+	if err == io.EOF {
+		return []models.Diagnostic{templateError(0, "", "template is empty")}
+	}
+	if err != nil {
+		return []models.Diagnostic{templateError(csvErrorLine(err, 1), "", err.Error())}
+	}
+	headers = append([]string(nil), headers...)
+	diagnostics = append(diagnostics, checkHeaders(headers)...)
+
+	var elements, placed []rowElement
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			diagnostics = append(diagnostics, templateError(csvErrorLine(err, 0), "", err.Error()))
+			if errors.Is(err, csv.ErrQuote) || errors.Is(err, csv.ErrBareQuote) {
+				break
+			}
+			continue
+		}
+
+		row, _ := csvReader.FieldPos(0)
+		if isBlankRecord(record) {
+			continue
+		}
+		if len(record) != len(headers) {
+			diagnostics = append(diagnostics, templateError(row, "",
+				fmt.Sprintf("expected %d columns, got %d; the row is skipped", len(headers), len(record))))
+			continue
+		}
+
+		data := make(map[string]string, len(headers))
+		for i, header := range headers {
+			data[header] = record[i]
+		}
+		rowDiagnostics := checkCSVValues(row, data)
+		diagnostics = append(diagnostics, rowDiagnostics...)
+
+		element, err := v.csv.createElementFromRow(headers, record, row)
+		if err != nil {
+			diagnostics = append(diagnostics, templateError(row, "", err.Error()))
+			continue
+		}
+		if err := element.Validate(); err != nil {
+			diagnostics = append(diagnostics, templateError(row, "",
+				fmt.Sprintf("%v; the row is skipped", err)))
+			continue
+		}
+
+		diagnostics = append(diagnostics, v.checkElement(row, *element)...)
+		placed = append(placed, rowElement{row: row, element: *element})
+		if !models.HasErrors(rowDiagnostics) {
+			// Unparseable values fall back to zero, so only check overlaps for clean rows
+			elements = append(elements, rowElement{row: row, element: *element})
+		}
+	}
+
+	diagnostics = append(diagnostics, v.checkBounds(placed)...)
+	return append(diagnostics, checkOverlaps(elements)...)
+}
+
+// checkHeaders reports unknown and duplicate CSV columns
+func checkHeaders(headers []string) []models.Diagnostic {
+	var diagnostics []models.Diagnostic
+
+	known := make(map[string]bool, len(knownColumns))
+	folded := make(map[string]string, len(knownColumns))
+	for _, column := range knownColumns {
+		known[column] = true
+		folded[strings.ToLower(column)] = column
+	}
+
+	seen := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		if seen[header] {
+			diagnostics = append(diagnostics, templateError(1, header, "duplicate column"))
+		}
+		seen[header] = true
+
+		if known[header] {
+			continue
+		}
+		message := "unknown column; its values are ignored"
+		if strings.HasPrefix(header, "\ufeff") {
+			message = "column name starts with a byte order mark; save the file as UTF-8 without BOM"
+		} else if suggestion, ok := folded[strings.ToLower(header)]; ok {
+			message = fmt.Sprintf("unknown column; did you mean %q?", suggestion)
+		}
+		diagnostics = append(diagnostics, templateWarning(1, header, message))
+	}
+
+	return diagnostics
+}
+
+// checkCSVValues reports CSV values that can't be parsed
+func checkCSVValues(row int, data map[string]string) []models.Diagnostic {
+	var diagnostics []models.Diagnostic
+
+	for _, column := range floatColumns {
+		if value := data[column]; value != "" {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				diagnostics = append(diagnostics, templateError(row, column,
+					fmt.Sprintf("%q is not a number", value)))
+			}
+		}
+	}
+
+	if value := data["y"]; value != "" {
+		if _, _, ok := utils.ParseAnchor(value); !ok {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				diagnostics = append(diagnostics, templateError(row, "y",
+					fmt.Sprintf("%q is not a number or an anchor like \"after:items+4\"", value)))
+			}
+		}
+	}
+
+	for _, column := range intColumns {
+		if value := data[column]; value != "" {
+			if _, err := strconv.Atoi(value); err != nil {
+				diagnostics = append(diagnostics, templateError(row, column,
+					fmt.Sprintf("%q is not a whole number", value)))
+			}
+		}
+	}
+
+	if value := data["type"]; value != "" {
+		if _, ok := lookupElementType(value); !ok {
+			diagnostics = append(diagnostics, templateError(row, "type",
+				fmt.Sprintf("unknown element type %q", value)))
+		}
+	}
+	if value := data["method"]; value != "" {
+		if _, ok := lookupMethod(value); !ok {
+			diagnostics = append(diagnostics, templateWarning(row, "method",
+				fmt.Sprintf("unknown method %q", value)))
+		}
+	}
+
+	if value := data["columns"]; value != "" {
+		for _, part := range strings.Split(value, ",") {
+			columnParts := strings.Split(strings.TrimSpace(part), ":")
+			if len(columnParts) < 2 {
+				diagnostics = append(diagnostics, templateError(row, "columns",
+					fmt.Sprintf("column %q must be written as field:width[:align[:style[:header]]]", part)))
+				continue
+			}
+			if _, err := strconv.ParseFloat(strings.TrimSpace(columnParts[1]), 64); err != nil {
+				diagnostics = append(diagnostics, templateError(row, "columns",
+					fmt.Sprintf("column %q has a width that is not a number", columnParts[0])))
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// validateStructured checks a JSON template document
+func (v *TemplateValidator) validateStructured(data []byte) []models.Diagnostic {
+	document, err := decodeTemplateDocument(data)
+	if err != nil {
+		column := ""
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &typeError) {
+			column = typeError.Field
+		}
+		return []models.Diagnostic{templateError(0, column, err.Error())}
+	}
+
+	var diagnostics []models.Diagnostic
+	for i, field := range document.Computed {
+		element := field.Element()
+		if err := element.Validate(); err != nil {
+			diagnostics = append(diagnostics, templateError(i+1, "computed",
+				fmt.Sprintf("%v; the field is skipped", err)))
+			continue
+		}
+		diagnostics = append(diagnostics, checkComputed(i+1, "computed", element)...)
+	}
+
+	var elements []rowElement
+	for i, element := range document.allElements() {
+		row := i + 1
+
+		if element.Type != "" {
+			if _, ok := lookupElementType(string(element.Type)); !ok {
+				diagnostics = append(diagnostics, templateError(row, "type",
+					fmt.Sprintf("unknown element type %q", element.Type)))
+			}
+		}
+		if element.Method != "" {
+			if _, ok := lookupMethod(element.Method); !ok {
+				diagnostics = append(diagnostics, templateWarning(row, "method",
+					fmt.Sprintf("unknown method %q", element.Method)))
+			}
+		}
+
+		normalizeElement(&element)
+		if err := element.Validate(); err != nil {
+			diagnostics = append(diagnostics, templateError(row, "",
+				fmt.Sprintf("%v; the element is skipped", err)))
+			continue
+		}
+
+		diagnostics = append(diagnostics, v.checkElement(row, element)...)
+		elements = append(elements, rowElement{row: row, element: element})
+	}
+
+	diagnostics = append(diagnostics, v.checkBounds(elements)...)
+	return append(diagnostics, checkOverlaps(elements)...)
+}
+
+// checkElement reports layout, font and image problems with a parsed element
+func (v *TemplateValidator) checkElement(row int, element models.PDFElement) []models.Diagnostic {
+	if element.Type == models.ElementTypeComputed {
+		return checkComputed(row, "text", element)
+	}
+	if element.IsComposition() {
+		return checkComposition(row, element)
+	}
+
+	if element.IsPageSetup() {
+		return nil
+	}
+
+	var diagnostics []models.Diagnostic
+
+	if usesFont(element) {
+		diagnostics = append(diagnostics, v.checkFont(row, element.Style.Font)...)
+	}
+
+	if source := element.Style.ImageSrc; source != "" && !strings.Contains(source, "{{") {
+		if path, err := utils.ResolveIn(v.options.ImageDir, source); err != nil {
+			diagnostics = append(diagnostics, templateError(row, "imageSrc",
+				fmt.Sprintf("image %q is outside the image directory", source)))
+		} else if _, err := os.Stat(path); err != nil {
+			diagnostics = append(diagnostics, templateError(row, "imageSrc",
+				fmt.Sprintf("image %q not found", source)))
+		}
+	}
+
+	diagnostics = append(diagnostics, checkFilters(row, "text", element.Text)...)
+	diagnostics = append(diagnostics, checkFilters(row, "qrContent", element.QRContent)...)
+	diagnostics = append(diagnostics, checkFilters(row, "barcodeContent", element.BarcodeContent)...)
+	for _, column := range element.Columns {
+		diagnostics = append(diagnostics, checkFilters(row, "columns", "{{"+column.Field+"}}")...)
+	}
+	diagnostics = append(diagnostics, checkCondition(row, "showIf", element.ShowIf)...)
+	diagnostics = append(diagnostics, checkCondition(row, "hideIf", element.HideIf)...)
+
+	return diagnostics
+}
+
+// pointsPerMillimetre converts the default page size to points
+const pointsPerMillimetre = 72 / 25.4
+
+// checkBounds reports elements that extend past the edges of their page,
+// using the size and unit set by the template's settings and page elements.
+// Continuous pages grow to fit, so only their width is checked.
+func (v *TemplateValidator) checkBounds(elements []rowElement) []models.Diagnostic {
+	var diagnostics []models.Diagnostic
+
+	var settings models.TemplateSettings
+	pages := make(map[int]models.PageSettings)
+	for _, candidate := range elements {
+		switch candidate.element.Type {
+		case models.ElementTypeSettings:
+			settings = settings.Merge(candidate.element.Settings)
+		case models.ElementTypePage:
+			pages[candidate.element.PageNumber()] = candidate.element.PageSetup
+		}
+	}
+
+	// Convert the default page size to the template's unit
+	points, ok := models.UnitPoints(settings.Unit)
+	if !ok {
+		points = pointsPerMillimetre
+	}
+	scale := 1 / points
+	defaultWidth, defaultHeight := settings.Page().Dimensions(
+		v.options.PageWidth*pointsPerMillimetre*scale, v.options.PageHeight*pointsPerMillimetre*scale, scale)
+
+	for _, candidate := range elements {
+		row, element := candidate.row, candidate.element
+		switch {
+		case element.IsPageSetup(), element.Type == models.ElementTypeComputed, element.IsComposition():
+			continue
+		}
+
+		width, height := pages[element.PageNumber()].Dimensions(defaultWidth, defaultHeight, scale)
+		if right := element.Position.X + element.Size.Width; element.Position.X < 0 || right > width {
+			diagnostics = append(diagnostics, templateWarning(row, "x",
+				fmt.Sprintf("element spans x %.1f to %.1f, outside the page width of %.1f",
+					element.Position.X, right, width)))
+		}
+		if !element.Position.IsAnchored() && !settings.Continuous {
+			if bottom := element.Position.Y + element.Size.Height; element.Position.Y < 0 || bottom > height {
+				diagnostics = append(diagnostics, templateWarning(row, "y",
+					fmt.Sprintf("element spans y %.1f to %.1f, outside the page height of %.1f",
+						element.Position.Y, bottom, height)))
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// checkFilters reports placeholders in text that can't be parsed or use
+// filters that aren't registered
+func checkFilters(row int, column, text string) []models.Diagnostic {
+	var diagnostics []models.Diagnostic
+	registry := utils.GetFilterRegistry()
+
+	for _, expression := range utils.PlaceholderExpressions(text) {
+		placeholder, err := utils.ParsePlaceholder(expression)
+		if err != nil {
+			diagnostics = append(diagnostics, templateError(row, column,
+				fmt.Sprintf("invalid placeholder {{%s}}: %v", expression, err)))
+			continue
+		}
+		for _, filter := range placeholder.Filters {
+			if _, ok := registry.Lookup(filter.Name); !ok {
+				diagnostics = append(diagnostics, templateError(row, column,
+					fmt.Sprintf("unknown filter %q in {{%s}}", filter.Name, expression)))
+			}
+		}
+	}
+	return diagnostics
+}
+
+// checkComposition reports include and extends elements that refer to files
+// the parser can't read. Whether the file exists is checked by ValidateFile.
+func checkComposition(row int, element models.PDFElement) []models.Diagnostic {
+	if element.Source == "" {
+		return nil
+	}
+	switch strings.ToLower(filepath.Ext(element.Source)) {
+	case ".csv", ".json", ".yaml", ".yml":
+		return nil
+	}
+	return []models.Diagnostic{templateError(row, "src",
+		fmt.Sprintf("%q is not a CSV, JSON or YAML template", element.Source))}
+}
+
+// checkComputed reports computed field expressions that don't compile
+func checkComputed(row int, column string, element models.PDFElement) []models.Diagnostic {
+	_, expression := element.Computation()
+	if _, err := expr.Compile(expression); err != nil {
+		return []models.Diagnostic{templateError(row, column, err.Error())}
+	}
+	return nil
+}
+
+// checkCondition reports a showIf or hideIf condition that doesn't compile
+func checkCondition(row int, column, condition string) []models.Diagnostic {
+	if condition == "" {
+		return nil
+	}
+	if _, err := expr.Compile(condition); err != nil {
+		return []models.Diagnostic{templateError(row, column, err.Error())}
+	}
+	return nil
+}
+
+// usesFont returns true if the element draws text
+func usesFont(element models.PDFElement) bool {
+	return element.Type == models.ElementTypeText || element.Type == models.ElementTypeTable
+}
+
+// checkFont reports fonts and styles the generator can't set
+func (v *TemplateValidator) checkFont(row int, font models.Font) []models.Diagnostic {
+	var diagnostics []models.Diagnostic
+
+	for _, letter := range strings.ToUpper(font.Style) {
+		if !strings.ContainsRune("BIUS", letter) {
+			diagnostics = append(diagnostics, templateError(row, "fontStyle",
+				fmt.Sprintf("unknown font style %q; use B, I, U or S", string(letter))))
+		}
+	}
+
+	family := strings.ToLower(font.Family)
+	switch {
+	case coreFonts[family]:
+	case family == "tahoma":
+		if strings.ContainsRune(strings.ToUpper(font.Style), 'I') {
+			diagnostics = append(diagnostics, templateError(row, "fontStyle",
+				"Tahoma has no italic style"))
+		}
+		if _, err := os.Stat(filepath.Join(v.options.FontDir, "tahoma.ttf")); err != nil {
+			diagnostics = append(diagnostics, templateWarning(row, "font",
+				fmt.Sprintf("Tahoma font file not found in %s", v.options.FontDir)))
+		}
+	default:
+		diagnostics = append(diagnostics, templateError(row, "font",
+			fmt.Sprintf("unknown font %q; use Tahoma or one of the core fonts", font.Family)))
+	}
+
+	return diagnostics
+}
+
+// checkOverlaps reports elements that cover each other. Boxes, anchored
+// elements, loop rows and conditional elements are skipped since they are
+// meant to be layered or their final position or visibility depends on the data.
+func checkOverlaps(elements []rowElement) []models.Diagnostic {
+	var diagnostics []models.Diagnostic
+
+	var candidates []rowElement
+	for _, candidate := range elements {
+		element := candidate.element
+		if element.Type == models.ElementTypeBox || element.IsPageSetup() || element.Position.IsAnchored() || element.LoopField != "" || element.IsConditional() {
+			continue
+		}
+		if element.Size.Width <= 0 || element.Size.Height <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	for i := 0; i < len(candidates); i++ {
+		for j := i + 1; j < len(candidates); j++ {
+			a, b := candidates[i], candidates[j]
+			if a.element.Region != b.element.Region || a.element.PageNumber() != b.element.PageNumber() || !overlaps(a.element, b.element) {
+				continue
+			}
+			diagnostics = append(diagnostics, templateWarning(b.row, "",
+				fmt.Sprintf("element overlaps the element on row %d", a.row)))
+		}
+	}
+
+	return diagnostics
+}
+
+// overlaps returns true if the two elements' rectangles intersect
+func overlaps(a, b models.PDFElement) bool {
+	return a.Position.X+a.Size.Width-overlapTolerance > b.Position.X &&
+		b.Position.X+b.Size.Width-overlapTolerance > a.Position.X &&
+		a.Position.Y+a.Size.Height-overlapTolerance > b.Position.Y &&
+		b.Position.Y+b.Size.Height-overlapTolerance > a.Position.Y
+}
+
+// isBlankRecord returns true if every field of a CSV record is empty
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// csvErrorLine returns the line of a CSV parse error, or fallback
+func csvErrorLine(err error, fallback int) int {
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return parseError.Line
+	}
+	return fallback
+}
+
+// templateError creates an error diagnostic
+func templateError(row int, column, message string) models.Diagnostic {
+	return models.Diagnostic{Row: row, Column: column, Severity: models.SeverityError, Message: message}
+}
+
+// templateWarning creates a warning diagnostic
+func templateWarning(row int, column, message string) models.Diagnostic {
+	return models.Diagnostic{Row: row, Column: column, Severity: models.SeverityWarning, Message: message}
+}
@@ -0,0 +1,210 @@
+package parsers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// newTestValidator creates a validator for an A4 page with the repository's fonts
+func newTestValidator(imageDir string) *TemplateValidator {
+	return NewTemplateValidator(ValidationOptions{FontDir: "../../fonts", ImageDir: imageDir})
+}
+
+// checkDiagnostics compares diagnostics with the wanted ones, matching
+// messages by substring
+func checkDiagnostics(t *testing.T, name string, got, want []models.Diagnostic) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d diagnostics, want %d:\n%v", name, len(got), len(want), got)
+		return
+	}
+	for i, d := range got {
+		w := want[i]
+		if d.Row != w.Row || d.Column != w.Column || d.Severity != w.Severity || !strings.Contains(d.Message, w.Message) {
+			t.Errorf("%s: diagnostic %d = %v, want %v", name, i+1, d, w)
+		}
+	}
+}
+
+func TestValidateCSV(t *testing.T) {
+	const header = "type,method,x,y,width,height,text,font,fontStyle,imageSrc\n"
+	tests := []struct {
+		name     string
+		template string
+		want     []models.Diagnostic
+	}{
+		{
+			"clean template",
+			header +
+				"text,Cell,10,10,80,8,Invoice,Tahoma,B,\n" +
+				"text,Cell,10,20,80,8,Date,Helvetica,,\n" +
+				"image,Image,150,10,40,20,,,,logo.png\n",
+			nil,
+		},
+		{
+			"unknown element type and method",
+			header + "txt,Celll,10,10,80,8,Invoice,,,\n",
+			[]models.Diagnostic{
+				templateError(2, "type", `unknown element type "txt"`),
+				templateWarning(2, "method", `unknown method "Celll"`),
+			},
+		},
+		{
+			"unparseable numbers",
+			header + "text,Cell,ten,10,80,8,Invoice,,,\n" +
+				"text,Cell,10,below:items,80,8,Invoice,,,\n",
+			[]models.Diagnostic{
+				templateError(2, "x", `"ten" is not a number`),
+				templateError(3, "y", `"below:items" is not a number or an anchor`),
+			},
+		},
+		{
+			"off the page",
+			header + "text,Cell,150,10,80,8,Invoice,,,\n" +
+				"text,Cell,10,290,80,8,Total,,,\n" +
+				// Anchored elements are only checked across the page
+				"text,Cell,10,after:previous,80,8,Notes,,,\n",
+			[]models.Diagnostic{
+				templateWarning(2, "x", "outside the page width of 210.0"),
+				templateWarning(3, "y", "outside the page height of 297.0"),
+			},
+		},
+		{
+			"overlaps",
+			header + "text,Cell,10,10,80,8,Invoice,,,\n" +
+				"text,Cell,50,12,80,8,Date,,,\n" +
+				// Touching within the tolerance and boxes aren't overlaps
+				"text,Cell,10,19.6,80,8,Total,,,\n" +
+				"box,Rect,0,0,210,297,,,,\n",
+			[]models.Diagnostic{
+				templateWarning(3, "", "overlaps the element on row 2"),
+			},
+		},
+		{
+			"fonts",
+			header + "text,Cell,10,10,80,8,Invoice,Comic Sans,,\n" +
+				"text,Cell,10,20,80,8,Date,Tahoma,I,\n" +
+				"text,Cell,10,30,80,8,Total,Helvetica,BX,\n",
+			[]models.Diagnostic{
+				templateError(2, "font", `unknown font "Comic Sans"`),
+				templateError(3, "fontStyle", "Tahoma has no italic style"),
+				templateError(4, "fontStyle", `unknown font style "X"`),
+			},
+		},
+		{
+			"images",
+			header + "image,Image,10,10,40,20,,,,missing.png\n" +
+				"image,Image,60,10,40,20,,,,../secret.png\n" +
+				// Images named by a placeholder are only known when rendering
+				"image,Image,110,10,40,20,,,,{{logo}}\n",
+			[]models.Diagnostic{
+				templateError(2, "imageSrc", `image "missing.png" not found`),
+				templateError(3, "imageSrc", "outside the image directory"),
+			},
+		},
+		{
+			"columns",
+			"type,method,x,y,width,height,color,variableName,columns\n" +
+				"table,Table,10,10,120,6,red,items,name:wide\n",
+			[]models.Diagnostic{
+				templateWarning(1, "color", "unknown column"),
+				templateError(2, "columns", `column "name" has a width that is not a number`),
+			},
+		},
+		{
+			"rows that are skipped",
+			header + "text,Cell,10,10,80,8,Invoice\n" +
+				"table,Table,10,20,80,8,,,,\n",
+			[]models.Diagnostic{
+				templateError(2, "", "expected 10 columns, got 7"),
+				templateError(3, "", "the row is skipped"),
+			},
+		},
+		{"empty template", "", []models.Diagnostic{templateError(0, "", "template is empty")}},
+	}
+
+	imageDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(imageDir, "logo.png"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	validator := newTestValidator(imageDir)
+	for _, tt := range tests {
+		diagnostics, err := validator.Validate(strings.NewReader(tt.template), "csv")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		checkDiagnostics(t, tt.name, diagnostics, tt.want)
+	}
+}
+
+func TestValidateStructured(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		want     []models.Diagnostic
+	}{
+		{
+			"JSON elements are numbered from 1",
+			"json",
+			`[{"type": "text", "position": {"x": 10, "y": 10}, "size": {"width": 80, "height": 8}, "text": "Invoice"},
+			  {"type": "txt", "position": {"x": 10, "y": 20}, "size": {"width": 80, "height": 8}, "text": "Date"},
+			  {"type": "text", "position": {"x": 150, "y": 30}, "size": {"width": 80, "height": 8}, "text": "Total"}]`,
+			[]models.Diagnostic{
+				templateError(2, "type", `unknown element type "txt"`),
+				templateWarning(3, "x", "outside the page width"),
+			},
+		},
+		{
+			"JSON type errors name the field",
+			"json",
+			`[{"type": "text", "size": {"width": "wide"}}]`,
+			[]models.Diagnostic{templateError(0, "0.size.width", "cannot unmarshal string")},
+		},
+		{
+			"YAML",
+			"yaml",
+			"elements:\n" +
+				"  - {type: text, position: {x: 10, y: 10}, size: {width: 80, height: 8}, text: Invoice}\n" +
+				"  - {type: text, position: {x: 20, y: 12}, size: {width: 80, height: 8}, text: Date}\n",
+			[]models.Diagnostic{templateWarning(2, "", "overlaps the element on row 1")},
+		},
+		{"invalid YAML", "yml", "elements: [", []models.Diagnostic{templateError(0, "", "")}},
+	}
+
+	validator := newTestValidator("")
+	for _, tt := range tests {
+		diagnostics, err := validator.Validate(strings.NewReader(tt.template), tt.format)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		checkDiagnostics(t, tt.name, diagnostics, tt.want)
+	}
+
+	if _, err := validator.Validate(strings.NewReader(""), "txt"); err == nil {
+		t.Error("a txt template was validated")
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	template := "type,method,x,y,width,height,text,variableName,columns\n" +
+		"text,Cell,10,10,80,8,{{total|currency:INR|upper}},,\n" +
+		"text,Cell,10,20,80,8,{{total|shout}},,\n" +
+		`text,Cell,10,30,80,8,"{{notes|default:""N/A}}",,` + "\n" +
+		"table,Table,10,40,120,6,,charges,amount|money:40\n"
+	diagnostics, err := newTestValidator("").Validate(strings.NewReader(template), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDiagnostics(t, "filters", diagnostics, []models.Diagnostic{
+		templateError(3, "text", `unknown filter "shout" in {{total|shout}}`),
+		templateError(4, "text", "invalid placeholder"),
+		templateError(5, "columns", `unknown filter "money" in {{amount|money}}`),
+	})
+}
@@ -0,0 +1,62 @@
+package parsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"pdf-gen-simple/internal/cache"
+	"pdf-gen-simple/internal/models"
+)
+
+// YAMLParser handles parsing YAML templates. YAML templates use the same
+// field names as JSON templates.
+type YAMLParser struct {
+	cache *cache.TemplateCache
+}
+
+// NewYAMLParser creates a new YAML parser with caching
+func NewYAMLParser() *YAMLParser {
+	return &YAMLParser{
+		cache: cache.GetTemplateCache(),
+	}
+}
+
+// ParseYAML parses a local YAML template file and returns PDF elements
+func (p *YAMLParser) ParseYAML(filePath string) ([]models.PDFElement, error) {
+	return loadLocalTemplate(filePath, p, p.cache)
+}
+
+// ParseYAMLFromReader parses YAML template data from an io.Reader
+func (p *YAMLParser) ParseYAMLFromReader(reader io.Reader) ([]models.PDFElement, error) {
+	data, err := yamlToJSON(reader)
+	if err != nil {
+		return nil, err
+	}
+	return parseStructuredElements(data)
+}
+
+// Parse implements TemplateLoader
+func (p *YAMLParser) Parse(reader io.Reader) ([]models.PDFElement, error) {
+	return p.ParseYAMLFromReader(reader)
+}
+
+// yamlToJSON converts a YAML document to JSON so it can be decoded with the
+// models' JSON field names
+func yamlToJSON(reader io.Reader) ([]byte, error) {
+	var document interface{}
+	if err := yaml.NewDecoder(reader).Decode(&document); err != nil {
+		if err == io.EOF {
+			return []byte("[]"), nil
+		}
+		return nil, fmt.Errorf("error decoding YAML template: %w", err)
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("error converting YAML template: %w", err)
+	}
+	return data, nil
+}
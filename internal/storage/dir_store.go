@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DirStore keeps templates in a local directory
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates a store for the templates in dir
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+// Name implements TemplateStore
+func (s *DirStore) Name() string {
+	if abs, err := filepath.Abs(s.dir); err == nil {
+		return "dir:" + abs
+	}
+	return "dir:" + s.dir
+}
+
+// Dir returns the directory of the store
+func (s *DirStore) Dir() string {
+	return s.dir
+}
+
+// Stat implements TemplateStore. The version is a hash of the content, so
+// the file is read.
+func (s *DirStore) Stat(name string) (FileInfo, error) {
+	_, info, err := s.ReadFile(name)
+	return info, err
+}
+
+// ReadFile implements TemplateStore
+func (s *DirStore) ReadFile(name string) ([]byte, FileInfo, error) {
+	if err := checkName(name); err != nil {
+		return nil, FileInfo{}, err
+	}
+	path := s.path(name)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	if stat.IsDir() {
+		return nil, FileInfo{}, notExist(name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	return data, FileInfo{
+		Name:     name,
+		Size:     int64(len(data)),
+		Modified: stat.ModTime(),
+		Version:  ContentVersion(data),
+	}, nil
+}
+
+// List implements TemplateStore. Versions aren't filled in, to avoid reading
+// every file.
+func (s *DirStore) List() ([]FileInfo, error) {
+	var files []FileInfo
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileInfo{
+			Name:     filepath.ToSlash(rel),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// WriteFile implements TemplateStore. The file is replaced atomically, so
+// readers never see a partly written template.
+func (s *DirStore) WriteFile(name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	path := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return nil
+}
+
+// Remove implements TemplateStore
+func (s *DirStore) Remove(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path returns the local path of a file
+func (s *DirStore) path(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// FSStore serves read-only templates from an fs.FS, such as an embed.FS
+// compiled into the binary:
+//
+//	//go:embed assets
+//	var assets embed.FS
+//
+//	sub, _ := fs.Sub(assets, "assets")
+//	store := storage.NewFSStore(sub)
+type FSStore struct {
+	name string
+	fsys fs.FS
+}
+
+// NewFSStore creates a read-only store for the templates in fsys
+func NewFSStore(fsys fs.FS) *FSStore {
+	return &FSStore{name: nextStoreID("fs"), fsys: fsys}
+}
+
+// Name implements TemplateStore
+func (s *FSStore) Name() string {
+	return s.name
+}
+
+// Stat implements TemplateStore
+func (s *FSStore) Stat(name string) (FileInfo, error) {
+	_, info, err := s.ReadFile(name)
+	return info, err
+}
+
+// ReadFile implements TemplateStore
+func (s *FSStore) ReadFile(name string) ([]byte, FileInfo, error) {
+	if err := checkName(name); err != nil {
+		return nil, FileInfo{}, err
+	}
+	stat, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	if stat.IsDir() {
+		return nil, FileInfo{}, notExist(name)
+	}
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	return data, FileInfo{
+		Name:     name,
+		Size:     int64(len(data)),
+		Modified: stat.ModTime(),
+		Version:  ContentVersion(data),
+	}, nil
+}
+
+// List implements TemplateStore. Versions aren't filled in.
+func (s *FSStore) List() ([]FileInfo, error) {
+	var files []FileInfo
+	err := fs.WalkDir(s.fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, FileInfo{Name: path, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// WriteFile implements TemplateStore; embedded templates can't be changed
+func (s *FSStore) WriteFile(name string, data []byte) error {
+	return ErrReadOnly
+}
+
+// Remove implements TemplateStore; embedded templates can't be changed
+func (s *FSStore) Remove(name string) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible object store, such as AWS S3, MinIO
+// or Cloudflare R2
+type S3Config struct {
+	// Endpoint is the base URL of the service, such as
+	// https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Endpoint string
+	// Region signs the requests; it defaults to us-east-1
+	Region string
+	Bucket string
+	// Prefix is prepended to every object key, such as "templates/"
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// Client sends the requests; it defaults to a client with a 30 second timeout
+	Client *http.Client
+}
+
+// S3Store keeps templates as objects in an S3-compatible bucket. Objects are
+// addressed path-style (endpoint/bucket/key) and requests are signed with
+// AWS Signature Version 4.
+type S3Store struct {
+	name     string
+	config   S3Config
+	endpoint *url.URL
+}
+
+// NewS3Store creates a store for the objects under the config's prefix
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Prefix != "" && !strings.HasSuffix(config.Prefix, "/") {
+		config.Prefix += "/"
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	// Like "dir:/srv/templates", the name is the kind of store and where its
+	// files are: s3:host/bucket or s3:host/bucket/prefix
+	location := path.Join(endpoint.Host+endpoint.Path, config.Bucket, config.Prefix)
+	return &S3Store{name: "s3:" + location, config: config, endpoint: endpoint}, nil
+}
+
+// Name implements TemplateStore
+func (s *S3Store) Name() string {
+	return s.name
+}
+
+// Stat implements TemplateStore
+func (s *S3Store) Stat(name string) (FileInfo, error) {
+	if err := checkName(name); err != nil {
+		return FileInfo{}, err
+	}
+	resp, err := s.do(http.MethodHead, s.config.Prefix+name, nil, nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	resp.Body.Close()
+	if err := s.check(resp, name); err != nil {
+		return FileInfo{}, err
+	}
+	return objectInfo(name, resp), nil
+}
+
+// ReadFile implements TemplateStore
+func (s *S3Store) ReadFile(name string) ([]byte, FileInfo, error) {
+	if err := checkName(name); err != nil {
+		return nil, FileInfo{}, err
+	}
+	resp, err := s.do(http.MethodGet, s.config.Prefix+name, nil, nil)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	defer resp.Body.Close()
+	if err := s.check(resp, name); err != nil {
+		return nil, FileInfo{}, err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, FileInfo{}, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	info := objectInfo(name, resp)
+	info.Size = int64(len(data))
+	return data, info, nil
+}
+
+// List implements TemplateStore
+func (s *S3Store) List() ([]FileInfo, error) {
+	var files []FileInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if s.config.Prefix != "" {
+			query.Set("prefix", s.config.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = s.check(resp, "")
+		if err == nil {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list templates: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, s.config.Prefix)
+			if checkName(name) != nil {
+				continue
+			}
+			files = append(files, FileInfo{
+				Name:     name,
+				Size:     object.Size,
+				Modified: object.LastModified,
+				Version:  strings.Trim(object.ETag, `"`),
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// WriteFile implements TemplateStore
+func (s *S3Store) WriteFile(name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPut, s.config.Prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return s.check(resp, name)
+}
+
+// Remove implements TemplateStore
+func (s *S3Store) Remove(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodDelete, s.config.Prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return s.check(resp, name)
+}
+
+// listBucketResult is the response of ListObjectsV2
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// objectInfo describes an object from the headers of a HEAD or GET response
+func objectInfo(name string, resp *http.Response) FileInfo {
+	info := FileInfo{
+		Name:    name,
+		Size:    resp.ContentLength,
+		Version: strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.Modified = modified
+	}
+	return info
+}
+
+// check turns an error response into an error
+func (s *S3Store) check(resp *http.Response, name string) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound && name != "":
+		return notExist(name)
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+}
+
+// do sends a signed request for an object key, or for the bucket if key is ""
+func (s *S3Store) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	target := *s.endpoint
+	target.Path = s.endpoint.Path + "/" + s.config.Bucket
+	if key != "" {
+		target.Path += "/" + key
+	}
+	target.RawPath = s.endpoint.Path + "/" + uriEncode(s.config.Bucket, false)
+	if key != "" {
+		target.RawPath += "/" + uriEncode(key, false)
+	}
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+	}
+	signRequest(req, body, s.config.AccessKey, s.config.SecretKey, s.config.Region, time.Now())
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// signRequest signs a request with AWS Signature Version 4 for the s3
+// service. The host, the x-amz-* headers and any other headers already set
+// on the request are signed.
+func signRequest(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	const algorithm = "AWS4-HMAC-SHA256"
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonical, signedHeaders := canonicalRequest(req, payloadHash)
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{algorithm, amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalRequest returns the canonical form of a request that Signature
+// Version 4 signs, and the names of the headers it signs
+func canonicalRequest(req *http.Request, payloadHash string) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	return strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+// canonicalQuery encodes query parameters sorted by name, as signing requires
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters. Slashes
+// are kept in object keys.
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// sha256Hex returns the hex encoded SHA-256 hash of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sqliteSchema creates the table templates are kept in
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS templates (
+	name     TEXT PRIMARY KEY,
+	data     BLOB NOT NULL,
+	version  TEXT NOT NULL,
+	modified INTEGER NOT NULL
+)`
+
+// SQLiteStore keeps templates in a SQLite database. The database is opened
+// by the caller with the driver of their choice, for example:
+//
+//	import _ "modernc.org/sqlite"
+//
+//	db, err := sql.Open("sqlite", "templates.db")
+//	store, err := storage.NewSQLiteStore(db)
+type SQLiteStore struct {
+	name string
+	db   *sql.DB
+}
+
+// NewSQLiteStore creates a store in db, creating its table if needed
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return nil, fmt.Errorf("failed to create templates table: %w", err)
+	}
+	return &SQLiteStore{name: nextStoreID("sqlite"), db: db}, nil
+}
+
+// Name implements TemplateStore
+func (s *SQLiteStore) Name() string {
+	return s.name
+}
+
+// Stat implements TemplateStore
+func (s *SQLiteStore) Stat(name string) (FileInfo, error) {
+	if err := checkName(name); err != nil {
+		return FileInfo{}, err
+	}
+	info := FileInfo{Name: name}
+	var modified int64
+	err := s.db.QueryRow(`SELECT length(data), version, modified FROM templates WHERE name = ?`, name).
+		Scan(&info.Size, &info.Version, &modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return FileInfo{}, notExist(name)
+	}
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	info.Modified = time.Unix(0, modified)
+	return info, nil
+}
+
+// ReadFile implements TemplateStore
+func (s *SQLiteStore) ReadFile(name string) ([]byte, FileInfo, error) {
+	if err := checkName(name); err != nil {
+		return nil, FileInfo{}, err
+	}
+	info := FileInfo{Name: name}
+	var data []byte
+	var modified int64
+	err := s.db.QueryRow(`SELECT data, version, modified FROM templates WHERE name = ?`, name).
+		Scan(&data, &info.Version, &modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, FileInfo{}, notExist(name)
+	}
+	if err != nil {
+		return nil, FileInfo{}, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	info.Size = int64(len(data))
+	info.Modified = time.Unix(0, modified)
+	return data, info, nil
+}
+
+// List implements TemplateStore
+func (s *SQLiteStore) List() ([]FileInfo, error) {
+	rows, err := s.db.Query(`SELECT name, length(data), version, modified FROM templates ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	defer rows.Close()
+
+	var files []FileInfo
+	for rows.Next() {
+		var info FileInfo
+		var modified int64
+		if err := rows.Scan(&info.Name, &info.Size, &info.Version, &modified); err != nil {
+			return nil, fmt.Errorf("failed to list templates: %w", err)
+		}
+		info.Modified = time.Unix(0, modified)
+		files = append(files, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	return files, nil
+}
+
+// WriteFile implements TemplateStore
+func (s *SQLiteStore) WriteFile(name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	_, err := s.db.Exec(`INSERT INTO templates (name, data, version, modified) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET data = excluded.data, version = excluded.version, modified = excluded.modified`,
+		name, data, ContentVersion(data), time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to write template %s: %w", name, err)
+	}
+	return nil
+}
+
+// Remove implements TemplateStore
+func (s *SQLiteStore) Remove(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`DELETE FROM templates WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete template %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build cgo
+
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestSQLiteStore creates a store in a temporary database
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "templates.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testTemplateStore(t, newTestSQLiteStore(t))
+}
+
+func TestSQLiteStoreName(t *testing.T) {
+	first, second := newTestSQLiteStore(t), newTestSQLiteStore(t)
+	if !strings.HasPrefix(first.Name(), "sqlite#") {
+		t.Errorf("Name = %q, want sqlite#N", first.Name())
+	}
+	// Caches are keyed by store name, so two databases mustn't share one
+	if first.Name() == second.Name() {
+		t.Errorf("two stores are both named %q", first.Name())
+	}
+}
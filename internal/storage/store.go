@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync/atomic"
+	"time"
+)
+
+// ErrReadOnly is returned when writing to a store that can't be changed,
+// such as templates embedded in the binary
+var ErrReadOnly = errors.New("template store is read-only")
+
+// FileInfo describes a file in a template store
+type FileInfo struct {
+	// Name is the slash-separated path of the file within the store
+	Name     string
+	Size     int64
+	Modified time.Time
+	// Version changes whenever the content changes. It is a hash of the
+	// content, or the object's ETag for S3 stores.
+	Version string
+}
+
+// TemplateStore holds template sources and the files that go with them, such
+// as schemas and included templates. Names are slash-separated paths relative
+// to the root of the store, such as "invoice.csv" or "partials/header.yaml".
+// Missing files are reported with errors wrapping fs.ErrNotExist.
+type TemplateStore interface {
+	// Name identifies the store; cache entries of different stores are kept apart by it
+	Name() string
+	// Stat describes a file without returning its content
+	Stat(name string) (FileInfo, error)
+	// ReadFile returns the content of a file and the version it has
+	ReadFile(name string) ([]byte, FileInfo, error)
+	// List returns every file in the store sorted by name
+	List() ([]FileInfo, error)
+	// WriteFile creates or replaces a file
+	WriteFile(name string, data []byte) error
+	// Remove deletes a file; removing a file that doesn't exist is not an error
+	Remove(name string) error
+}
+
+// storeIDs numbers the stores that have no natural name
+var storeIDs atomic.Int64
+
+// nextStoreID returns a name unique within the process, such as "sqlite#2"
+func nextStoreID(kind string) string {
+	return fmt.Sprintf("%s#%d", kind, storeIDs.Add(1))
+}
+
+// ContentVersion returns the version of file content: its SHA-256 hash
+func ContentVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkName rejects names that aren't clean paths inside the store
+func checkName(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// notExist returns the error for a missing file
+func notExist(name string) error {
+	return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
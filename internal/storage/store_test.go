@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+// testTemplateStore runs the behaviour every TemplateStore shares against an
+// empty store
+func testTemplateStore(t *testing.T, store TemplateStore) {
+	t.Helper()
+
+	if _, _, err := store.ReadFile("invoice.csv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile of a missing file: error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := store.Stat("invoice.csv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing file: error = %v, want fs.ErrNotExist", err)
+	}
+
+	files := map[string]string{
+		"invoice.csv":                "type,x,y\n",
+		"partials/header yaml.yaml":  "elements: []\n",
+		"invoice.schema.json":        "{}",
+		"partials/footer+total.yaml": "elements: []\n",
+	}
+	for name, content := range files {
+		if err := store.WriteFile(name, []byte(content)); err != nil {
+			t.Fatalf("WriteFile(%s): %v", name, err)
+		}
+	}
+
+	data, info, err := store.ReadFile("partials/header yaml.yaml")
+	if err != nil || string(data) != files["partials/header yaml.yaml"] {
+		t.Fatalf("ReadFile = %q, %v", data, err)
+	}
+	if info.Name != "partials/header yaml.yaml" || info.Size != int64(len(data)) || info.Version == "" {
+		t.Errorf("ReadFile info = %+v", info)
+	}
+	stat, err := store.Stat("partials/header yaml.yaml")
+	if err != nil || stat.Size != info.Size || stat.Version != info.Version {
+		t.Errorf("Stat = %+v, %v; want the info of ReadFile %+v", stat, err, info)
+	}
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"invoice.csv", "invoice.schema.json", "partials/footer+total.yaml", "partials/header yaml.yaml"}
+	if len(list) != len(want) {
+		t.Fatalf("List = %+v, want %v", list, want)
+	}
+	for i, file := range list {
+		if file.Name != want[i] || file.Size != int64(len(files[file.Name])) {
+			t.Errorf("List[%d] = %+v, want %s", i, file, want[i])
+		}
+	}
+
+	// Replacing a file changes its version
+	if err := store.WriteFile("invoice.csv", []byte("type,x,y,width\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, replaced, err := store.ReadFile("invoice.csv")
+	if err != nil || string(data) != "type,x,y,width\n" || replaced.Version == list[0].Version {
+		t.Errorf("replaced file = %q with version %q, %v", data, replaced.Version, err)
+	}
+
+	if err := store.Remove("invoice.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.ReadFile("invoice.csv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile after Remove: error = %v, want fs.ErrNotExist", err)
+	}
+	if err := store.Remove("invoice.csv"); err != nil {
+		t.Errorf("Remove of a missing file: %v", err)
+	}
+
+	for _, name := range []string{"../invoice.csv", "/etc/passwd", "partials/../invoice.csv", ""} {
+		if _, _, err := store.ReadFile(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("ReadFile(%q): error = %v, want fs.ErrInvalid", name, err)
+		}
+		if err := store.WriteFile(name, nil); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("WriteFile(%q): error = %v, want fs.ErrInvalid", name, err)
+		}
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDirStore(dir)
+	if store.Name() != "dir:"+dir {
+		t.Errorf("Name = %q", store.Name())
+	}
+	testTemplateStore(t, store)
+}
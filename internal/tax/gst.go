@@ -0,0 +1,344 @@
+package tax
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/utils"
+)
+
+// Default fields used by the GST calculation
+const (
+	DefaultItemsField  = "items"
+	DefaultOutputField = "gst"
+)
+
+// Tax types written to the output as taxType
+const (
+	TaxTypeIntraState = "CGST+SGST"
+	TaxTypeInterState = "IGST"
+)
+
+// GSTCalculator computes CGST/SGST/IGST for the line items of an invoice. Each
+// line item gets its tax rates and amounts, and the invoice totals and an
+// HSN-wise summary are added under the output field:
+//
+//	{{gst.cgstAmount}} {{gst.grandTotal|currency:INR}} {{gst.grandTotal|words:INR}}
+//	table with variableName gst.hsnSummary
+type GSTCalculator struct {
+	settings models.GSTSettings
+}
+
+// NewGSTCalculator creates a GST calculator
+func NewGSTCalculator(settings models.GSTSettings) *GSTCalculator {
+	if settings.ItemsField == "" {
+		settings.ItemsField = DefaultItemsField
+	}
+	if settings.OutputField == "" {
+		settings.OutputField = DefaultOutputField
+	}
+	if settings.Rounding == "" {
+		settings.Rounding = models.GSTRoundingLine
+	}
+	return &GSTCalculator{settings: settings}
+}
+
+// hsnGroup accumulates the lines of one HSN code and rate
+type hsnGroup struct {
+	hsn     string
+	rate    float64
+	taxable float64
+	cgst    float64
+	sgst    float64
+	igst    float64
+}
+
+// Calculate returns a copy of data with the line items and GST totals filled in
+func (c *GSTCalculator) Calculate(data map[string]interface{}) (map[string]interface{}, error) {
+	if c.settings.Rounding != models.GSTRoundingLine && c.settings.Rounding != models.GSTRoundingInvoice {
+		return nil, fmt.Errorf("unknown GST rounding %q: use %s or %s",
+			c.settings.Rounding, models.GSTRoundingLine, models.GSTRoundingInvoice)
+	}
+	supplier, err := c.stateCode("supplier", c.settings.SupplierState, c.settings.SupplierGSTIN, data)
+	if err != nil {
+		return nil, err
+	}
+	placeOfSupply, err := c.stateCode("place of supply", c.settings.PlaceOfSupply, c.settings.RecipientGSTIN, data)
+	if err != nil {
+		return nil, err
+	}
+	interState := supplier != placeOfSupply
+
+	value, ok := utils.ResolvePath(data, c.settings.ItemsField)
+	if !ok {
+		return nil, fmt.Errorf("line items field not found: %s", c.settings.ItemsField)
+	}
+	items, isArray := utils.ToSlice(value)
+	if !isArray {
+		return nil, fmt.Errorf("line items field is not an array: %s", c.settings.ItemsField)
+	}
+
+	var totals hsnGroup
+	var groups []*hsnGroup
+	groupIndex := make(map[string]*hsnGroup)
+	lines := make([]interface{}, len(items))
+
+	for i, item := range items {
+		fields, isMap := item.(map[string]interface{})
+		if !isMap {
+			return nil, fmt.Errorf("line item %d is not an object", i+1)
+		}
+		line, err := c.calculateLine(fields, interState)
+		if err != nil {
+			return nil, fmt.Errorf("line item %d: %w", i+1, err)
+		}
+		lines[i] = line.fields
+
+		key := fmt.Sprintf("%s|%g", line.hsn, line.rate)
+		group, ok := groupIndex[key]
+		if !ok {
+			group = &hsnGroup{hsn: line.hsn, rate: line.rate}
+			groupIndex[key] = group
+			groups = append(groups, group)
+		}
+		group.add(line.hsnGroup)
+		totals.add(line.hsnGroup)
+	}
+
+	totals = totals.rounded()
+	invoiceTotal := Round(totals.taxable + totals.totalTax())
+	grandTotal := invoiceTotal
+	if c.settings.RoundOff {
+		grandTotal = math.Round(invoiceTotal)
+	}
+
+	summary := make([]interface{}, len(groups))
+	for i, group := range groups {
+		summary[i] = group.fields(interState)
+	}
+
+	result := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		result[k] = v
+	}
+	setPath(result, c.settings.ItemsField, lines)
+
+	taxType := TaxTypeIntraState
+	if interState {
+		taxType = TaxTypeInterState
+	}
+	result[c.settings.OutputField] = map[string]interface{}{
+		"supplierState": supplier,
+		"placeOfSupply": placeOfSupply,
+		"interState":    interState,
+		"taxType":       taxType,
+		"taxableValue":  totals.taxable,
+		"cgstAmount":    totals.cgst,
+		"sgstAmount":    totals.sgst,
+		"igstAmount":    totals.igst,
+		"totalTax":      Round(totals.totalTax()),
+		"invoiceTotal":  invoiceTotal,
+		"roundOff":      Round(grandTotal - invoiceTotal),
+		"grandTotal":    grandTotal,
+		"hsnSummary":    summary,
+	}
+
+	utils.LogDebug("Calculated %s for %d line items: taxable %.2f, tax %.2f",
+		taxType, len(items), totals.taxable, totals.totalTax())
+	return result, nil
+}
+
+// line is a calculated line item
+type line struct {
+	hsnGroup
+	fields map[string]interface{}
+}
+
+// calculateLine computes the tax of one line item and returns a copy of its
+// fields with the rates and amounts added
+func (c *GSTCalculator) calculateLine(item map[string]interface{}, interState bool) (line, error) {
+	taxable, err := taxableValue(item)
+	if err != nil {
+		return line{}, err
+	}
+
+	rate := c.settings.DefaultRate
+	if value, ok := item[models.GSTFieldRate]; ok && value != nil {
+		if rate, err = utils.ToFloat(value); err != nil {
+			return line{}, fmt.Errorf("%s: %w", models.GSTFieldRate, err)
+		}
+	}
+	if rate < 0 {
+		return line{}, fmt.Errorf("%s must not be negative", models.GSTFieldRate)
+	}
+
+	l := line{hsnGroup: hsnGroup{
+		hsn:     utils.FormatValue(item[models.GSTFieldHSN]),
+		rate:    rate,
+		taxable: taxable,
+	}}
+	// Tax rounded per invoice is kept exact on the lines and rounded in the
+	// totals, so the line amounts shown may not add up to them
+	percent := Percent
+	if c.settings.Rounding == models.GSTRoundingInvoice {
+		percent = func(amount, rate float64) float64 { return amount * rate / 100 }
+	}
+	if interState {
+		l.igst = percent(taxable, rate)
+	} else {
+		l.cgst = percent(taxable, rate/2)
+		l.sgst = percent(taxable, rate/2)
+	}
+
+	l.fields = make(map[string]interface{}, len(item)+9)
+	for k, v := range item {
+		l.fields[k] = v
+	}
+	for k, v := range l.hsnGroup.fields(interState) {
+		if k != "hsn" {
+			l.fields[k] = v
+		}
+	}
+	rounded := l.hsnGroup.rounded()
+	l.fields["lineTotal"] = Round(rounded.taxable + rounded.totalTax())
+	return l, nil
+}
+
+// taxableValue returns the item's taxableValue, or its quantity times unit
+// price less any discount
+func taxableValue(item map[string]interface{}) (float64, error) {
+	number := func(field string, fallback float64) (float64, error) {
+		value, ok := item[field]
+		if !ok || value == nil || value == "" {
+			return fallback, nil
+		}
+		n, err := utils.ToFloat(value)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", field, err)
+		}
+		return n, nil
+	}
+
+	if _, ok := item[models.GSTFieldTaxableValue]; ok {
+		return number(models.GSTFieldTaxableValue, 0)
+	}
+	if _, ok := item[models.GSTFieldUnitPrice]; !ok {
+		return 0, fmt.Errorf("%s or %s is required", models.GSTFieldTaxableValue, models.GSTFieldUnitPrice)
+	}
+
+	quantity, err := number(models.GSTFieldQuantity, 1)
+	if err != nil {
+		return 0, err
+	}
+	price, err := number(models.GSTFieldUnitPrice, 0)
+	if err != nil {
+		return 0, err
+	}
+	discount, err := number(models.GSTFieldDiscount, 0)
+	if err != nil {
+		return 0, err
+	}
+	return Round(quantity*price - discount), nil
+}
+
+// add adds the amounts of other to the group
+func (g *hsnGroup) add(other hsnGroup) {
+	g.taxable += other.taxable
+	g.cgst += other.cgst
+	g.sgst += other.sgst
+	g.igst += other.igst
+}
+
+// totalTax returns the sum of the group's taxes
+func (g *hsnGroup) totalTax() float64 {
+	return g.cgst + g.sgst + g.igst
+}
+
+// rounded returns the group with each amount rounded to paise, so that the
+// tax printed for each type adds up to the total tax
+func (g hsnGroup) rounded() hsnGroup {
+	g.taxable = Round(g.taxable)
+	g.cgst = Round(g.cgst)
+	g.sgst = Round(g.sgst)
+	g.igst = Round(g.igst)
+	return g
+}
+
+// fields returns the group as an HSN summary row
+func (g *hsnGroup) fields(interState bool) map[string]interface{} {
+	r := g.rounded()
+	cgstRate, sgstRate, igstRate := g.rate/2, g.rate/2, 0.0
+	if interState {
+		cgstRate, sgstRate, igstRate = 0, 0, g.rate
+	}
+	return map[string]interface{}{
+		"hsn":          g.hsn,
+		"gstRate":      g.rate,
+		"taxableValue": r.taxable,
+		"cgstRate":     cgstRate,
+		"cgstAmount":   r.cgst,
+		"sgstRate":     sgstRate,
+		"sgstAmount":   r.sgst,
+		"igstRate":     igstRate,
+		"igstAmount":   r.igst,
+		"totalTax":     Round(r.totalTax()),
+	}
+}
+
+// stateCode returns a configured state code, resolving placeholders, or the
+// state code at the start of the GSTIN
+func (c *GSTCalculator) stateCode(name, code, gstin string, data map[string]interface{}) (string, error) {
+	code = strings.TrimSpace(utils.ReplacePlaceholders(code, data))
+	gstin = strings.TrimSpace(utils.ReplacePlaceholders(gstin, data))
+
+	if code == "" && len(gstin) >= 2 {
+		code = gstin[:2]
+	}
+	if code == "" || strings.Contains(code, "{{") {
+		return "", fmt.Errorf("%s state code is required", name)
+	}
+
+	// Accept "27" as well as "27-Maharashtra"
+	if end := strings.IndexFunc(code, func(r rune) bool { return r < '0' || r > '9' }); end > 0 {
+		code = code[:end]
+	}
+	if n, err := strconv.Atoi(code); err == nil {
+		code = fmt.Sprintf("%02d", n)
+	}
+	return code, nil
+}
+
+// setPath stores value at a top-level key or a dotted path of nested objects,
+// copying the objects along the path so the request data isn't modified
+func setPath(data map[string]interface{}, path string, value interface{}) {
+	if _, ok := data[path]; ok || !strings.Contains(path, ".") {
+		data[path] = value
+		return
+	}
+
+	key, rest, _ := strings.Cut(path, ".")
+	child := make(map[string]interface{})
+	if existing, isMap := data[key].(map[string]interface{}); isMap {
+		for k, v := range existing {
+			child[k] = v
+		}
+	}
+	setPath(child, rest, value)
+	data[key] = child
+}
+
+// Percent returns rate percent of amount, rounded to paise
+func Percent(amount, rate float64) float64 {
+	return Round(amount * rate / 100)
+}
+
+// Round rounds an amount half away from zero to two decimals. The amount is
+// first rounded to eight decimals so that values such as 2.675, which are
+// stored slightly below their decimal value, round up.
+func Round(amount float64) float64 {
+	cents := math.Round(amount*1e8) / 1e6
+	return math.Round(cents) / 100
+}
@@ -0,0 +1,212 @@
+package tax
+
+import (
+	"testing"
+
+	"pdf-gen-simple/internal/models"
+)
+
+// calculate runs the GST calculation on items and returns the output field
+func calculate(t *testing.T, settings models.GSTSettings, items ...map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	lines := make([]interface{}, len(items))
+	for i, item := range items {
+		lines[i] = item
+	}
+	result, err := NewGSTCalculator(settings).Calculate(map[string]interface{}{"items": lines})
+	if err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+	return result[DefaultOutputField].(map[string]interface{})
+}
+
+// checkFields compares the fields named in want
+func checkFields(t *testing.T, name string, got, want map[string]interface{}) {
+	t.Helper()
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s: %s = %v, want %v", name, key, got[key], value)
+		}
+	}
+}
+
+func TestGSTIntraStateSplitsCGSTAndSGST(t *testing.T) {
+	gst := calculate(t, models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27-Maharashtra"},
+		map[string]interface{}{"hsn": "9965", "taxableValue": 1000, "gstRate": 18})
+
+	checkFields(t, "intra-state", gst, map[string]interface{}{
+		"taxType":      TaxTypeIntraState,
+		"interState":   false,
+		"taxableValue": 1000.0,
+		"cgstAmount":   90.0,
+		"sgstAmount":   90.0,
+		"igstAmount":   0.0,
+		"totalTax":     180.0,
+		"invoiceTotal": 1180.0,
+	})
+}
+
+func TestGSTInterStateChargesIGST(t *testing.T) {
+	gst := calculate(t, models.GSTSettings{SupplierGSTIN: "27AAACB1234C1Z5", RecipientGSTIN: "29AABCU9603R1ZM"},
+		map[string]interface{}{"hsn": "9965", "taxableValue": 1000, "gstRate": 18})
+
+	checkFields(t, "inter-state", gst, map[string]interface{}{
+		"supplierState": "27",
+		"placeOfSupply": "29",
+		"taxType":       TaxTypeInterState,
+		"interState":    true,
+		"cgstAmount":    0.0,
+		"sgstAmount":    0.0,
+		"igstAmount":    180.0,
+		"invoiceTotal":  1180.0,
+	})
+}
+
+func TestGSTLineItems(t *testing.T) {
+	data := map[string]interface{}{"items": []interface{}{
+		map[string]interface{}{"hsn": "4819", "quantity": 2, "unitPrice": 45.5, "discount": 1, "gstRate": 12},
+	}}
+	result, err := NewGSTCalculator(models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27"}).Calculate(data)
+	if err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+
+	line := result["items"].([]interface{})[0].(map[string]interface{})
+	checkFields(t, "line", line, map[string]interface{}{
+		"hsn":          "4819",
+		"taxableValue": 90.0,
+		"cgstRate":     6.0,
+		"cgstAmount":   5.4,
+		"sgstAmount":   5.4,
+		"lineTotal":    100.8,
+	})
+
+	original := data["items"].([]interface{})[0].(map[string]interface{})
+	if _, ok := original["cgstAmount"]; ok {
+		t.Error("the request's line items were modified")
+	}
+}
+
+func TestGSTGroupsHSNSummaryByCodeAndRate(t *testing.T) {
+	gst := calculate(t, models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27"},
+		map[string]interface{}{"hsn": "9965", "taxableValue": 1000, "gstRate": 18},
+		map[string]interface{}{"hsn": "4819", "taxableValue": 90, "gstRate": 12},
+		map[string]interface{}{"hsn": "9965", "taxableValue": 500, "gstRate": 18},
+		map[string]interface{}{"hsn": "9965", "taxableValue": 100, "gstRate": 5},
+	)
+
+	summary := gst["hsnSummary"].([]interface{})
+	want := []map[string]interface{}{
+		{"hsn": "9965", "gstRate": 18.0, "taxableValue": 1500.0, "cgstAmount": 135.0, "sgstAmount": 135.0, "totalTax": 270.0},
+		{"hsn": "4819", "gstRate": 12.0, "taxableValue": 90.0, "cgstAmount": 5.4, "sgstAmount": 5.4, "totalTax": 10.8},
+		{"hsn": "9965", "gstRate": 5.0, "taxableValue": 100.0, "cgstAmount": 2.5, "sgstAmount": 2.5, "totalTax": 5.0},
+	}
+	if len(summary) != len(want) {
+		t.Fatalf("got %d HSN rows, want %d", len(summary), len(want))
+	}
+	for i := range want {
+		checkFields(t, "HSN row", summary[i].(map[string]interface{}), want[i])
+	}
+	checkFields(t, "totals", gst, map[string]interface{}{"taxableValue": 1690.0, "totalTax": 285.8})
+}
+
+func TestGSTRounding(t *testing.T) {
+	// 18% of 10.10 is 1.818: rounded per line that's 1.82 three times, per
+	// invoice it's 5.454
+	items := []map[string]interface{}{
+		{"hsn": "9965", "taxableValue": 10.10, "gstRate": 18},
+		{"hsn": "9965", "taxableValue": 10.10, "gstRate": 18},
+		{"hsn": "9965", "taxableValue": 10.10, "gstRate": 18},
+	}
+	tests := []struct {
+		rounding string
+		igst     float64
+		total    float64
+	}{
+		{"", 5.46, 35.76},
+		{models.GSTRoundingLine, 5.46, 35.76},
+		{models.GSTRoundingInvoice, 5.45, 35.75},
+	}
+	for _, tt := range tests {
+		settings := models.GSTSettings{SupplierState: "27", PlaceOfSupply: "29", Rounding: tt.rounding}
+		gst := calculate(t, settings, items...)
+		checkFields(t, "rounding "+tt.rounding, gst, map[string]interface{}{
+			"igstAmount":   tt.igst,
+			"totalTax":     tt.igst,
+			"invoiceTotal": tt.total,
+		})
+		row := gst["hsnSummary"].([]interface{})[0].(map[string]interface{})
+		checkFields(t, "HSN row, rounding "+tt.rounding, row, map[string]interface{}{"igstAmount": tt.igst})
+	}
+
+	// Invoice totals add up to the rounded CGST and SGST shown
+	gst := calculate(t, models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27", Rounding: models.GSTRoundingInvoice},
+		map[string]interface{}{"taxableValue": 0.1, "gstRate": 5},
+		map[string]interface{}{"taxableValue": 0.1, "gstRate": 5},
+	)
+	checkFields(t, "invoice rounding", gst, map[string]interface{}{
+		"cgstAmount": 0.01,
+		"sgstAmount": 0.01,
+		"totalTax":   0.02,
+	})
+}
+
+func TestGSTRoundOff(t *testing.T) {
+	tests := []struct {
+		taxable  float64
+		roundOff bool
+		invoice  float64
+		offset   float64
+		grand    float64
+	}{
+		{1000.40, true, 1180.48, -0.48, 1180},
+		{1000.50, true, 1180.6, 0.4, 1181},
+		{1000.40, false, 1180.48, 0, 1180.48},
+	}
+	for _, tt := range tests {
+		settings := models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27", RoundOff: tt.roundOff}
+		gst := calculate(t, settings, map[string]interface{}{"taxableValue": tt.taxable, "gstRate": 18})
+		checkFields(t, "round-off", gst, map[string]interface{}{
+			"invoiceTotal": tt.invoice,
+			"roundOff":     tt.offset,
+			"grandTotal":   tt.grand,
+		})
+	}
+}
+
+func TestGSTRejectsInvalidSettingsAndItems(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings models.GSTSettings
+		item     interface{}
+	}{
+		{"missing state", models.GSTSettings{PlaceOfSupply: "27"}, map[string]interface{}{"taxableValue": 1}},
+		{"unresolved state", models.GSTSettings{SupplierState: "{{missing}}", PlaceOfSupply: "27"}, map[string]interface{}{"taxableValue": 1}},
+		{"unknown rounding", models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27", Rounding: "item"}, map[string]interface{}{"taxableValue": 1}},
+		{"no value", models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27"}, map[string]interface{}{"hsn": "9965"}},
+		{"negative rate", models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27"}, map[string]interface{}{"taxableValue": 1, "gstRate": -5}},
+		{"bad price", models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27"}, map[string]interface{}{"unitPrice": "abc"}},
+		{"not an object", models.GSTSettings{SupplierState: "27", PlaceOfSupply: "27"}, "9965"},
+	}
+	for _, tt := range tests {
+		data := map[string]interface{}{"items": []interface{}{tt.item}}
+		if _, err := NewGSTCalculator(tt.settings).Calculate(data); err == nil {
+			t.Errorf("%s: Calculate succeeded", tt.name)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct{ amount, want float64 }{
+		{2.675, 2.68},
+		{1.005, 1.01},
+		{-2.675, -2.68},
+		{0.004, 0},
+		{1180.6, 1180.6},
+	}
+	for _, tt := range tests {
+		if got := Round(tt.amount); got != tt.want {
+			t.Errorf("Round(%v) = %v, want %v", tt.amount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,559 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pdf-gen-simple/internal/cache"
+	"pdf-gen-simple/internal/models"
+	"pdf-gen-simple/internal/parsers"
+	"pdf-gen-simple/internal/storage"
+	"pdf-gen-simple/internal/utils"
+)
+
+var (
+	// ErrNotFound is returned for templates and versions that don't exist
+	ErrNotFound = errors.New("template not found")
+	// ErrArchived is returned when an archived template is used for generation
+	ErrArchived = errors.New("template is archived")
+	// ErrInvalidName is returned for template names that can't be used as file names
+	ErrInvalidName = errors.New("invalid template name: use letters, digits, '-' and '_'")
+	// ErrUnsupportedFormat is returned for uploads in a format without a loader
+	ErrUnsupportedFormat = errors.New("unsupported template format: use csv, json or yaml")
+)
+
+// namePattern matches the names templates can be uploaded under
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,100}$`)
+
+// formatExtensions maps upload formats to template file extensions
+var formatExtensions = map[string]string{
+	"csv":  ".csv",
+	"json": ".json",
+	"yaml": ".yaml",
+	"yml":  ".yaml",
+}
+
+// InvalidTemplateError is returned for uploads that fail validation
+type InvalidTemplateError struct {
+	Diagnostics []models.Diagnostic
+}
+
+// Error implements error
+func (e *InvalidTemplateError) Error() string {
+	var messages []string
+	for _, diagnostic := range e.Diagnostics {
+		if diagnostic.Severity == models.SeverityError {
+			messages = append(messages, diagnostic.String())
+		}
+	}
+	return fmt.Sprintf("invalid template: %s", strings.Join(messages, "; "))
+}
+
+// Version is an immutable upload of a template
+type Version struct {
+	Version   int       `json:"version"`
+	Format    string    `json:"format"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Template describes a template in the registry. Version is 0 for templates
+// copied into the directory rather than uploaded.
+type Template struct {
+	Name     string    `json:"name"`
+	Format   string    `json:"format,omitempty"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Version  int       `json:"version"`
+	Versions []Version `json:"versions,omitempty"`
+	Archived bool      `json:"archived,omitempty"`
+}
+
+// history is the version index of a template, kept in .<name>.versions.json
+type history struct {
+	Archived bool      `json:"archived,omitempty"`
+	Versions []Version `json:"versions"`
+}
+
+// latest returns the newest version, or nil if there is none
+func (h *history) latest() *Version {
+	if len(h.Versions) == 0 {
+		return nil
+	}
+	return &h.Versions[len(h.Versions)-1]
+}
+
+// find returns a version, or nil if it doesn't exist
+func (h *history) find(version int) *Version {
+	for i := range h.Versions {
+		if h.Versions[i].Version == version {
+			return &h.Versions[i]
+		}
+	}
+	return nil
+}
+
+// Registry manages the templates at the root of a template store. The
+// current source of a template is <name>.<ext>, which is what generation uses
+// by default. Every upload is also kept as an immutable hidden file
+// .<name>.v<N>.<ext> next to it, so that versions resolve includes from the
+// same directory.
+type Registry struct {
+	mu        sync.Mutex
+	store     storage.TemplateStore
+	loaders   *parsers.TemplateLoaders
+	validator *parsers.TemplateValidator
+	cache     *cache.TemplateCache
+}
+
+// NewRegistry creates a registry for the templates in the loaders' store
+func NewRegistry(loaders *parsers.TemplateLoaders, validator *parsers.TemplateValidator) *Registry {
+	return &Registry{
+		store:     loaders.Store(),
+		loaders:   loaders,
+		validator: validator,
+		cache:     cache.GetTemplateCache(),
+	}
+}
+
+// Upload validates a template and stores it as the next version, making it
+// the current source of the template. The validation diagnostics are
+// returned; uploads with errors fail with an *InvalidTemplateError.
+func (r *Registry) Upload(name, format string, source []byte) (*Version, []models.Diagnostic, error) {
+	if !namePattern.MatchString(name) {
+		return nil, nil, ErrInvalidName
+	}
+	extension, ok := formatExtensions[strings.ToLower(strings.TrimPrefix(format, "."))]
+	if !ok {
+		return nil, nil, ErrUnsupportedFormat
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, err := r.history(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.importCurrent(name, h); err != nil {
+		return nil, nil, err
+	}
+
+	number := 1
+	if latest := h.latest(); latest != nil {
+		number = latest.Version + 1
+	}
+	versionFile := r.versionFile(name, number, extension)
+	if err := r.writeNewFile(versionFile, source); err != nil {
+		return nil, nil, fmt.Errorf("failed to store template version: %w", err)
+	}
+
+	diagnostics, err := r.validator.ValidateFile(r.store, versionFile)
+	if err == nil && models.HasErrors(diagnostics) {
+		err = &InvalidTemplateError{Diagnostics: diagnostics}
+	}
+	if err != nil {
+		r.store.Remove(versionFile)
+		return nil, diagnostics, err
+	}
+
+	version := Version{
+		Version:   number,
+		Format:    strings.TrimPrefix(extension, "."),
+		Size:      int64(len(source)),
+		SHA256:    storage.ContentVersion(source),
+		CreatedAt: time.Now(),
+	}
+	h.Versions = append(h.Versions, version)
+	h.Archived = false
+	if err := r.saveHistory(name, h); err != nil {
+		r.store.Remove(versionFile)
+		return nil, nil, err
+	}
+
+	// The upload replaces the current source in whichever format it had
+	if err := r.removeCurrent(name); err != nil {
+		return nil, nil, err
+	}
+	currentFile := name + extension
+	if err := r.store.WriteFile(currentFile, source); err != nil {
+		return nil, nil, fmt.Errorf("failed to store template: %w", err)
+	}
+	r.cache.Invalidate(r.store.Name(), currentFile)
+
+	utils.LogInfo("Uploaded template %s version %d", name, number)
+	return &version, diagnostics, nil
+}
+
+// List returns the templates in the store sorted by name. Archived templates
+// are included if archived is true.
+func (r *Registry) List(archived bool) ([]Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := r.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, file := range files {
+		if name, ok := r.currentName(file.Name); ok {
+			names[name] = true
+		} else if name, ok := historyName(file.Name); ok && archived {
+			names[name] = true
+		}
+	}
+
+	templates := make([]Template, 0, len(names))
+	for name := range names {
+		template, err := r.describe(name)
+		if err != nil {
+			utils.LogWarn("Skipping template %s: %v", name, err)
+			continue
+		}
+		if template.Archived && !archived {
+			continue
+		}
+		templates = append(templates, *template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// Get describes a template and its versions
+func (r *Registry) Get(name string) (*Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.describe(name)
+}
+
+// File returns the file in the store to generate a template from: the
+// current source, or a pinned version if version is greater than 0. The
+// current source can be named with its extension, such as invoice.json.
+// Hidden files, which include the versions, and files in subdirectories
+// can't be generated from.
+func (r *Registry) File(name string, version int) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.Contains(name, "/") {
+		return "", ErrInvalidName
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if version <= 0 {
+		return r.sourceFile(name)
+	}
+	h, err := r.history(name)
+	if err != nil {
+		return "", err
+	}
+	if h.Archived {
+		return "", ErrArchived
+	}
+	found := h.find(version)
+	if found == nil {
+		return "", ErrNotFound
+	}
+	return r.versionFile(name, version, "."+found.Format), nil
+}
+
+// Source returns the source of a template and its format: the current source,
+// or a version if version is greater than 0. Archived templates keep their
+// versions.
+func (r *Registry) Source(name string, version int) ([]byte, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var file string
+	if version <= 0 {
+		file = r.currentFile(name)
+	} else {
+		h, err := r.history(name)
+		if err != nil {
+			return nil, "", err
+		}
+		if found := h.find(version); found != nil {
+			file = r.versionFile(name, version, "."+found.Format)
+		}
+	}
+	if file == "" {
+		return nil, "", ErrNotFound
+	}
+
+	source, _, err := r.store.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read template: %w", err)
+	}
+	return source, strings.TrimPrefix(path.Ext(file), "."), nil
+}
+
+// Archive retires a template: its current source is removed so it can no
+// longer be generated, while its versions are kept. Uploading it again
+// restores it.
+func (r *Registry) Archive(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, err := r.history(name)
+	if err != nil {
+		return err
+	}
+	if r.currentFile(name) == "" {
+		if h.Archived || len(h.Versions) == 0 {
+			return ErrNotFound
+		}
+	}
+	if err := r.importCurrent(name, h); err != nil {
+		return err
+	}
+
+	h.Archived = true
+	if err := r.saveHistory(name, h); err != nil {
+		return err
+	}
+	if err := r.removeCurrent(name); err != nil {
+		return err
+	}
+	utils.LogInfo("Archived template %s", name)
+	return nil
+}
+
+// Delete removes a template together with all its versions
+func (r *Registry) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, err := r.history(name)
+	if err != nil {
+		return err
+	}
+	if r.currentFile(name) == "" && len(h.Versions) == 0 {
+		return ErrNotFound
+	}
+
+	if err := r.removeCurrent(name); err != nil {
+		return err
+	}
+	for _, version := range h.Versions {
+		file := r.versionFile(name, version.Version, "."+version.Format)
+		if err := r.store.Remove(file); err != nil {
+			return fmt.Errorf("failed to delete template version: %w", err)
+		}
+		r.cache.Invalidate(r.store.Name(), file)
+	}
+	if err := r.store.Remove(r.historyFile(name)); err != nil {
+		return fmt.Errorf("failed to delete template history: %w", err)
+	}
+	utils.LogInfo("Deleted template %s and %d versions", name, len(h.Versions))
+	return nil
+}
+
+// describe builds the description of a template
+func (r *Registry) describe(name string) (*Template, error) {
+	h, err := r.history(name)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &Template{Name: name, Versions: h.Versions, Archived: h.Archived}
+	if file := r.currentFile(name); file != "" {
+		info, err := r.store.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		template.Format = strings.TrimPrefix(path.Ext(file), ".")
+		template.Size = info.Size
+		template.Modified = info.Modified
+		if latest := h.latest(); latest != nil {
+			template.Version = latest.Version
+		}
+	} else if latest := h.latest(); latest != nil && h.Archived {
+		template.Format = latest.Format
+		template.Size = latest.Size
+		template.Modified = latest.CreatedAt
+	} else {
+		return nil, ErrNotFound
+	}
+	return template, nil
+}
+
+// importCurrent keeps a template that was copied into the store as version 1
+// before it is first replaced or archived
+func (r *Registry) importCurrent(name string, h *history) error {
+	if len(h.Versions) > 0 {
+		return nil
+	}
+	file := r.currentFile(name)
+	if file == "" {
+		return nil
+	}
+
+	source, info, err := r.store.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read template: %w", err)
+	}
+	extension := path.Ext(file)
+	if err := r.writeNewFile(r.versionFile(name, 1, extension), source); err != nil {
+		return fmt.Errorf("failed to store template version: %w", err)
+	}
+
+	h.Versions = append(h.Versions, Version{
+		Version:   1,
+		Format:    strings.TrimPrefix(extension, "."),
+		Size:      int64(len(source)),
+		SHA256:    storage.ContentVersion(source),
+		CreatedAt: info.Modified,
+	})
+	return r.saveHistory(name, h)
+}
+
+// removeCurrent removes the current source of a template in every format
+func (r *Registry) removeCurrent(name string) error {
+	for _, extension := range r.loaders.Extensions() {
+		file := name + extension
+		if err := r.store.Remove(file); err != nil {
+			return fmt.Errorf("failed to remove template: %w", err)
+		}
+		r.cache.Invalidate(r.store.Name(), file)
+	}
+	return nil
+}
+
+// currentFile returns the current source of a template, or "" if it has none
+func (r *Registry) currentFile(name string) string {
+	if !namePattern.MatchString(name) {
+		return ""
+	}
+	for _, extension := range r.loaders.Extensions() {
+		if _, err := r.store.Stat(name + extension); err == nil {
+			return name + extension
+		}
+	}
+	return ""
+}
+
+// sourceFile returns the current source of a template for generation.
+// Templates copied into the store under names that can't be uploaded, such
+// as "invoice copy.csv", have no history and are used as they are.
+func (r *Registry) sourceFile(name string) (string, error) {
+	base, file := name, ""
+	if r.loaders.Supports(name) {
+		base, file = strings.TrimSuffix(name, path.Ext(name)), name
+	}
+	if namePattern.MatchString(base) {
+		h, err := r.history(base)
+		if err != nil {
+			return "", err
+		}
+		if h.Archived {
+			return "", ErrArchived
+		}
+	}
+
+	if file == "" {
+		for _, extension := range r.loaders.Extensions() {
+			if _, err := r.store.Stat(name + extension); err == nil {
+				return name + extension, nil
+			}
+		}
+		return "", ErrNotFound
+	}
+	if _, err := r.store.Stat(file); err != nil {
+		return "", ErrNotFound
+	}
+	return file, nil
+}
+
+// currentName returns the template name of a current source file. Files in
+// subdirectories, such as included partials, aren't templates of their own.
+func (r *Registry) currentName(fileName string) (string, bool) {
+	if strings.HasPrefix(fileName, ".") || strings.Contains(fileName, "/") || !r.loaders.Supports(fileName) {
+		return "", false
+	}
+	name := strings.TrimSuffix(fileName, path.Ext(fileName))
+	// Schema files such as invoice.schema.json describe a template
+	if strings.HasSuffix(name, ".schema") || !namePattern.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// historyName returns the template name of a version index file
+func historyName(fileName string) (string, bool) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(fileName, "."), ".versions.json")
+	if !ok || !strings.HasPrefix(fileName, ".") || !namePattern.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// versionFile returns the file of a template version
+func (r *Registry) versionFile(name string, version int, extension string) string {
+	return fmt.Sprintf(".%s.v%d%s", name, version, extension)
+}
+
+// historyFile returns the version index of a template
+func (r *Registry) historyFile(name string) string {
+	return "." + name + ".versions.json"
+}
+
+// history reads the version index of a template; templates that were never
+// uploaded have an empty one
+func (r *Registry) history(name string) (*history, error) {
+	if !namePattern.MatchString(name) {
+		return nil, ErrNotFound
+	}
+
+	data, _, err := r.store.ReadFile(r.historyFile(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &history{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template history: %w", err)
+	}
+
+	var h history
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("failed to decode template history: %w", err)
+	}
+	return &h, nil
+}
+
+// saveHistory writes the version index of a template
+func (r *Registry) saveHistory(name string, h *history) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode template history: %w", err)
+	}
+	if err := r.store.WriteFile(r.historyFile(name), data); err != nil {
+		return fmt.Errorf("failed to write template history: %w", err)
+	}
+	return nil
+}
+
+// writeNewFile writes a file that must not exist yet. Versions are
+// immutable, so an existing file means the history is out of step.
+func (r *Registry) writeNewFile(file string, data []byte) error {
+	if _, err := r.store.Stat(file); err == nil {
+		return fmt.Errorf("%s already exists", file)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return r.store.WriteFile(file, data)
+}
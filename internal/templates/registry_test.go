@@ -0,0 +1,205 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"pdf-gen-simple/internal/parsers"
+	"pdf-gen-simple/internal/storage"
+)
+
+const (
+	invoiceV1 = "type,method,x,y,width,height,text\ntext,Cell,10,10,80,8,Invoice\n"
+	invoiceV2 = "type,method,x,y,width,height,text\ntext,Cell,10,10,80,8,Tax Invoice\n"
+	// invalidTemplate has an element type the validator doesn't know
+	invalidTemplate = "type,method,x,y,width,height,text\nsparkle,Cell,10,10,80,8,Invoice\n"
+)
+
+// newTestRegistry creates a registry for a temporary directory
+func newTestRegistry(t *testing.T) (*Registry, string) {
+	t.Helper()
+	dir := t.TempDir()
+	options := parsers.DefaultValidationOptions()
+	options.FontDir = "../../fonts"
+	return NewRegistry(parsers.NewTemplateLoaders(storage.NewDirStore(dir)), parsers.NewTemplateValidator(options)), dir
+}
+
+// files returns the names of the files in dir
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	sort.Strings(names)
+	return names
+}
+
+// upload uploads source as the invoice template
+func upload(t *testing.T, r *Registry, source string) *Version {
+	t.Helper()
+	version, _, err := r.Upload("invoice", "csv", []byte(source))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	return version
+}
+
+func TestRegistryVersions(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	if v := upload(t, r, invoiceV1); v.Version != 1 {
+		t.Errorf("first upload is version %d", v.Version)
+	}
+	if v := upload(t, r, invoiceV2); v.Version != 2 {
+		t.Errorf("second upload is version %d", v.Version)
+	}
+
+	template, err := r.Get("invoice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Version != 2 || len(template.Versions) != 2 || template.Format != "csv" {
+		t.Errorf("template = %+v", template)
+	}
+
+	tests := []struct {
+		version int
+		file    string
+		source  string
+	}{
+		{0, "invoice.csv", invoiceV2},
+		{1, ".invoice.v1.csv", invoiceV1},
+		{2, ".invoice.v2.csv", invoiceV2},
+	}
+	for _, tt := range tests {
+		file, err := r.File("invoice", tt.version)
+		if err != nil || file != tt.file {
+			t.Errorf("File(%d) = %q, %v; want %q", tt.version, file, err, tt.file)
+		}
+		source, format, err := r.Source("invoice", tt.version)
+		if err != nil || string(source) != tt.source || format != "csv" {
+			t.Errorf("Source(%d) = %q, %q, %v", tt.version, source, format, err)
+		}
+	}
+	if _, err := r.File("invoice", 3); !errors.Is(err, ErrNotFound) {
+		t.Errorf("File(3): error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRegistryImportsCopiedTemplate(t *testing.T) {
+	r, dir := newTestRegistry(t)
+	if err := os.WriteFile(filepath.Join(dir, "invoice.csv"), []byte(invoiceV1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The copied template is kept as version 1 before the upload replaces it
+	if v := upload(t, r, invoiceV2); v.Version != 2 {
+		t.Errorf("upload over a copied template is version %d, want 2", v.Version)
+	}
+	if source, _, err := r.Source("invoice", 1); err != nil || string(source) != invoiceV1 {
+		t.Errorf("Source(1) = %q, %v", source, err)
+	}
+}
+
+func TestRegistryRejectsInvalidUpload(t *testing.T) {
+	r, dir := newTestRegistry(t)
+
+	_, diagnostics, err := r.Upload("invoice", "csv", []byte(invalidTemplate))
+	var invalid *InvalidTemplateError
+	if !errors.As(err, &invalid) || len(diagnostics) == 0 {
+		t.Fatalf("Upload: error = %v, want an InvalidTemplateError", err)
+	}
+	if got := files(t, dir); len(got) != 0 {
+		t.Errorf("invalid upload left %v", got)
+	}
+
+	// A failed upload doesn't take a version number or replace the source
+	upload(t, r, invoiceV1)
+	if _, _, err := r.Upload("invoice", "csv", []byte(invalidTemplate)); err == nil {
+		t.Fatal("invalid upload succeeded")
+	}
+	want := []string{".invoice.v1.csv", ".invoice.versions.json", "invoice.csv"}
+	if got := files(t, dir); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if v := upload(t, r, invoiceV2); v.Version != 2 {
+		t.Errorf("upload after the invalid one is version %d, want 2", v.Version)
+	}
+}
+
+func TestRegistryArchive(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	upload(t, r, invoiceV1)
+
+	if err := r.Archive("invoice"); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []int{0, 1} {
+		if _, err := r.File("invoice", version); !errors.Is(err, ErrArchived) {
+			t.Errorf("File(%d) of an archived template: error = %v, want ErrArchived", version, err)
+		}
+	}
+	if source, _, err := r.Source("invoice", 1); err != nil || string(source) != invoiceV1 {
+		t.Errorf("archived template lost version 1: %q, %v", source, err)
+	}
+	if list, _ := r.List(false); len(list) != 0 {
+		t.Errorf("List(false) = %+v, want the archived template left out", list)
+	}
+	if list, _ := r.List(true); len(list) != 1 || !list[0].Archived {
+		t.Errorf("List(true) = %+v", list)
+	}
+
+	// Uploading again restores it
+	upload(t, r, invoiceV2)
+	if file, err := r.File("invoice", 0); err != nil || file != "invoice.csv" {
+		t.Errorf("File after restoring = %q, %v", file, err)
+	}
+}
+
+func TestRegistryDelete(t *testing.T) {
+	r, dir := newTestRegistry(t)
+	upload(t, r, invoiceV1)
+	upload(t, r, invoiceV2)
+	if err := os.WriteFile(filepath.Join(dir, "receipt.csv"), []byte(invoiceV1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Delete("invoice"); err != nil {
+		t.Fatal(err)
+	}
+	if got := files(t, dir); len(got) != 1 || got[0] != "receipt.csv" {
+		t.Errorf("files after Delete = %v, want only the other template", got)
+	}
+	if _, err := r.Get("invoice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: error = %v", err)
+	}
+	if err := r.Delete("invoice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRegistryInvalidNames(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	for _, name := range []string{"", "../invoice", "in voice", ".invoice"} {
+		if _, _, err := r.Upload(name, "csv", []byte(invoiceV1)); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Upload(%q): error = %v, want ErrInvalidName", name, err)
+		}
+	}
+	// Versions and files in subdirectories can't be generated by file name
+	upload(t, r, invoiceV1)
+	for _, name := range []string{".invoice.v1.csv", ".invoice.versions.json", "partials/invoice.csv", ""} {
+		if _, err := r.File(name, 0); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("File(%q): error = %v, want ErrInvalidName", name, err)
+		}
+	}
+	if _, _, err := r.Upload("invoice", "docx", []byte(invoiceV1)); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Upload as docx: error = %v, want ErrUnsupportedFormat", err)
+	}
+}
@@ -0,0 +1,187 @@
+package tenants
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"pdf-gen-simple/internal/storage"
+)
+
+var (
+	// ErrUnauthorized is returned for requests that don't identify a tenant
+	ErrUnauthorized = errors.New("a valid API key is required")
+	// ErrUnknownTenant is returned when the tenant header names no tenant
+	ErrUnknownTenant = errors.New("unknown tenant")
+)
+
+// DefaultAPIKeyHeader is the header API keys are read from, besides
+// "Authorization: Bearer <key>"
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// validID matches tenant IDs
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Tenant is a client with its own templates, images and fonts
+type Tenant struct {
+	ID string
+	// APIKeys identify the tenant's requests
+	APIKeys []string
+	// Store holds the tenant's templates
+	Store storage.TemplateStore
+	// ImageDir is the directory image paths are resolved in; images outside
+	// it can't be used
+	ImageDir string
+	// FontDir holds the tenant's font files; it defaults to ./fonts
+	FontDir string
+	// RateLimit is the number of requests allowed per second; 0 is unlimited
+	RateLimit float64
+	// Burst is the number of requests allowed at once; it defaults to the
+	// rate limit rounded up
+	Burst int
+}
+
+// NewDirTenant creates a tenant whose directory is laid out like the
+// service's working directory: templates in dir/assets and fonts in
+// dir/fonts. Image paths such as ./assets/logo.png are resolved in dir.
+// Tenants without a fonts directory use ./fonts.
+func NewDirTenant(id, dir string, apiKeys ...string) Tenant {
+	tenant := Tenant{
+		ID:       id,
+		APIKeys:  apiKeys,
+		Store:    storage.NewDirStore(filepath.Join(dir, "assets")),
+		ImageDir: dir,
+	}
+	if info, err := os.Stat(filepath.Join(dir, "fonts")); err == nil && info.IsDir() {
+		tenant.FontDir = filepath.Join(dir, "fonts")
+	}
+	return tenant
+}
+
+// Config lists the tenants and how requests identify them
+type Config struct {
+	Tenants []Tenant
+	// APIKeyHeader is the header API keys are read from; it defaults to X-API-Key
+	APIKeyHeader string
+	// TenantHeader, if set, names a header that gives the tenant ID directly.
+	// Only set it when a gateway in front of the service authenticates
+	// clients and sets the header itself.
+	TenantHeader string
+}
+
+// Registry identifies the tenant of each request and applies its rate limit
+type Registry struct {
+	config   Config
+	tenants  map[string]*Tenant
+	keys     map[string]*Tenant
+	limiters map[string]*limiter
+}
+
+// NewRegistry checks the tenants of config and creates a registry for them
+func NewRegistry(config Config) (*Registry, error) {
+	if config.APIKeyHeader == "" {
+		config.APIKeyHeader = DefaultAPIKeyHeader
+	}
+
+	r := &Registry{
+		config:   config,
+		tenants:  make(map[string]*Tenant),
+		keys:     make(map[string]*Tenant),
+		limiters: make(map[string]*limiter),
+	}
+	for i := range config.Tenants {
+		tenant := config.Tenants[i]
+		if !validID.MatchString(tenant.ID) {
+			return nil, fmt.Errorf("invalid tenant ID %q", tenant.ID)
+		}
+		if _, exists := r.tenants[tenant.ID]; exists {
+			return nil, fmt.Errorf("duplicate tenant %q", tenant.ID)
+		}
+		if tenant.Store == nil {
+			return nil, fmt.Errorf("tenant %s has no template store", tenant.ID)
+		}
+		if tenant.ImageDir == "" {
+			return nil, fmt.Errorf("tenant %s has no image directory", tenant.ID)
+		}
+		if tenant.FontDir == "" {
+			tenant.FontDir = "./fonts"
+		}
+		if tenant.RateLimit < 0 {
+			return nil, fmt.Errorf("tenant %s has a negative rate limit", tenant.ID)
+		}
+		if tenant.RateLimit > 0 && tenant.Burst <= 0 {
+			tenant.Burst = int(math.Ceil(tenant.RateLimit))
+		}
+
+		for _, key := range tenant.APIKeys {
+			if key == "" {
+				return nil, fmt.Errorf("tenant %s has an empty API key", tenant.ID)
+			}
+			if other, exists := r.keys[key]; exists {
+				return nil, fmt.Errorf("tenants %s and %s share an API key", other.ID, tenant.ID)
+			}
+			r.keys[key] = &tenant
+		}
+		r.tenants[tenant.ID] = &tenant
+		if tenant.RateLimit > 0 {
+			r.limiters[tenant.ID] = newLimiter(tenant.RateLimit, tenant.Burst)
+		}
+	}
+	return r, nil
+}
+
+// Tenants returns every tenant
+func (r *Registry) Tenants() []*Tenant {
+	tenants := make([]*Tenant, 0, len(r.config.Tenants))
+	for _, tenant := range r.config.Tenants {
+		tenants = append(tenants, r.tenants[tenant.ID])
+	}
+	return tenants
+}
+
+// Get returns the tenant with the given ID
+func (r *Registry) Get(id string) (*Tenant, bool) {
+	tenant, ok := r.tenants[id]
+	return tenant, ok
+}
+
+// Identify returns the tenant of a request, from its API key or, if
+// configured, the tenant header
+func (r *Registry) Identify(req *http.Request) (*Tenant, error) {
+	if r.config.TenantHeader != "" {
+		if id := strings.TrimSpace(req.Header.Get(r.config.TenantHeader)); id != "" {
+			tenant, ok := r.tenants[id]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownTenant, id)
+			}
+			return tenant, nil
+		}
+	}
+
+	key := strings.TrimSpace(req.Header.Get(r.config.APIKeyHeader))
+	if key == "" {
+		if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+			key = strings.TrimSpace(token)
+		}
+	}
+	if tenant, ok := r.keys[key]; ok && key != "" {
+		return tenant, nil
+	}
+	return nil, ErrUnauthorized
+}
+
+// Allow takes a request from the tenant's rate limit. If the limit is
+// reached it returns false and how long to wait before retrying.
+func (r *Registry) Allow(tenant *Tenant) (bool, time.Duration) {
+	limiter, ok := r.limiters[tenant.ID]
+	if !ok {
+		return true, 0
+	}
+	return limiter.allow(time.Now())
+}
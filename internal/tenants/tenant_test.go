@@ -0,0 +1,112 @@
+package tenants
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pdf-gen-simple/internal/storage"
+)
+
+// testTenant creates a tenant with the given API keys
+func testTenant(t *testing.T, id string, apiKeys ...string) Tenant {
+	t.Helper()
+	dir := t.TempDir()
+	return Tenant{ID: id, APIKeys: apiKeys, Store: storage.NewDirStore(dir), ImageDir: dir}
+}
+
+func TestIdentify(t *testing.T) {
+	r, err := NewRegistry(Config{
+		Tenants:      []Tenant{testTenant(t, "acme", "acme-key"), testTenant(t, "globex", "globex-key")},
+		TenantHeader: "X-Tenant",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		tenant  string
+		err     error
+	}{
+		{"API key header", map[string]string{"X-API-Key": "acme-key"}, "acme", nil},
+		{"bearer token", map[string]string{"Authorization": "Bearer globex-key"}, "globex", nil},
+		{"tenant header", map[string]string{"X-Tenant": "globex"}, "globex", nil},
+		{"tenant header wins", map[string]string{"X-Tenant": "globex", "X-API-Key": "acme-key"}, "globex", nil},
+		{"unknown tenant", map[string]string{"X-Tenant": "initech"}, "", ErrUnknownTenant},
+		{"unknown key", map[string]string{"X-API-Key": "other-key"}, "", ErrUnauthorized},
+		{"basic auth", map[string]string{"Authorization": "Basic YWNtZS1rZXk6"}, "", ErrUnauthorized},
+		{"no key", nil, "", ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		tenant, err := r.Identify(req)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || tenant.ID != tt.tenant {
+			t.Errorf("%s: tenant = %v, %v; want %s", tt.name, tenant, err, tt.tenant)
+		}
+	}
+}
+
+func TestNewRegistryRejectsInvalidTenants(t *testing.T) {
+	noStore := testTenant(t, "acme", "key")
+	noStore.Store = nil
+	negative := testTenant(t, "acme", "key")
+	negative.RateLimit = -1
+
+	tests := []struct {
+		name    string
+		tenants []Tenant
+	}{
+		{"invalid ID", []Tenant{testTenant(t, "../acme", "key")}},
+		{"duplicate ID", []Tenant{testTenant(t, "acme", "a"), testTenant(t, "acme", "b")}},
+		{"shared API key", []Tenant{testTenant(t, "acme", "key"), testTenant(t, "globex", "key")}},
+		{"empty API key", []Tenant{testTenant(t, "acme", "")}},
+		{"no store", []Tenant{noStore}},
+		{"negative rate limit", []Tenant{negative}},
+	}
+	for _, tt := range tests {
+		if _, err := NewRegistry(Config{Tenants: tt.tenants}); err == nil {
+			t.Errorf("%s: NewRegistry succeeded", tt.name)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(2, 3)
+	now := time.Now()
+
+	// A full bucket allows a burst, then one request every half second
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow(now); !ok {
+			t.Fatalf("request %d of the burst was refused", i+1)
+		}
+	}
+	ok, wait := l.allow(now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("request after the burst: %v, wait %v; want refused for 500ms", ok, wait)
+	}
+	if ok, _ := l.allow(now.Add(500 * time.Millisecond)); !ok {
+		t.Error("request after the wait was refused")
+	}
+
+	// The bucket doesn't fill past the burst
+	later := now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		l.allow(later)
+	}
+	if ok, _ := l.allow(later); ok {
+		t.Error("an idle hour allowed more than the burst")
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// Currency describes how amounts in a currency are formatted in figures and
+// in words. Unit names are singular and plural, as in Rupee and Rupees.
+type Currency struct {
+	Code     string
+	Symbol   string
+	Decimals int
+	Grouping NumberGrouping
+
+	MajorUnit  string
+	MajorUnits string
+	MinorUnit  string
+	MinorUnits string
+	// UnitFirst writes the major unit before the amount: "Rupees One Hundred Only"
+	UnitFirst bool
+}
+
+// Format formats an amount with the currency's symbol, decimals and grouping.
+// Currencies without a symbol are written with their code: "AED 1,234.50".
+func (c Currency) Format(amount float64) string {
+	number := FormatNumber(math.Abs(amount), c.Decimals, c.Grouping)
+
+	symbol := c.Symbol
+	if symbol == "" {
+		symbol = c.Code + " "
+	}
+
+	sign := ""
+	if amount < 0 && strings.Trim(number, "0.,") != "" {
+		sign = "-"
+	}
+	return sign + symbol + number
+}
+
+var (
+	currenciesMu sync.RWMutex
+	currencies   = map[string]Currency{
+		"INR": {Code: "INR", Symbol: "₹", Decimals: 2, Grouping: GroupingIndian,
+			MajorUnit: "Rupee", MajorUnits: "Rupees", MinorUnit: "Paisa", MinorUnits: "Paise", UnitFirst: true},
+		"USD": {Code: "USD", Symbol: "$", Decimals: 2, Grouping: GroupingInternational,
+			MajorUnit: "Dollar", MajorUnits: "Dollars", MinorUnit: "Cent", MinorUnits: "Cents"},
+		"EUR": {Code: "EUR", Symbol: "€", Decimals: 2, Grouping: GroupingInternational,
+			MajorUnit: "Euro", MajorUnits: "Euros", MinorUnit: "Cent", MinorUnits: "Cents"},
+		"GBP": {Code: "GBP", Symbol: "£", Decimals: 2, Grouping: GroupingInternational,
+			MajorUnit: "Pound", MajorUnits: "Pounds", MinorUnit: "Penny", MinorUnits: "Pence"},
+		"JPY": {Code: "JPY", Symbol: "¥", Decimals: 0, Grouping: GroupingInternational,
+			MajorUnit: "Yen", MajorUnits: "Yen"},
+		"AED": {Code: "AED", Decimals: 2, Grouping: GroupingInternational,
+			MajorUnit: "Dirham", MajorUnits: "Dirhams", MinorUnit: "Fil", MinorUnits: "Fils"},
+		"SGD": {Code: "SGD", Symbol: "S$", Decimals: 2, Grouping: GroupingInternational,
+			MajorUnit: "Singapore Dollar", MajorUnits: "Singapore Dollars", MinorUnit: "Cent", MinorUnits: "Cents"},
+	}
+)
+
+// LookupCurrency returns the currency with the given ISO code
+func LookupCurrency(code string) (Currency, bool) {
+	currenciesMu.RLock()
+	defer currenciesMu.RUnlock()
+	currency, ok := currencies[strings.ToUpper(strings.TrimSpace(code))]
+	return currency, ok
+}
+
+// RegisterCurrency adds or replaces a currency used by the currency filter
+func RegisterCurrency(currency Currency) {
+	currenciesMu.Lock()
+	defer currenciesMu.Unlock()
+	currency.Code = strings.ToUpper(currency.Code)
+	if currency.Grouping == "" {
+		currency.Grouping = GroupingInternational
+	}
+	currencies[currency.Code] = currency
+}
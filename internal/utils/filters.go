@@ -0,0 +1,387 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Filter transforms a placeholder value, as in {{amount|currency:INR}}. args
+// are the arguments given after the filter name. value is nil when the
+// placeholder's path could not be resolved.
+type Filter func(value interface{}, args []string) (interface{}, error)
+
+// FilterRegistry holds the filters available to placeholders
+type FilterRegistry struct {
+	mu      sync.RWMutex
+	filters map[string]Filter
+}
+
+// NewFilterRegistry creates a registry with the built-in filters
+func NewFilterRegistry() *FilterRegistry {
+	registry := &FilterRegistry{filters: make(map[string]Filter)}
+	registry.Register("upper", stringFilter(strings.ToUpper))
+	registry.Register("lower", stringFilter(strings.ToLower))
+	registry.Register("trim", stringFilter(strings.TrimSpace))
+	registry.Register("default", defaultFilter)
+	registry.Register("number", numberFilter)
+	registry.Register("currency", currencyFilter)
+	registry.Register("date", dateFilter)
+	registry.Register("words", wordsFilter)
+	return registry
+}
+
+// Register adds or replaces a filter
+func (r *FilterRegistry) Register(name string, filter Filter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filters[strings.ToLower(name)] = filter
+}
+
+// Lookup returns the filter with the given name
+func (r *FilterRegistry) Lookup(name string) (Filter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	filter, ok := r.filters[strings.ToLower(name)]
+	return filter, ok
+}
+
+// Names returns the registered filter names in alphabetical order
+func (r *FilterRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.filters))
+	for name := range r.filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var defaultFilters = NewFilterRegistry()
+
+// GetFilterRegistry returns the global filter registry used by placeholders
+func GetFilterRegistry() *FilterRegistry {
+	return defaultFilters
+}
+
+// RegisterFilter adds a filter to the global registry
+func RegisterFilter(name string, filter Filter) {
+	defaultFilters.Register(name, filter)
+}
+
+// FilterCall is a filter applied to a placeholder, with its arguments
+type FilterCall struct {
+	Name string
+	Args []string
+}
+
+// Placeholder is a parsed {{path|filter:arg}} placeholder
+type Placeholder struct {
+	Path    string
+	Filters []FilterCall
+}
+
+// HasFilter returns true if the placeholder applies the named filter
+func (p Placeholder) HasFilter(name string) bool {
+	for _, filter := range p.Filters {
+		if strings.EqualFold(filter.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePlaceholder parses the text between {{ and }}. Filters are separated by
+// |, arguments by :, and arguments may be double quoted to contain either.
+func ParsePlaceholder(expression string) (Placeholder, error) {
+	parts, err := SplitQuoted(expression, '|')
+	if err != nil {
+		return Placeholder{}, err
+	}
+
+	placeholder := Placeholder{Path: strings.TrimSpace(parts[0])}
+	for _, part := range parts[1:] {
+		fields, err := SplitQuoted(part, ':')
+		if err != nil {
+			return Placeholder{}, err
+		}
+		call := FilterCall{Name: strings.TrimSpace(fields[0])}
+		if call.Name == "" {
+			return Placeholder{}, fmt.Errorf("empty filter in %q", expression)
+		}
+		for _, arg := range fields[1:] {
+			call.Args = append(call.Args, Unquote(strings.TrimSpace(arg)))
+		}
+		placeholder.Filters = append(placeholder.Filters, call)
+	}
+
+	return placeholder, nil
+}
+
+// Apply runs the placeholder's filters on value using registry
+func (p Placeholder) Apply(value interface{}, registry *FilterRegistry) (interface{}, error) {
+	for _, call := range p.Filters {
+		filter, ok := registry.Lookup(call.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter %q in {{%s}}", call.Name, p.Path)
+		}
+		var err error
+		if value, err = filter(value, call.Args); err != nil {
+			return nil, fmt.Errorf("filter %s in {{%s}}: %w", call.Name, p.Path, err)
+		}
+	}
+	return value, nil
+}
+
+// SplitQuoted splits s on sep, ignoring separators inside double quotes
+func SplitQuoted(s string, sep byte) ([]string, error) {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	return append(parts, s[start:]), nil
+}
+
+// Unquote removes double quotes around a filter argument or column field
+func Unquote(arg string) string {
+	if len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+		if unquoted, err := strconv.Unquote(arg); err == nil {
+			return unquoted
+		}
+		return arg[1 : len(arg)-1]
+	}
+	return arg
+}
+
+// stringFilter makes a filter from a string function; missing values pass through
+func stringFilter(fn func(string) string) Filter {
+	return func(value interface{}, args []string) (interface{}, error) {
+		if value == nil {
+			return nil, nil
+		}
+		return fn(FormatValue(value)), nil
+	}
+}
+
+// defaultFilter replaces a missing or empty value: {{gstin|default:"N/A"}}
+func defaultFilter(value interface{}, args []string) (interface{}, error) {
+	if value == nil || FormatValue(value) == "" {
+		if len(args) == 0 {
+			return "", nil
+		}
+		return args[0], nil
+	}
+	return value, nil
+}
+
+// numberFilter formats a number: {{qty|number:0}}. The optional second
+// argument is the digit grouping: international (default), indian or none.
+func numberFilter(value interface{}, args []string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	number, err := ToFloat(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decimals, err := argInt(args, 0, 2)
+	if err != nil {
+		return nil, err
+	}
+	grouping := GroupingInternational
+	if len(args) > 1 {
+		if grouping, err = ParseGrouping(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	return FormatNumber(number, decimals, grouping), nil
+}
+
+// currencyFilter formats an amount in a currency: {{amount|currency:INR}}.
+// An optional second argument replaces the currency symbol, for fonts that
+// lack it: {{amount|currency:INR:"Rs. "}}
+func currencyFilter(value interface{}, args []string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	amount, err := ToFloat(value)
+	if err != nil {
+		return nil, err
+	}
+
+	code := "INR"
+	if len(args) > 0 && args[0] != "" {
+		code = args[0]
+	}
+	currency, ok := LookupCurrency(code)
+	if !ok {
+		return nil, fmt.Errorf("unknown currency %q", code)
+	}
+	if len(args) > 1 {
+		currency.Symbol = args[1]
+	}
+	return currency.Format(amount), nil
+}
+
+// dateLayouts are the layouts accepted for date values, in order
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02-01-2006",
+	"02/01/2006",
+}
+
+// dateFilter reformats a date with a Go layout: {{date|date:02-Jan-2006}}. An
+// optional second argument is the layout of the input value.
+func dateFilter(value interface{}, args []string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if len(args) == 0 || args[0] == "" {
+		return nil, fmt.Errorf("date filter requires a layout, such as date:02-Jan-2006")
+	}
+
+	var date time.Time
+	switch v := value.(type) {
+	case time.Time:
+		date = v
+	default:
+		text := strings.TrimSpace(FormatValue(value))
+		layouts := dateLayouts
+		if len(args) > 1 {
+			layouts = []string{args[1]}
+		}
+		parsed := false
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, text); err == nil {
+				date, parsed = t, true
+				break
+			}
+		}
+		if !parsed {
+			return nil, fmt.Errorf("cannot parse %q as a date", text)
+		}
+	}
+
+	return date.Format(args[0]), nil
+}
+
+// ToFloat converts a numeric value or numeric string to float64
+func ToFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case fmt.Stringer:
+		return ToFloat(v.String())
+	case string:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(v), ",", ""), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+}
+
+// argInt returns the integer argument at index, or fallback if it is absent
+func argInt(args []string, index, fallback int) (int, error) {
+	if index >= len(args) || args[index] == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(args[index])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number of decimals %q", args[index])
+	}
+	return n, nil
+}
+
+// NumberGrouping is the style used to group the digits of large numbers
+type NumberGrouping string
+
+const (
+	// GroupingInternational groups by thousands: 1,234,567.00
+	GroupingInternational NumberGrouping = "international"
+	// GroupingIndian groups by thousand, lakh and crore: 12,34,567.00
+	GroupingIndian NumberGrouping = "indian"
+	// GroupingNone doesn't group digits: 1234567.00
+	GroupingNone NumberGrouping = "none"
+)
+
+// ParseGrouping parses a digit grouping name
+func ParseGrouping(name string) (NumberGrouping, error) {
+	switch grouping := NumberGrouping(strings.ToLower(strings.TrimSpace(name))); grouping {
+	case GroupingInternational, GroupingIndian, GroupingNone:
+		return grouping, nil
+	case "":
+		return GroupingInternational, nil
+	default:
+		return "", fmt.Errorf("unknown digit grouping %q: use international, indian or none", name)
+	}
+}
+
+// FormatNumber formats a number with a fixed number of decimals and grouped digits
+func FormatNumber(number float64, decimals int, grouping NumberGrouping) string {
+	text := strconv.FormatFloat(math.Abs(number), 'f', decimals, 64)
+	whole, fraction, _ := strings.Cut(text, ".")
+
+	sign := ""
+	if number < 0 && strings.Trim(text, "0.") != "" {
+		sign = "-"
+	}
+
+	result := sign + groupDigits(whole, grouping)
+	if fraction != "" {
+		result += "." + fraction
+	}
+	return result
+}
+
+// groupDigits inserts commas into a string of digits
+func groupDigits(digits string, grouping NumberGrouping) string {
+	if grouping == GroupingNone || len(digits) <= 3 {
+		return digits
+	}
+
+	// The last three digits form the first group in both styles
+	head, tail := digits[:len(digits)-3], digits[len(digits)-3:]
+	size := 3
+	if grouping == GroupingIndian {
+		size = 2
+	}
+
+	var groups []string
+	for len(head) > size {
+		groups = append([]string{head[len(head)-size:]}, groups...)
+		head = head[:len(head)-size]
+	}
+	groups = append([]string{head}, groups...)
+	return strings.Join(groups, ",") + "," + tail
+}
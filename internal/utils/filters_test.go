@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePlaceholder(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       Placeholder
+	}{
+		{"amount", Placeholder{Path: "amount"}},
+		{" name | upper ", Placeholder{Path: "name", Filters: []FilterCall{{Name: "upper"}}}},
+		{"amount|currency:INR", Placeholder{Path: "amount", Filters: []FilterCall{{Name: "currency", Args: []string{"INR"}}}}},
+		{`time|date:"15:04"`, Placeholder{Path: "time", Filters: []FilterCall{{Name: "date", Args: []string{"15:04"}}}}},
+		{`gstin|default:"N/A"|upper`, Placeholder{Path: "gstin", Filters: []FilterCall{{Name: "default", Args: []string{"N/A"}}, {Name: "upper"}}}},
+		{`note|default:"a \"b\" | c"`, Placeholder{Path: "note", Filters: []FilterCall{{Name: "default", Args: []string{`a "b" | c`}}}}},
+		{"qty|number:0:indian", Placeholder{Path: "qty", Filters: []FilterCall{{Name: "number", Args: []string{"0", "indian"}}}}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePlaceholder(tt.expression)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePlaceholder(%q) = %+v, %v; want %+v", tt.expression, got, err, tt.want)
+		}
+	}
+
+	for _, expression := range []string{"name|", "name||upper", `name|default:"N/A`} {
+		if _, err := ParsePlaceholder(expression); err == nil {
+			t.Errorf("ParsePlaceholder(%q) succeeded", expression)
+		}
+	}
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	data := map[string]interface{}{
+		"amount":   1234567.5,
+		"negative": -0.004,
+		"qty":      "1,250",
+		"name":     "acme",
+		"date":     "2024-04-01",
+		"time":     "2024-04-01T09:30:00Z",
+		"gstin":    "",
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{{amount|currency:INR}}", "₹12,34,567.50"},
+		{"{{amount|currency:USD}}", "$1,234,567.50"},
+		{`{{amount|currency:INR:"Rs. "}}`, "Rs. 12,34,567.50"},
+		{"{{amount|currency:AED}}", "AED 1,234,567.50"},
+		{"{{amount|currency:JPY}}", "¥1,234,568"},
+		{"{{negative|currency:USD}}", "$0.00"},
+		{"{{amount|number:0}}", "1,234,568"},
+		{"{{amount|number:1:indian}}", "12,34,567.5"},
+		{"{{amount|number:2:none}}", "1234567.50"},
+		{"{{qty|number:0}}", "1,250"},
+		{"{{name|upper}}", "ACME"},
+		{"{{ name | upper | lower }}", "acme"},
+		{"{{date|date:02-Jan-2006}}", "01-Apr-2024"},
+		{`{{time|date:"15:04"}}`, "09:30"},
+		{"{{date|date:2006:02/01/2006}}", "{{date|date:2006:02/01/2006}}"},
+		{`{{gstin|default:"N/A"}}`, "N/A"},
+		{`{{missing|default:"N/A"}}`, "N/A"},
+		{"{{missing|upper}}", "{{missing|upper}}"},
+	}
+	for _, tt := range tests {
+		got, _ := ExpandPlaceholders(tt.text, data)
+		if got != tt.want {
+			t.Errorf("ExpandPlaceholders(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExpandPlaceholdersErrors(t *testing.T) {
+	data := map[string]interface{}{"name": "acme", "amount": 5, "date": "yesterday"}
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{"{{name|number}}", `filter number in {{name}}`},
+		{"{{amount|currency:XYZ}}", `unknown currency "XYZ"`},
+		{"{{amount|number:-1}}", "invalid number of decimals"},
+		{"{{amount|number:2:roman}}", "unknown digit grouping"},
+		{"{{date|date:02-Jan-2006}}", `cannot parse "yesterday" as a date`},
+		{"{{date|date}}", "date filter requires a layout"},
+		{"{{name|shout}}", `unknown filter "shout"`},
+		{`{{name|default:"N/A}}`, "invalid placeholder"},
+	}
+	for _, tt := range tests {
+		got, err := ExpandPlaceholders(tt.text, data)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ExpandPlaceholders(%q) error = %v, want %q", tt.text, err, tt.err)
+		}
+		// The placeholder is left as written
+		if got != tt.text {
+			t.Errorf("ExpandPlaceholders(%q) = %q, want the placeholder unchanged", tt.text, got)
+		}
+	}
+}
+
+func TestFilterRegistry(t *testing.T) {
+	registry := NewFilterRegistry()
+	registry.Register("GSTIN", func(value interface{}, args []string) (interface{}, error) {
+		return "GSTIN " + FormatValue(value), nil
+	})
+
+	// Filter names are case-insensitive
+	placeholder, err := ParsePlaceholder("gstin|gstin|Upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := placeholder.Apply("27abcde1234f1z5", registry)
+	if err != nil || got != "GSTIN 27ABCDE1234F1Z5" {
+		t.Errorf("Apply = %v, %v; want GSTIN 27ABCDE1234F1Z5", got, err)
+	}
+	if !placeholder.HasFilter("upper") || placeholder.HasFilter("lower") {
+		t.Errorf("HasFilter doesn't match the filters of %+v", placeholder)
+	}
+
+	// Filters registered on a registry stay out of the global one
+	if _, ok := GetFilterRegistry().Lookup("gstin"); ok {
+		t.Error("a filter of a new registry was added to the global registry")
+	}
+	if names := registry.Names(); !reflect.DeepEqual(names[:3], []string{"currency", "date", "default"}) {
+		t.Errorf("Names() = %q, want them sorted", names)
+	}
+}
+
+func TestSplitQuoted(t *testing.T) {
+	tests := []struct {
+		s    string
+		sep  byte
+		want []string
+	}{
+		{"a:b:c", ':', []string{"a", "b", "c"}},
+		{`a:"b:c":d`, ':', []string{"a", `"b:c"`, "d"}},
+		{`"a \"b:c\"":d`, ':', []string{`"a \"b:c\""`, "d"}},
+		{"", ',', []string{""}},
+	}
+	for _, tt := range tests {
+		got, err := SplitQuoted(tt.s, tt.sep)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitQuoted(%q) = %q, %v; want %q", tt.s, got, err, tt.want)
+		}
+	}
+	if _, err := SplitQuoted(`a:"b`, ':'); err == nil {
+		t.Error("SplitQuoted accepted an unterminated quote")
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"log"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -20,6 +21,24 @@ func ParseFloat(s string) float64 {
 	return f
 }
 
+// ParseAnchor parses a flow anchor such as "after:charges+4" into the anchor
+// name and the gap below it. ok is false if s is not an anchor.
+func ParseAnchor(s string) (name string, gap float64, ok bool) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(s), "after:")
+	if !found {
+		return "", 0, false
+	}
+
+	name = strings.TrimSpace(rest)
+	if i := strings.LastIndexAny(name, "+-"); i > 0 {
+		if g, err := strconv.ParseFloat(name[i:], 64); err == nil {
+			name, gap = strings.TrimSpace(name[:i]), g
+		}
+	}
+
+	return name, gap, name != ""
+}
+
 // ParseInt safely converts a string to int
 func ParseInt(s string) int {
 	if s == "" {
@@ -33,73 +52,20 @@ func ParseInt(s string) int {
 	return i
 }
 
-// ReplaceVariables replaces template variables in text with actual values
-func ReplaceVariables(text string, data map[string]interface{}) string {
-	result := text
-
-	// Replace variables in format {{variableName}}
-	for key, value := range data {
-		placeholder := "{{" + key + "}}"
-		result = strings.ReplaceAll(result, placeholder, fmt.Sprintf("%v", value))
-	}
-
-	return result
-}
-
-// ReplaceVariablesInArray replaces variables from a JSON array format like ["var1", "var2"]
-func ReplaceVariablesInArray(text, variableName string, data map[string]interface{}) string {
-	if !strings.HasPrefix(variableName, "[") || !strings.HasSuffix(variableName, "]") {
-		// Single variable, try direct replacement
-		if val, ok := data[variableName]; ok {
-			return strings.ReplaceAll(text, "{{"+variableName+"}}", fmt.Sprintf("%v", val))
-		}
-
-		// Try case-insensitive match
-		for inputKey, val := range data {
-			cleanInputKey := strings.TrimRight(inputKey, ":")
-			if strings.EqualFold(cleanInputKey, variableName) {
-				return strings.ReplaceAll(text, "{{"+variableName+"}}", fmt.Sprintf("%v", val))
-			}
-		}
-		return text
-	}
-
-	// Array format: remove brackets and split
-	varsStr := strings.Trim(variableName, "[]")
-	vars := strings.Split(varsStr, ",")
-
-	result := text
-	for _, varName := range vars {
-		// Clean up variable name
-		cleanVar := strings.Trim(strings.Trim(varName, "\""), " ")
-
-		// Try exact match first
-		if val, ok := data[cleanVar]; ok {
-			result = strings.ReplaceAll(result, "{{"+cleanVar+"}}", fmt.Sprintf("%v", val))
-			continue
-		}
-
-		// Try case-insensitive match
-		for inputKey, val := range data {
-			cleanInputKey := strings.TrimRight(inputKey, ":")
-			if strings.EqualFold(cleanInputKey, cleanVar) {
-				result = strings.ReplaceAll(result, "{{"+cleanVar+"}}", fmt.Sprintf("%v", val))
-				break
-			}
-		}
-	}
-
-	return result
-}
-
-// GetArrayFieldValue extracts a field value from an array element
-func GetArrayFieldValue(item interface{}, fieldName string) string {
-	if itemMap, isMap := item.(map[string]interface{}); isMap {
-		if val, ok := itemMap[fieldName]; ok {
-			return fmt.Sprintf("%v", val)
+// ToSlice converts an array field value into a slice of items
+func ToSlice(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
 		}
+		return items, true
+	default:
+		return nil, false
 	}
-	return ""
 }
 
 // IsValidPosition checks if position coordinates are valid
@@ -141,6 +107,20 @@ func EnsureDirectory(path string) error {
 	return nil
 }
 
+// ResolveIn resolves a relative path inside dir. If dir is empty the path is
+// returned as it is; otherwise absolute paths and paths that leave dir are
+// rejected.
+func ResolveIn(dir, path string) (string, error) {
+	if dir == "" {
+		return path, nil
+	}
+	local := filepath.Clean(filepath.FromSlash(path))
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%s is outside %s", path, dir)
+	}
+	return filepath.Join(dir, local), nil
+}
+
 // LogDebug logs debug information if debug mode is enabled
 func LogDebug(format string, args ...interface{}) {
 	// This could be enhanced to check for debug flags
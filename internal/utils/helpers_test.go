@@ -0,0 +1,29 @@
+package utils
+
+import "testing"
+
+func TestParseAnchor(t *testing.T) {
+	tests := []struct {
+		s    string
+		name string
+		gap  float64
+		ok   bool
+	}{
+		{"after:charges+4", "charges", 4, true},
+		{"after:charges", "charges", 0, true},
+		{" after:previous-2.5 ", "previous", -2.5, true},
+		{"after:orders[].lines+1", "orders[].lines", 1, true},
+		// A hyphen that doesn't start a number is part of the name
+		{"after:ship-to", "ship-to", 0, true},
+		{"after:ship-to+3", "ship-to", 3, true},
+		{"after:", "", 0, false},
+		{"120", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tt := range tests {
+		name, gap, ok := ParseAnchor(tt.s)
+		if name != tt.name || gap != tt.gap || ok != tt.ok {
+			t.Errorf("ParseAnchor(%q) = %q, %v, %v; want %q, %v, %v", tt.s, name, gap, ok, tt.name, tt.gap, tt.ok)
+		}
+	}
+}
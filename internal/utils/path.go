@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// placeholderPattern matches {{path}} placeholders in text
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// pathSegment is one step of a variable path: a map key or an array index
+type pathSegment struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// ResolvePath looks up a variable path such as "customer.address.city" or
+// "shipment.packages[0].weight" in data. A key that contains the whole path is
+// used first, so flat keys like "items.description" keep working. Map keys
+// are matched exactly, then case-insensitively ignoring a trailing colon.
+func ResolvePath(data map[string]interface{}, path string) (interface{}, bool) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, false
+	}
+	if value, ok := data[path]; ok {
+		return value, true
+	}
+
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var current interface{} = data
+	for _, segment := range segments {
+		if segment.isKey {
+			fields, isMap := current.(map[string]interface{})
+			if !isMap {
+				return nil, false
+			}
+			value, ok := lookupKey(fields, segment.key)
+			if !ok {
+				return nil, false
+			}
+			current = value
+			continue
+		}
+
+		items, isArray := ToSlice(current)
+		if !isArray || segment.index < 0 || segment.index >= len(items) {
+			return nil, false
+		}
+		current = items[segment.index]
+	}
+
+	return current, true
+}
+
+// ResolveString looks up a variable path and formats its value as text
+func ResolveString(data map[string]interface{}, path string) (string, bool) {
+	value, ok := ResolvePath(data, path)
+	if !ok || value == nil {
+		return "", false
+	}
+	return FormatValue(value), true
+}
+
+// FormatValue formats a variable value for output
+func FormatValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// ReplacePlaceholders replaces {{path}} placeholders in text with values
+// resolved from data. Placeholders that can't be resolved, or whose filters
+// fail, are left as they are.
+func ReplacePlaceholders(text string, data map[string]interface{}) string {
+	result, _ := ExpandPlaceholders(text, data)
+	return result
+}
+
+// ExpandPlaceholders replaces {{path|filter:arg}} placeholders in text with
+// values resolved from data and passed through their filters. Unresolved
+// placeholders are left as they are unless a filter such as default supplies
+// a value. The first filter error is returned along with the expanded text.
+func ExpandPlaceholders(text string, data map[string]interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	var firstErr error
+	result := placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		placeholder, err := ParsePlaceholder(placeholderPattern.FindStringSubmatch(match)[1])
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid placeholder %s: %w", match, err)
+			}
+			return match
+		}
+
+		value, ok := ResolvePath(data, placeholder.Path)
+		if !ok {
+			value = nil
+		}
+		value, err = placeholder.Apply(value, defaultFilters)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return match
+		}
+		if value == nil {
+			return match
+		}
+		return FormatValue(value)
+	})
+
+	return result, firstErr
+}
+
+// Placeholders returns the placeholders used in text. Placeholders that can't
+// be parsed are skipped.
+func Placeholders(text string) []Placeholder {
+	var placeholders []Placeholder
+	for _, expression := range PlaceholderExpressions(text) {
+		if placeholder, err := ParsePlaceholder(expression); err == nil {
+			placeholders = append(placeholders, placeholder)
+		}
+	}
+	return placeholders
+}
+
+// PlaceholderExpressions returns the text inside each {{...}} placeholder
+func PlaceholderExpressions(text string) []string {
+	var expressions []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		expressions = append(expressions, match[1])
+	}
+	return expressions
+}
+
+// PlaceholderPaths returns the variable paths referenced by placeholders in text
+func PlaceholderPaths(text string) []string {
+	var paths []string
+	for _, placeholder := range Placeholders(text) {
+		paths = append(paths, placeholder.Path)
+	}
+	return paths
+}
+
+// parsePath splits a variable path into keys and array indices
+func parsePath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed index in path %q", path)
+			}
+			index, err := strconv.Atoi(strings.TrimSpace(path[i+1 : i+end]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid index in path %q", path)
+			}
+			segments = append(segments, pathSegment{index: index})
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, pathSegment{key: path[i : i+end], isKey: true})
+			i += end
+		}
+	}
+
+	return segments, nil
+}
+
+// lookupKey finds a map key exactly, or case-insensitively ignoring a trailing colon
+func lookupKey(fields map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := fields[key]; ok {
+		return value, true
+	}
+	for inputKey, value := range fields {
+		if strings.EqualFold(strings.TrimRight(inputKey, ":"), key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
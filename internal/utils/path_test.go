@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// pathData is the nested request data the path tests resolve against
+func pathData() map[string]interface{} {
+	return map[string]interface{}{
+		"invoiceNumber":     "INV-1",
+		"items.description": "Flat key",
+		"Invoice Date:":     "2024-04-01",
+		"customer": map[string]interface{}{
+			"address": map[string]interface{}{"city": "Pune"},
+		},
+		"shipment": map[string]interface{}{
+			"packages": []interface{}{
+				map[string]interface{}{"weight": 2.5},
+				map[string]interface{}{"weight": 4},
+			},
+		},
+		"lines": []map[string]interface{}{{"qty": 3}},
+		"notes": nil,
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	tests := []struct {
+		path  string
+		want  interface{}
+		found bool
+	}{
+		{"invoiceNumber", "INV-1", true},
+		{" invoiceNumber ", "INV-1", true},
+		{"customer.address.city", "Pune", true},
+		{"shipment.packages[0].weight", 2.5, true},
+		{"shipment.packages[1].weight", 4, true},
+		{"lines[0].qty", 3, true},
+		{"customer.address", map[string]interface{}{"city": "Pune"}, true},
+		{"notes", nil, true},
+
+		// A key holding the whole path wins over nested lookup
+		{"items.description", "Flat key", true},
+		// Keys match case-insensitively without a trailing colon
+		{"invoice date", "2024-04-01", true},
+
+		{"", nil, false},
+		{"missing", nil, false},
+		{"customer.phone", nil, false},
+		{"invoiceNumber.length", nil, false},
+		{"shipment.packages[2].weight", nil, false},
+		{"shipment.packages[-1].weight", nil, false},
+		{"shipment.packages[x].weight", nil, false},
+		{"shipment.packages[0.weight", nil, false},
+		{"customer[0]", nil, false},
+	}
+	data := pathData()
+	for _, tt := range tests {
+		got, found := ResolvePath(data, tt.path)
+		if found != tt.found || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ResolvePath(%q) = %v, %v; want %v, %v", tt.path, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestResolveString(t *testing.T) {
+	tests := []struct {
+		path  string
+		want  string
+		found bool
+	}{
+		{"shipment.packages[0].weight", "2.5", true},
+		{"lines[0].qty", "3", true},
+		{"notes", "", false},
+		{"missing", "", false},
+	}
+	data := pathData()
+	for _, tt := range tests {
+		got, found := ResolveString(data, tt.path)
+		if got != tt.want || found != tt.found {
+			t.Errorf("ResolveString(%q) = %q, %v; want %q, %v", tt.path, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Invoice {{invoiceNumber}}", "Invoice INV-1"},
+		{"{{ customer.address.city }}, {{shipment.packages[1].weight}} kg", "Pune, 4 kg"},
+		{"{{missing}} stays", "{{missing}} stays"},
+		{"{{notes}} stays", "{{notes}} stays"},
+		{"No placeholders", "No placeholders"},
+	}
+	data := pathData()
+	for _, tt := range tests {
+		if got := ReplacePlaceholders(tt.text, data); got != tt.want {
+			t.Errorf("ReplacePlaceholders(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPlaceholderPaths(t *testing.T) {
+	got := PlaceholderPaths("{{invoiceNumber}} for {{ customer.address.city }} on {{items[0].qty}}")
+	want := []string{"invoiceNumber", "customer.address.city", "items[0].qty"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PlaceholderPaths = %q, want %q", got, want)
+	}
+}
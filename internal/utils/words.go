@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	smallNumberWords = []string{
+		"Zero", "One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine",
+		"Ten", "Eleven", "Twelve", "Thirteen", "Fourteen", "Fifteen", "Sixteen",
+		"Seventeen", "Eighteen", "Nineteen",
+	}
+	tensWords = []string{
+		"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy", "Eighty", "Ninety",
+	}
+)
+
+// maxWordsUnits bounds the number of units (cents, paise or whole units) that
+// can be written in words. Above 2^53 a float64 no longer holds every whole
+// number, so the words would name a different amount.
+const maxWordsUnits = 1 << 53
+
+// ErrAmountOutOfRange is returned for amounts too large to write in words,
+// and for NaN and infinite amounts
+var ErrAmountOutOfRange = errors.New("amount is out of range for words")
+
+// wordsUnits rounds |amount|*scale to a whole number of units, checking that
+// it fits in maxWordsUnits
+func wordsUnits(amount, scale float64) (uint64, error) {
+	units := math.Round(math.Abs(amount) * scale)
+	if math.IsNaN(units) || units >= maxWordsUnits {
+		return 0, fmt.Errorf("%w: %v", ErrAmountOutOfRange, amount)
+	}
+	return uint64(units), nil
+}
+
+// numberScale is a power of ten with a name, such as lakh or million
+type numberScale struct {
+	value uint64
+	name  string
+}
+
+// Scales are listed from largest to smallest
+var (
+	indianScales = []numberScale{
+		{10000000, "Crore"},
+		{100000, "Lakh"},
+		{1000, "Thousand"},
+		{100, "Hundred"},
+	}
+	internationalScales = []numberScale{
+		{1000000000000, "Trillion"},
+		{1000000000, "Billion"},
+		{1000000, "Million"},
+		{1000, "Thousand"},
+		{100, "Hundred"},
+	}
+)
+
+// NumberToWords writes a whole number in English words, grouped by lakh and
+// crore for GroupingIndian and by million and billion otherwise:
+// 120000 is "One Lakh Twenty Thousand" or "One Hundred Twenty Thousand".
+func NumberToWords(n uint64, grouping NumberGrouping) string {
+	if n == 0 {
+		return smallNumberWords[0]
+	}
+	scales := internationalScales
+	if grouping == GroupingIndian {
+		scales = indianScales
+	}
+	return strings.Join(numberWords(n, scales), " ")
+}
+
+// numberWords splits n into scale words. A count above the largest scale is
+// written recursively, as in "One Hundred Crore".
+func numberWords(n uint64, scales []numberScale) []string {
+	var words []string
+	for _, scale := range scales {
+		if n < scale.value {
+			continue
+		}
+		words = append(words, numberWords(n/scale.value, scales)...)
+		words = append(words, scale.name)
+		n %= scale.value
+	}
+
+	switch {
+	case n == 0:
+	case n < 20:
+		words = append(words, smallNumberWords[n])
+	default:
+		words = append(words, tensWords[n/10])
+		if n%10 != 0 {
+			words = append(words, smallNumberWords[n%10])
+		}
+	}
+	return words
+}
+
+// AmountInWords writes an amount in words with the currency's unit names and
+// digit grouping: 120000.50 in INR is "Rupees One Lakh Twenty Thousand and
+// Fifty Paise Only". It returns ErrAmountOutOfRange for NaN, infinite and
+// very large amounts.
+func AmountInWords(amount float64, currency Currency) (string, error) {
+	return amountInWords(amount, currency, currency.Grouping)
+}
+
+// amountInWords writes an amount in words with the given digit grouping
+func amountInWords(amount float64, currency Currency, grouping NumberGrouping) (string, error) {
+	scale := math.Pow(10, float64(currency.Decimals))
+	total, err := wordsUnits(amount, scale)
+	if err != nil {
+		return "", err
+	}
+	major, minor := total/uint64(scale), total%uint64(scale)
+
+	var parts []string
+	if amount < 0 && total > 0 {
+		parts = append(parts, "Minus")
+	}
+
+	if major > 0 || minor == 0 {
+		unit := currency.majorUnit(major)
+		if currency.UnitFirst {
+			parts = append(parts, unit, NumberToWords(major, grouping))
+		} else {
+			parts = append(parts, NumberToWords(major, grouping), unit)
+		}
+	}
+	if minor > 0 {
+		if major > 0 {
+			parts = append(parts, "and")
+		}
+		parts = append(parts, NumberToWords(minor, grouping), currency.minorUnit(minor))
+	}
+
+	parts = append(parts, "Only")
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " "), nil
+}
+
+// majorUnit returns the name of the main unit for a count, falling back to the code
+func (c Currency) majorUnit(count uint64) string {
+	switch {
+	case count == 1 && c.MajorUnit != "":
+		return c.MajorUnit
+	case c.MajorUnits != "":
+		return c.MajorUnits
+	case c.MajorUnit != "":
+		return c.MajorUnit
+	default:
+		return c.Code
+	}
+}
+
+// minorUnit returns the name of the fractional unit for a count
+func (c Currency) minorUnit(count uint64) string {
+	if count == 1 && c.MinorUnit != "" {
+		return c.MinorUnit
+	}
+	if c.MinorUnits != "" {
+		return c.MinorUnits
+	}
+	return c.MinorUnit
+}
+
+// wordsFilter writes a number in words: {{total|words:INR}} for an amount in
+// a currency, or {{qty|words}} for a plain whole number. An optional second
+// argument overrides the currency's grouping: {{total|words:USD:indian}}.
+func wordsFilter(value interface{}, args []string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	number, err := ToFloat(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 || args[0] == "" {
+		units, err := wordsUnits(number, 1)
+		if err != nil {
+			return nil, err
+		}
+		words := NumberToWords(units, GroupingInternational)
+		if math.Round(number) < 0 {
+			words = "Minus " + words
+		}
+		return words, nil
+	}
+
+	currency, ok := LookupCurrency(args[0])
+	if !ok {
+		return nil, fmt.Errorf("unknown currency %q", args[0])
+	}
+	grouping := currency.Grouping
+	if len(args) > 1 {
+		if grouping, err = ParseGrouping(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	return amountInWords(number, currency, grouping)
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestNumberToWords(t *testing.T) {
+	tests := []struct {
+		n        uint64
+		grouping NumberGrouping
+		want     string
+	}{
+		{0, GroupingIndian, "Zero"},
+		{15, GroupingIndian, "Fifteen"},
+		{120000, GroupingIndian, "One Lakh Twenty Thousand"},
+		{120000, GroupingInternational, "One Hundred Twenty Thousand"},
+		{12345678, GroupingIndian, "One Crore Twenty Three Lakh Forty Five Thousand Six Hundred Seventy Eight"},
+		{1000000000, GroupingIndian, "One Hundred Crore"},
+		{2500000, GroupingInternational, "Two Million Five Hundred Thousand"},
+		{3000000001, GroupingInternational, "Three Billion One"},
+	}
+	for _, tt := range tests {
+		if got := NumberToWords(tt.n, tt.grouping); got != tt.want {
+			t.Errorf("NumberToWords(%d, %s) = %q, want %q", tt.n, tt.grouping, got, tt.want)
+		}
+	}
+}
+
+func TestAmountInWords(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{120000.50, "INR", "Rupees One Lakh Twenty Thousand and Fifty Paise Only"},
+		{10000000, "INR", "Rupees One Crore Only"},
+		{1, "INR", "Rupee One Only"},
+		{0.01, "INR", "One Paisa Only"},
+		{0.25, "USD", "Twenty Five Cents Only"},
+		{0, "INR", "Rupees Zero Only"},
+		{-0.001, "INR", "Rupees Zero Only"},
+		{-42.10, "INR", "Minus Rupees Forty Two and Ten Paise Only"},
+		{1250000, "USD", "One Million Two Hundred Fifty Thousand Dollars Only"},
+		{2000000000.99, "USD", "Two Billion Dollars and Ninety Nine Cents Only"},
+		{1500, "JPY", "One Thousand Five Hundred Yen Only"},
+	}
+	for _, tt := range tests {
+		currency, _ := LookupCurrency(tt.currency)
+		got, err := AmountInWords(tt.amount, currency)
+		if err != nil {
+			t.Errorf("AmountInWords(%v, %s): %v", tt.amount, tt.currency, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("AmountInWords(%v, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestAmountInWordsOutOfRange(t *testing.T) {
+	inr, _ := LookupCurrency("INR")
+	for _, amount := range []float64{1e17, -1e17, 1e300, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := AmountInWords(amount, inr); !errors.Is(err, ErrAmountOutOfRange) {
+			t.Errorf("AmountInWords(%v) error = %v, want ErrAmountOutOfRange", amount, err)
+		}
+	}
+}
+
+func TestWordsFilter(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		args  []string
+		want  string
+	}{
+		{"120000", nil, "One Hundred Twenty Thousand"},
+		{-7, nil, "Minus Seven"},
+		{"120000.50", []string{"INR"}, "Rupees One Lakh Twenty Thousand and Fifty Paise Only"},
+		{120000, []string{"USD", "indian"}, "One Lakh Twenty Thousand Dollars Only"},
+	}
+	for _, tt := range tests {
+		got, err := wordsFilter(tt.value, tt.args)
+		if err != nil {
+			t.Errorf("words %v %v: %v", tt.value, tt.args, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("words %v %v = %q, want %q", tt.value, tt.args, got, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{nil, {"INR"}} {
+		if _, err := wordsFilter(1e20, args); !errors.Is(err, ErrAmountOutOfRange) {
+			t.Errorf("words 1e20 %v error = %v, want ErrAmountOutOfRange", args, err)
+		}
+	}
+	if _, err := wordsFilter(10, []string{"XYZ"}); err == nil {
+		t.Error("words with an unknown currency succeeded")
+	}
+}
@@ -11,6 +11,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-pdf/fpdf"
+
+	"pdf-gen-simple/internal/tax"
+	"pdf-gen-simple/internal/utils"
 )
 
 type ChargeItem struct {
@@ -99,6 +102,15 @@ func generatePDF(data InvoiceData) ([]byte, error) {
 		return nil, fmt.Errorf("invoice number and full name are required")
 	}
 
+	// Write the total in words when the caller doesn't supply it
+	if data.AmountInWords == "" {
+		if total, err := utils.ToFloat(data.TotalCharges); err == nil {
+			if data.AmountInWords, err = amountInWords(total); err != nil {
+				return nil, fmt.Errorf("invalid total charges: %w", err)
+			}
+		}
+	}
+
 	pdf := fpdf.New("P", "mm", "A4", "./fonts")
 	pdf.SetMargins(5, 5, 5)
 	pdf.AddUTF8Font("Tahoma", "", "tahoma.ttf")
@@ -186,6 +198,12 @@ func formatAmount(val float64) string {
 	return fmt.Sprintf("%.2f", val)
 }
 
+// amountInWords writes a rupee amount in words, grouped by lakh and crore
+func amountInWords(val float64) (string, error) {
+	inr, _ := utils.LookupCurrency("INR")
+	return utils.AmountInWords(val, inr)
+}
+
 func main() {
 	// Enable Gin's debug mode and logging
 	gin.SetMode(gin.DebugMode)
@@ -272,19 +290,27 @@ func main() {
 
 		// Calculate tax amounts if rates are provided but amounts are not
 		if req.CGSTRate > 0 && req.CGSTAmount == 0 {
-			req.CGSTAmount = req.SubTotal * req.CGSTRate / 100
+			req.CGSTAmount = tax.Percent(req.SubTotal, req.CGSTRate)
 		}
 		if req.SGSTRate > 0 && req.SGSTAmount == 0 {
-			req.SGSTAmount = req.SubTotal * req.SGSTRate / 100
+			req.SGSTAmount = tax.Percent(req.SubTotal, req.SGSTRate)
 		}
 		if req.IGSTRate > 0 && req.IGSTAmount == 0 {
-			req.IGSTAmount = req.SubTotal * req.IGSTRate / 100
+			req.IGSTAmount = tax.Percent(req.SubTotal, req.IGSTRate)
 		}
 
 		// Calculate total if not provided
 		if req.TotalAmount == 0 {
 			req.TotalAmount = req.SubTotal + req.CGSTAmount + req.SGSTAmount + req.IGSTAmount
 		}
+		if req.AmountInWords == "" {
+			words, err := amountInWords(req.TotalAmount)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid total amount: %v", err)})
+				return
+			}
+			req.AmountInWords = words
+		}
 
 		pdfBytes, err := GenerateInvoiceFromTemplate(req)
 		if err != nil {